@@ -6,17 +6,17 @@ package bridge
 import (
     "bufio"
     "bytes"
+    "crypto/tls"
     "errors"
     "fmt"
     "github.com/go-stomp/stomp"
     "github.com/go-stomp/stomp/frame"
     "github.com/google/uuid"
     "github.com/gorilla/websocket"
+    "github.com/vmware/transport-go/log"
     "github.com/vmware/transport-go/model"
-    "log"
     "net/http"
     "net/url"
-    "os"
     "strconv"
     "sync"
 )
@@ -31,9 +31,12 @@ type BridgeClient struct {
     inboundChan      chan *frame.Frame
     stompConnected   bool
     Subscriptions    map[string]*BridgeClientSub
-    logger           *log.Logger
+    logger           log.Logger // nil if logging is disabled
     lock             sync.Mutex
     sendLock         sync.Mutex
+    TLSConfig        *tls.Config   // TLS configuration used for wss:// connections
+    lostChan         chan struct{} // closed when the websocket connection can no longer be read
+    lostOnce         sync.Once
 }
 
 // Create a new WebSocket client.
@@ -42,9 +45,9 @@ func NewBridgeWsClient(enableLogging bool) *BridgeClient {
 }
 
 func newBridgeWsClient(enableLogging bool) *BridgeClient {
-    var l *log.Logger = nil
+    var l log.Logger = nil
     if enableLogging {
-        l = log.New(os.Stderr, "WebSocket Client: ", 2)
+        l = log.Default().With("component", "bridge-client")
     }
     return &BridgeClient{
         WSc:              nil,
@@ -57,6 +60,7 @@ func newBridgeWsClient(enableLogging bool) *BridgeClient {
         Subscriptions:    make(map[string]*BridgeClientSub),
         ConnectedChan:    make(chan bool),
         disconnectedChan: make(chan bool),
+        lostChan:         make(chan struct{}),
         inboundChan:      make(chan *frame.Frame)}
 }
 
@@ -65,10 +69,18 @@ func (ws *BridgeClient) Connect(url *url.URL, headers http.Header) error {
     ws.lock.Lock()
     defer ws.lock.Unlock()
     if ws.logger != nil {
-        ws.logger.Printf("connecting to fabric endpoint over %s", url.String())
+        ws.logger.Info("connecting to fabric endpoint", "url", url.String())
     }
 
-    c, _, err := websocket.DefaultDialer.Dial(url.String(), headers)
+    dialer := websocket.DefaultDialer
+    if ws.TLSConfig != nil {
+        dialer = &websocket.Dialer{
+            Proxy:            websocket.DefaultDialer.Proxy,
+            HandshakeTimeout: websocket.DefaultDialer.HandshakeTimeout,
+            TLSClientConfig:  ws.TLSConfig,
+        }
+    }
+    c, _, err := dialer.Dial(url.String(), headers)
     if err != nil {
         return err
     }
@@ -84,15 +96,22 @@ func (ws *BridgeClient) Connect(url *url.URL, headers http.Header) error {
     ws.SendFrame(frame.New(frame.CONNECT, frame.AcceptVersion, string(stomp.V12)))
 
     // wait to be connected
-    <-ws.ConnectedChan
-    return nil
+    select {
+    case <-ws.ConnectedChan:
+        return nil
+    case <-ws.lostChan:
+        return fmt.Errorf("connection to %s closed before STOMP session was established", url.String())
+    }
 }
 
 // Disconnect from broker endpoint
 func (ws *BridgeClient) Disconnect() error {
     if ws.WSc != nil {
         defer ws.WSc.Close()
-        ws.disconnectedChan <- true
+        select {
+        case ws.disconnectedChan <- true:
+        case <-ws.lostChan:
+        }
     } else {
         return fmt.Errorf("cannot disconnect, no connection defined")
     }
@@ -101,11 +120,16 @@ func (ws *BridgeClient) Disconnect() error {
 
 // Subscribe to destination
 func (ws *BridgeClient) Subscribe(destination string) *BridgeClientSub {
+    return ws.subscribeWithChannel(destination, make(chan *model.Message))
+}
+
+// subscribe to destination and deliver the messages to an existing channel.
+func (ws *BridgeClient) subscribeWithChannel(destination string, c chan *model.Message) *BridgeClientSub {
     ws.lock.Lock()
     defer ws.lock.Unlock()
     id := uuid.New()
     s := &BridgeClientSub{
-        C:           make(chan *model.Message),
+        C:           c,
         Id:          &id,
         Client:      ws,
         Destination: destination,
@@ -126,6 +150,11 @@ func (ws *BridgeClient) Subscribe(destination string) *BridgeClientSub {
 
 // send a payload to a destination
 func (ws *BridgeClient) Send(destination string, payload []byte) {
+    ws.SendWithContentType(destination, model.JSONContentType, payload)
+}
+
+// send a payload encoded as contentType to a destination
+func (ws *BridgeClient) SendWithContentType(destination string, contentType string, payload []byte) {
     ws.lock.Lock()
     defer ws.lock.Unlock()
 
@@ -133,7 +162,7 @@ func (ws *BridgeClient) Send(destination string, payload []byte) {
     sendFrame := frame.New(frame.SEND,
         frame.Destination, destination,
         frame.ContentLength, strconv.Itoa(len(payload)),
-        frame.ContentType, "application/json")
+        frame.ContentType, contentType)
 
     // add payload
     sendFrame.Body = payload
@@ -169,7 +198,12 @@ func (ws *BridgeClient) listenSocket() {
         f, _ := sr.Read()
 
         if err != nil {
-            break // socket can't be read anymore, exit.
+            // socket can't be read anymore, exit.
+            ws.connected = false
+            ws.lostOnce.Do(func() {
+                close(ws.lostChan)
+            })
+            break
         }
         if f != nil {
             ws.inboundChan <- f
@@ -182,11 +216,13 @@ func (ws *BridgeClient) handleIncomingSTOMPFrames() {
         select {
         case <-ws.disconnectedChan:
             return
+        case <-ws.lostChan:
+            return
         case f := <-ws.inboundChan:
             switch f.Command {
             case frame.CONNECTED:
                 if ws.logger != nil {
-                    ws.logger.Printf("STOMP Client connected")
+                    ws.logger.Info("STOMP client connected")
                 }
                 ws.stompConnected = true
                 ws.connected = true
@@ -195,7 +231,8 @@ func (ws *BridgeClient) handleIncomingSTOMPFrames() {
             case frame.MESSAGE:
                 for _, sub := range ws.Subscriptions {
                     if sub.Destination == f.Header.Get(frame.Destination) {
-                        c := &model.MessageConfig{Payload: f.Body, Destination: sub.Destination}
+                        c := &model.MessageConfig{
+                            Payload: f.Body, Destination: sub.Destination, Headers: convertFrameHeaders(f.Header)}
                         sub.lock.RLock()
                         if sub.subscribed {
                             ws.sendResponseSafe(sub.C, model.GenerateResponse(c))
@@ -206,7 +243,7 @@ func (ws *BridgeClient) handleIncomingSTOMPFrames() {
 
             case frame.ERROR:
                 if ws.logger != nil {
-                    ws.logger.Printf("STOMP ErrorDir received")
+                    ws.logger.Warn("STOMP error received", "destination", f.Header.Get(frame.Destination))
                 }
 
                 for _, sub := range ws.Subscriptions {
@@ -224,7 +261,7 @@ func (ws *BridgeClient) sendResponseSafe(C chan *model.Message, m *model.Message
     defer func() {
         if r := recover(); r != nil {
             if ws.logger != nil {
-                ws.logger.Println("channel is closed, message undeliverable to closed channel.")
+                ws.logger.Warn("channel is closed, message undeliverable to closed channel")
             }
         }
     }()
@@ -6,8 +6,8 @@ package bridge
 import (
     "github.com/go-stomp/stomp/frame"
     "github.com/stretchr/testify/assert"
+    "github.com/vmware/transport-go/log"
     "github.com/vmware/transport-go/model"
-    "log"
     "os"
     "sync"
     "testing"
@@ -26,7 +26,7 @@ func TestBridgeClient_handleCommands(t *testing.T) {
     i := make(chan *frame.Frame, 1)
     e := make(chan *model.Message, 1)
 
-    l := log.New(os.Stderr, "WebSocket Client: ", 2)
+    l := log.New(log.NewTextHandler(os.Stderr), log.DebugLevel)
     bc.logger = l
     bc.inboundChan = i
     bc.Subscriptions = make(map[string]*BridgeClientSub)
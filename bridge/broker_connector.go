@@ -4,9 +4,11 @@
 package bridge
 
 import (
+    "crypto/tls"
     "fmt"
     "github.com/go-stomp/stomp"
     "github.com/google/uuid"
+    "github.com/vmware/transport-go/log"
     "net/url"
     "sync"
 )
@@ -14,12 +16,15 @@ import (
 // BrokerConnector is used to connect to a message broker over TCP or WebSocket.
 type BrokerConnector interface {
     Connect(config *BrokerConnectorConfig, enableLogging bool) (Connection, error)
+    // Set the logger of the connections created by the connector, log.Default() is used if nil.
+    SetLogger(logger log.Logger)
 }
 
 type brokerConnector struct {
     c         Connection
     config    *BrokerConnectorConfig
     connected bool
+    logger    log.Logger
 }
 
 // Create a new broker connector
@@ -27,6 +32,19 @@ func NewBrokerConnector() BrokerConnector {
     return &brokerConnector{connected: false}
 }
 
+func (bc *brokerConnector) SetLogger(logger log.Logger) {
+    bc.logger = logger
+}
+
+// Returns the logger of a new connection.
+func (bc *brokerConnector) connectionLogger(id *uuid.UUID, config *BrokerConnectorConfig) log.Logger {
+    logger := bc.logger
+    if logger == nil {
+        logger = log.Default()
+    }
+    return logger.With("broker.connection.id", id.String(), "broker.address", config.ServerAddr)
+}
+
 func checkConfig(config *BrokerConnectorConfig) error {
     if config == nil {
         return fmt.Errorf("config is nil")
@@ -60,24 +78,19 @@ func (bc *brokerConnector) Connect(config *BrokerConnectorConfig, enableLogging
 }
 
 func (bc *brokerConnector) connectTCP(config *BrokerConnectorConfig, err error) (Connection, error) {
-    if config.HostHeader == "" {
-        config.HostHeader = "/"
-    }
-    var options = []func(*stomp.Conn) error{
-        stomp.ConnOpt.Login(config.Username, config.Password),
-        stomp.ConnOpt.Host(config.HostHeader),
-    }
-    conn, err := stomp.Dial("tcp", config.ServerAddr, options...)
+    conn, err := dialTCP(config)
     if err != nil {
         return nil, err
     }
     id := uuid.New()
     bcConn := &connection{
         id:             &id,
+        logger:         bc.connectionLogger(&id, config),
         conn:           conn,
         subscriptions:  make(map[string]Subscription),
         useWs:          false,
         connLock:       sync.Mutex{},
+        config:         config,
         disconnectChan: make(chan bool)}
     bc.c = bcConn
     bc.connected = true
@@ -85,23 +98,65 @@ func (bc *brokerConnector) connectTCP(config *BrokerConnectorConfig, err error)
     return bcConn, nil
 }
 
-func (bc *brokerConnector) connectWs(config *BrokerConnectorConfig, enableLogging bool) (Connection, error) {
-
-    u := url.URL{Scheme: "ws", Host: config.ServerAddr, Path: config.WSPath}
-    c := NewBridgeWsClient(enableLogging)
-    err := c.Connect(&u, nil)
+func dialTCP(config *BrokerConnectorConfig) (*stomp.Conn, error) {
+    if config.HostHeader == "" {
+        config.HostHeader = "/"
+    }
+    var options = []func(*stomp.Conn) error{
+        stomp.ConnOpt.Login(config.Username, config.Password),
+        stomp.ConnOpt.Host(config.HostHeader),
+    }
+    if config.TLSConfig == nil {
+        return stomp.Dial("tcp", config.ServerAddr, options...)
+    }
+    netConn, err := tls.Dial("tcp", config.ServerAddr, config.TLSConfig)
     if err != nil {
-        return nil, fmt.Errorf("cannot connect to host '%s' via path '%s', stopping", config.ServerAddr, config.WSPath)
+        return nil, err
+    }
+    conn, err := stomp.Connect(netConn, options...)
+    if err != nil {
+        netConn.Close()
+        return nil, err
     }
+    return conn, nil
+}
+
+func (bc *brokerConnector) connectWs(config *BrokerConnectorConfig, enableLogging bool) (Connection, error) {
     id := uuid.New()
+    logger := bc.connectionLogger(&id, config)
+    c, err := dialWs(config, enableLogging, logger)
+    if err != nil {
+        return nil, err
+    }
     bcConn := &connection{
         id:             &id,
+        logger:         logger,
         wsConn:         c,
         subscriptions:  make(map[string]Subscription),
         useWs:          true,
         connLock:       sync.Mutex{},
+        config:         config,
+        enableLogging:  enableLogging,
         disconnectChan: make(chan bool)}
+    go bcConn.watchWsConnection(c)
     bc.c = bcConn
     bc.connected = true
     return bcConn, nil
+}
+
+func dialWs(config *BrokerConnectorConfig, enableLogging bool, logger log.Logger) (*BridgeClient, error) {
+    u := url.URL{Scheme: "ws", Host: config.ServerAddr, Path: config.WSPath}
+    c := NewBridgeWsClient(enableLogging)
+    if enableLogging {
+        c.logger = logger
+    }
+    if config.TLSConfig != nil {
+        u.Scheme = "wss"
+        c.TLSConfig = config.TLSConfig
+    }
+    err := c.Connect(&u, nil)
+    if err != nil {
+        return nil, fmt.Errorf("cannot connect to host '%s' via path '%s', stopping", config.ServerAddr, config.WSPath)
+    }
+    return c, nil
 }
\ No newline at end of file
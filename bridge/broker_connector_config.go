@@ -3,6 +3,11 @@
 
 package bridge
 
+import (
+    "crypto/tls"
+    "time"
+)
+
 // BrokerConnectorConfig is a configuration used when connecting to a message broker
 type BrokerConnectorConfig struct {
     Username        string
@@ -11,4 +16,16 @@ type BrokerConnectorConfig struct {
     WSPath          string  // if UseWS is true, set this to your websocket path (e.g. '/fabric')
     UseWS           bool    // use WebSocket instead of TCP
     HostHeader      string
+    // connect over TLS (wss:// for WebSocket connections) using this configuration. Add a client
+    // certificate to the configuration if the broker requires mutual TLS.
+    TLSConfig       *tls.Config
+    AutoReconnect   bool    // reconnect and restore all subscriptions when the connection drops
+    // maximum number of reconnect attempts, zero means unlimited.
+    ReconnectMaxAttempts int
+    // delay before the first reconnect attempt, doubled after every failed attempt. Defaults to one second.
+    ReconnectDelay time.Duration
+    // upper bound of the delay between two reconnect attempts. Defaults to 30 seconds.
+    ReconnectMaxDelay time.Duration
+    // optional callback notified about connection state changes.
+    ConnectionStateHandler ConnectionStateHandlerFunction
 }
@@ -6,6 +6,8 @@ package bridge
 import (
     "bufio"
     "bytes"
+    "crypto/tls"
+    "crypto/x509"
     "fmt"
     "github.com/go-stomp/stomp/frame"
     "github.com/go-stomp/stomp/server"
@@ -17,6 +19,7 @@ import (
     "net/http/httptest"
     "net/url"
     "testing"
+    "time"
 )
 
 var upgrader = websocket.Upgrader{}
@@ -366,3 +369,146 @@ func TestBrokerConnector_Unsubscribe(t *testing.T) {
         })
     }
 }
+
+func TestBrokerConnector_ReconnectWs(t *testing.T) {
+    url, _ := url.Parse(websocketURL)
+
+    states := make(chan ConnectionState, 10)
+    config := &BrokerConnectorConfig{
+        Username: "guest", Password: "guest", UseWS: true, WSPath: "/", ServerAddr: url.Host,
+        AutoReconnect:  true,
+        ReconnectDelay: 10 * time.Millisecond,
+        ConnectionStateHandler: func(conn Connection, state ConnectionState, attempt int) {
+            states <- state
+        }}
+
+    bc := NewBrokerConnector()
+    c, err := bc.Connect(config, false)
+    assert.Nil(t, err)
+    s, _ := c.Subscribe("/topic/test")
+    msg := <-s.GetMsgChannel()
+    assert.Equal(t, "happy baby melody!", string(msg.Payload.([]byte)))
+
+    // drop the underlying websocket connection.
+    c.(*connection).wsConn.WSc.Close()
+
+    assert.Equal(t, ConnectionLost, <-states)
+    assert.Equal(t, ConnectionReconnecting, <-states)
+    assert.Equal(t, ConnectionReconnected, <-states)
+
+    // the subscription is restored and delivers to the same channel.
+    msg = <-s.GetMsgChannel()
+    assert.Equal(t, "happy baby melody!", string(msg.Payload.([]byte)))
+
+    assert.Nil(t, c.Disconnect())
+}
+
+func TestBrokerConnector_ReconnectMaxAttempts(t *testing.T) {
+    server := httptest.NewServer(http.HandlerFunc(websocketHandler))
+    url, _ := url.Parse(server.URL)
+
+    states := make(chan ConnectionState, 10)
+    config := &BrokerConnectorConfig{
+        Username: "guest", Password: "guest", UseWS: true, WSPath: "/", ServerAddr: url.Host,
+        AutoReconnect:        true,
+        ReconnectDelay:       time.Millisecond,
+        ReconnectMaxAttempts: 2,
+        ConnectionStateHandler: func(conn Connection, state ConnectionState, attempt int) {
+            states <- state
+        }}
+
+    bc := NewBrokerConnector()
+    c, err := bc.Connect(config, false)
+    assert.Nil(t, err)
+
+    server.Close()
+    c.(*connection).wsConn.WSc.Close()
+
+    assert.Equal(t, ConnectionLost, <-states)
+    assert.Equal(t, ConnectionReconnecting, <-states)
+    assert.Equal(t, ConnectionReconnecting, <-states)
+    assert.Equal(t, ConnectionReconnectFailed, <-states)
+
+    conn := c.(*connection)
+    conn.connLock.Lock()
+    assert.False(t, conn.reconnecting)
+    conn.connLock.Unlock()
+}
+
+func TestBrokerConnector_NoReconnectAfterDisconnect(t *testing.T) {
+    url, _ := url.Parse(websocketURL)
+
+    states := make(chan ConnectionState, 10)
+    config := &BrokerConnectorConfig{
+        Username: "guest", Password: "guest", UseWS: true, WSPath: "/", ServerAddr: url.Host,
+        AutoReconnect: true,
+        ConnectionStateHandler: func(conn Connection, state ConnectionState, attempt int) {
+            states <- state
+        }}
+
+    bc := NewBrokerConnector()
+    c, err := bc.Connect(config, false)
+    assert.Nil(t, err)
+    assert.Nil(t, c.Disconnect())
+
+    select {
+    case state := <-states:
+        assert.Fail(t, "unexpected connection state", state.String())
+    case <-time.After(50 * time.Millisecond):
+    }
+}
+
+func TestBrokerConnector_ConnectTLS(t *testing.T) {
+    wssServer := httptest.NewTLSServer(http.HandlerFunc(websocketHandler))
+    defer wssServer.Close()
+    wssURL, _ := url.Parse(wssServer.URL)
+
+    tlsListener, err := tls.Listen("tcp", "127.0.0.1:0", wssServer.TLS)
+    assert.Nil(t, err)
+    defer tlsListener.Close()
+    go server.Serve(tlsListener)
+
+    rootCAs := x509.NewCertPool()
+    rootCAs.AddCert(wssServer.Certificate())
+
+    tt := []struct {
+        test   string
+        config *BrokerConnectorConfig
+    }{
+        {
+            "Connect via wss",
+            &BrokerConnectorConfig{
+                Username: "guest", Password: "guest", UseWS: true, WSPath: "/", ServerAddr: wssURL.Host,
+                TLSConfig: &tls.Config{RootCAs: rootCAs}}},
+        {
+            "Connect via TCP with TLS",
+            &BrokerConnectorConfig{
+                Username: "guest", Password: "guest", ServerAddr: tlsListener.Addr().String(),
+                TLSConfig: &tls.Config{RootCAs: rootCAs}}},
+    }
+
+    for _, tc := range tt {
+        t.Run(tc.test, func(t *testing.T) {
+            bc := NewBrokerConnector()
+            c, err := bc.Connect(tc.config, false)
+            assert.Nil(t, err)
+            assert.NotNil(t, c)
+
+            s, _ := c.Subscribe("/topic/test")
+            if !tc.config.UseWS {
+                go c.SendMessage("/topic/test", []byte(`happy baby melody!`))
+            }
+            msg := <-s.GetMsgChannel()
+            assert.Equal(t, "happy baby melody!", string(msg.Payload.([]byte)))
+            c.Disconnect()
+        })
+    }
+
+    // the broker certificate is not trusted by default.
+    bc := NewBrokerConnector()
+    c, err := bc.Connect(&BrokerConnectorConfig{
+        Username: "guest", Password: "guest", UseWS: true, WSPath: "/", ServerAddr: wssURL.Host,
+        TLSConfig: &tls.Config{}}, false)
+    assert.Nil(t, c)
+    assert.NotNil(t, err)
+}
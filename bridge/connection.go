@@ -6,9 +6,10 @@ package bridge
 import (
     "fmt"
     "github.com/go-stomp/stomp"
+    "github.com/go-stomp/stomp/frame"
     "github.com/google/uuid"
+    "github.com/vmware/transport-go/log"
     "github.com/vmware/transport-go/model"
-    "log"
     "sync"
 )
 
@@ -17,6 +18,7 @@ type Connection interface {
     Subscribe(destination string) (Subscription, error)
     Disconnect() (err error)
     SendMessage(destination string, payload []byte) error
+    SendMessageWithContentType(destination string, contentType string, payload []byte) error
 }
 
 // Connection represents a Connection to a message broker.
@@ -28,6 +30,12 @@ type connection struct {
     disconnectChan chan bool
     subscriptions  map[string]Subscription
     connLock       sync.Mutex
+    config         *BrokerConnectorConfig
+    enableLogging  bool
+    logger         log.Logger
+    closing        bool // set when Disconnect() is called, the connection won't be restored
+    reconnecting   bool
+    disconnectOnce sync.Once
 }
 
 func (c *connection) GetId() *uuid.UUID{
@@ -61,6 +69,14 @@ func (c *connection) Disconnect() (err error) {
     if c == nil {
         return fmt.Errorf("cannot disconnect, not connected")
     }
+    c.connLock.Lock()
+    c.closing = true
+    c.connLock.Unlock()
+    c.disconnectOnce.Do(func() {
+        if c.disconnectChan != nil {
+            close(c.disconnectChan)
+        }
+    })
     if c.useWs {
         if c.wsConn != nil && c.wsConn.connected {
             defer c.cleanUpConnection()
@@ -76,6 +92,8 @@ func (c *connection) Disconnect() (err error) {
 }
 
 func (c *connection) cleanUpConnection() {
+    c.connLock.Lock()
+    defer c.connLock.Unlock()
     if c.conn != nil {
         c.conn = nil
     }
@@ -89,7 +107,7 @@ func (c *connection) subscribeWs(destination string) (Subscription, error) {
     defer c.connLock.Unlock()
     if c.wsConn != nil {
         wsSub := c.wsConn.Subscribe(destination)
-        sub := &subscription{wsStompSub: wsSub, id: wsSub.Id, c: wsSub.C, destination: destination}
+        sub := &subscription{wsStompSub: wsSub, id: wsSub.Id, c: wsSub.C, destination: destination, conn: c}
         c.subscriptions[destination] = sub
         return sub, nil
     }
@@ -103,22 +121,35 @@ func (c *connection) subscribeTCP(destination string) (Subscription, error) {
         sub, _ := c.conn.Subscribe(destination, stomp.AckAuto)
         id := uuid.New()
         destChan := make(chan *model.Message)
-        go c.listenTCPFrames(sub.C, destChan)
-        bcSub := &subscription{stompTCPSub: sub, id: &id, c: destChan}
+        bcSub := &subscription{stompTCPSub: sub, id: &id, c: destChan, destination: destination, conn: c}
+        go c.listenTCPFrames(sub.C, bcSub, sub)
         c.subscriptions[destination] = bcSub
         return bcSub, nil
     }
     return nil, fmt.Errorf("no STOMP TCP connection established")
 }
 
-func (c *connection) listenTCPFrames(src chan *stomp.Message, dst chan *model.Message) {
+func (c *connection) listenTCPFrames(src chan *stomp.Message, sub *subscription, stompSub *stomp.Subscription) {
     defer func() {
         if r := recover(); r != nil {
-            log.Println("subscription is closed, message undeliverable to closed channel.")
+            c.logger.Warn("subscription is closed, message undeliverable to closed channel",
+                "destination", sub.destination)
         }
     }()
+    dst := sub.c
     for {
-        f := <-src
+        f, ok := <-src
+        if !ok {
+            // the stomp subscription is closed, either because the connection dropped
+            // or because the subscription was replaced or unsubscribed.
+            if sub.isActive(stompSub) {
+                c.handleConnectionLost()
+            }
+            return
+        }
+        if f.Err != nil {
+            continue
+        }
         var body []byte
         var dest string
         if f != nil && f.Body != nil {
@@ -128,7 +159,7 @@ func (c *connection) listenTCPFrames(src chan *stomp.Message, dst chan *model.Me
             dest = f.Destination
         }
         if f != nil {
-            cf := &model.MessageConfig{Payload: body, Destination: dest}
+            cf := &model.MessageConfig{Payload: body, Destination: dest, Headers: convertFrameHeaders(f.Header)}
             m := model.GenerateResponse(cf)
             dst <- m
         }
@@ -137,16 +168,46 @@ func (c *connection) listenTCPFrames(src chan *stomp.Message, dst chan *model.Me
 
 // Send a []byte payload to a destination.
 func (c *connection) SendMessage(destination string, payload []byte) error {
+    return c.SendMessageWithContentType(destination, model.JSONContentType, payload)
+}
+
+// Send a []byte payload, encoded with the codec for contentType, to a destination.
+func (c *connection) SendMessageWithContentType(destination string, contentType string, payload []byte) error {
     c.connLock.Lock()
     defer c.connLock.Unlock()
     if c != nil && !c.useWs && c.conn != nil {
-        c.conn.Send(destination, "application/json", payload, nil)
-        return nil
+        err := c.conn.Send(destination, contentType, payload, nil)
+        if err == stomp.ErrAlreadyClosed && !c.closing {
+            go c.handleConnectionLost()
+        }
+        return err
     }
     if c != nil && c.useWs && c.wsConn != nil {
-        c.wsConn.Send(destination, payload)
+        c.wsConn.SendWithContentType(destination, contentType, payload)
         return nil
     }
     return fmt.Errorf("cannot send message, no connection")
 
 }
+
+// Converts STOMP frame headers into message headers, so the content type and any application
+// headers of incoming frames are available to bus handlers.
+func convertFrameHeaders(h *frame.Header) []model.MessageHeader {
+    if h == nil || h.Len() == 0 {
+        return nil
+    }
+    headers := make([]model.MessageHeader, 0, h.Len())
+    for i := 0; i < h.Len(); i++ {
+        key, value := h.GetAt(i)
+        headers = append(headers, model.MessageHeader{Label: key, Value: value})
+    }
+    return headers
+}
+
+func (c *connection) removeSubscription(sub *subscription) {
+    c.connLock.Lock()
+    defer c.connLock.Unlock()
+    if c.subscriptions[sub.destination] == sub {
+        delete(c.subscriptions, sub.destination)
+    }
+}
@@ -0,0 +1,194 @@
+// Copyright 2019-2020 VMware, Inc.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package bridge
+
+import (
+    "github.com/go-stomp/stomp"
+    "time"
+)
+
+// ConnectionState describes the state changes of a broker connection.
+type ConnectionState int
+
+const (
+    // The connection to the broker dropped unexpectedly.
+    ConnectionLost ConnectionState = iota
+    // A reconnect attempt is about to be made.
+    ConnectionReconnecting
+    // The connection was re-established and all subscriptions restored.
+    ConnectionReconnected
+    // All reconnect attempts failed, the connection is closed.
+    ConnectionReconnectFailed
+)
+
+func (s ConnectionState) String() string {
+    switch s {
+    case ConnectionLost:
+        return "lost"
+    case ConnectionReconnecting:
+        return "reconnecting"
+    case ConnectionReconnected:
+        return "reconnected"
+    case ConnectionReconnectFailed:
+        return "reconnect-failed"
+    }
+    return "unknown"
+}
+
+// Callback for connection state changes. attempt is the number of the current reconnect attempt,
+// starting from 1, and is zero for all states other than ConnectionReconnecting.
+type ConnectionStateHandlerFunction func(conn Connection, state ConnectionState, attempt int)
+
+const (
+    defaultReconnectDelay    = time.Second
+    defaultReconnectMaxDelay = 30 * time.Second
+)
+
+func (c *connection) notifyState(state ConnectionState, attempt int) {
+    if c.config != nil && c.config.ConnectionStateHandler != nil {
+        c.config.ConnectionStateHandler(c, state, attempt)
+    }
+}
+
+// called when the broker connection drops, starts reconnecting if it's enabled.
+func (c *connection) handleConnectionLost() {
+    c.connLock.Lock()
+    if c.closing || c.reconnecting {
+        c.connLock.Unlock()
+        return
+    }
+    c.reconnecting = true
+    c.connLock.Unlock()
+
+    c.notifyState(ConnectionLost, 0)
+
+    if c.config == nil || !c.config.AutoReconnect {
+        return
+    }
+    go c.reconnect()
+}
+
+func (c *connection) reconnect() {
+    delay := c.config.ReconnectDelay
+    if delay <= 0 {
+        delay = defaultReconnectDelay
+    }
+    maxDelay := c.config.ReconnectMaxDelay
+    if maxDelay <= 0 {
+        maxDelay = defaultReconnectMaxDelay
+    }
+
+    for attempt := 1; c.config.ReconnectMaxAttempts <= 0 || attempt <= c.config.ReconnectMaxAttempts; attempt++ {
+        c.notifyState(ConnectionReconnecting, attempt)
+
+        select {
+        case <-c.disconnectChan:
+            return
+        case <-time.After(delay):
+        }
+
+        if err := c.redial(); err != nil {
+            c.logger.Warn("reconnect attempt failed", "attempt", attempt, "error", err)
+            delay *= 2
+            if delay > maxDelay {
+                delay = maxDelay
+            }
+            continue
+        }
+
+        c.notifyState(ConnectionReconnected, 0)
+        return
+    }
+
+    // a later connection loss can't be detected for the closed connection,
+    // but the connection is no longer reconnecting.
+    c.connLock.Lock()
+    c.reconnecting = false
+    c.connLock.Unlock()
+
+    c.notifyState(ConnectionReconnectFailed, 0)
+}
+
+// re-establishes the broker connection and restores all subscriptions on the new connection.
+// The broker is dialed without holding the connection lock, the new connection replaces
+// the lost one once it is established.
+func (c *connection) redial() error {
+    c.connLock.Lock()
+    closing := c.closing
+    c.connLock.Unlock()
+    if closing {
+        return nil
+    }
+
+    var wsConn *BridgeClient
+    var conn *stomp.Conn
+    var err error
+    if c.useWs {
+        wsConn, err = dialWs(c.config, c.enableLogging, c.logger)
+    } else {
+        conn, err = dialTCP(c.config)
+    }
+    if err != nil {
+        return err
+    }
+
+    c.connLock.Lock()
+    if c.closing {
+        // disconnected while dialing, drop the new connection.
+        c.connLock.Unlock()
+        if wsConn != nil {
+            wsConn.Disconnect()
+        } else {
+            conn.Disconnect()
+        }
+        return nil
+    }
+    defer c.connLock.Unlock()
+
+    if c.useWs {
+        if c.wsConn != nil && c.wsConn.WSc != nil {
+            c.wsConn.WSc.Close()
+        }
+        c.wsConn = wsConn
+        go c.watchWsConnection(wsConn)
+    } else {
+        c.conn = conn
+    }
+
+    for _, sub := range c.subscriptions {
+        c.resubscribe(sub.(*subscription))
+    }
+    c.reconnecting = false
+    return nil
+}
+
+func (c *connection) resubscribe(sub *subscription) {
+    sub.lock.Lock()
+    defer sub.lock.Unlock()
+
+    if c.useWs {
+        sub.wsStompSub = c.wsConn.subscribeWithChannel(sub.destination, sub.c)
+    } else {
+        stompSub, err := c.conn.Subscribe(sub.destination, stomp.AckAuto)
+        if err != nil {
+            c.logger.Warn("cannot restore subscription", "destination", sub.destination, "error", err)
+            return
+        }
+        sub.stompTCPSub = stompSub
+        go c.listenTCPFrames(stompSub.C, sub, stompSub)
+    }
+}
+
+// waits until the websocket connection drops.
+func (c *connection) watchWsConnection(wsConn *BridgeClient) {
+    <-wsConn.lostChan
+
+    c.connLock.Lock()
+    current := c.wsConn == wsConn
+    c.connLock.Unlock()
+
+    if current {
+        c.handleConnectionLost()
+    }
+}
@@ -8,6 +8,7 @@ import (
     "github.com/go-stomp/stomp"
     "github.com/google/uuid"
     "github.com/vmware/transport-go/model"
+    "sync"
 )
 
 type Subscription interface {
@@ -19,11 +20,14 @@ type Subscription interface {
 
 // Subscription represents a subscription to a broker destination.
 type subscription struct {
-    c           chan *model.Message // listen to this for incoming messages
-    id          *uuid.UUID
-    destination string              // Destination of where this message was sent.
-    stompTCPSub *stomp.Subscription
-    wsStompSub  *BridgeClientSub
+    c            chan *model.Message // listen to this for incoming messages
+    id           *uuid.UUID
+    destination  string              // Destination of where this message was sent.
+    stompTCPSub  *stomp.Subscription
+    wsStompSub   *BridgeClientSub
+    conn         *connection
+    lock         sync.Mutex
+    unsubscribed bool
 }
 
 func (s *subscription) GetId() *uuid.UUID {
@@ -38,11 +42,30 @@ func (s *subscription) GetDestination() string {
     return s.destination
 }
 
+// Returns true if stompSub is the current underlying subscription and it wasn't unsubscribed.
+func (s *subscription) isActive(stompSub *stomp.Subscription) bool {
+    s.lock.Lock()
+    defer s.lock.Unlock()
+    return !s.unsubscribed && s.stompTCPSub == stompSub
+}
+
 // Unsubscribe from destination. All channels will be closed.
 func (s *subscription) Unsubscribe() error {
+    // the subscription must not be restored after a reconnect.
+    if s.conn != nil {
+        s.conn.removeSubscription(s)
+    }
+
+    s.lock.Lock()
+    defer s.lock.Unlock()
+
+    if s.unsubscribed {
+        return nil
+    }
 
     // if we're using TCP
     if s.stompTCPSub != nil {
+        s.unsubscribed = true
         go s.stompTCPSub.Unsubscribe() // local broker hangs, so lets make sure it is non blocking.
         close(s.c)
         return nil
@@ -50,6 +73,7 @@ func (s *subscription) Unsubscribe() error {
 
     // if we're using Websockets.
     if s.wsStompSub != nil {
+        s.unsubscribed = true
         s.wsStompSub.Unsubscribe()
         close(s.c)
         return nil
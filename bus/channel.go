@@ -4,11 +4,15 @@
 package bus
 
 import (
+    "fmt"
     "github.com/google/uuid"
     "github.com/vmware/transport-go/bridge"
+    "github.com/vmware/transport-go/log"
     "github.com/vmware/transport-go/model"
+    "runtime/debug"
     "sync"
     "sync/atomic"
+    "time"
 )
 
 // Channel represents the stream and the subscribed event handlers waiting for ticks on the stream
@@ -23,6 +27,48 @@ type Channel struct {
     brokerSubs                []*connectionSub
     brokerConns               []bridge.Connection
     brokerMappedEvent         chan bool
+    config                    ChannelConfig
+    deadLetterHandler         func(deadLetter *DeadLetter)
+    // sends monitor events related to this Channel, nil for channels created without a ChannelManager
+    monitor                   func(evtType MonitorEventType, data interface{})
+    // returns true if the per-message monitor events have listeners, nil if they are always sent
+    monitorMessages           func() bool
+    // returns the logger of the bus, nil for channels created without a ChannelManager
+    getLogger                 func() log.Logger
+}
+
+// MessageHandled describes a message processed by a Channel handler. It is the data
+// of ChannelMessageHandledEvt monitor events.
+type MessageHandled struct {
+    Message  *model.Message
+    // Time the handler took to process the message
+    Duration time.Duration
+}
+
+// HandlerPanic describes a panic recovered while a handler processed a message. It is
+// the data of HandlerPanicEvt monitor events.
+type HandlerPanic struct {
+    // Name of the channel the message was sent on
+    Channel string
+    // The recovered panic value wrapped as an error
+    Error   error
+    // Stack trace of the panicking goroutine
+    Stack   []byte
+    Message *model.Message
+}
+
+// Builds the HandlerPanic for the value returned by recover() in a deferred function of a
+// message handler. Returns nil if the handler didn't panic.
+func RecoverHandlerPanic(channelName string, message *model.Message, r interface{}) *HandlerPanic {
+    if r == nil {
+        return nil
+    }
+    return &HandlerPanic{
+        Channel: channelName,
+        Error:   fmt.Errorf("handler panic: %v", r),
+        Stack:   debug.Stack(),
+        Message: message,
+    }
 }
 
 // Create a new Channel with the supplied Channel name. Returns a pointer to that Channel.
@@ -68,9 +114,29 @@ func (channel *Channel) IsPrivate() bool {
 }
 
 // Send a new message on this Channel, to all event handlers.
+// Expired messages and messages sent to a Channel without handlers are dead-lettered, see DeadLetter.
+// Use SendWithError to find out whether a handler queue rejected the message.
 func (channel *Channel) Send(message *model.Message) {
+    channel.SendWithError(message)
+}
+
+// Same as Send, but returns ErrHandlerQueueFull if the Channel was created with the OverflowError
+// policy and at least one handler queue was full. The message is still delivered to all other handlers.
+func (channel *Channel) SendWithError(message *model.Message) error {
+    if message.ExpiresAt.IsZero() && channel.config.MessageTTL > 0 {
+        message.SetTTL(channel.config.MessageTTL)
+    }
+    if message.IsExpired() {
+        channel.deadLetter(DeadLetterExpired, message, nil)
+        return nil
+    }
+    if channel.isMessageMonitored() {
+        channel.sendMonitorEvent(ChannelMessageSentEvt, message)
+    }
+
     channel.channelLock.Lock()
-    defer channel.channelLock.Unlock()
+    var queuedHandlers []*channelEventHandler
+    delivered := false
     if eventHandlers := channel.eventHandlers; len(eventHandlers) > 0 {
 
         // if a handler is run once only, then the slice will be mutated mid cycle.
@@ -83,9 +149,42 @@ func (channel *Channel) Send(message *model.Message) {
                 continue
             }
             channel.wg.Add(1)
-            go channel.sendMessageToHandler(eventHandler, message)
+            delivered = true
+            if eventHandler.queue != nil {
+                queuedHandlers = append(queuedHandlers, eventHandler)
+            } else {
+                go channel.sendMessageToHandler(eventHandler, message)
+            }
+        }
+    }
+    channel.channelLock.Unlock()
+
+    if !delivered {
+        channel.deadLetter(DeadLetterNoHandlers, message, nil)
+        return nil
+    }
+
+    // queue outside of the lock, a blocking queue must not stop handlers from sending
+    // on, or unsubscribing from this Channel.
+    var err error
+    for _, eventHandler := range queuedHandlers {
+        dropped, overflowed, queueErr := eventHandler.queue.push(message)
+        if dropped != nil {
+            channel.wg.Done()
+        }
+        if overflowed {
+            channel.deadLetter(DeadLetterQueueOverflow, dropped, nil)
+        }
+        if queueErr != nil && err == nil {
+            err = queueErr
         }
     }
+    return err
+}
+
+// Returns the delivery configuration of the Channel.
+func (channel *Channel) GetConfig() ChannelConfig {
+    return channel.config
 }
 
 // Check if the Channel has any registered subscribers
@@ -95,18 +194,134 @@ func (channel *Channel) ContainsHandlers() bool {
 
 // Send message to handler function
 func (channel *Channel) sendMessageToHandler(handler *channelEventHandler, message *model.Message) {
+    defer channel.wg.Done()
+
+    // queued messages can expire while waiting for the handler.
+    if message.IsExpired() {
+        channel.deadLetter(DeadLetterExpired, message, nil)
+        return
+    }
+
+    // a panicking handler must not take down the whole process.
+    defer func() {
+        if handlerPanic := RecoverHandlerPanic(channel.Name, message, recover()); handlerPanic != nil {
+            atomic.AddInt64(&handler.runCount, 1)
+            channel.reportPanic(handlerPanic)
+            channel.deadLetter(DeadLetterHandlerPanic, message, handlerPanic.Error)
+        }
+    }()
+
+    if !channel.isMessageMonitored() {
+        handler.callBackFunction(message)
+        atomic.AddInt64(&handler.runCount, 1)
+        return
+    }
+
+    start := time.Now()
     handler.callBackFunction(message)
     atomic.AddInt64(&handler.runCount, 1)
-    channel.wg.Done()
+    channel.sendMonitorEvent(ChannelMessageHandledEvt, &MessageHandled{
+        Message:  message,
+        Duration: time.Since(start),
+    })
+}
+
+// Returns the number of messages waiting in the handler queues of the Channel.
+func (channel *Channel) QueueDepth() int {
+    channel.channelLock.Lock()
+    defer channel.channelLock.Unlock()
+
+    depth := 0
+    for _, handler := range channel.eventHandlers {
+        if handler.queue != nil {
+            depth += handler.queue.len()
+        }
+    }
+    return depth
+}
+
+// Returns true if the ChannelMessageSentEvt and ChannelMessageHandledEvt events of
+// the Channel have listeners, the events are skipped on the hot path otherwise.
+func (channel *Channel) isMessageMonitored() bool {
+    if channel.monitor == nil {
+        return false
+    }
+    return channel.monitorMessages == nil || channel.monitorMessages()
+}
+
+func (channel *Channel) sendMonitorEvent(evtType MonitorEventType, data interface{}) {
+    if channel.monitor != nil {
+        channel.monitor(evtType, data)
+    }
+}
+
+func (channel *Channel) reportPanic(handlerPanic *HandlerPanic) {
+    channel.logger().Warn("recovered from a panic of a channel handler",
+        "error", handlerPanic.Error, "stack", string(handlerPanic.Stack))
+    channel.sendMonitorEvent(HandlerPanicEvt, handlerPanic)
+}
+
+func (channel *Channel) logger() log.Logger {
+    logger := log.Default()
+    if channel.getLogger != nil {
+        logger = channel.getLogger()
+    }
+    return logger.With("channel", channel.Name)
+}
+
+// Hand an undeliverable message over to the dead letter handler. Messages without handlers and
+// handler panics are only dead-lettered if the Channel has a dead letter channel configured.
+func (channel *Channel) deadLetter(reason DeadLetterReason, message *model.Message, err error) {
+    if channel.deadLetterHandler == nil {
+        return
+    }
+    if (reason == DeadLetterNoHandlers || reason == DeadLetterHandlerPanic) && channel.config.DeadLetterChannel == "" {
+        return
+    }
+    channel.deadLetterHandler(&DeadLetter{
+        Channel: channel.Name,
+        Reason:  reason,
+        Error:   err,
+        Message: message,
+        Time:    time.Now(),
+    })
+}
+
+// Process queued messages for a handler until its queue is closed and drained.
+func (channel *Channel) runHandlerQueue(handler *channelEventHandler) {
+    for {
+        message, ok := handler.queue.pop()
+        if !ok {
+            return
+        }
+        channel.sendMessageToHandler(handler, message)
+    }
 }
 
 // Subscribe a new handler function.
 func (channel *Channel) subscribeHandler(handler *channelEventHandler) {
     channel.channelLock.Lock()
     defer channel.channelLock.Unlock()
+    if channel.config.isQueued() {
+        handler.queue = newHandlerQueue(channel.config.HandlerQueueSize, channel.config.OverflowPolicy)
+        for i := 0; i < channel.config.workerCount(); i++ {
+            go channel.runHandlerQueue(handler)
+        }
+    }
     channel.eventHandlers = append(channel.eventHandlers, handler)
 }
 
+// Close all handler queues, messages already queued are still delivered.
+func (channel *Channel) closeHandlerQueues() {
+    channel.channelLock.Lock()
+    defer channel.channelLock.Unlock()
+    for _, handler := range channel.eventHandlers {
+        if handler.queue != nil {
+            handler.queue.close()
+        }
+    }
+}
+
 func (channel *Channel) unsubscribeHandler(uuid *uuid.UUID) bool {
     channel.channelLock.Lock()
     defer channel.channelLock.Unlock()
@@ -130,6 +345,10 @@ func (channel *Channel) removeEventHandler(index int) {
         return
     }
 
+    if queue := channel.eventHandlers[index].queue; queue != nil {
+        queue.close()
+    }
+
     // delete from event handler slice.
     copy(channel.eventHandlers[index:], channel.eventHandlers[index+1:])
     channel.eventHandlers[numHandlers-1] = nil
@@ -12,4 +12,5 @@ type channelEventHandler struct {
     runOnce          bool
     runCount         int64
     uuid             *uuid.UUID
+    queue            *handlerQueue
 }
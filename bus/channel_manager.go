@@ -14,13 +14,15 @@ import (
 
 // ChannelManager interfaces controls all access to channels vis the bus.
 type ChannelManager interface {
-	CreateChannel(channelName string) *Channel
+	CreateChannel(channelName string, options ...ChannelOption) *Channel
 	DestroyChannel(channelName string)
 	CheckChannelExists(channelName string) bool
 	GetChannel(channelName string) (*Channel, error)
 	GetAllChannels() map[string]*Channel
 	SubscribeChannelHandler(channelName string, fn MessageHandlerFunction, runOnce bool) (*uuid.UUID, error)
 	UnsubscribeChannelHandler(channelName string, id *uuid.UUID) error
+	SubscribeChannelPatternHandler(pattern string, fn MessageHandlerFunction) (*uuid.UUID, error)
+	UnsubscribeChannelPatternHandler(id *uuid.UUID) error
 	WaitForChannel(channelName string) error
 	MarkChannelAsGalactic(channelName string, brokerDestination string, connection bridge.Connection) (err error)
 	MarkChannelAsLocal(channelName string) (err error)
@@ -29,18 +31,21 @@ type ChannelManager interface {
 func NewBusChannelManager(bus EventBus) ChannelManager {
 	manager := new(busChannelManager)
 	manager.Channels = make(map[string]*Channel)
+	manager.patternSubs = make(map[uuid.UUID]*patternSubscription)
 	manager.bus = bus.(*transportEventBus)
 	return manager
 }
 
 type busChannelManager struct {
-	Channels map[string]*Channel
-	bus      *transportEventBus
-	lock     sync.RWMutex
+	Channels    map[string]*Channel
+	bus         *transportEventBus
+	lock        sync.RWMutex
+	patternSubs map[uuid.UUID]*patternSubscription
 }
 
-// Create a new Channel with the supplied Channel name. Returns pointer to new Channel object
-func (manager *busChannelManager) CreateChannel(channelName string) *Channel {
+// Create a new Channel with the supplied Channel name and delivery options. Returns pointer to new Channel object.
+// If the Channel already exists, it is returned unchanged and the options are ignored.
+func (manager *busChannelManager) CreateChannel(channelName string, options ...ChannelOption) *Channel {
 	manager.lock.Lock()
 	defer manager.lock.Unlock()
 
@@ -49,9 +54,52 @@ func (manager *busChannelManager) CreateChannel(channelName string) *Channel {
 		return channel
 	}
 
-	manager.Channels[channelName] = NewChannel(channelName)
+	channel = manager.createChannel(channelName, options...)
+	deadLetterChannel := channel.config.DeadLetterChannel
+	if deadLetterChannel != "" && manager.Channels[deadLetterChannel] == nil {
+		manager.createChannel(deadLetterChannel)
+	}
+	return channel
+}
+
+// Create and register a new Channel, the caller must hold the manager lock.
+func (manager *busChannelManager) createChannel(channelName string, options ...ChannelOption) *Channel {
+	channel := NewChannel(channelName)
+	for _, option := range options {
+		option(&channel.config)
+	}
+	channel.deadLetterHandler = func(deadLetter *DeadLetter) {
+		manager.handleDeadLetter(channel, deadLetter)
+	}
+	channel.monitor = func(evtType MonitorEventType, data interface{}) {
+		manager.bus.SendMonitorEvent(evtType, channel.Name, data)
+	}
+	channel.monitorMessages = manager.bus.monitor.hasMessageListeners
+	channel.getLogger = manager.bus.GetLogger
+	manager.Channels[channelName] = channel
 	go manager.bus.SendMonitorEvent(ChannelCreatedEvt, channelName, nil)
-	return manager.Channels[channelName]
+
+	// attach any pattern handlers that match the new channel.
+	for _, sub := range manager.patternSubs {
+		if sub.pattern.Matches(channelName) {
+			sub.channels[channelName] = subscribePatternHandler(channel, sub)
+			go manager.bus.SendMonitorEvent(ChannelSubscriberJoinedEvt, channelName, nil)
+		}
+	}
+	return channel
+}
+
+// Report an undeliverable message and forward it to the dead letter channel of the Channel, if any.
+func (manager *busChannelManager) handleDeadLetter(channel *Channel, deadLetter *DeadLetter) {
+	manager.bus.SendMonitorEvent(ChannelMessageDeadLetteredEvt, channel.Name, deadLetter)
+
+	deadLetterChannel := channel.config.DeadLetterChannel
+	if deadLetterChannel == "" || deadLetterChannel == channel.Name {
+		return
+	}
+	if dlChannel, err := manager.GetChannel(deadLetterChannel); err == nil {
+		dlChannel.Send(model.GenerateResponse(buildConfig(deadLetterChannel, deadLetter, nil)))
+	}
 }
 
 // Destroy a Channel and all the handlers listening on it.
@@ -59,7 +107,13 @@ func (manager *busChannelManager) DestroyChannel(channelName string) {
 	manager.lock.Lock()
 	defer manager.lock.Unlock()
 
+	if channel, ok := manager.Channels[channelName]; ok {
+		channel.closeHandlerQueues()
+	}
 	delete(manager.Channels, channelName)
+	for _, sub := range manager.patternSubs {
+		delete(sub.channels, channelName)
+	}
 	go manager.bus.SendMonitorEvent(ChannelDestroyedEvt, channelName, nil)
 }
 
@@ -115,6 +169,79 @@ func (manager *busChannelManager) UnsubscribeChannelHandler(channelName string,
 	return nil
 }
 
+// Subscribe new handler lambda for all channels matching the supplied pattern (see ChannelPattern).
+// The handler is attached to all existing matching channels and to every matching channel created later.
+// Returns UUID pointer of the pattern subscription, or error if the pattern is invalid.
+func (manager *busChannelManager) SubscribeChannelPatternHandler(
+	pattern string, fn MessageHandlerFunction) (*uuid.UUID, error) {
+
+	channelPattern, err := NewChannelPattern(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	id := uuid.New()
+	sub := &patternSubscription{
+		id:       &id,
+		pattern:  channelPattern,
+		fn:       fn,
+		channels: make(map[string]*uuid.UUID),
+	}
+
+	manager.lock.Lock()
+	manager.patternSubs[id] = sub
+	for channelName, channel := range manager.Channels {
+		if channelPattern.Matches(channelName) {
+			sub.channels[channelName] = subscribePatternHandler(channel, sub)
+		}
+	}
+	joined := make([]string, 0, len(sub.channels))
+	for channelName := range sub.channels {
+		joined = append(joined, channelName)
+	}
+	manager.lock.Unlock()
+
+	for _, channelName := range joined {
+		manager.bus.SendMonitorEvent(ChannelSubscriberJoinedEvt, channelName, nil)
+	}
+	return &id, nil
+}
+
+// Unsubscribe a pattern handler from all the channels it is attached to.
+// Returns an error if there is no pattern subscription with the supplied id.
+func (manager *busChannelManager) UnsubscribeChannelPatternHandler(id *uuid.UUID) error {
+	if id == nil {
+		return fmt.Errorf("no pattern handler for uuid [%s]", id)
+	}
+
+	manager.lock.Lock()
+	sub, ok := manager.patternSubs[*id]
+	if !ok {
+		manager.lock.Unlock()
+		return fmt.Errorf("no pattern handler for uuid [%s]", id)
+	}
+	delete(manager.patternSubs, *id)
+
+	left := make([]string, 0, len(sub.channels))
+	for channelName, handlerId := range sub.channels {
+		if channel, exists := manager.Channels[channelName]; exists && channel.unsubscribeHandler(handlerId) {
+			left = append(left, channelName)
+		}
+	}
+	manager.lock.Unlock()
+
+	for _, channelName := range left {
+		manager.bus.SendMonitorEvent(ChannelSubscriberLeftEvt, channelName, nil)
+	}
+	return nil
+}
+
+func subscribePatternHandler(channel *Channel, sub *patternSubscription) *uuid.UUID {
+	id := uuid.New()
+	channel.subscribeHandler(&channelEventHandler{callBackFunction: sub.fn, runOnce: false, uuid: &id})
+	return &id
+}
+
 func (manager *busChannelManager) WaitForChannel(channelName string) error {
 	channel, _ := manager.GetChannel(channelName)
 	if channel == nil {
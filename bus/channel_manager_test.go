@@ -313,3 +313,209 @@ func TestChannelManager_TestLocalMonitorInvalidChannel(t *testing.T) {
     err := testChannelManager.MarkChannelAsLocal("fun-chan")
     assert.Nil(t, err)
 }
+
+func TestChannelPattern_Matches(t *testing.T) {
+    p, err := NewChannelPattern("vm-service.*")
+    assert.Nil(t, err)
+    assert.True(t, p.Matches("vm-service.create"))
+    assert.True(t, p.Matches("vm-service.power.on"))
+    assert.False(t, p.Matches("vm-service"))
+    assert.False(t, p.Matches("xvm-service.create"))
+
+    p, _ = NewChannelPattern("tenant/+/events")
+    assert.True(t, p.Matches("tenant/acme/events"))
+    assert.False(t, p.Matches("tenant/acme/sub/events"))
+    assert.False(t, p.Matches("tenant//events"))
+    assert.Equal(t, "tenant/+/events", p.String())
+
+    p, _ = NewChannelPattern("exact.channel")
+    assert.True(t, p.Matches("exact.channel"))
+    assert.False(t, p.Matches("exactxchannel"))
+
+    _, err = NewChannelPattern("")
+    assert.NotNil(t, err)
+
+    assert.True(t, IsChannelPattern("a.*"))
+    assert.True(t, IsChannelPattern("a/+/b"))
+    assert.False(t, IsChannelPattern("melody"))
+}
+
+func TestChannelManager_SubscribeChannelPatternHandler(t *testing.T) {
+    testChannelManager, _ = createManager()
+    testChannelManager.CreateChannel("vm-service.create")
+    testChannelManager.CreateChannel("vm-service.delete")
+    testChannelManager.CreateChannel("melody")
+
+    var lock sync.Mutex
+    received := make(map[string]int)
+    id, err := testChannelManager.SubscribeChannelPatternHandler("vm-service.*", func(msg *model.Message) {
+        lock.Lock()
+        received[msg.Channel]++
+        lock.Unlock()
+    })
+    assert.Nil(t, err)
+    assert.NotNil(t, id)
+
+    // channel created after the subscription should be picked up.
+    testChannelManager.CreateChannel("vm-service.power")
+    melody, _ := testChannelManager.GetChannel("melody")
+    assert.False(t, melody.ContainsHandlers())
+
+    for _, name := range []string{"vm-service.create", "vm-service.delete", "vm-service.power", "melody"} {
+        ch, _ := testChannelManager.GetChannel(name)
+        ch.Send(model.GenerateResponse(&model.MessageConfig{Channel: name, Payload: "hi"}))
+        testChannelManager.WaitForChannel(name)
+    }
+
+    lock.Lock()
+    assert.Equal(t, map[string]int{"vm-service.create": 1, "vm-service.delete": 1, "vm-service.power": 1}, received)
+    lock.Unlock()
+
+    assert.Nil(t, testChannelManager.UnsubscribeChannelPatternHandler(id))
+    for _, name := range []string{"vm-service.create", "vm-service.delete", "vm-service.power"} {
+        ch, _ := testChannelManager.GetChannel(name)
+        assert.False(t, ch.ContainsHandlers())
+    }
+
+    // new channels no longer get the handler.
+    ch := testChannelManager.CreateChannel("vm-service.update")
+    assert.False(t, ch.ContainsHandlers())
+
+    assert.NotNil(t, testChannelManager.UnsubscribeChannelPatternHandler(id))
+    assert.NotNil(t, testChannelManager.UnsubscribeChannelPatternHandler(nil))
+}
+
+func TestChannelManager_SubscribeChannelPatternHandlerDestroyedChannel(t *testing.T) {
+    testChannelManager, _ = createManager()
+    testChannelManager.CreateChannel("tenant/acme/events")
+
+    id, _ := testChannelManager.SubscribeChannelPatternHandler("tenant/+/events", func(msg *model.Message) {})
+    testChannelManager.DestroyChannel("tenant/acme/events")
+
+    // re-created channel gets a fresh handler attached.
+    ch := testChannelManager.CreateChannel("tenant/acme/events")
+    assert.True(t, ch.ContainsHandlers())
+
+    assert.Nil(t, testChannelManager.UnsubscribeChannelPatternHandler(id))
+    assert.False(t, ch.ContainsHandlers())
+}
+
+func TestChannelManager_SubscribeChannelPatternHandlerInvalidPattern(t *testing.T) {
+    testChannelManager, _ = createManager()
+    id, err := testChannelManager.SubscribeChannelPatternHandler("", func(msg *model.Message) {})
+    assert.Nil(t, id)
+    assert.NotNil(t, err)
+}
+
+func TestChannelManager_CreateChannelWithOptions(t *testing.T) {
+    testChannelManager, _ = createManager()
+    ch := testChannelManager.CreateChannel(testChannelManagerChannelName,
+        WithHandlerQueue(5, OverflowDropOldest), WithOrderedDelivery())
+
+    assert.Equal(t, ChannelConfig{HandlerQueueSize: 5, OverflowPolicy: OverflowDropOldest, OrderedDelivery: true},
+        ch.GetConfig())
+
+    // options are ignored for existing channels.
+    ch = testChannelManager.CreateChannel(testChannelManagerChannelName, WithHandlerQueue(1, OverflowError))
+    assert.Equal(t, 5, ch.GetConfig().HandlerQueueSize)
+
+    var count int32
+    testChannelManager.SubscribeChannelHandler(testChannelManagerChannelName, func(message *model.Message) {
+        count++
+    }, false)
+    for i := 0; i < 3; i++ {
+        ch.Send(model.GenerateResponse(&model.MessageConfig{Payload: i}))
+    }
+    testChannelManager.WaitForChannel(testChannelManagerChannelName)
+    assert.Equal(t, int32(3), count)
+    testChannelManager.DestroyChannel(testChannelManagerChannelName)
+}
+
+func TestChannelManager_DeadLetterChannel(t *testing.T) {
+    manager, bus := createManager()
+
+    var monitorEvents []*MonitorEvent
+    var lock sync.Mutex
+    bus.AddMonitorEventListener(func(evt *MonitorEvent) {
+        lock.Lock()
+        monitorEvents = append(monitorEvents, evt)
+        lock.Unlock()
+    }, ChannelMessageDeadLetteredEvt)
+
+    channel := manager.CreateChannel("work", WithDeadLetterChannel("work-dlq"))
+    assert.True(t, manager.CheckChannelExists("work-dlq"))
+
+    deadLetters := make(chan *DeadLetter, 10)
+    manager.SubscribeChannelHandler("work-dlq", func(msg *model.Message) {
+        deadLetters <- msg.Payload.(*DeadLetter)
+    }, false)
+
+    // no handlers
+    channel.Send(model.GenerateRequest(&model.MessageConfig{Channel: "work", Payload: "no-handlers"}))
+    dl := <-deadLetters
+    assert.Equal(t, DeadLetterNoHandlers, dl.Reason)
+    assert.Equal(t, "work", dl.Channel)
+    assert.Equal(t, "no-handlers", dl.Message.Payload)
+
+    // handler panic
+    manager.SubscribeChannelHandler("work", func(msg *model.Message) {
+        panic("handler failure")
+    }, false)
+    channel.Send(model.GenerateRequest(&model.MessageConfig{Channel: "work", Payload: "panic"}))
+    dl = <-deadLetters
+    assert.Equal(t, DeadLetterHandlerPanic, dl.Reason)
+    assert.EqualError(t, dl.Error, "handler panic: handler failure")
+    assert.Equal(t, "panic", dl.Message.Payload)
+
+    // expired message
+    expired := model.GenerateRequest(&model.MessageConfig{Channel: "work", Payload: "expired"})
+    expired.ExpiresAt = time.Now().Add(-time.Second)
+    channel.Send(expired)
+    dl = <-deadLetters
+    assert.Equal(t, DeadLetterExpired, dl.Reason)
+    assert.Equal(t, expired, dl.Message)
+
+    lock.Lock()
+    defer lock.Unlock()
+    assert.Equal(t, 3, len(monitorEvents))
+    for _, evt := range monitorEvents {
+        assert.Equal(t, "work", evt.EntityName)
+    }
+}
+
+func TestChannelManager_MessageTTL(t *testing.T) {
+    manager, bus := createManager()
+
+    expired := make(chan *DeadLetter, 10)
+    bus.AddMonitorEventListener(func(evt *MonitorEvent) {
+        expired <- evt.Data.(*DeadLetter)
+    }, ChannelMessageDeadLetteredEvt)
+
+    channel := manager.CreateChannel("slow", WithMessageTTL(20 * time.Millisecond), WithOrderedDelivery())
+
+    release := make(chan bool)
+    var received []interface{}
+    manager.SubscribeChannelHandler("slow", func(msg *model.Message) {
+        received = append(received, msg.Payload)
+        <-release
+    }, false)
+
+    channel.Send(model.GenerateRequest(&model.MessageConfig{Channel: "slow", Payload: "first"}))
+    channel.Send(model.GenerateRequest(&model.MessageConfig{Channel: "slow", Payload: "second"}))
+    // the second message expires while the handler is busy with the first one.
+    time.Sleep(40 * time.Millisecond)
+    release <- true
+
+    dl := <-expired
+    assert.Equal(t, DeadLetterExpired, dl.Reason)
+    assert.Equal(t, "second", dl.Message.Payload)
+    manager.WaitForChannel("slow")
+    assert.Equal(t, []interface{}{"first"}, received)
+
+    // messages without handlers are not reported if there is no dead letter channel.
+    manager.CreateChannel("empty").Send(model.GenerateRequest(&model.MessageConfig{Channel: "empty"}))
+    ttlMsg := model.GenerateRequest(&model.MessageConfig{Channel: "empty", TTL: time.Minute})
+    assert.False(t, ttlMsg.IsExpired())
+    assert.False(t, ttlMsg.ExpiresAt.IsZero())
+    assert.Equal(t, 0, len(expired))
+}
@@ -0,0 +1,101 @@
+// Copyright 2019-2020 VMware, Inc.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package bus
+
+import (
+	"errors"
+	"time"
+)
+
+// OverflowPolicy defines what happens when a message is sent to a handler whose queue is full.
+type OverflowPolicy int
+
+const (
+	// Block the sender until there is room in the handler queue.
+	OverflowBlock OverflowPolicy = iota
+	// Drop the oldest queued message to make room for the new one,
+	// the dropped message is dead-lettered with DeadLetterQueueOverflow.
+	OverflowDropOldest
+	// Drop the new message, it is dead-lettered with DeadLetterQueueOverflow.
+	OverflowDropNewest
+	// Drop the new message and return ErrHandlerQueueFull to the sender.
+	OverflowError
+)
+
+// ErrHandlerQueueFull is returned by Channel.SendWithError when a handler queue is full and the
+// channel uses the OverflowError policy.
+var ErrHandlerQueueFull = errors.New("channel handler queue is full")
+
+// ChannelConfig controls how messages sent on a Channel are delivered to its handlers.
+//
+// The zero value keeps the default behaviour: every message is delivered to every handler on
+// its own goroutine, without bound and without ordering guarantees.
+// If HandlerQueueSize or OrderedDelivery is set, each handler gets its own queue served by a fixed
+// number of worker goroutines instead.
+type ChannelConfig struct {
+	// Maximum number of messages waiting for a single handler. Zero means unbounded.
+	HandlerQueueSize int
+	// What to do when a handler queue is full.
+	OverflowPolicy OverflowPolicy
+	// Number of goroutines delivering messages to a single handler. Defaults to 1.
+	HandlerConcurrency int
+	// Deliver messages to each handler one at a time, in the order they were sent.
+	OrderedDelivery bool
+	// Default time to live of the messages sent without an expiry. Zero means no expiry.
+	MessageTTL time.Duration
+	// Name of the channel receiving the messages which could not be delivered, see DeadLetter.
+	DeadLetterChannel string
+}
+
+// ChannelOption configures a Channel when it is created with ChannelManager.CreateChannel.
+type ChannelOption func(config *ChannelConfig)
+
+// Bound every handler queue to size messages, applying policy when a queue is full.
+func WithHandlerQueue(size int, policy OverflowPolicy) ChannelOption {
+	return func(config *ChannelConfig) {
+		config.HandlerQueueSize = size
+		config.OverflowPolicy = policy
+	}
+}
+
+// Deliver messages to each handler using the supplied number of goroutines.
+// Ignored when ordered delivery is enabled.
+func WithHandlerConcurrency(workers int) ChannelOption {
+	return func(config *ChannelConfig) {
+		config.HandlerConcurrency = workers
+	}
+}
+
+// Deliver messages to each handler strictly in the order they were sent.
+func WithOrderedDelivery() ChannelOption {
+	return func(config *ChannelConfig) {
+		config.OrderedDelivery = true
+	}
+}
+
+// Expire the messages sent on the Channel without an expiry after ttl.
+func WithMessageTTL(ttl time.Duration) ChannelOption {
+	return func(config *ChannelConfig) {
+		config.MessageTTL = ttl
+	}
+}
+
+// Send the messages which could not be delivered to the handlers of the Channel to the dead letter channel.
+// The dead letter channel is created if it doesn't exist.
+func WithDeadLetterChannel(channelName string) ChannelOption {
+	return func(config *ChannelConfig) {
+		config.DeadLetterChannel = channelName
+	}
+}
+
+func (config *ChannelConfig) isQueued() bool {
+	return config.HandlerQueueSize > 0 || config.OrderedDelivery
+}
+
+func (config *ChannelConfig) workerCount() int {
+	if config.OrderedDelivery || config.HandlerConcurrency < 1 {
+		return 1
+	}
+	return config.HandlerConcurrency
+}
@@ -0,0 +1,72 @@
+// Copyright 2019-2020 VMware, Inc.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package bus
+
+import (
+	"fmt"
+	"github.com/google/uuid"
+	"regexp"
+	"strings"
+)
+
+// ChannelPattern matches channel names against a wildcard pattern.
+// Supported wildcards are:
+//  *  matches any sequence of characters, including separators ("vm-service.*")
+//  +  matches exactly one non empty segment, segments are separated by '/' or '.' ("tenant/+/events")
+// All other characters are matched literally.
+type ChannelPattern struct {
+	pattern string
+	regex   *regexp.Regexp
+}
+
+// Compile a new ChannelPattern. Returns an error if the pattern is empty.
+func NewChannelPattern(pattern string) (*ChannelPattern, error) {
+	if pattern == "" {
+		return nil, fmt.Errorf("invalid channel pattern: pattern is empty")
+	}
+
+	var sb strings.Builder
+	sb.WriteString("^")
+	for _, r := range pattern {
+		switch r {
+		case '*':
+			sb.WriteString(".*")
+		case '+':
+			sb.WriteString("[^/.]+")
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	sb.WriteString("$")
+
+	regex, err := regexp.Compile(sb.String())
+	if err != nil {
+		return nil, err
+	}
+	return &ChannelPattern{pattern: pattern, regex: regex}, nil
+}
+
+// Returns true if the supplied string contains any wildcard characters.
+func IsChannelPattern(s string) bool {
+	return strings.ContainsAny(s, "*+")
+}
+
+// Returns the raw pattern string.
+func (p *ChannelPattern) String() string {
+	return p.pattern
+}
+
+// Returns true if the channel name matches the pattern.
+func (p *ChannelPattern) Matches(channelName string) bool {
+	return p.regex.MatchString(channelName)
+}
+
+// patternSubscription tracks a handler subscribed with a pattern and the handler id it was given
+// on every matching channel.
+type patternSubscription struct {
+	id       *uuid.UUID
+	pattern  *ChannelPattern
+	fn       MessageHandlerFunction
+	channels map[string]*uuid.UUID
+}
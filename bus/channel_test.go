@@ -9,7 +9,10 @@ import (
     "github.com/stretchr/testify/mock"
     "github.com/vmware/transport-go/bridge"
     "github.com/vmware/transport-go/model"
+    "sync"
+    "sync/atomic"
     "testing"
+    "time"
 )
 
 var testChannelName string = "testing"
@@ -268,6 +271,11 @@ func (c *MockBridgeConnection) SendMessage(destination string, payload []byte) e
     return args.Error(0)
 }
 
+func (c *MockBridgeConnection) SendMessageWithContentType(destination string, contentType string, payload []byte) error {
+    args := c.MethodCalled("SendMessageWithContentType", destination, contentType, payload)
+    return args.Error(0)
+}
+
 type MockBridgeSubscription struct {
     Id *uuid.UUID
     Destination string
@@ -289,3 +297,195 @@ func (m *MockBridgeSubscription) GetMsgChannel() chan *model.Message {
 func (m *MockBridgeSubscription) Unsubscribe() error {
     return nil
 }
+
+func newQueuedTestChannel(options ...ChannelOption) *Channel {
+    channel := NewChannel(testChannelName)
+    for _, option := range options {
+        option(&channel.config)
+    }
+    return channel
+}
+
+func TestChannel_OrderedDelivery(t *testing.T) {
+    channel := newQueuedTestChannel(WithOrderedDelivery())
+    assert.True(t, channel.GetConfig().OrderedDelivery)
+
+    var received []int
+    id := uuid.New()
+    channel.subscribeHandler(&channelEventHandler{callBackFunction: func(message *model.Message) {
+        received = append(received, message.Payload.(int))
+    }, uuid: &id})
+
+    for i := 0; i < 500; i++ {
+        assert.Nil(t, channel.SendWithError(model.GenerateResponse(&model.MessageConfig{Payload: i})))
+    }
+    channel.wg.Wait()
+
+    assert.Len(t, received, 500)
+    for i, v := range received {
+        assert.Equal(t, i, v)
+    }
+}
+
+func TestChannel_QueueBlockPolicy(t *testing.T) {
+    channel := newQueuedTestChannel(WithHandlerQueue(2, OverflowBlock))
+
+    release := make(chan bool)
+    var count int32
+    id := uuid.New()
+    channel.subscribeHandler(&channelEventHandler{callBackFunction: func(message *model.Message) {
+        <-release
+        atomic.AddInt32(&count, 1)
+    }, uuid: &id})
+
+    // one message in the handler, two in the queue, the fourth must block.
+    for i := 0; i < 3; i++ {
+        channel.Send(model.GenerateResponse(&model.MessageConfig{Payload: i}))
+    }
+    sent := make(chan bool)
+    go func() {
+        channel.Send(model.GenerateResponse(&model.MessageConfig{Payload: 3}))
+        sent <- true
+    }()
+
+    select {
+    case <-sent:
+        assert.Fail(t, "send should block while the handler queue is full")
+    case <-time.After(20 * time.Millisecond):
+    }
+
+    close(release)
+    <-sent
+    channel.wg.Wait()
+    assert.Equal(t, int32(4), atomic.LoadInt32(&count))
+}
+
+func TestChannel_QueueDropPolicies(t *testing.T) {
+    for _, policy := range []OverflowPolicy{OverflowDropOldest, OverflowDropNewest, OverflowError} {
+        channel := newQueuedTestChannel(WithHandlerQueue(2, policy))
+        var deadLetters []int
+        channel.deadLetterHandler = func(deadLetter *DeadLetter) {
+            assert.Equal(t, DeadLetterQueueOverflow, deadLetter.Reason)
+            deadLetters = append(deadLetters, deadLetter.Message.Payload.(int))
+        }
+
+        release := make(chan bool)
+        var lock sync.Mutex
+        var received []int
+        id := uuid.New()
+        channel.subscribeHandler(&channelEventHandler{callBackFunction: func(message *model.Message) {
+            <-release
+            lock.Lock()
+            received = append(received, message.Payload.(int))
+            lock.Unlock()
+        }, uuid: &id})
+
+        // wait for the first message to be picked up by the worker.
+        channel.Send(model.GenerateResponse(&model.MessageConfig{Payload: 0}))
+        for channel.eventHandlers[0].queue.len() > 0 {
+            time.Sleep(time.Millisecond)
+        }
+
+        var errs []error
+        for i := 1; i < 5; i++ {
+            if err := channel.SendWithError(model.GenerateResponse(&model.MessageConfig{Payload: i})); err != nil {
+                errs = append(errs, err)
+            }
+        }
+
+        close(release)
+        channel.wg.Wait()
+
+        switch policy {
+        case OverflowDropOldest:
+            assert.Equal(t, []int{0, 3, 4}, received)
+            assert.Equal(t, []int{1, 2}, deadLetters)
+            assert.Empty(t, errs)
+        case OverflowDropNewest:
+            assert.Equal(t, []int{0, 1, 2}, received)
+            assert.Equal(t, []int{3, 4}, deadLetters)
+            assert.Empty(t, errs)
+        case OverflowError:
+            assert.Equal(t, []int{0, 1, 2}, received)
+            assert.Empty(t, deadLetters)
+            assert.Equal(t, []error{ErrHandlerQueueFull, ErrHandlerQueueFull}, errs)
+        }
+    }
+}
+
+func TestChannel_QueueConcurrency(t *testing.T) {
+    channel := newQueuedTestChannel(WithHandlerQueue(10, OverflowBlock), WithHandlerConcurrency(3))
+
+    var active, maxActive int32
+    id := uuid.New()
+    channel.subscribeHandler(&channelEventHandler{callBackFunction: func(message *model.Message) {
+        current := atomic.AddInt32(&active, 1)
+        for {
+            max := atomic.LoadInt32(&maxActive)
+            if current <= max || atomic.CompareAndSwapInt32(&maxActive, max, current) {
+                break
+            }
+        }
+        time.Sleep(5 * time.Millisecond)
+        atomic.AddInt32(&active, -1)
+    }, uuid: &id})
+
+    for i := 0; i < 9; i++ {
+        channel.Send(model.GenerateResponse(&model.MessageConfig{Payload: i}))
+    }
+    channel.wg.Wait()
+    assert.True(t, atomic.LoadInt32(&maxActive) > 1)
+    assert.True(t, atomic.LoadInt32(&maxActive) <= 3)
+}
+
+func TestChannel_QueueClosedOnUnsubscribe(t *testing.T) {
+    channel := newQueuedTestChannel(WithOrderedDelivery())
+    id := uuid.New()
+    var count int32
+    channel.subscribeHandler(&channelEventHandler{callBackFunction: func(message *model.Message) {
+        atomic.AddInt32(&count, 1)
+    }, uuid: &id})
+    queue := channel.eventHandlers[0].queue
+
+    channel.Send(model.GenerateResponse(&model.MessageConfig{Payload: 1}))
+    channel.wg.Wait()
+    assert.True(t, channel.unsubscribeHandler(&id))
+
+    dropped, overflowed, err := queue.push(model.GenerateResponse(&model.MessageConfig{Payload: 2}))
+    assert.NotNil(t, dropped)
+    assert.False(t, overflowed)
+    assert.Nil(t, err)
+    assert.Equal(t, int32(1), atomic.LoadInt32(&count))
+}
+
+func TestChannel_HandlerPanic(t *testing.T) {
+    manager, bus := createManager()
+
+    panicEvents := make(chan *MonitorEvent, 1)
+    bus.AddMonitorEventListener(func(evt *MonitorEvent) {
+        panicEvents <- evt
+    }, HandlerPanicEvt)
+
+    channel := manager.CreateChannel(testChannelName)
+    var received int32
+    manager.SubscribeChannelHandler(testChannelName, func(msg *model.Message) {
+        panic("handler failure")
+    }, false)
+    manager.SubscribeChannelHandler(testChannelName, func(msg *model.Message) {
+        atomic.AddInt32(&received, 1)
+    }, false)
+
+    msg := model.GenerateResponse(&model.MessageConfig{Channel: testChannelName, Payload: "payload"})
+    channel.Send(msg)
+    channel.wg.Wait()
+
+    // the other handlers still receive the message.
+    assert.Equal(t, int32(1), atomic.LoadInt32(&received))
+
+    evt := <-panicEvents
+    assert.Equal(t, testChannelName, evt.EntityName)
+    handlerPanic := evt.Data.(*HandlerPanic)
+    assert.EqualError(t, handlerPanic.Error, "handler panic: handler failure")
+    assert.Equal(t, msg, handlerPanic.Message)
+    assert.NotEmpty(t, handlerPanic.Stack)
+}
@@ -0,0 +1,50 @@
+// Copyright 2019-2020 VMware, Inc.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package bus
+
+import (
+    "github.com/vmware/transport-go/model"
+    "time"
+)
+
+// Reason why a message could not be delivered.
+type DeadLetterReason int
+
+const (
+    // The message expired before it was delivered to a handler.
+    DeadLetterExpired DeadLetterReason = iota
+    // The channel had no handlers when the message was sent.
+    DeadLetterNoHandlers
+    // A handler panicked while processing the message.
+    DeadLetterHandlerPanic
+    // The message was dropped from a full handler queue by the OverflowDropOldest
+    // or OverflowDropNewest policy.
+    DeadLetterQueueOverflow
+)
+
+func (r DeadLetterReason) String() string {
+    switch r {
+    case DeadLetterExpired:
+        return "expired"
+    case DeadLetterNoHandlers:
+        return "no handlers"
+    case DeadLetterHandlerPanic:
+        return "handler panic"
+    case DeadLetterQueueOverflow:
+        return "queue overflow"
+    }
+    return "unknown"
+}
+
+// DeadLetter wraps a message which could not be delivered. It is the payload of the response
+// messages sent to a dead letter channel and the data of ChannelMessageDeadLetteredEvt monitor events.
+type DeadLetter struct {
+    // Name of the channel the message was sent on
+    Channel string
+    Reason  DeadLetterReason
+    // The value of the recovered panic for DeadLetterHandlerPanic, otherwise nil
+    Error   error
+    Message *model.Message
+    Time    time.Time
+}
@@ -0,0 +1,170 @@
+// Copyright 2019-2020 VMware, Inc.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package bus
+
+import (
+    "fmt"
+    "github.com/vmware/transport-go/stompserver"
+    "strings"
+    "sync"
+)
+
+// EndpointAccessPolicy decides which fabric endpoint clients can subscribe to or
+// send requests on a channel.
+type EndpointAccessPolicy interface {
+    // Returns true if the principal can perform the action on the channel. principal is
+    // nil for anonymous clients, i.e. when the endpoint has no Authenticator configured.
+    IsAllowed(principal *stompserver.Principal, action stompserver.DestinationAction, channel string) bool
+}
+
+// Adapter which allows the use of ordinary functions as EndpointAccessPolicy.
+type EndpointAccessPolicyFunc func(
+        principal *stompserver.Principal, action stompserver.DestinationAction, channel string) bool
+
+func (f EndpointAccessPolicyFunc) IsAllowed(
+        principal *stompserver.Principal, action stompserver.DestinationAction, channel string) bool {
+    return f(principal, action, channel)
+}
+
+// Placeholder in AccessRule.ChannelPattern replaced with the name of the principal.
+const PrincipalNamePlaceholder = "{principal}"
+
+// AccessRule allows or denies actions on the channels matching a pattern.
+type AccessRule struct {
+    // Channel name pattern in ChannelPattern syntax, e.g. "tenant-a-*" or "tenant/+/events".
+    // The {principal} placeholder is replaced with the principal name, e.g. "private-{principal}",
+    // principal names containing wildcard characters never match it.
+    ChannelPattern string
+    // Names of the principals the rule applies to. "*" matches any authenticated principal
+    // and an empty list matches all clients, including the anonymous ones.
+    Principals []string
+    // The actions the rule applies to, an empty list matches all actions.
+    Actions []stompserver.DestinationAction
+    // Allow or deny the matching actions.
+    Allow bool
+}
+
+func (r *AccessRule) matches(principal *stompserver.Principal,
+        action stompserver.DestinationAction, channel string, patterns *sync.Map) bool {
+
+    if len(r.Actions) > 0 {
+        found := false
+        for _, a := range r.Actions {
+            if a == action {
+                found = true
+                break
+            }
+        }
+        if !found {
+            return false
+        }
+    }
+
+    if len(r.Principals) > 0 {
+        if principal == nil {
+            return false
+        }
+        found := false
+        for _, name := range r.Principals {
+            if name == "*" || name == principal.Name {
+                found = true
+                break
+            }
+        }
+        if !found {
+            return false
+        }
+    }
+
+    if strings.Contains(r.ChannelPattern, PrincipalNamePlaceholder) {
+        if principal == nil || IsChannelPattern(principal.Name) {
+            return false
+        }
+        pattern, err := NewChannelPattern(
+            strings.ReplaceAll(r.ChannelPattern, PrincipalNamePlaceholder, principal.Name))
+        return err == nil && pattern.Matches(channel)
+    }
+
+    pattern, ok := patterns.Load(r.ChannelPattern)
+    if !ok {
+        compiled, err := NewChannelPattern(r.ChannelPattern)
+        if err != nil {
+            return false
+        }
+        pattern, _ = patterns.LoadOrStore(r.ChannelPattern, compiled)
+    }
+    return pattern.(*ChannelPattern).Matches(channel)
+}
+
+// RuleAccessPolicy evaluates its rules in order, the first matching rule decides.
+// DefaultAllow is used if no rule matches.
+type RuleAccessPolicy struct {
+    Rules        []AccessRule
+    DefaultAllow bool
+    // compiled channel patterns of the rules
+    patterns     sync.Map
+}
+
+func (p *RuleAccessPolicy) IsAllowed(
+        principal *stompserver.Principal, action stompserver.DestinationAction, channel string) bool {
+
+    for i := range p.Rules {
+        if p.Rules[i].matches(principal, action, channel, &p.patterns) {
+            return p.Rules[i].Allow
+        }
+    }
+    return p.DefaultAllow
+}
+
+// Data of FabricEndpointAccessDeniedEvt monitor events.
+type EndpointAccessDenied struct {
+    ConnectionId string
+    // Name of the principal, empty for anonymous clients
+    Principal    string
+    Action       stompserver.DestinationAction
+    Destination  string
+}
+
+// stompserver.Authorizer implementation which enforces the endpoint access policy.
+func (fe *fabricEndpoint) authorize(connectionId string, principal *stompserver.Principal,
+        action stompserver.DestinationAction, destination string) error {
+
+    channelName, ok := fe.getChannelNameFromDestination(destination)
+    if !ok {
+        // not a bus channel, check the raw destination
+        channelName = destination
+    }
+
+    if fe.config.AccessPolicy.IsAllowed(principal, action, channelName) {
+        return nil
+    }
+
+    deniedEvt := &EndpointAccessDenied{
+        ConnectionId: connectionId,
+        Action:       action,
+        Destination:  destination,
+    }
+    if principal != nil {
+        deniedEvt.Principal = principal.Name
+    }
+    fe.bus.SendMonitorEvent(FabricEndpointAccessDeniedEvt, channelName, deniedEvt)
+    return fmt.Errorf("%s on channel '%s' is not allowed", action, channelName)
+}
+
+// Returns the channel name of a subscription or an application request destination.
+func (fe *fabricEndpoint) getChannelNameFromDestination(destination string) (string, bool) {
+    if channelName, ok := fe.getChannelNameFromSubscription(destination); ok {
+        return channelName, true
+    }
+    if fe.config.QueuePrefix != "" && strings.HasPrefix(destination, fe.config.QueuePrefix) {
+        return destination[len(fe.config.QueuePrefix):], true
+    }
+    if fe.config.AppRequestQueuePrefix != "" && strings.HasPrefix(destination, fe.config.AppRequestQueuePrefix) {
+        return destination[len(fe.config.AppRequestQueuePrefix):], true
+    }
+    if fe.config.AppRequestPrefix != "" && strings.HasPrefix(destination, fe.config.AppRequestPrefix) {
+        return destination[len(fe.config.AppRequestPrefix):], true
+    }
+    return "", false
+}
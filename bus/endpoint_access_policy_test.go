@@ -0,0 +1,110 @@
+// Copyright 2019-2020 VMware, Inc.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package bus
+
+import (
+    "github.com/stretchr/testify/assert"
+    "github.com/vmware/transport-go/stompserver"
+    "testing"
+)
+
+func TestRuleAccessPolicy_IsAllowed(t *testing.T) {
+    policy := &RuleAccessPolicy{
+        Rules: []AccessRule{
+            {ChannelPattern: "public-*", Actions: []stompserver.DestinationAction{stompserver.SubscribeAction}, Allow: true},
+            {ChannelPattern: "private-{principal}", Principals: []string{"*"}, Allow: true},
+            {ChannelPattern: "tenant-a-*", Principals: []string{"alice", "bob"}, Allow: true},
+            {ChannelPattern: "tenant-a-*", Allow: false},
+            {ChannelPattern: "admin", Principals: []string{"root"}, Actions: []stompserver.DestinationAction{stompserver.SendAction}, Allow: true},
+            {ChannelPattern: "events/+/public", Actions: []stompserver.DestinationAction{stompserver.SubscribeAction}, Allow: true},
+        },
+        DefaultAllow: false,
+    }
+
+    alice := &stompserver.Principal{Name: "alice"}
+    eve := &stompserver.Principal{Name: "eve"}
+    root := &stompserver.Principal{Name: "root"}
+
+    assert.True(t, policy.IsAllowed(nil, stompserver.SubscribeAction, "public-news"))
+    assert.False(t, policy.IsAllowed(nil, stompserver.SendAction, "public-news"))
+
+    assert.True(t, policy.IsAllowed(alice, stompserver.SendAction, "private-alice"))
+    assert.False(t, policy.IsAllowed(eve, stompserver.SubscribeAction, "private-alice"))
+    assert.False(t, policy.IsAllowed(nil, stompserver.SubscribeAction, "private-alice"))
+
+    assert.True(t, policy.IsAllowed(alice, stompserver.SubscribeAction, "tenant-a-orders"))
+    assert.False(t, policy.IsAllowed(eve, stompserver.SubscribeAction, "tenant-a-orders"))
+    assert.False(t, policy.IsAllowed(nil, stompserver.SendAction, "tenant-a-orders"))
+
+    // principal names are matched literally
+    assert.False(t, policy.IsAllowed(&stompserver.Principal{Name: "*"}, stompserver.SubscribeAction, "private-alice"))
+
+    assert.True(t, policy.IsAllowed(nil, stompserver.SubscribeAction, "events/vm/public"))
+    assert.False(t, policy.IsAllowed(nil, stompserver.SubscribeAction, "events/vm/1/public"))
+    assert.True(t, policy.IsAllowed(nil, stompserver.SubscribeAction, "public-news/today"))
+
+    assert.True(t, policy.IsAllowed(root, stompserver.SendAction, "admin"))
+    assert.False(t, policy.IsAllowed(root, stompserver.SubscribeAction, "admin"))
+
+    assert.False(t, policy.IsAllowed(alice, stompserver.SubscribeAction, "unknown-channel"))
+    policy.DefaultAllow = true
+    assert.True(t, policy.IsAllowed(alice, stompserver.SubscribeAction, "unknown-channel"))
+}
+
+func TestFabricEndpoint_Authorize(t *testing.T) {
+    bus := newTestEventBus()
+    fe, _ := newTestFabricEndpoint(bus, EndpointConfig{
+        TopicPrefix:           "/topic",
+        AppRequestPrefix:      "/pub",
+        AppRequestQueuePrefix: "/pub/queue",
+        UserQueuePrefix:       "/user/queue",
+        QueuePrefix:           "/queue",
+        AccessPolicy: &RuleAccessPolicy{
+            Rules: []AccessRule{
+                {ChannelPattern: "tenant-a-*", Principals: []string{"alice"}, Allow: true},
+            },
+        },
+    })
+
+    var events []*MonitorEvent
+    bus.AddMonitorEventListener(func(event *MonitorEvent) {
+        events = append(events, event)
+    }, FabricEndpointAccessDeniedEvt)
+
+    alice := &stompserver.Principal{Name: "alice"}
+    eve := &stompserver.Principal{Name: "eve"}
+
+    assert.Nil(t, fe.authorize("con1", alice, stompserver.SubscribeAction, "/topic/tenant-a-orders"))
+    assert.Nil(t, fe.authorize("con1", alice, stompserver.SubscribeAction, "/user/queue/tenant-a-orders"))
+    assert.Nil(t, fe.authorize("con1", alice, stompserver.SendAction, "/pub/tenant-a-orders"))
+    assert.Nil(t, fe.authorize("con1", alice, stompserver.SendAction, "/pub/queue/tenant-a-orders"))
+    assert.Nil(t, fe.authorize("con1", alice, stompserver.SendAction, "/queue/tenant-a-orders"))
+    assert.Equal(t, 0, len(events))
+
+    err := fe.authorize("con2", eve, stompserver.SubscribeAction, "/topic/tenant-a-orders")
+    assert.EqualError(t, err, "subscribe on channel 'tenant-a-orders' is not allowed")
+    err = fe.authorize("con3", nil, stompserver.SendAction, "/pub/queue/tenant-a-orders")
+    assert.EqualError(t, err, "send on channel 'tenant-a-orders' is not allowed")
+    assert.NotNil(t, fe.authorize("con2", eve, stompserver.SendAction, "/other/destination"))
+
+    assert.Equal(t, []*MonitorEvent{
+        NewMonitorEvent(FabricEndpointAccessDeniedEvt, "tenant-a-orders", &EndpointAccessDenied{
+            ConnectionId: "con2",
+            Principal:    "eve",
+            Action:       stompserver.SubscribeAction,
+            Destination:  "/topic/tenant-a-orders",
+        }),
+        NewMonitorEvent(FabricEndpointAccessDeniedEvt, "tenant-a-orders", &EndpointAccessDenied{
+            ConnectionId: "con3",
+            Action:       stompserver.SendAction,
+            Destination:  "/pub/queue/tenant-a-orders",
+        }),
+        NewMonitorEvent(FabricEndpointAccessDeniedEvt, "/other/destination", &EndpointAccessDenied{
+            ConnectionId: "con2",
+            Principal:    "eve",
+            Action:       stompserver.SendAction,
+            Destination:  "/other/destination",
+        }),
+    }, events)
+}
@@ -4,9 +4,11 @@
 package bus
 
 import (
+	"context"
 	"fmt"
 	"github.com/google/uuid"
 	"github.com/vmware/transport-go/bridge"
+	"github.com/vmware/transport-go/log"
 	"github.com/vmware/transport-go/model"
 	"github.com/vmware/transport-go/stompserver"
 	"sync"
@@ -21,6 +23,12 @@ type EventBus interface {
 	SendRequestMessage(channelName string, payload interface{}, destinationId *uuid.UUID) error
 	SendResponseMessage(channelName string, payload interface{}, destinationId *uuid.UUID) error
 	SendErrorMessage(channelName string, err error, destinationId *uuid.UUID) error
+	SendRequestMessageWithHeaders(
+		channelName string, payload interface{}, destinationId *uuid.UUID, headers []model.MessageHeader) error
+	SendResponseMessageWithHeaders(
+		channelName string, payload interface{}, destinationId *uuid.UUID, headers []model.MessageHeader) error
+	SendErrorMessageWithHeaders(
+		channelName string, err error, destinationId *uuid.UUID, headers []model.MessageHeader) error
 	ListenStream(channelName string) (MessageHandler, error)
 	ListenStreamForDestination(channelName string, destinationId *uuid.UUID) (MessageHandler, error)
 	ListenFirehose(channelName string) (MessageHandler, error)
@@ -32,6 +40,9 @@ type EventBus interface {
 	ListenOnceForDestination(channelName string, destId *uuid.UUID) (MessageHandler, error)
 	RequestOnce(channelName string, payload interface{}) (MessageHandler, error)
 	RequestOnceForDestination(channelName string, payload interface{}, destId *uuid.UUID) (MessageHandler, error)
+	RequestOnceWithContext(ctx context.Context, channelName string, payload interface{}) (*model.Message, error)
+	RequestOnceForDestinationWithContext(
+		ctx context.Context, channelName string, payload interface{}, destId *uuid.UUID) (*model.Message, error)
 	RequestStream(channelName string, payload interface{}) (MessageHandler, error)
 	RequestStreamForDestination(channelName string, payload interface{}, destId *uuid.UUID) (MessageHandler, error)
 	ConnectBroker(config *bridge.BrokerConnectorConfig) (conn bridge.Connection, err error)
@@ -43,6 +54,10 @@ type EventBus interface {
 	AddMonitorEventListener(listener MonitorEventHandler, eventTypes ...MonitorEventType) MonitorEventListenerId
 	RemoveMonitorEventListener(listenerId MonitorEventListenerId)
 	SendMonitorEvent(evtType MonitorEventType, entityName string, data interface{})
+	// Set the logger of the bus, its channels, stores, fabric endpoint and broker connections.
+	SetLogger(logger log.Logger)
+	// Returns the logger of the bus, log.Default() if no logger was set.
+	GetLogger() log.Logger
 }
 
 var enableLogging bool = false
@@ -78,6 +93,8 @@ type transportEventBus struct {
 	initStoreSync     sync.Once
 	storeSyncService  *storeSyncService
 	monitor           *bifrostMonitor
+	loggerLock        sync.RWMutex
+	logger            log.Logger
 }
 
 type MonitorEventListenerId int
@@ -87,6 +104,14 @@ type bifrostMonitor struct {
 	listenersByType       map[MonitorEventType]map[MonitorEventListenerId]MonitorEventHandler
 	listenersForAllEvents map[MonitorEventListenerId]MonitorEventHandler
 	subId                 MonitorEventListenerId
+	// number of listeners receiving the per-message events, the channels skip
+	// these events while there are none.
+	messageListeners      int32
+}
+
+// Returns true if the event type is sent for every message handled by a channel.
+func isPerMessageEvent(eventType MonitorEventType) bool {
+	return eventType == ChannelMessageSentEvt || eventType == ChannelMessageHandledEvt
 }
 
 func newMonitor() *bifrostMonitor {
@@ -103,7 +128,14 @@ func (m *bifrostMonitor) addListener(listener MonitorEventHandler, eventTypes []
 	m.subId++
 	if len(eventTypes) == 0 {
 		m.listenersForAllEvents[m.subId] = listener
+		atomic.AddInt32(&m.messageListeners, 1)
 	} else {
+		for _, eventType := range eventTypes {
+			if isPerMessageEvent(eventType) {
+				atomic.AddInt32(&m.messageListeners, 1)
+				break
+			}
+		}
 		for _, eventType := range eventTypes {
 			listeners, ok := m.listenersByType[eventType]
 			if !ok {
@@ -121,10 +153,21 @@ func (m *bifrostMonitor) removeListener(listenerId MonitorEventListenerId) {
 	m.lock.Lock()
 	defer m.lock.Unlock()
 
+	_, receivesMessageEvents := m.listenersForAllEvents[listenerId]
 	delete(m.listenersForAllEvents, listenerId)
-	for _, listeners := range m.listenersByType {
+	for eventType, listeners := range m.listenersByType {
+		if _, ok := listeners[listenerId]; ok && isPerMessageEvent(eventType) {
+			receivesMessageEvents = true
+		}
 		delete(listeners, listenerId)
 	}
+	if receivesMessageEvents {
+		atomic.AddInt32(&m.messageListeners, -1)
+	}
+}
+
+func (m *bifrostMonitor) hasMessageListeners() bool {
+	return atomic.LoadInt32(&m.messageListeners) > 0
 }
 
 func (m *bifrostMonitor) sendEvent(event *MonitorEvent) {
@@ -152,10 +195,26 @@ func (bus *transportEventBus) init() {
 	bus.bc = bridge.NewBrokerConnector()
 	bus.monitor = newMonitor()
 	if enableLogging {
-		fmt.Printf("🌈 Transport booted with Id [%s]\n", bus.Id.String())
+		bus.GetLogger().Info("transport booted", "bus.id", bus.Id.String())
 	}
 }
 
+func (bus *transportEventBus) SetLogger(logger log.Logger) {
+	bus.loggerLock.Lock()
+	bus.logger = logger
+	bus.loggerLock.Unlock()
+	bus.bc.SetLogger(logger)
+}
+
+func (bus *transportEventBus) GetLogger() log.Logger {
+	bus.loggerLock.RLock()
+	defer bus.loggerLock.RUnlock()
+	if bus.logger == nil {
+		return log.Default()
+	}
+	return bus.logger
+}
+
 func (bus *transportEventBus) GetStoreManager() StoreManager {
 	return bus.storeManager
 }
@@ -168,40 +227,64 @@ func (bus *transportEventBus) GetChannelManager() ChannelManager {
 // Send a ResponseDir type (inbound) message on Channel, with supplied Payload.
 // Throws error if the Channel does not exist.
 func (bus *transportEventBus) SendResponseMessage(channelName string, payload interface{}, destId *uuid.UUID) error {
+	return bus.SendResponseMessageWithHeaders(channelName, payload, destId, nil)
+}
+
+// Send a ResponseDir type (inbound) message on Channel, with supplied Payload and message headers.
+// Throws error if the Channel does not exist.
+func (bus *transportEventBus) SendResponseMessageWithHeaders(
+	channelName string, payload interface{}, destId *uuid.UUID, headers []model.MessageHeader) error {
+
 	channelObject, err := bus.ChannelManager.GetChannel(channelName)
 	if err != nil {
 		return err
 	}
 	config := buildConfig(channelName, payload, destId)
+	config.Headers = headers
 	message := model.GenerateResponse(config)
-	sendMessageToChannel(channelObject, message)
-	return nil
+	return sendMessageToChannel(channelObject, message)
 }
 
 // Send a RequestDir type message (outbound) message on Channel, with supplied Payload.
 // Throws error if the Channel does not exist.
 func (bus *transportEventBus) SendRequestMessage(channelName string, payload interface{}, destId *uuid.UUID) error {
+	return bus.SendRequestMessageWithHeaders(channelName, payload, destId, nil)
+}
+
+// Send a RequestDir type message (outbound) message on Channel, with supplied Payload and message headers.
+// Throws error if the Channel does not exist.
+func (bus *transportEventBus) SendRequestMessageWithHeaders(
+	channelName string, payload interface{}, destId *uuid.UUID, headers []model.MessageHeader) error {
+
 	channelObject, err := bus.ChannelManager.GetChannel(channelName)
 	if err != nil {
 		return err
 	}
 	config := buildConfig(channelName, payload, destId)
+	config.Headers = headers
 	message := model.GenerateRequest(config)
-	sendMessageToChannel(channelObject, message)
-	return nil
+	return sendMessageToChannel(channelObject, message)
 }
 
 // Send a ErrorDir type message (outbound) message on Channel, with supplied error
 // Throws error if the Channel does not exist.
 func (bus *transportEventBus) SendErrorMessage(channelName string, err error, destId *uuid.UUID) error {
+	return bus.SendErrorMessageWithHeaders(channelName, err, destId, nil)
+}
+
+// Send a ErrorDir type message (outbound) message on Channel, with supplied error and message headers.
+// Throws error if the Channel does not exist.
+func (bus *transportEventBus) SendErrorMessageWithHeaders(
+	channelName string, err error, destId *uuid.UUID, headers []model.MessageHeader) error {
+
 	channelObject, chanErr := bus.ChannelManager.GetChannel(channelName)
 	if chanErr != nil {
-		return err
+		return chanErr
 	}
 	config := buildError(channelName, err, destId)
+	config.Headers = headers
 	message := model.GenerateError(config)
-	sendMessageToChannel(channelObject, message)
-	return nil
+	return sendMessageToChannel(channelObject, message)
 }
 
 // Listen to stream of ResponseDir (inbound) messages on Channel. Will keep on ticking until closed.
@@ -381,6 +464,74 @@ func (bus *transportEventBus) RequestOnceForDestination(
 	return messageHandler, nil
 }
 
+// Send a request message with Payload and block until a single response message arrives, or until the
+// context is cancelled or its deadline passes. The response handler is unsubscribed in every case.
+// Returns the response message, or an error if the Channel is unknown, an error message was received
+// or the context is done.
+func (bus *transportEventBus) RequestOnceWithContext(
+	ctx context.Context, channelName string, payload interface{}) (*model.Message, error) {
+
+	handler, err := bus.RequestOnce(channelName, payload)
+	if err != nil {
+		return nil, err
+	}
+	return waitForResponseWithContext(ctx, handler)
+}
+
+// Send a request message with Payload for a targeted DestinationId and block until a single response
+// message arrives, or until the context is cancelled or its deadline passes. The response handler is
+// unsubscribed in every case.
+// Returns the response message, or an error if the Channel is unknown, an error message was received
+// or the context is done.
+func (bus *transportEventBus) RequestOnceForDestinationWithContext(
+	ctx context.Context, channelName string, payload interface{}, destId *uuid.UUID) (*model.Message, error) {
+
+	handler, err := bus.RequestOnceForDestination(channelName, payload, destId)
+	if err != nil {
+		return nil, err
+	}
+	return waitForResponseWithContext(ctx, handler)
+}
+
+func waitForResponseWithContext(ctx context.Context, handler MessageHandler) (*model.Message, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	// fail fast if the context is already done, there is no point sending the request.
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	responseChan := make(chan *model.Message, 1)
+	errorChan := make(chan error, 1)
+	handler.Handle(
+		func(msg *model.Message) {
+			responseChan <- msg
+		},
+		func(err error) {
+			errorChan <- err
+		})
+	// the handler unsubscribes itself after the first event, Close() takes care of the
+	// case where nothing arrived before the context was done.
+	defer handler.Close()
+
+	// don't use Fire(), it waits for all channel handlers to complete, which would block
+	// forever on a hung responder.
+	msgHandler := handler.(*messageHandler)
+	if err := sendMessageToChannel(msgHandler.channel, msgHandler.requestMessage); err != nil {
+		return nil, err
+	}
+
+	select {
+	case msg := <-responseChan:
+		return msg, nil
+	case err := <-errorChan:
+		return nil, err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
 func getChannelFromManager(bus *transportEventBus, channelName string) (*Channel, error) {
 	channelManager := bus.ChannelManager
 	channel, err := channelManager.GetChannel(channelName)
@@ -423,6 +574,18 @@ func (bus *transportEventBus) RequestStreamForDestination(
 
 // Connect to a message broker. If successful, you get a pointer to a Connection. If not, you will get an error.
 func (bus *transportEventBus) ConnectBroker(config *bridge.BrokerConnectorConfig) (conn bridge.Connection, err error) {
+	if config != nil {
+		// report connection state changes as monitor events in addition to the user handler.
+		busConfig := *config
+		userHandler := config.ConnectionStateHandler
+		busConfig.ConnectionStateHandler = func(c bridge.Connection, state bridge.ConnectionState, attempt int) {
+			if userHandler != nil {
+				userHandler(c, state, attempt)
+			}
+			bus.sendConnectionStateEvent(c, state, attempt)
+		}
+		config = &busConfig
+	}
 	conn, err = bus.bc.Connect(config, enableLogging)
 	if conn != nil {
 		bus.brokerConnections[conn.GetId()] = conn
@@ -430,6 +593,23 @@ func (bus *transportEventBus) ConnectBroker(config *bridge.BrokerConnectorConfig
 	return
 }
 
+func (bus *transportEventBus) sendConnectionStateEvent(conn bridge.Connection, state bridge.ConnectionState, attempt int) {
+	var evtType MonitorEventType
+	switch state {
+	case bridge.ConnectionLost:
+		evtType = BrokerConnectionLostEvt
+	case bridge.ConnectionReconnecting:
+		evtType = BrokerReconnectingEvt
+	case bridge.ConnectionReconnected:
+		evtType = BrokerReconnectedEvt
+	case bridge.ConnectionReconnectFailed:
+		evtType = BrokerReconnectFailedEvt
+	default:
+		return
+	}
+	bus.SendMonitorEvent(evtType, conn.GetId().String(), attempt)
+}
+
 // Start a new Fabric Endpoint
 func (bus *transportEventBus) StartFabricEndpoint(
 	connectionListener stompserver.RawConnectionListener, config EndpointConfig) error {
@@ -558,8 +738,8 @@ func checkForSuppliedId(id *uuid.UUID) *uuid.UUID {
 	return id
 }
 
-func sendMessageToChannel(channelObject *Channel, message *model.Message) {
-	channelObject.Send(message)
+func sendMessageToChannel(channelObject *Channel, message *model.Message) error {
+	return channelObject.SendWithError(message)
 }
 
 func buildConfig(channelName string, payload interface{}, destinationId *uuid.UUID) *model.MessageConfig {
@@ -4,17 +4,20 @@
 package bus
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"github.com/vmware/transport-go/bridge"
+	"github.com/vmware/transport-go/log"
 	"github.com/vmware/transport-go/model"
 	"github.com/vmware/transport-go/stompserver"
 	"sync"
 	"sync/atomic"
 	"testing"
+	"time"
 )
 
 var evtBusTest *transportEventBus
@@ -33,6 +36,9 @@ func (mock *MockBrokerConnector) Connect(config *bridge.BrokerConnectorConfig, e
 	return args.Get(0).(bridge.Connection), args.Error(1)
 }
 
+func (mock *MockBrokerConnector) SetLogger(logger log.Logger) {
+}
+
 func (mock *MockBrokerConnector) StartTCPServer(address string) error {
 	args := mock.MethodCalled("StartTCPServer", address)
 	return args.Error(0)
@@ -87,6 +93,11 @@ func TestEventBus_SendRequestMessageNoChannel(t *testing.T) {
 	assert.NotNil(t, err)
 }
 
+func TestEventBus_SendErrorMessageNoChannel(t *testing.T) {
+	err := evtBusTest.SendErrorMessage("Channel-not-here", errors.New("something went wrong"), nil)
+	assert.EqualError(t, err, "Channel does not exist: Channel-not-here")
+}
+
 func TestEventBus_ListenStream(t *testing.T) {
 	createTestChannel()
 	handler, err := evtBusTest.ListenStream(evtbusTestChannelName)
@@ -445,6 +456,102 @@ func TestEventBus_RequestOnceForDestination(t *testing.T) {
 	destroyTestChannel()
 }
 
+func TestEventBus_RequestOnceWithContext(t *testing.T) {
+	createTestChannel()
+	handler, _ := evtBusTest.ListenRequestStream(evtbusTestChannelName)
+	handler.Handle(
+		func(msg *model.Message) {
+			assert.Equal(t, "who is a pretty baby?", msg.Payload.(string))
+			evtBusTest.SendResponseMessage(evtbusTestChannelName, "why melody is of course", msg.DestinationId)
+		},
+		func(err error) {})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	msg, err := evtBusTest.RequestOnceWithContext(ctx, evtbusTestChannelName, "who is a pretty baby?")
+	assert.Nil(t, err)
+	assert.Equal(t, "why melody is of course", msg.Payload.(string))
+
+	handler.Close()
+	evtbusTestManager.WaitForChannel(evtbusTestChannelName)
+	ch, _ := evtbusTestManager.GetChannel(evtbusTestChannelName)
+	assert.False(t, ch.ContainsHandlers())
+	destroyTestChannel()
+}
+
+func TestEventBus_RequestOnceWithContextDeadline(t *testing.T) {
+	ch := createTestChannel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	msg, err := evtBusTest.RequestOnceWithContext(ctx, evtbusTestChannelName, "anyone there?")
+	assert.Nil(t, msg)
+	assert.Equal(t, context.DeadlineExceeded, err)
+	assert.False(t, ch.ContainsHandlers())
+	destroyTestChannel()
+}
+
+func TestEventBus_RequestOnceWithContextCancelled(t *testing.T) {
+	ch := createTestChannel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+	msg, err := evtBusTest.RequestOnceWithContext(ctx, evtbusTestChannelName, "anyone there?")
+	assert.Nil(t, msg)
+	assert.Equal(t, context.Canceled, err)
+	assert.False(t, ch.ContainsHandlers())
+
+	// already cancelled context should not send anything.
+	msg, err = evtBusTest.RequestOnceWithContext(ctx, evtbusTestChannelName, "anyone there?")
+	assert.Nil(t, msg)
+	assert.Equal(t, context.Canceled, err)
+	destroyTestChannel()
+}
+
+func TestEventBus_RequestOnceWithContextError(t *testing.T) {
+	createTestChannel()
+	handler, _ := evtBusTest.ListenRequestStream(evtbusTestChannelName)
+	handler.Handle(
+		func(msg *model.Message) {
+			evtBusTest.SendErrorMessage(evtbusTestChannelName, errors.New("no melody here"), msg.DestinationId)
+		},
+		func(err error) {})
+
+	msg, err := evtBusTest.RequestOnceWithContext(context.Background(), evtbusTestChannelName, "who is a pretty baby?")
+	assert.Nil(t, msg)
+	assert.EqualError(t, err, "no melody here")
+	handler.Close()
+	destroyTestChannel()
+}
+
+func TestEventBus_RequestOnceForDestinationWithContext(t *testing.T) {
+	createTestChannel()
+	dest := uuid.New()
+	handler, _ := evtBusTest.ListenRequestStream(evtbusTestChannelName)
+	handler.Handle(
+		func(msg *model.Message) {
+			evtBusTest.SendResponseMessage(evtbusTestChannelName, "why melody is of course", msg.DestinationId)
+		},
+		func(err error) {})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	msg, err := evtBusTest.RequestOnceForDestinationWithContext(
+		ctx, evtbusTestChannelName, "who is a pretty baby?", &dest)
+	assert.Nil(t, err)
+	assert.Equal(t, dest, *msg.DestinationId)
+
+	_, err = evtBusTest.RequestOnceForDestinationWithContext(ctx, evtbusTestChannelName, "hi", nil)
+	assert.NotNil(t, err)
+	_, err = evtBusTest.RequestOnceWithContext(ctx, "missing-Channel", "hi")
+	assert.NotNil(t, err)
+	handler.Close()
+	destroyTestChannel()
+}
+
 func TestEventBus_RequestOnceForDesintationNoChannel(t *testing.T) {
 	_, err := evtBusTest.RequestOnceForDestination("some-chan", nil, nil)
 	assert.NotNil(t, err)
@@ -606,13 +713,63 @@ func TestChannelManager_TestConnectBroker(t *testing.T) {
 	mockCon := &MockBridgeConnection{
 		Id: &id,
 	}
-	evtBusTest.bc.(*MockBrokerConnector).On("Connect", cf).Return(mockCon, nil)
+	var connectConfig *bridge.BrokerConnectorConfig
+	evtBusTest.bc.(*MockBrokerConnector).On("Connect", mock.Anything).Run(func(args mock.Arguments) {
+		connectConfig = args.Get(0).(*bridge.BrokerConnectorConfig)
+	}).Return(mockCon, nil)
 
 	c, _ := evtBusTest.ConnectBroker(cf)
 
 	assert.Equal(t, c, mockCon)
 	assert.Equal(t, len(evtBusTest.brokerConnections), 1)
 	assert.Equal(t, evtBusTest.brokerConnections[mockCon.Id], mockCon)
+
+	// the config is passed to the connector with a state handler reporting monitor events.
+	assert.Equal(t, cf.ServerAddr, connectConfig.ServerAddr)
+	assert.Equal(t, cf.Username, connectConfig.Username)
+	assert.True(t, connectConfig.UseWS)
+	assert.Nil(t, cf.ConnectionStateHandler)
+	assert.NotNil(t, connectConfig.ConnectionStateHandler)
+}
+
+func TestChannelManager_TestConnectBrokerStateEvents(t *testing.T) {
+	evtBusTest := newTestEventBus().(*transportEventBus)
+	evtBusTest.bc = new(MockBrokerConnector)
+
+	var handlerStates []bridge.ConnectionState
+	cf := &bridge.BrokerConnectorConfig{
+		ServerAddr: "broker-url",
+		ConnectionStateHandler: func(conn bridge.Connection, state bridge.ConnectionState, attempt int) {
+			handlerStates = append(handlerStates, state)
+		}}
+
+	id := uuid.New()
+	mockCon := &MockBridgeConnection{
+		Id: &id,
+	}
+	var connectConfig *bridge.BrokerConnectorConfig
+	evtBusTest.bc.(*MockBrokerConnector).On("Connect", mock.Anything).Run(func(args mock.Arguments) {
+		connectConfig = args.Get(0).(*bridge.BrokerConnectorConfig)
+	}).Return(mockCon, nil)
+
+	var events []*MonitorEvent
+	evtBusTest.AddMonitorEventListener(func(event *MonitorEvent) {
+		events = append(events, event)
+	}, BrokerConnectionLostEvt, BrokerReconnectingEvt, BrokerReconnectedEvt, BrokerReconnectFailedEvt)
+
+	evtBusTest.ConnectBroker(cf)
+
+	connectConfig.ConnectionStateHandler(mockCon, bridge.ConnectionLost, 0)
+	connectConfig.ConnectionStateHandler(mockCon, bridge.ConnectionReconnecting, 1)
+	connectConfig.ConnectionStateHandler(mockCon, bridge.ConnectionReconnected, 0)
+
+	assert.Equal(t, []bridge.ConnectionState{
+		bridge.ConnectionLost, bridge.ConnectionReconnecting, bridge.ConnectionReconnected}, handlerStates)
+	assert.Equal(t, []*MonitorEvent{
+		NewMonitorEvent(BrokerConnectionLostEvt, id.String(), 0),
+		NewMonitorEvent(BrokerReconnectingEvt, id.String(), 1),
+		NewMonitorEvent(BrokerReconnectedEvt, id.String(), 0),
+	}, events)
 }
 
 func TestEventBus_TestCreateSyncTransaction(t *testing.T) {
@@ -736,3 +893,75 @@ func TestBifrostEventBus_AddMonitorEventListener(t *testing.T) {
 	assert.Equal(t, listener2Count, 2)
 	assert.Equal(t, listener3Count, 5)
 }
+
+func TestEventBus_PerMessageMonitorEvents(t *testing.T) {
+	bus := newTestEventBus()
+	channel := bus.GetChannelManager().CreateChannel("test-channel")
+	assert.False(t, channel.isMessageMonitored())
+
+	listener1 := bus.AddMonitorEventListener(func(event *MonitorEvent) {}, ChannelCreatedEvt)
+	assert.False(t, channel.isMessageMonitored())
+
+	events := make(chan MonitorEventType, 10)
+	listener2 := bus.AddMonitorEventListener(func(event *MonitorEvent) {
+		events <- event.EventType
+	}, ChannelMessageSentEvt, ChannelMessageHandledEvt)
+	assert.True(t, channel.isMessageMonitored())
+
+	handler, _ := bus.ListenStream("test-channel")
+	handler.Handle(func(message *model.Message) {}, func(e error) {})
+	bus.SendResponseMessage("test-channel", "hello", nil)
+	assert.Equal(t, ChannelMessageSentEvt, <-events)
+	assert.Equal(t, ChannelMessageHandledEvt, <-events)
+
+	bus.RemoveMonitorEventListener(listener2)
+	assert.False(t, channel.isMessageMonitored())
+
+	listener3 := bus.AddMonitorEventListener(func(event *MonitorEvent) {})
+	assert.True(t, channel.isMessageMonitored())
+	bus.RemoveMonitorEventListener(listener3)
+	bus.RemoveMonitorEventListener(listener1)
+	assert.False(t, channel.isMessageMonitored())
+}
+
+func TestEventBus_SetLogger(t *testing.T) {
+	bus := newTestEventBus()
+	assert.Equal(t, log.Default(), bus.GetLogger())
+
+	records := make(chan *log.Record, 1)
+	logger := log.New(log.HandlerFunc(func(record *log.Record) {
+		records <- record
+	}), log.WarnLevel)
+	bus.SetLogger(logger)
+	assert.Equal(t, logger, bus.GetLogger())
+
+	bus.GetChannelManager().CreateChannel("logged-channel")
+	bus.GetChannelManager().SubscribeChannelHandler("logged-channel", func(msg *model.Message) {
+		panic("handler failure")
+	}, false)
+	bus.SendResponseMessage("logged-channel", "payload", nil)
+
+	record := <-records
+	assert.Equal(t, log.WarnLevel, record.Level)
+	assert.Equal(t, log.Field{Key: "channel", Value: "logged-channel"}, record.Fields[0])
+	assert.Equal(t, log.Field{Key: "error", Value: errors.New("handler panic: handler failure")}, record.Fields[1])
+}
+
+func TestEventBus_BootMessage(t *testing.T) {
+	var records []*log.Record
+	defaultLogger := log.Default()
+	log.SetDefault(log.New(log.HandlerFunc(func(record *log.Record) {
+		records = append(records, record)
+	}), log.InfoLevel))
+	EnableLogging(true)
+	defer func() {
+		EnableLogging(false)
+		log.SetDefault(defaultLogger)
+	}()
+
+	bus := newTestEventBus()
+	assert.Len(t, records, 1)
+	assert.Equal(t, log.InfoLevel, records[0].Level)
+	assert.Equal(t, "transport booted", records[0].Message)
+	assert.Equal(t, []log.Field{{Key: "bus.id", Value: bus.GetId().String()}}, records[0].Fields)
+}
@@ -4,12 +4,12 @@
 package bus
 
 import (
-    "encoding/json"
     "fmt"
     "github.com/go-stomp/stomp/frame"
     "github.com/vmware/transport-go/log"
     "github.com/vmware/transport-go/model"
     "github.com/vmware/transport-go/stompserver"
+    "github.com/vmware/transport-go/tracing"
     "strings"
     "sync"
 )
@@ -29,7 +29,30 @@ type EndpointConfig struct {
     // "/user/queue/sample-channel" destination.
     // This behavior will mimic the Spring SimpleMessageBroker implementation.
     AppRequestQueuePrefix string
+    // Optional prefix for queue destinations e.g. "/queue". Each message sent to a queue
+    // destination is delivered to only one of its subscribers, which allows load balancing
+    // the messages across multiple worker clients.
+    QueuePrefix           string
+    // Maximum number of messages buffered by a queue destination while it has no subscribers.
+    // Zero uses stompserver.DefaultQueueBufferSize and negative values disable the buffering.
+    QueueBufferSize       int
+    // Maximum number of open STOMP transactions per client connection.
+    // Zero uses stompserver.DefaultMaxTransactions and negative values remove the limit.
+    MaxTransactions       int
+    // Maximum number of frames buffered by a STOMP transaction.
+    // Zero uses stompserver.DefaultMaxTransactionFrames and negative values remove the limit.
+    MaxTransactionFrames  int
+    // Maximum number of unacknowledged messages tracked per client ack subscription.
+    // Zero uses stompserver.DefaultMaxPendingMessages and negative values remove the limit.
+    MaxPendingMessages    int
     Heartbeat             int64
+    // Optional authenticator for the CONNECT frames of the endpoint clients.
+    // If not set all client connections are accepted.
+    Authenticator         stompserver.Authenticator
+    // Optional policy controlling which clients can subscribe to or send requests on a channel.
+    // Denied frames are answered with an "access denied" ERROR frame and reported as
+    // FabricEndpointAccessDeniedEvt monitor events. If not set all frames are allowed.
+    AccessPolicy          EndpointAccessPolicy
 }
 
 func (ec *EndpointConfig) validate() error {
@@ -77,17 +100,38 @@ func newFabricEndpoint(bus EventBus,
     config.AppRequestPrefix = addPrefixIfNotEmpty(config.AppRequestPrefix, "/")
     config.AppRequestQueuePrefix = addPrefixIfNotEmpty(config.AppRequestQueuePrefix, "/")
     config.UserQueuePrefix = addPrefixIfNotEmpty(config.UserQueuePrefix, "/")
-
-    stompConf := stompserver.NewStompConfig(config.Heartbeat,
-            []string{config.AppRequestPrefix, config.AppRequestQueuePrefix})
+    config.QueuePrefix = addPrefixIfNotEmpty(config.QueuePrefix, "/")
 
     fabricEndpoint := &fabricEndpoint{
-        server:       stompserver.NewStompServer(conListener, stompConf),
         config:       config,
         bus:          bus,
         chanMappings: make(map[string]*channelMapping),
     }
 
+    var stompOptions []stompserver.StompConfigOption
+    if config.Authenticator != nil {
+        stompOptions = append(stompOptions, stompserver.WithAuthenticator(config.Authenticator))
+    }
+    if config.AccessPolicy != nil {
+        stompOptions = append(stompOptions, stompserver.WithAuthorizer(
+            stompserver.AuthorizerFunc(fabricEndpoint.authorize)))
+    }
+    if config.QueuePrefix != "" {
+        stompOptions = append(stompOptions,
+            stompserver.WithQueueDestinationPrefix(config.QueuePrefix),
+            stompserver.WithQueueBufferSize(config.QueueBufferSize))
+    }
+    stompOptions = append(stompOptions,
+        stompserver.WithMaxTransactions(config.MaxTransactions),
+        stompserver.WithMaxTransactionFrames(config.MaxTransactionFrames),
+        stompserver.WithMaxPendingMessages(config.MaxPendingMessages))
+    if bus != nil {
+        stompOptions = append(stompOptions, stompserver.WithLogger(bus.GetLogger()))
+    }
+    stompConf := stompserver.NewStompConfig(config.Heartbeat,
+            []string{config.AppRequestPrefix, config.AppRequestQueuePrefix}, stompOptions...)
+    fabricEndpoint.server = stompserver.NewStompServer(conListener, stompConf)
+
     fabricEndpoint.initHandlers()
     return fabricEndpoint
 }
@@ -101,9 +145,24 @@ func (fe *fabricEndpoint) Stop() {
 }
 
 func (fe *fabricEndpoint) initHandlers() {
-    fe.server.OnApplicationRequest(fe.bridgeMessage)
+    fe.server.OnApplicationRequestFrame(fe.bridgeMessage)
     fe.server.OnSubscribeEvent(fe.addSubscription)
     fe.server.OnUnsubscribeEvent(fe.removeSubscription)
+    fe.server.OnConnectionEvent(fe.handleConnectionEvent)
+}
+
+func (fe *fabricEndpoint) handleConnectionEvent(conId string, connected bool) {
+    if connected {
+        fe.logger().Debug("client connected", "connection.id", conId)
+        fe.bus.SendMonitorEvent(FabricEndpointConnectedEvt, conId, nil)
+    } else {
+        fe.logger().Debug("client disconnected", "connection.id", conId)
+        fe.bus.SendMonitorEvent(FabricEndpointDisconnectedEvt, conId, nil)
+    }
+}
+
+func (fe *fabricEndpoint) logger() log.Logger {
+    return fe.bus.GetLogger()
 }
 
 func (fe *fabricEndpoint) addSubscription(
@@ -125,23 +184,24 @@ func (fe *fabricEndpoint) addSubscription(
             fe.bus.GetChannelManager().CreateChannel(channelName)
             messageHandler, err = fe.bus.ListenStream(channelName)
             if messageHandler == nil || err != nil {
-                log.Warn("Unable to auto-create channel for destination: %s", destination)
+                fe.logger().Warn("unable to auto-create channel for destination",
+                    "channel", channelName, "destination", destination, "connection.id", conId)
                 return
             }
             autoCreated = true
         }
         messageHandler.Handle(
             func(message *model.Message) {
-                data, err := marshalMessagePayload(message)
+                data, headers, err := encodeMessage(message)
                 if err == nil {
                     resp, ok := convertPayloadToResponseObj(message)
                     if ok && resp != nil && resp.BrokerDestination != nil {
-                        fe.server.SendMessageToClient(
+                        fe.server.SendMessageToClientWithHeaders(
                             resp.BrokerDestination.ConnectionId,
                             resp.BrokerDestination.Destination,
-                            data)
+                            data, headers)
                     } else {
-                        fe.server.SendMessage(fe.config.TopicPrefix + channelName, data)
+                        fe.server.SendMessageWithHeaders(fe.config.TopicPrefix + channelName, data, headers)
                     }
                 }
             },
@@ -179,18 +239,40 @@ func convertPayloadToResponseObj(message *model.Message) (*model.Response, bool)
     return nil, false
 }
 
-func marshalMessagePayload(message *model.Message) ([]byte, error) {
+// Encodes the message payload and returns it with the message headers. The content-type
+// header is set to the content type of the codec which encoded the payload.
+func encodeMessage(message *model.Message) ([]byte, map[string]string, error) {
+    data, contentType, err := marshalMessagePayload(message)
+    if err != nil {
+        return nil, nil, err
+    }
+    headers := model.MessageHeadersToMap(message.Headers)
+    if contentType != "" {
+        if headers == nil {
+            headers = make(map[string]string)
+        }
+        headers[frame.ContentType] = contentType
+    }
+    return data, headers, nil
+}
+
+// Returns the encoded message payload and the content type of the codec used to encode it.
+// The content type is empty for string and []byte payloads, which are sent as is.
+func marshalMessagePayload(message *model.Message) ([]byte, string, error) {
     // don't marshal string and []byte payloads
     stringPayload, ok := message.Payload.(string)
     if ok {
-        return []byte(stringPayload), nil
+        return []byte(stringPayload), "", nil
     }
     bytePayload, ok := message.Payload.([]byte)
     if ok {
-        return bytePayload, nil
+        return bytePayload, "", nil
     }
-    // encode the message payload as JSON
-    return json.Marshal(message.Payload)
+    // encode the message payload with the codec for the message content type (JSON by default)
+    contentType, _ := message.GetHeader(frame.ContentType)
+    codec := model.GetCodecOrDefault(contentType)
+    data, err := codec.Marshal(message.Payload)
+    return data, codec.ContentType(), err
 }
 
 func (fe *fabricEndpoint) removeSubscription(conId string, subId string, destination string) {
@@ -222,7 +304,33 @@ func (fe *fabricEndpoint) removeSubscription(conId string, subId string, destina
     }
 }
 
-func (fe *fabricEndpoint) bridgeMessage(destination string, message []byte, connectionId string) {
+// STOMP headers describing the SEND frame itself, these are not passed on as request headers.
+var stompProtocolHeaders = map[string]bool{
+    frame.Destination: true,
+    frame.ContentLength: true,
+    frame.Receipt: true,
+    frame.Transaction: true,
+}
+
+// Returns the application headers of a STOMP frame.
+func getApplicationHeaders(f *frame.Frame) map[string]string {
+    headers := make(map[string]string)
+    if f == nil || f.Header == nil {
+        return headers
+    }
+    for i := 0; i < f.Header.Len(); i++ {
+        key, value := f.Header.GetAt(i)
+        if !stompProtocolHeaders[key] {
+            if _, exists := headers[key]; !exists {
+                // as per the STOMP spec, only the first occurrence of a repeated header is used.
+                headers[key] = value
+            }
+        }
+    }
+    return headers
+}
+
+func (fe *fabricEndpoint) bridgeMessage(destination string, f *frame.Frame, connectionId string) {
     var channelName string
     isPrivateRequest := false
 
@@ -236,9 +344,10 @@ func (fe *fabricEndpoint) bridgeMessage(destination string, message []byte, conn
     }
 
     var req model.Request
-    err := json.Unmarshal(message, &req)
+    err := model.GetCodecOrDefault(f.Header.Get(frame.ContentType)).Unmarshal(f.Body, &req)
     if err != nil {
-        log.Warn("Failed to deserialize request for channel %s", channelName)
+        fe.logger().Warn("failed to deserialize request",
+            "channel", channelName, "connection.id", connectionId, "error", err)
         return
     }
 
@@ -249,7 +358,49 @@ func (fe *fabricEndpoint) bridgeMessage(destination string, message []byte, conn
         }
     }
 
-    fe.bus.SendRequestMessage(channelName, &req, nil)
+    req.ClientIdentity = fe.getClientIdentity(connectionId)
+
+    // frame headers take precedence over the headers in the request body.
+    frameHeaders := getApplicationHeaders(f)
+    if len(frameHeaders) > 0 {
+        if req.Headers == nil {
+            req.Headers = make(map[string]string)
+        }
+        for k, v := range frameHeaders {
+            req.Headers[k] = v
+        }
+    }
+
+    // continue the trace of the client if the frame has a traceparent header, new traces
+    // are only started if the root sampler of the tracer samples them.
+    span := tracing.StartTracedSpan("fabric-endpoint "+channelName, tracing.ServerSpan,
+        model.TraceContextFromHeaders(model.MessageHeadersFromMap(req.Headers)))
+    if span != nil {
+        defer span.End()
+        span.SetAttribute("channel", channelName)
+        span.SetAttribute("destination", destination)
+        span.SetAttribute("connection.id", connectionId)
+        span.InjectRequest(&req)
+    }
+
+    err = fe.bus.SendRequestMessageWithHeaders(channelName, &req, nil, model.MessageHeadersFromMap(req.Headers))
+    if err != nil && span != nil {
+        span.SetError(err)
+    }
+}
+
+// Returns the identity of the verified TLS client certificate of a connection, or nil.
+func (fe *fabricEndpoint) getClientIdentity(connectionId string) *model.ClientIdentity {
+    tlsState, ok := fe.server.GetConnectionTLSState(connectionId)
+    if !ok || tlsState == nil || len(tlsState.VerifiedChains) == 0 || len(tlsState.VerifiedChains[0]) == 0 {
+        return nil
+    }
+    chain := tlsState.VerifiedChains[0]
+    return &model.ClientIdentity{
+        CommonName:   chain[0].Subject.CommonName,
+        Subject:      chain[0].Subject.String(),
+        Certificates: chain,
+    }
 }
 
 func (fe *fabricEndpoint) getChannelNameFromSubscription(destination string) (channelName string, ok bool) {
@@ -4,12 +4,18 @@
 package bus
 
 import (
+    "bytes"
+    "crypto/tls"
+    "crypto/x509"
+    "crypto/x509/pkix"
     "encoding/json"
     "errors"
+    "github.com/go-stomp/stomp/frame"
     "github.com/google/uuid"
     "github.com/stretchr/testify/assert"
     "github.com/vmware/transport-go/model"
     "github.com/vmware/transport-go/stompserver"
+    "github.com/vmware/transport-go/tracing"
     "sync"
     "testing"
 )
@@ -18,6 +24,7 @@ type MockStompServerMessage struct {
     Destination string `json:"destination"`
     Payload []byte `json:"payload"`
     conId string
+    headers map[string]string
 }
 
 type MockStompServer struct {
@@ -26,6 +33,9 @@ type MockStompServer struct {
     subscribeHandlerFunction stompserver.SubscribeHandlerFunction
     unsubscribeHandlerFunction stompserver.UnsubscribeHandlerFunction
     applicationRequestHandlerFunction stompserver.ApplicationRequestHandlerFunction
+    applicationRequestFrameHandlerFunction stompserver.ApplicationRequestFrameHandlerFunction
+    connectionEventHandlerFunction stompserver.ConnectionEventHandlerFunction
+    tlsStates map[string]*tls.ConnectionState
     wg *sync.WaitGroup
 }
 
@@ -55,6 +65,25 @@ func(s *MockStompServer) SendMessageToClient(conId string, destination string, m
     }
 }
 
+func(s *MockStompServer) SendMessageWithHeaders(destination string, messageBody []byte, headers map[string]string) {
+    s.sentMessages = append(s.sentMessages,
+        MockStompServerMessage{Destination: destination, Payload: messageBody, headers: headers})
+
+    if s.wg != nil {
+        s.wg.Done()
+    }
+}
+
+func(s *MockStompServer) SendMessageToClientWithHeaders(
+        conId string, destination string, messageBody []byte, headers map[string]string) {
+    s.sentMessages = append(s.sentMessages,
+        MockStompServerMessage{Destination: destination, Payload: messageBody, conId: conId, headers: headers})
+
+    if s.wg != nil {
+        s.wg.Done()
+    }
+}
+
 func(s *MockStompServer) OnUnsubscribeEvent(callback stompserver.UnsubscribeHandlerFunction) {
     s.unsubscribeHandlerFunction = callback
 }
@@ -63,6 +92,28 @@ func(s *MockStompServer) OnApplicationRequest(callback stompserver.ApplicationRe
     s.applicationRequestHandlerFunction = callback
 }
 
+func(s *MockStompServer) OnApplicationRequestFrame(callback stompserver.ApplicationRequestFrameHandlerFunction) {
+    s.applicationRequestFrameHandlerFunction = callback
+    s.applicationRequestHandlerFunction = func(destination string, message []byte, connectionId string) {
+        f := frame.New(frame.SEND, frame.Destination, destination)
+        f.Body = message
+        callback(destination, f, connectionId)
+    }
+}
+
+func(s *MockStompServer) OnConnectionEvent(callback stompserver.ConnectionEventHandlerFunction) {
+    s.connectionEventHandlerFunction = callback
+}
+
+func(s *MockStompServer) GetConnectionTLSState(connectionId string) (*tls.ConnectionState, bool) {
+    state, ok := s.tlsStates[connectionId]
+    return state, ok
+}
+
+func(s *MockStompServer) GetConnectionPrincipal(connectionId string) (*stompserver.Principal, bool) {
+    return nil, false
+}
+
 func(s *MockStompServer) OnSubscribeEvent(callback stompserver.SubscribeHandlerFunction) {
     s.subscribeHandlerFunction = callback
 }
@@ -382,3 +433,244 @@ func TestFabricEndpoint_BridgeMessage(t *testing.T) {
     assert.Equal(t, receivedReq2.BrokerDestination.ConnectionId, "con2")
     assert.Equal(t, receivedReq2.BrokerDestination.Destination, "/user/queue/request-channel")
 }
+
+func TestFabricEndpoint_BridgeMessageHeaders(t *testing.T) {
+    bus := newTestEventBus()
+    _, mockServer := newTestFabricEndpoint(bus, EndpointConfig{TopicPrefix: "/topic", AppRequestPrefix:"/pub",
+            AppRequestQueuePrefix: "/pub/queue", UserQueuePrefix:"/user/queue" })
+
+    bus.GetChannelManager().CreateChannel("request-channel")
+    mh, _ := bus.ListenRequestStream("request-channel")
+
+    wg := sync.WaitGroup{}
+    var messages []*model.Message
+    mh.Handle(func(message *model.Message) {
+        messages = append(messages, message)
+        wg.Done()
+    }, func(e error) {
+        assert.Fail(t, "unexpected error")
+    })
+
+    id := uuid.New()
+    body, _ := json.Marshal(model.Request{
+        Request: "test-request",
+        Id: &id,
+        Headers: map[string]string{"tenant-id": "body-tenant", "auth": "token"},
+    })
+    f := frame.New(frame.SEND,
+        frame.Destination, "/pub/request-channel",
+        frame.ContentType, "application/json",
+        frame.Receipt, "receipt-1",
+        "correlation-id", "corr-1",
+        "tenant-id", "frame-tenant",
+        "tenant-id", "ignored-duplicate")
+    f.Body = body
+
+    wg.Add(1)
+    mockServer.applicationRequestFrameHandlerFunction("/pub/request-channel", f, "con1")
+    wg.Wait()
+
+    assert.Len(t, messages, 1)
+    expectedHeaders := map[string]string{"correlation-id": "corr-1", "tenant-id": "frame-tenant", "auth": "token",
+        frame.ContentType: "application/json"}
+    assert.Equal(t, expectedHeaders, messages[0].Payload.(*model.Request).Headers)
+    assert.Equal(t, expectedHeaders, model.MessageHeadersToMap(messages[0].Headers))
+}
+
+func TestFabricEndpoint_SubscribeEventHeaders(t *testing.T) {
+    bus := newTestEventBus()
+    _, mockServer := newTestFabricEndpoint(bus,
+        EndpointConfig{TopicPrefix: "/topic", UserQueuePrefix:"/user/queue"})
+
+    bus.GetChannelManager().CreateChannel("test-service")
+    mockServer.subscribeHandlerFunction("con1", "sub1", "/topic/test-service", nil)
+
+    mockServer.wg = &sync.WaitGroup{}
+    mockServer.wg.Add(1)
+    bus.SendResponseMessageWithHeaders("test-service", "test-message", nil,
+        []model.MessageHeader{{Label: "correlation-id", Value: "corr-1"}})
+    mockServer.wg.Wait()
+
+    mockServer.wg.Add(1)
+    bus.SendResponseMessageWithHeaders("test-service", &model.Response{
+        BrokerDestination: &model.BrokerDestinationConfig{
+            Destination: "/user/queue/test-service",
+            ConnectionId: "con1",
+        },
+        Payload: "test-private-message",
+    }, nil, []model.MessageHeader{{Label: "correlation-id", Value: "corr-2"}})
+    mockServer.wg.Wait()
+
+    assert.Len(t, mockServer.sentMessages, 2)
+    assert.Equal(t, map[string]string{"correlation-id": "corr-1"}, mockServer.sentMessages[0].headers)
+    assert.Equal(t, "con1", mockServer.sentMessages[1].conId)
+    // the response is encoded with the JSON codec
+    assert.Equal(t, map[string]string{"correlation-id": "corr-2", frame.ContentType: "application/json"},
+        mockServer.sentMessages[1].headers)
+}
+
+func TestFabricEndpoint_BridgeMessageTrace(t *testing.T) {
+    exporter := tracing.NewInMemoryExporter()
+    tracing.SetExporter(exporter)
+    defer tracing.SetExporter(nil)
+
+    bus := newTestEventBus()
+    _, mockServer := newTestFabricEndpoint(bus, EndpointConfig{TopicPrefix: "/topic", AppRequestPrefix:"/pub"})
+
+    bus.GetChannelManager().CreateChannel("request-channel")
+    mh, _ := bus.ListenRequestStream("request-channel")
+    wg := sync.WaitGroup{}
+    var messages []*model.Message
+    mh.Handle(func(message *model.Message) {
+        messages = append(messages, message)
+        wg.Done()
+    }, func(e error) {})
+
+    f := frame.New(frame.SEND,
+        frame.Destination, "/pub/request-channel",
+        model.TraceParentHeader, "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01",
+        model.TraceStateHeader, "vendor=value")
+    f.Body = []byte(`{"request": "test-request"}`)
+
+    wg.Add(1)
+    mockServer.applicationRequestFrameHandlerFunction("/pub/request-channel", f, "con1")
+    wg.Wait()
+
+    spans := exporter.SpansByName("fabric-endpoint request-channel")
+    assert.Len(t, spans, 1)
+    assert.Equal(t, tracing.ServerSpan, spans[0].Kind)
+    assert.Equal(t, "0af7651916cd43dd8448eb211c80319c", spans[0].Context.TraceId)
+    assert.Equal(t, "b7ad6b7169203331", spans[0].ParentSpanId)
+    assert.Equal(t, "con1", spans[0].Attributes["connection.id"])
+
+    // the request and the message carry the trace context of the endpoint span
+    req := messages[0].Payload.(*model.Request)
+    assert.Equal(t, spans[0].Context, req.Trace)
+    assert.Equal(t, spans[0].Context, messages[0].Trace)
+    assert.Equal(t, spans[0].Context.TraceParent(), req.Headers[model.TraceParentHeader])
+    assert.Equal(t, "vendor=value", req.Headers[model.TraceStateHeader])
+
+    // requests without traceparent header are not traced by default
+    f = frame.New(frame.SEND, frame.Destination, "/pub/request-channel")
+    f.Body = []byte(`{"request": "test-request"}`)
+    wg.Add(1)
+    mockServer.applicationRequestFrameHandlerFunction("/pub/request-channel", f, "con1")
+    wg.Wait()
+
+    req = messages[1].Payload.(*model.Request)
+    assert.Nil(t, req.Trace)
+    assert.Nil(t, req.Headers)
+    assert.Nil(t, messages[1].Trace)
+    assert.Len(t, exporter.Spans(), 1)
+
+    // the root sampler starts new traces
+    tracing.SetRootSampler(tracing.AlwaysSampleRoots)
+    defer tracing.SetRootSampler(nil)
+    wg.Add(1)
+    mockServer.applicationRequestFrameHandlerFunction("/pub/request-channel", f, "con1")
+    wg.Wait()
+
+    req = messages[2].Payload.(*model.Request)
+    assert.NotNil(t, req.Trace)
+    assert.NotEqual(t, "0af7651916cd43dd8448eb211c80319c", req.Trace.TraceId)
+    assert.Equal(t, req.Trace.TraceParent(), req.Headers[model.TraceParentHeader])
+    assert.Equal(t, req.Trace, messages[2].Trace)
+}
+
+func TestFabricEndpoint_BridgeMessageWithCodec(t *testing.T) {
+    model.RegisterCodec(model.NewCodec("application/x-test-prefix",
+        func(value interface{}) ([]byte, error) {
+            data, err := json.Marshal(value)
+            return append([]byte("prefix:"), data...), err
+        },
+        func(data []byte, target interface{}) error {
+            return json.Unmarshal(bytes.TrimPrefix(data, []byte("prefix:")), target)
+        }))
+
+    bus := newTestEventBus()
+    _, mockServer := newTestFabricEndpoint(bus, EndpointConfig{TopicPrefix: "/topic", AppRequestPrefix:"/pub"})
+
+    bus.GetChannelManager().CreateChannel("request-channel")
+    mh, _ := bus.ListenRequestStream("request-channel")
+    wg := sync.WaitGroup{}
+    var messages []*model.Message
+    mh.Handle(func(message *model.Message) {
+        messages = append(messages, message)
+        wg.Done()
+    }, func(e error) {})
+
+    f := frame.New(frame.SEND,
+        frame.Destination, "/pub/request-channel",
+        frame.ContentType, "application/x-test-prefix")
+    f.Body = []byte(`prefix:{"request": "test-request", "payload": "test-rq"}`)
+
+    wg.Add(1)
+    mockServer.applicationRequestFrameHandlerFunction("/pub/request-channel", f, "con1")
+    wg.Wait()
+
+    req := messages[0].Payload.(*model.Request)
+    assert.Equal(t, "test-request", req.Request)
+    assert.Equal(t, "test-rq", req.Payload)
+
+    // responses with the same content type header are encoded with the same codec
+    mockServer.subscribeHandlerFunction("con1", "sub1", "/topic/request-channel", nil)
+    mockServer.wg = &sync.WaitGroup{}
+    mockServer.wg.Add(1)
+    bus.SendResponseMessageWithHeaders("request-channel", map[string]string{"result": "ok"}, nil,
+        model.MessageHeadersFromMap(req.Headers))
+    mockServer.wg.Wait()
+
+    assert.Equal(t, `prefix:{"result":"ok"}`, string(mockServer.sentMessages[0].Payload))
+    assert.Equal(t, "application/x-test-prefix", mockServer.sentMessages[0].headers[frame.ContentType])
+}
+
+func TestFabricEndpoint_BridgeMessageClientIdentity(t *testing.T) {
+    bus := newTestEventBus()
+    _, mockServer := newTestFabricEndpoint(bus, EndpointConfig{TopicPrefix: "/topic", AppRequestPrefix:"/pub"})
+
+    clientCert := &x509.Certificate{
+        Subject: pkix.Name{CommonName: "client-1", Organization: []string{"VMware"}},
+    }
+    caCert := &x509.Certificate{
+        Subject: pkix.Name{CommonName: "test-ca"},
+    }
+    mockServer.tlsStates = map[string]*tls.ConnectionState{
+        "verified-con": {
+            PeerCertificates: []*x509.Certificate{clientCert},
+            VerifiedChains: [][]*x509.Certificate{{clientCert, caCert}},
+        },
+        "unverified-con": {
+            PeerCertificates: []*x509.Certificate{clientCert},
+        },
+    }
+
+    bus.GetChannelManager().CreateChannel("request-channel")
+    mh, _ := bus.ListenRequestStream("request-channel")
+
+    wg := sync.WaitGroup{}
+    var requests []*model.Request
+    mh.Handle(func(message *model.Message) {
+        requests = append(requests, message.Payload.(*model.Request))
+        wg.Done()
+    }, func(e error) {
+        assert.Fail(t, "unexpected error")
+    })
+
+    id := uuid.New()
+    body, _ := json.Marshal(model.Request{Request: "test-request", Id: &id})
+
+    for _, conId := range []string{"verified-con", "unverified-con", "plaintext-con"} {
+        wg.Add(1)
+        mockServer.applicationRequestHandlerFunction("/pub/request-channel", body, conId)
+        wg.Wait()
+    }
+
+    assert.Len(t, requests, 3)
+    assert.Equal(t, &model.ClientIdentity{
+        CommonName: "client-1",
+        Subject: "CN=client-1,O=VMware",
+        Certificates: []*x509.Certificate{clientCert, caCert},
+    }, requests[0].ClientIdentity)
+    assert.Nil(t, requests[1].ClientIdentity)
+    assert.Nil(t, requests[2].ClientIdentity)
+}
@@ -0,0 +1,97 @@
+// Copyright 2019-2020 VMware, Inc.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package bus
+
+import (
+	"github.com/vmware/transport-go/model"
+	"sync"
+)
+
+// handlerQueue is a FIFO of messages waiting to be delivered to a single channel handler.
+// A size of zero means the queue is unbounded.
+type handlerQueue struct {
+	lock     sync.Mutex
+	notEmpty *sync.Cond
+	notFull  *sync.Cond
+	items    []*model.Message
+	size     int
+	policy   OverflowPolicy
+	closed   bool
+}
+
+func newHandlerQueue(size int, policy OverflowPolicy) *handlerQueue {
+	q := &handlerQueue{size: size, policy: policy}
+	q.notEmpty = sync.NewCond(&q.lock)
+	q.notFull = sync.NewCond(&q.lock)
+	return q
+}
+
+// push a message on to the queue. Returns the message that was dropped (which may be the pushed
+// message itself), true if it was dropped to honour the overflow policy rather than because the
+// queue is closed, and ErrHandlerQueueFull for the OverflowError policy.
+func (q *handlerQueue) push(msg *model.Message) (*model.Message, bool, error) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	var dropped *model.Message
+	if q.size > 0 && len(q.items) >= q.size && !q.closed {
+		switch q.policy {
+		case OverflowDropNewest:
+			return msg, true, nil
+		case OverflowError:
+			return msg, false, ErrHandlerQueueFull
+		case OverflowDropOldest:
+			dropped = q.items[0]
+			q.items[0] = nil
+			q.items = q.items[1:]
+		default:
+			for len(q.items) >= q.size && !q.closed {
+				q.notFull.Wait()
+			}
+		}
+	}
+	if q.closed {
+		return msg, false, nil
+	}
+
+	q.items = append(q.items, msg)
+	q.notEmpty.Signal()
+	return dropped, dropped != nil, nil
+}
+
+// pop the next message, waiting until one is available. Returns false once the queue
+// is closed and drained.
+func (q *handlerQueue) pop() (*model.Message, bool) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	for len(q.items) == 0 && !q.closed {
+		q.notEmpty.Wait()
+	}
+	if len(q.items) == 0 {
+		return nil, false
+	}
+	msg := q.items[0]
+	q.items[0] = nil
+	q.items = q.items[1:]
+	q.notFull.Signal()
+	return msg, true
+}
+
+// Number of messages currently waiting in the queue.
+func (q *handlerQueue) len() int {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	return len(q.items)
+}
+
+// close the queue, messages already queued are still delivered but new messages are dropped.
+func (q *handlerQueue) close() {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	q.closed = true
+	q.notEmpty.Broadcast()
+	q.notFull.Broadcast()
+}
@@ -69,9 +69,9 @@ func (msgHandler *messageHandler) GetDestinationId() *uuid.UUID {
 
 func (msgHandler *messageHandler) Fire() error {
     if msgHandler.requestMessage != nil {
-        sendMessageToChannel(msgHandler.channel, msgHandler.requestMessage)
+        err := sendMessageToChannel(msgHandler.channel, msgHandler.requestMessage)
         msgHandler.channel.wg.Wait()
-        return nil
+        return err
     } else {
         return fmt.Errorf("nothing to fire, request is empty")
     }
@@ -16,6 +16,18 @@ const (
     BrokerUnsubscribedEvt
     FabricEndpointSubscribeEvt
     FabricEndpointUnsubscribeEvt
+    BrokerConnectionLostEvt
+    BrokerReconnectingEvt
+    BrokerReconnectedEvt
+    BrokerReconnectFailedEvt
+    FabricEndpointAccessDeniedEvt
+    ChannelMessageDeadLetteredEvt
+    HandlerPanicEvt
+    ChannelMessageSentEvt
+    ChannelMessageHandledEvt
+    FabricEndpointConnectedEvt
+    FabricEndpointDisconnectedEvt
+    RestServiceCallEvt
 )
 
 type MonitorEventHandler func(event *MonitorEvent)
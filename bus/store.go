@@ -30,23 +30,44 @@ type BusStore interface {
     GetName() string
     // Add new or updates existing item in the store.
     Put(id string, value interface{}, state interface{})
+    // Same as Put but fails with StoreVersionConflictError if the item was changed after
+    // the given version, i.e. if the item version is greater than version.
+    // Galactic stores send the version to the server and return nil, conflicts are
+    // resolved by the server.
+    PutIfVersion(id string, value interface{}, state interface{}, version int64) error
     // Returns an item from the store and a boolean flag
     // indicating whether the item exists
     Get(id string) (interface{}, bool)
+    // Returns an item from the store, the item version and a boolean flag
+    // indicating whether the item exists. The item version is the store version
+    // of the last change made to the item.
+    GetWithVersion(id string) (interface{}, int64, bool)
     // Shorten version of the Get() method, returns only the item value.
     GetValue(id string) interface{}
     // Remove an item from the store. Returns true if the remove operation was successful.
     Remove(id string, state interface{}) bool
+    // Same as Remove but fails with StoreVersionConflictError if the item was changed
+    // after the given version.
+    RemoveIfVersion(id string, state interface{}, version int64) (bool, error)
     // Return a slice containing all store items.
     AllValues() []interface{}
     // Return a map with all items from the store.
     AllValuesAsMap() map[string]interface{}
     // Return a map with all items from the store with the current store version.
     AllValuesAndVersion() (map[string]interface{}, int64)
+    // Return a map with all items matching the predicate.
+    Query(predicate StoreItemPredicate) map[string]interface{}
+    // Create a named secondary index on a field of the store items. The index is kept
+    // up to date on every store change and can be queried with QueryIndex().
+    CreateIndex(indexName string, fieldName string) error
+    // Return a map with all items whose indexed field is equal to value.
+    QueryIndex(indexName string, value interface{}) (map[string]interface{}, error)
     // Subscribe to state changes for a specific object.
     OnChange(id string, state ...interface{}) StoreStream
     // Subscribe to state changes for all objects
     OnAllChanges(state ...interface{}) StoreStream
+    // Subscribe to state changes matching the predicate.
+    OnMatchingChanges(predicate StoreChangePredicate, state ...interface{}) StoreStream
     // Notify when the store has been initialize (via populate() or initialize()
     WhenReady(readyFunction func())
     // Populate the store with a map of items and their ID's.
@@ -67,11 +88,27 @@ type BusStore interface {
     GetItemType() reflect.Type
 }
 
+// Returned by BusStore.PutIfVersion and BusStore.RemoveIfVersion when the item
+// was changed after the version supplied by the caller.
+type StoreVersionConflictError struct {
+    StoreName       string
+    ItemId          string
+    ItemVersion     int64 // the current version of the item
+    ExpectedVersion int64 // the version supplied by the caller
+}
+
+func (e *StoreVersionConflictError) Error() string {
+    return fmt.Sprintf("version conflict for item '%s' in store '%s': item version is %d, expected %d",
+        e.ItemId, e.StoreName, e.ItemVersion, e.ExpectedVersion)
+}
+
 // Internal BusStore implementation
 type busStore struct {
     name                string
     itemsLock           sync.RWMutex
     items               map[string]interface{}
+    itemVersions        map[string]int64
+    indexes             map[string]*storeIndex
     storeVersion        int64
     storeStreamsLock    sync.RWMutex
     storeStreams        []*storeStream
@@ -84,19 +121,47 @@ type busStore struct {
     bus                 EventBus
     itemType            reflect.Type
     storeSynHandler     MessageHandler
+    persistence         StorePersistence
+    changeHistory       []*StoreChange
+    changeHistorySize   int
+    // set while a galactic store waits for the changes it missed.
+    resyncPending       bool
+    // set if the store was restored from its persistence, the store manager
+    // initializes it once the store is registered.
+    restored            bool
+}
+
+// StoreOption configures a BusStore when it is created with StoreManager.CreateStoreWithType.
+type StoreOption func(store *busStore)
+
+// Number of changes a store remembers by default, so galactic clients can resume
+// from an older store version without downloading the whole store again.
+const DefaultStoreChangeHistorySize = 1000
+
+// Keep the last size changes of the store in memory, zero disables the change history.
+func WithStoreChangeHistory(size int) StoreOption {
+    return func(store *busStore) {
+        store.changeHistorySize = size
+    }
 }
 
 type galacticStoreConfig struct {
     syncChannelConfig   *storeSyncChannelConfig
 }
 
-func newBusStore(name string, bus EventBus, itemType reflect.Type, galacticConf *galacticStoreConfig) BusStore {
+func newBusStore(name string, bus EventBus, itemType reflect.Type,
+        galacticConf *galacticStoreConfig, options ...StoreOption) BusStore {
 
     store := new(busStore)
     store.name = name
     store.bus = bus
     store.itemType = itemType
     store.galacticConf = galacticConf
+    store.changeHistorySize = DefaultStoreChangeHistorySize
+
+    for _, option := range options {
+        option(store)
+    }
 
     initStore(store)
 
@@ -104,17 +169,43 @@ func newBusStore(name string, bus EventBus, itemType reflect.Type, galacticConf
 
     if store.isGalactic {
         initGalacticStore(store)
+    } else if store.persistence != nil {
+        store.restored = restorePersistedStore(store)
     }
 
     return store
 }
 
+// replays the persisted state of the store, returns true if the store had persisted state.
+func restorePersistedStore(store *busStore) bool {
+    items, version, found, err := store.persistence.Load(store.name, store.itemType)
+    if err != nil {
+        store.logger().Warn("failed to restore store", "error", err)
+        return false
+    }
+    if !found {
+        return false
+    }
+
+    store.itemsLock.Lock()
+    defer store.itemsLock.Unlock()
+
+    if version > 0 {
+        store.storeVersion = version
+    }
+    store.populateInternal(items)
+    return true
+}
+
 func initStore(store *busStore) {
     store.readyC = make(chan struct{})
     store.storeStreams = []*storeStream {}
     store.mutationStreams = []*mutationStoreStream {}
     store.items = make(map[string]interface{})
+    store.itemVersions = make(map[string]int64)
     store.storeVersion = 1
+    store.changeHistory = nil
+    store.clearIndexes()
     store.initializer = sync.Once{}
 }
 
@@ -133,9 +224,11 @@ func initGalacticStore(store *busStore) {
             d := msg.Payload.([]byte)
             var storeResponse map[string]interface{}
 
-            err := json.Unmarshal(d, &storeResponse)
+            contentType, _ := msg.GetHeader("content-type")
+            codec := model.GetCodecOrDefault(contentType)
+            err := codec.Unmarshal(d, &storeResponse)
             if err != nil {
-                log.Warn("failed to unmarshal storeResponse")
+                store.logger().Warn("failed to unmarshal store response", "error", err)
                 return
             }
 
@@ -152,16 +245,21 @@ func initGalacticStore(store *busStore) {
                 store.itemsLock.Lock()
                 defer store.itemsLock.Unlock()
 
+                store.resyncPending = false
                 store.updateVersionFromResponse(storeResponse)
                 items := storeResponse["items"].(map[string]interface{})
                 store.items = make(map[string]interface{})
+                store.itemVersions = make(map[string]int64)
+                store.clearIndexes()
                 for key, val := range items {
-                    deserializedValue, err :=  store.deserializeRawValue(val)
+                    deserializedValue, err :=  store.deserializeRawValue(val, codec)
                     if err != nil {
-                        log.Warn("failed to deserialize store item value %e", err)
+                        store.logger().Warn("failed to deserialize store item value", "item", key, "error", err)
                         continue
                     } else {
                         store.items[key] = deserializedValue
+                        store.itemVersions[key] = store.storeVersion
+                        store.indexItem(key, deserializedValue)
                     }
                 }
                 store.Initialize()
@@ -170,15 +268,18 @@ func initGalacticStore(store *busStore) {
                 store.itemsLock.Lock()
                 defer store.itemsLock.Unlock()
 
+                if !store.isNextChange(storeResponse) {
+                    return
+                }
                 store.updateVersionFromResponse(storeResponse)
                 newItemRaw, ok := storeResponse["newItemValue"]
                 itemId := storeResponse["itemId"].(string)
                 if !ok || newItemRaw == nil {
                     store.removeInternal(itemId, "galacticSyncRemove")
                 } else {
-                    newItemValue, err := store.deserializeRawValue(newItemRaw)
+                    newItemValue, err := store.deserializeRawValue(newItemRaw, codec)
                     if err != nil {
-                        log.Warn("failed to deserialize store item value %e", err)
+                        store.logger().Warn("failed to deserialize store item value", "item", itemId, "error", err)
                         return
                     }
                     store.putInternal(itemId, newItemValue, "galacticSyncUpdate")
@@ -191,21 +292,52 @@ func initGalacticStore(store *busStore) {
     store.sendOpenStoreRequest()
 }
 
+func (store *busStore) logger() log.Logger {
+    return store.bus.GetLogger().With("store", store.name)
+}
+
 func (store *busStore) updateVersionFromResponse(storeResponse map[string]interface{}) {
-    version := storeResponse["storeVersion"]
-    switch version.(type) {
-    case float64:
-        store.storeVersion = int64(version.(float64))
-    case int64:
-        store.storeVersion = version.(int64)
+    version, ok := getInt64Property("storeVersion", storeResponse)
+    if !ok {
+        store.logger().Warn("failed to deserialize store version", "version", storeResponse["storeVersion"])
+        version = 1
+    }
+    store.storeVersion = version
+}
+
+// Returns true if the update response of an initialized store contains the change following
+// the current store version. Changes which are already applied are dropped, and a missing
+// change makes the store request the changes since its current version.
+func (store *busStore) isNextChange(storeResponse map[string]interface{}) bool {
+    version, ok := getInt64Property("storeVersion", storeResponse)
+    if !ok || !store.isReady() {
+        return true
+    }
+    if version <= store.storeVersion {
+        return false
+    }
+    if version > store.storeVersion + 1 {
+        if !store.resyncPending {
+            store.resyncPending = true
+            store.sendResyncRequest()
+        }
+        return false
+    }
+    store.resyncPending = false
+    return true
+}
+
+func (store *busStore) isReady() bool {
+    select {
+    case <-store.readyC:
+        return true
     default:
-        log.Warn("failed to deserialize store version")
-        store.storeVersion = 1
+        return false
     }
 }
 
-func (store *busStore) deserializeRawValue(rawValue interface{}) (interface{}, error) {
-    return model.ConvertValueToType(rawValue, store.itemType)
+func (store *busStore) deserializeRawValue(rawValue interface{}, codec model.Codec) (interface{}, error) {
+    return model.ConvertValueToTypeWithCodec(rawValue, store.itemType, codec)
 }
 
 func (store *busStore) sendOpenStoreRequest() {
@@ -215,6 +347,23 @@ func (store *busStore) sendOpenStoreRequest() {
     store.sendGalacticRequest("openStore", openStoreReq)
 }
 
+// requests the changes made on the server since the current store version.
+func (store *busStore) resync() {
+    store.itemsLock.Lock()
+    defer store.itemsLock.Unlock()
+
+    store.sendResyncRequest()
+}
+
+// must be called with the items lock held.
+func (store *busStore) sendResyncRequest() {
+    openStoreReq := map[string]interface{} {
+        "storeId": store.GetName(),
+        "storeVersion": store.storeVersion,
+    }
+    store.sendGalacticRequest("openStore", openStoreReq)
+}
+
 func (store *busStore) sendGalacticRequest(requestCmd string, requestPayload interface{}) {
     // create request
     id := uuid.New();
@@ -272,13 +421,38 @@ func (store *busStore) Populate(items map[string]interface{}) error {
         return fmt.Errorf("store items already initialized")
     }
 
-    for k,v := range items {
-        store.items[k] = v
+    store.populateInternal(items)
+    if store.persistence != nil {
+        store.persistSnapshot()
     }
     store.Initialize()
     return nil
 }
 
+func (store *busStore) populateInternal(items map[string]interface{}) {
+    for k,v := range items {
+        store.items[k] = v
+        store.itemVersions[k] = store.storeVersion
+        store.indexItem(k, v)
+    }
+}
+
+func (store *busStore) persistSnapshot() {
+    err := store.persistence.SaveSnapshot(store.name, store.items, store.storeVersion)
+    if err != nil {
+        store.logger().Warn("failed to persist store", "error", err)
+    }
+}
+
+func (store *busStore) persistChange(change *StoreChange) {
+    if store.persistence == nil || store.IsGalactic() {
+        return
+    }
+    if err := store.persistence.SaveChange(store.name, change); err != nil {
+        store.logger().Warn("failed to persist store change", "item", change.Id, "error", err)
+    }
+}
+
 func (store *busStore) Put(id string, value interface{}, state interface{}) {
     if store.IsGalactic() {
         store.putGalactic(id, value)
@@ -290,6 +464,36 @@ func (store *busStore) Put(id string, value interface{}, state interface{}) {
     }
 }
 
+func (store *busStore) PutIfVersion(id string, value interface{}, state interface{}, version int64) error {
+    if store.IsGalactic() {
+        store.sendUpdateStoreRequest(id, value, version)
+        return nil
+    }
+
+    store.itemsLock.Lock()
+    defer store.itemsLock.Unlock()
+
+    if err := store.checkItemVersion(id, version); err != nil {
+        return err
+    }
+    store.putInternal(id, value, state)
+    return nil
+}
+
+// Returns StoreVersionConflictError if the item was changed after the given version.
+func (store *busStore) checkItemVersion(id string, version int64) error {
+    itemVersion := store.itemVersions[id]
+    if itemVersion > version {
+        return &StoreVersionConflictError{
+            StoreName:       store.name,
+            ItemId:          id,
+            ItemVersion:     itemVersion,
+            ExpectedVersion: version,
+        }
+    }
+    return nil
+}
+
 func (store *busStore) putGalactic(id string, value interface{}) {
     store.itemsLock.RLock()
     clientStoreVersion := store.storeVersion
@@ -314,6 +518,8 @@ func (store *busStore) putInternal(id string, value interface{}, state interface
         store.storeVersion++
     }
     store.items[id] = value
+    store.itemVersions[id] = store.storeVersion
+    store.indexItem(id, value)
 
     change := &StoreChange{
         Id: id,
@@ -322,9 +528,65 @@ func (store *busStore) putInternal(id string, value interface{}, state interface
         StoreVersion: store.storeVersion,
     }
 
+    store.persistChange(change)
+    store.recordChange(change)
     go store.onStoreChange(change)
 }
 
+// keeps the last changeHistorySize changes, so clients can resume from an older store version.
+func (store *busStore) recordChange(change *StoreChange) {
+    if store.changeHistorySize <= 0 {
+        store.pruneTombstone(change)
+        return
+    }
+    if len(store.changeHistory) >= store.changeHistorySize {
+        dropped := len(store.changeHistory) - store.changeHistorySize + 1
+        for _, droppedChange := range store.changeHistory[:dropped] {
+            store.pruneTombstone(droppedChange)
+        }
+        n := copy(store.changeHistory, store.changeHistory[dropped:])
+        store.changeHistory = store.changeHistory[:n]
+    }
+    store.changeHistory = append(store.changeHistory, change)
+}
+
+// Drops the version of an item removed by the change once the change leaves the change history,
+// stale updates older than the history can recreate the item afterwards.
+func (store *busStore) pruneTombstone(change *StoreChange) {
+    if !change.IsDeleteChange {
+        return
+    }
+    if _, ok := store.items[change.Id]; ok {
+        return
+    }
+    if store.itemVersions[change.Id] == change.StoreVersion {
+        delete(store.itemVersions, change.Id)
+    }
+}
+
+// Returns all changes made after the given store version.
+// The returned flag is false if the change history doesn't reach back to that version.
+func (store *busStore) changesSince(version int64) ([]*StoreChange, bool) {
+    store.itemsLock.RLock()
+    defer store.itemsLock.RUnlock()
+
+    if version == store.storeVersion {
+        return nil, true
+    }
+    if version > store.storeVersion || len(store.changeHistory) == 0 ||
+            store.changeHistory[0].StoreVersion > version + 1 {
+        return nil, false
+    }
+
+    var changes []*StoreChange
+    for _, change := range store.changeHistory {
+        if change.StoreVersion > version {
+            changes = append(changes, change)
+        }
+    }
+    return changes, true
+}
+
 func (store *busStore) Get(id string) (interface{}, bool) {
     store.itemsLock.RLock()
     defer store.itemsLock.RUnlock()
@@ -334,6 +596,17 @@ func (store *busStore) Get(id string) (interface{}, bool) {
     return val, ok
 }
 
+func (store *busStore) GetWithVersion(id string) (interface{}, int64, bool) {
+    store.itemsLock.RLock()
+    defer store.itemsLock.RUnlock()
+
+    val, ok := store.items[id]
+    if !ok {
+        return nil, 0, false
+    }
+    return val, store.itemVersions[id], true
+}
+
 func (store *busStore) GetValue(id string) interface{} {
     val, _ := store.Get(id)
     return val
@@ -350,6 +623,30 @@ func (store *busStore) Remove(id string, state interface{}) bool {
     }
 }
 
+func (store *busStore) RemoveIfVersion(id string, state interface{}, version int64) (bool, error) {
+    if store.IsGalactic() {
+        store.itemsLock.RLock()
+        _, ok := store.items[id]
+        store.itemsLock.RUnlock()
+
+        if ok {
+            store.sendUpdateStoreRequest(id, nil, version)
+        }
+        return ok, nil
+    }
+
+    store.itemsLock.Lock()
+    defer store.itemsLock.Unlock()
+
+    if _, ok := store.items[id]; !ok {
+        return false, nil
+    }
+    if err := store.checkItemVersion(id, version); err != nil {
+        return false, err
+    }
+    return store.removeInternal(id, state), nil
+}
+
 func (store *busStore) removeGalactic(id string) bool {
     store.itemsLock.RLock()
     _, ok := store.items[id]
@@ -373,6 +670,12 @@ func (store *busStore) removeInternal(id string, state interface{}) bool {
         store.storeVersion++
     }
     delete(store.items, id)
+    for _, index := range store.indexes {
+        index.remove(id)
+    }
+    // keep the version of removed items while the removal is in the change history,
+    // so stale updates can't recreate them
+    store.itemVersions[id] = store.storeVersion
 
     change := &StoreChange{
         Id: id,
@@ -382,6 +685,8 @@ func (store *busStore) removeInternal(id string, state interface{}) bool {
         IsDeleteChange: true,
     }
 
+    store.persistChange(change)
+    store.recordChange(change)
     go store.onStoreChange(change)
     return true
 }
@@ -425,6 +730,73 @@ func (store *busStore) AllValuesAndVersion() (map[string]interface{}, int64) {
     return values, store.storeVersion
 }
 
+func (store *busStore) Query(predicate StoreItemPredicate) map[string]interface{} {
+    store.itemsLock.RLock()
+    defer store.itemsLock.RUnlock()
+
+    values := make(map[string] interface{})
+
+    for key, value := range store.items {
+        if predicate(key, value) {
+            values[key] = value
+        }
+    }
+
+    return values
+}
+
+func (store *busStore) CreateIndex(indexName string, fieldName string) error {
+    store.itemsLock.Lock()
+    defer store.itemsLock.Unlock()
+
+    if _, ok := store.indexes[indexName]; ok {
+        return fmt.Errorf("index '%s' already exists", indexName)
+    }
+
+    index, err := newStoreIndex(fieldName, store.itemType)
+    if err != nil {
+        return err
+    }
+    for id, value := range store.items {
+        index.put(id, value)
+    }
+
+    if store.indexes == nil {
+        store.indexes = make(map[string]*storeIndex)
+    }
+    store.indexes[indexName] = index
+    return nil
+}
+
+func (store *busStore) QueryIndex(indexName string, value interface{}) (map[string]interface{}, error) {
+    store.itemsLock.RLock()
+    defer store.itemsLock.RUnlock()
+
+    index, ok := store.indexes[indexName]
+    if !ok {
+        return nil, fmt.Errorf("index '%s' doesn't exist", indexName)
+    }
+
+    ids := index.lookup(value)
+    values := make(map[string] interface{}, len(ids))
+    for id := range ids {
+        values[id] = store.items[id]
+    }
+    return values, nil
+}
+
+func (store *busStore) indexItem(id string, value interface{}) {
+    for _, index := range store.indexes {
+        index.put(id, value)
+    }
+}
+
+func (store *busStore) clearIndexes() {
+    for _, index := range store.indexes {
+        index.clear()
+    }
+}
+
 func (store *busStore) OnMutationRequest(requestType ...interface{}) MutationStoreStream {
     return newMutationStoreStream(store, &mutationStreamFilter{
         requestTypes: requestType,
@@ -477,6 +849,8 @@ func (store *busStore) Reset() {
 
     if (store.IsGalactic()) {
         store.sendOpenStoreRequest()
+    } else if store.persistence != nil {
+        store.persistSnapshot()
     }
 }
 
@@ -501,6 +875,14 @@ func (store *busStore) OnAllChanges(state ...interface{}) StoreStream {
     })
 }
 
+func (store *busStore) OnMatchingChanges(predicate StoreChangePredicate, state ...interface{}) StoreStream {
+    return newStoreStream(store, &streamFilter{
+        states: state,
+        matchAllItems: true,
+        predicate: predicate,
+    })
+}
+
 func (store *busStore) onStreamSubscribe(stream *storeStream) {
     store.storeStreamsLock.Lock()
     defer store.storeStreamsLock.Unlock()
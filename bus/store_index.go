@@ -0,0 +1,116 @@
+// Copyright 2019-2020 VMware, Inc.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package bus
+
+import (
+    "fmt"
+    "reflect"
+)
+
+// Predicate used to query store items.
+type StoreItemPredicate func(id string, value interface{}) bool
+
+// Predicate used to filter store change streams.
+type StoreChangePredicate func(change *StoreChange) bool
+
+// storeIndex maps the values of a single item field to the ids of the items with that value.
+type storeIndex struct {
+    field    string
+    entries  map[interface{}]map[string]bool
+    itemKeys map[string]interface{}
+}
+
+func newStoreIndex(field string, itemType reflect.Type) (*storeIndex, error) {
+    if itemType != nil {
+        structType := itemType
+        if structType.Kind() == reflect.Ptr {
+            structType = structType.Elem()
+        }
+        if structType.Kind() == reflect.Struct {
+            structField, ok := structType.FieldByName(field)
+            if !ok {
+                return nil, fmt.Errorf("item type %v has no field '%s'", itemType, field)
+            }
+            if !structField.Type.Comparable() {
+                return nil, fmt.Errorf("field '%s' of item type %v cannot be indexed", field, itemType)
+            }
+        }
+    }
+
+    index := &storeIndex{field: field}
+    index.clear()
+    return index, nil
+}
+
+func (index *storeIndex) clear() {
+    index.entries = make(map[interface{}]map[string]bool)
+    index.itemKeys = make(map[string]interface{})
+}
+
+// Returns the indexed field value of a struct, pointer to struct or map item.
+func (index *storeIndex) key(value interface{}) (interface{}, bool) {
+    v := reflect.ValueOf(value)
+    for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+        if v.IsNil() {
+            return nil, false
+        }
+        v = v.Elem()
+    }
+
+    var fieldValue reflect.Value
+    switch v.Kind() {
+    case reflect.Struct:
+        fieldValue = v.FieldByName(index.field)
+    case reflect.Map:
+        if v.Type().Key().Kind() != reflect.String {
+            return nil, false
+        }
+        fieldValue = v.MapIndex(reflect.ValueOf(index.field))
+    }
+
+    if !fieldValue.IsValid() || !fieldValue.CanInterface() {
+        return nil, false
+    }
+    key := fieldValue.Interface()
+    if key == nil || !reflect.TypeOf(key).Comparable() {
+        return nil, false
+    }
+    return key, true
+}
+
+func (index *storeIndex) put(id string, value interface{}) {
+    index.remove(id)
+
+    key, ok := index.key(value)
+    if !ok {
+        return
+    }
+    ids, ok := index.entries[key]
+    if !ok {
+        ids = make(map[string]bool)
+        index.entries[key] = ids
+    }
+    ids[id] = true
+    index.itemKeys[id] = key
+}
+
+func (index *storeIndex) remove(id string) {
+    key, ok := index.itemKeys[id]
+    if !ok {
+        return
+    }
+    delete(index.itemKeys, id)
+    ids := index.entries[key]
+    delete(ids, id)
+    if len(ids) == 0 {
+        delete(index.entries, key)
+    }
+}
+
+func (index *storeIndex) lookup(key interface{}) map[string]bool {
+    if key == nil || !reflect.TypeOf(key).Comparable() {
+        return nil
+    }
+    return index.entries[key]
+}
@@ -18,14 +18,17 @@ type StoreManager interface {
     CreateStore(name string) BusStore
     // Create a new Store and use the itemType to deserialize item values when handling
     // incoming UpdateStoreRequest. If the store already exists, the method will return
-    // the existing store instance.
-    CreateStoreWithType(name string, itemType reflect.Type) BusStore
+    // the existing store instance. Use the WithStorePersistence option to make the store durable.
+    CreateStoreWithType(name string, itemType reflect.Type, options ...StoreOption) BusStore
     // Get a reference to the existing store. Returns nil if the store doesn't exist.
     GetStore(name string) BusStore
+    // Get all existing stores. Returns a map of store names and the stores.
+    GetAllStores() map[string]BusStore
     // Deletes a store.
     DestroyStore(name string) bool
     // Configure galactic store sync channel for a given connection.
     // Should be called before OpenGalacticStore() and OpenGalacticStoreWithItemType() APIs.
+    // The configuration is removed when the connection can't be restored or the sync channel is destroyed.
     ConfigureStoreSyncChannel(conn bridge.Connection, topicPrefix string, pubPrefix string) error
     // Open new galactic store
     OpenGalacticStore(name string, conn bridge.Connection) (BusStore, error)
@@ -44,6 +47,7 @@ type storeSyncChannelConfig struct {
     pubPrefix       string
     syncChannelName string
     conn            galacticStoreConnection
+    listenerId      MonitorEventListenerId
 }
 
 type storeManager struct {
@@ -67,19 +71,30 @@ func (m *storeManager) CreateStore(name string) BusStore {
     return m.CreateStoreWithType(name, nil)
 }
 
-func (m *storeManager) CreateStoreWithType(name string, itemType reflect.Type) BusStore {
+func (m *storeManager) CreateStoreWithType(name string, itemType reflect.Type, options ...StoreOption) BusStore {
     m.storesLock.Lock()
-    defer m.storesLock.Unlock()
 
     store, ok := m.stores[name]
 
     if ok {
+        m.storesLock.Unlock()
+        if len(options) > 0 {
+            m.eventBus.GetLogger().Warn("store already exists, the store options are ignored",
+                "store", name, "options", len(options))
+        }
         return store
     }
 
-    m.stores[name] = newBusStore(name, m.eventBus, itemType, nil)
-    go m.eventBus.SendMonitorEvent(StoreCreatedEvt, name, nil)
-    return m.stores[name]
+    newStore := newBusStore(name, m.eventBus, itemType, nil, options...).(*busStore)
+    m.stores[name] = newStore
+    m.storesLock.Unlock()
+
+    m.eventBus.SendMonitorEvent(StoreCreatedEvt, name, nil)
+    // a restored store is initialized after it was created.
+    if newStore.restored {
+        newStore.Initialize()
+    }
+    return newStore
 }
 
 func (m *storeManager) GetStore(name string) BusStore {
@@ -89,6 +104,17 @@ func (m *storeManager) GetStore(name string) BusStore {
     return m.stores[name]
 }
 
+func (m *storeManager) GetAllStores() map[string]BusStore {
+    m.storesLock.RLock()
+    defer m.storesLock.RUnlock()
+
+    stores := make(map[string]BusStore, len(m.stores))
+    for name, store := range m.stores {
+        stores[name] = store
+    }
+    return stores
+}
+
 func (m *storeManager) DestroyStore(name string) bool {
     m.storesLock.Lock()
     defer m.storesLock.Unlock()
@@ -134,9 +160,46 @@ func (m *storeManager) ConfigureStoreSyncChannel(
     m.eventBus.GetChannelManager().CreateChannel(syncChannel)
     m.eventBus.GetChannelManager().MarkChannelAsGalactic(syncChannel, topicPrefix + syncChannel, conn)
 
+    // catch up on the changes missed while the broker connection was down, the sync channel
+    // is torn down once the connection can't be restored or the channel is destroyed.
+    connId := conn.GetId().String()
+    storeSyncChannelConfig.listenerId = m.eventBus.AddMonitorEventListener(func(event *MonitorEvent) {
+        switch {
+        case event.EventType == BrokerReconnectedEvt && event.EntityName == connId:
+            m.resyncGalacticStores(storeSyncChannelConfig)
+        case event.EventType == BrokerReconnectFailedEvt && event.EntityName == connId,
+                event.EventType == ChannelDestroyedEvt && event.EntityName == syncChannel:
+            // listeners can't be removed while the monitor event is dispatched
+            go m.removeStoreSyncChannel(*conn.GetId(), storeSyncChannelConfig)
+        }
+    }, BrokerReconnectedEvt, BrokerReconnectFailedEvt, ChannelDestroyedEvt)
+
     return nil
 }
 
+func (m *storeManager) removeStoreSyncChannel(connId uuid.UUID, chanConf *storeSyncChannelConfig) {
+    m.syncChannelsLock.Lock()
+    defer m.syncChannelsLock.Unlock()
+
+    if m.syncChannels[connId] != chanConf {
+        return
+    }
+    delete(m.syncChannels, connId)
+    m.eventBus.RemoveMonitorEventListener(chanConf.listenerId)
+}
+
+func (m *storeManager) resyncGalacticStores(chanConf *storeSyncChannelConfig) {
+    m.storesLock.RLock()
+    defer m.storesLock.RUnlock()
+
+    for _, s := range m.stores {
+        store, ok := s.(*busStore)
+        if ok && store.IsGalactic() && store.galacticConf.syncChannelConfig == chanConf {
+            store.resync()
+        }
+    }
+}
+
 func (m *storeManager) OpenGalacticStore(name string, conn bridge.Connection) (BusStore, error) {
     return m.OpenGalacticStoreWithItemType(name, conn, nil)
 }
@@ -4,13 +4,16 @@
 package bus
 
 import (
+    "encoding/json"
     "github.com/google/uuid"
     "github.com/stretchr/testify/assert"
     "github.com/stretchr/testify/mock"
+    "github.com/vmware/transport-go/model"
     "reflect"
     "sync"
     "sync/atomic"
     "testing"
+    "time"
 )
 
 func createTestStoreManager() StoreManager {
@@ -241,3 +244,63 @@ func TestStoreManager_OpenGalacticStoreWithLocalStoreId(t *testing.T) {
     assert.EqualError(t, err, "cannot open galactic store: there is a local store with the same name")
     assert.Equal(t, store, localStore)
 }
+
+func TestStoreManager_ResyncGalacticStoresOnReconnect(t *testing.T) {
+    bus := newTestEventBus()
+    m := newStoreManager(bus)
+    id := uuid.New()
+    con := &MockBridgeConnection{Id: &id}
+    subId := uuid.New()
+    sub := &MockBridgeSubscription{
+        Id: &subId,
+    }
+
+    requests := make(chan *model.Request, 10)
+    con.On("Subscribe", mock.Anything).Return(sub, nil)
+    con.On("SendMessage", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+        var req model.Request
+        json.Unmarshal(args.Get(1).([]byte), &req)
+        requests <- &req
+    }).Return(nil)
+    m.ConfigureStoreSyncChannel(con, "/topic-prefix", "/pub-prefix")
+
+    store, _ := m.OpenGalacticStore("galacticStore", con)
+    req := <-requests
+    assert.Equal(t, "openStore", req.Request)
+    assert.Equal(t, map[string]interface{}{"storeId": "galacticStore"}, req.Payload)
+
+    wg := sync.WaitGroup{}
+    wg.Add(1)
+    store.WhenReady(wg.Done)
+    bus.SendResponseMessage("transport-store-sync." + id.String(), []byte(`{
+        "storeId": "galacticStore",
+        "responseType": "storeContentResponse",
+        "storeVersion": 5,
+        "items": {}
+    }`), nil)
+    wg.Wait()
+
+    // a reconnect of another connection is ignored.
+    bus.SendMonitorEvent(BrokerReconnectedEvt, uuid.New().String(), 0)
+    bus.SendMonitorEvent(BrokerReconnectedEvt, id.String(), 0)
+
+    req = <-requests
+    assert.Equal(t, "openStore", req.Request)
+    assert.Equal(t, map[string]interface{}{
+        "storeId": "galacticStore",
+        "storeVersion": float64(5),
+    }, req.Payload)
+    assert.Equal(t, 0, len(requests))
+
+    // the sync channel is removed with its listener once the connection can't be restored.
+    sm := m.(*storeManager)
+    bus.SendMonitorEvent(BrokerReconnectFailedEvt, id.String(), 0)
+    assert.Eventually(t, func() bool {
+        sm.syncChannelsLock.RLock()
+        defer sm.syncChannelsLock.RUnlock()
+        return len(sm.syncChannels) == 0
+    }, time.Second, time.Millisecond)
+
+    bus.SendMonitorEvent(BrokerReconnectedEvt, id.String(), 0)
+    assert.Equal(t, 0, len(requests))
+}
@@ -0,0 +1,439 @@
+// Copyright 2019-2020 VMware, Inc.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package bus
+
+import (
+    "bufio"
+    "encoding/json"
+    "fmt"
+    "github.com/vmware/transport-go/log"
+    "github.com/vmware/transport-go/model"
+    "io/ioutil"
+    "net/url"
+    "os"
+    "path/filepath"
+    "reflect"
+    "runtime"
+    "sync"
+)
+
+// StorePersistence saves the state of a BusStore so it can be restored after a process restart.
+// Attach it to a store with StoreManager.CreateStoreWithType(name, itemType, WithStorePersistence(p)).
+// The store calls SaveChange and SaveSnapshot while it is locked, so implementations should hand
+// the disk I/O off to a background writer which keeps the order of the calls.
+type StorePersistence interface {
+    // Loads the persisted items of a store and the store version. Item values are decoded to
+    // itemType if it is not nil. Returns false if nothing has been persisted for the store yet.
+    Load(storeName string, itemType reflect.Type) (map[string]interface{}, int64, bool, error)
+    // Persists a single item change.
+    SaveChange(storeName string, change *StoreChange) error
+    // Replaces all persisted state of the store with the supplied items and version.
+    // The items map must not be retained, the store keeps modifying it.
+    SaveSnapshot(storeName string, items map[string]interface{}, version int64) error
+    // Releases any resources held by the persistence.
+    Close() error
+}
+
+// Persist all changes of the store with the supplied persistence and restore
+// the store content from it when the store is created.
+func WithStorePersistence(persistence StorePersistence) StoreOption {
+    return func(store *busStore) {
+        store.persistence = persistence
+    }
+}
+
+// Default number of logged changes after which the file persistence compacts the
+// change log of a store into a new snapshot.
+const DefaultSnapshotInterval = 1000
+
+type storeSnapshot struct {
+    StoreVersion int64
+    Items        map[string]json.RawMessage
+}
+
+type storeChangeRecord struct {
+    Id             string
+    Value          json.RawMessage
+    IsDeleteChange bool
+    StoreVersion   int64
+}
+
+type storeLog struct {
+    file    *os.File
+    changes int
+}
+
+// a change log record or snapshot waiting for the writer, or a flush
+// request which is done once all earlier writes are on the disk.
+type persistenceWrite struct {
+    storeName string
+    record    []byte
+    snapshot  *storeSnapshot
+    done      chan struct{}
+}
+
+// Number of writes queued for the writer of a file persistence before SaveChange blocks.
+const persistenceWriteQueueSize = 1024
+
+// file based StorePersistence implementation.
+type fileStorePersistence struct {
+    dir              string
+    snapshotInterval int
+    lock             sync.Mutex
+    logs             map[string]*storeLog
+    closeLock        sync.RWMutex
+    closed           bool
+    writes           chan *persistenceWrite
+    writerDone       chan struct{}
+}
+
+// Creates a StorePersistence which keeps the state of each store in the dir directory as
+// a snapshot file and an append-only log of all changes made since that snapshot.
+// The log is compacted into a new snapshot every snapshotInterval changes, if snapshotInterval
+// is not positive DefaultSnapshotInterval is used.
+//
+// The files are written by a background writer which fsyncs the change log after each batch of
+// queued changes. Changes which are still queued are lost if the process crashes, Close waits
+// until they are written. Write errors are logged with log.Default().
+func NewFileStorePersistence(dir string, snapshotInterval int) (StorePersistence, error) {
+    if err := os.MkdirAll(dir, 0755); err != nil {
+        return nil, err
+    }
+    if snapshotInterval <= 0 {
+        snapshotInterval = DefaultSnapshotInterval
+    }
+    p := &fileStorePersistence{
+        dir:              dir,
+        snapshotInterval: snapshotInterval,
+        logs:             make(map[string]*storeLog),
+        writes:           make(chan *persistenceWrite, persistenceWriteQueueSize),
+        writerDone:       make(chan struct{}),
+    }
+    go p.runWriter()
+    return p, nil
+}
+
+func (p *fileStorePersistence) snapshotPath(storeName string) string {
+    return filepath.Join(p.dir, url.PathEscape(storeName) + ".snapshot")
+}
+
+func (p *fileStorePersistence) logPath(storeName string) string {
+    return filepath.Join(p.dir, url.PathEscape(storeName) + ".log")
+}
+
+func (p *fileStorePersistence) Load(
+        storeName string, itemType reflect.Type) (map[string]interface{}, int64, bool, error) {
+
+    // the state includes all changes saved before
+    p.flush()
+
+    p.lock.Lock()
+    defer p.lock.Unlock()
+
+    rawItems, version, found, err := p.readState(storeName)
+    if err != nil || !found {
+        return nil, 0, found, err
+    }
+
+    items := make(map[string]interface{})
+    for id, rawValue := range rawItems {
+        value, err := decodePersistedValue(rawValue, itemType)
+        if err != nil {
+            return nil, 0, true, fmt.Errorf("failed to decode item '%s' of store '%s': %v", id, storeName, err)
+        }
+        items[id] = value
+    }
+    return items, version, true, nil
+}
+
+func decodePersistedValue(rawValue json.RawMessage, itemType reflect.Type) (interface{}, error) {
+    if itemType == nil {
+        var value interface{}
+        err := json.Unmarshal(rawValue, &value)
+        return value, err
+    }
+    return model.ConvertValueToTypeWithCodec([]byte(rawValue), itemType, model.JSONCodec)
+}
+
+// reads the last snapshot of the store and replays the change log on top of it.
+func (p *fileStorePersistence) readState(storeName string) (map[string]json.RawMessage, int64, bool, error) {
+    snapshot := &storeSnapshot{Items: make(map[string]json.RawMessage)}
+    found := false
+
+    data, err := ioutil.ReadFile(p.snapshotPath(storeName))
+    if err == nil {
+        found = true
+        if err := json.Unmarshal(data, snapshot); err != nil {
+            return nil, 0, true, fmt.Errorf("corrupted snapshot for store '%s': %v", storeName, err)
+        }
+        if snapshot.Items == nil {
+            snapshot.Items = make(map[string]json.RawMessage)
+        }
+    } else if !os.IsNotExist(err) {
+        return nil, 0, false, err
+    }
+
+    logFile, err := os.Open(p.logPath(storeName))
+    if err != nil {
+        if os.IsNotExist(err) {
+            return snapshot.Items, snapshot.StoreVersion, found, nil
+        }
+        return nil, 0, found, err
+    }
+    defer logFile.Close()
+
+    scanner := bufio.NewScanner(logFile)
+    scanner.Buffer(make([]byte, 64 * 1024), 64 * 1024 * 1024)
+    for scanner.Scan() {
+        var record storeChangeRecord
+        if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+            // a partially written last record, the change was never acknowledged
+            break
+        }
+        found = true
+        if record.StoreVersion <= snapshot.StoreVersion {
+            continue
+        }
+        if record.IsDeleteChange {
+            delete(snapshot.Items, record.Id)
+        } else {
+            snapshot.Items[record.Id] = record.Value
+        }
+        snapshot.StoreVersion = record.StoreVersion
+    }
+    if err := scanner.Err(); err != nil {
+        return nil, 0, found, err
+    }
+    return snapshot.Items, snapshot.StoreVersion, found, nil
+}
+
+func (p *fileStorePersistence) SaveChange(storeName string, change *StoreChange) error {
+    record := &storeChangeRecord{
+        Id:             change.Id,
+        IsDeleteChange: change.IsDeleteChange,
+        StoreVersion:   change.StoreVersion,
+    }
+    if !change.IsDeleteChange {
+        value, err := json.Marshal(change.Value)
+        if err != nil {
+            return err
+        }
+        record.Value = value
+    }
+    data, err := json.Marshal(record)
+    if err != nil {
+        return err
+    }
+    return p.queueWrite(&persistenceWrite{storeName: storeName, record: append(data, '\n')})
+}
+
+// hands the write over to the writer, the write is queued in the order of the calls.
+func (p *fileStorePersistence) queueWrite(write *persistenceWrite) error {
+    p.closeLock.RLock()
+    defer p.closeLock.RUnlock()
+    if p.closed {
+        return fmt.Errorf("store persistence is closed")
+    }
+    p.writes <- write
+    return nil
+}
+
+// waits until all queued writes are on the disk.
+func (p *fileStorePersistence) flush() {
+    done := make(chan struct{})
+    if err := p.queueWrite(&persistenceWrite{done: done}); err != nil {
+        return
+    }
+    <-done
+}
+
+func (p *fileStorePersistence) runWriter() {
+    defer close(p.writerDone)
+    for write := range p.writes {
+        batch := []*persistenceWrite{write}
+        // write all queued changes before syncing the change logs once
+        for more := true; more && len(batch) < persistenceWriteQueueSize; {
+            select {
+            case write, ok := <-p.writes:
+                if ok {
+                    batch = append(batch, write)
+                } else {
+                    more = false
+                }
+            default:
+                more = false
+            }
+        }
+
+        p.lock.Lock()
+        p.writeBatch(batch)
+        p.lock.Unlock()
+
+        for _, write := range batch {
+            if write.done != nil {
+                close(write.done)
+            }
+        }
+    }
+}
+
+func (p *fileStorePersistence) writeBatch(batch []*persistenceWrite) {
+    unsynced := make(map[string]bool)
+    for _, write := range batch {
+        var err error
+        switch {
+        case write.snapshot != nil:
+            delete(unsynced, write.storeName)
+            err = p.writeSnapshot(write.storeName, write.snapshot)
+        case write.record != nil:
+            unsynced[write.storeName] = true
+            err = p.appendRecord(write.storeName, write.record)
+        }
+        if err != nil {
+            log.Default().Warn("failed to persist store", "store", write.storeName, "error", err)
+        }
+    }
+    for storeName := range unsynced {
+        if sLog, ok := p.logs[storeName]; ok {
+            if err := sLog.file.Sync(); err != nil {
+                log.Default().Warn("failed to sync store change log", "store", storeName, "error", err)
+            }
+        }
+    }
+}
+
+func (p *fileStorePersistence) appendRecord(storeName string, record []byte) error {
+    sLog, err := p.openLog(storeName)
+    if err != nil {
+        return err
+    }
+    if _, err := sLog.file.Write(record); err != nil {
+        return err
+    }
+    sLog.changes++
+
+    if sLog.changes >= p.snapshotInterval {
+        return p.compact(storeName)
+    }
+    return nil
+}
+
+func (p *fileStorePersistence) openLog(storeName string) (*storeLog, error) {
+    sLog, ok := p.logs[storeName]
+    if ok {
+        return sLog, nil
+    }
+    file, err := os.OpenFile(p.logPath(storeName), os.O_CREATE | os.O_WRONLY | os.O_APPEND, 0644)
+    if err != nil {
+        return nil, err
+    }
+    sLog = &storeLog{file: file}
+    p.logs[storeName] = sLog
+    return sLog, nil
+}
+
+// folds the change log of the store into a new snapshot.
+func (p *fileStorePersistence) compact(storeName string) error {
+    items, version, _, err := p.readState(storeName)
+    if err != nil {
+        return err
+    }
+    return p.writeSnapshot(storeName, &storeSnapshot{Items: items, StoreVersion: version})
+}
+
+func (p *fileStorePersistence) SaveSnapshot(storeName string, items map[string]interface{}, version int64) error {
+    snapshot := &storeSnapshot{
+        StoreVersion: version,
+        Items:        make(map[string]json.RawMessage),
+    }
+    for id, value := range items {
+        data, err := json.Marshal(value)
+        if err != nil {
+            return err
+        }
+        snapshot.Items[id] = data
+    }
+    return p.queueWrite(&persistenceWrite{storeName: storeName, snapshot: snapshot})
+}
+
+// atomically replaces the snapshot of the store and truncates its change log.
+func (p *fileStorePersistence) writeSnapshot(storeName string, snapshot *storeSnapshot) error {
+    data, err := json.Marshal(snapshot)
+    if err != nil {
+        return err
+    }
+
+    // the snapshot data and the rename must be on the disk before the change log is removed.
+    tmpPath := p.snapshotPath(storeName) + ".tmp"
+    if err := writeFileSync(tmpPath, data); err != nil {
+        return err
+    }
+    if err := os.Rename(tmpPath, p.snapshotPath(storeName)); err != nil {
+        return err
+    }
+    if err := syncDir(p.dir); err != nil {
+        return err
+    }
+
+    if sLog, ok := p.logs[storeName]; ok {
+        sLog.file.Close()
+        delete(p.logs, storeName)
+    }
+    if err := os.Remove(p.logPath(storeName)); err != nil && !os.IsNotExist(err) {
+        return err
+    }
+    return nil
+}
+
+// writes the data to the file and flushes it to the disk.
+func writeFileSync(path string, data []byte) error {
+    file, err := os.OpenFile(path, os.O_CREATE | os.O_WRONLY | os.O_TRUNC, 0644)
+    if err != nil {
+        return err
+    }
+    if _, err := file.Write(data); err != nil {
+        file.Close()
+        return err
+    }
+    if err := file.Sync(); err != nil {
+        file.Close()
+        return err
+    }
+    return file.Close()
+}
+
+// flushes the directory entries, e.g. a renamed file, to the disk.
+func syncDir(dir string) error {
+    d, err := os.Open(dir)
+    if err != nil {
+        return err
+    }
+    defer d.Close()
+    if err := d.Sync(); err != nil && runtime.GOOS != "windows" {
+        return err
+    }
+    return nil
+}
+
+func (p *fileStorePersistence) Close() error {
+    p.closeLock.Lock()
+    if !p.closed {
+        p.closed = true
+        close(p.writes)
+    }
+    p.closeLock.Unlock()
+    <-p.writerDone
+
+    p.lock.Lock()
+    defer p.lock.Unlock()
+
+    var closeErr error
+    for name, sLog := range p.logs {
+        if err := sLog.file.Close(); err != nil {
+            closeErr = err
+        }
+        delete(p.logs, name)
+    }
+    return closeErr
+}
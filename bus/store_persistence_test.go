@@ -0,0 +1,176 @@
+// Copyright 2019-2020 VMware, Inc.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package bus
+
+import (
+    "github.com/stretchr/testify/assert"
+    "github.com/vmware/transport-go/log"
+    "io/ioutil"
+    "os"
+    "reflect"
+    "sync"
+    "testing"
+)
+
+type messageItem struct {
+    From    string `json:"from"`
+    Message string `json:"message"`
+}
+
+func createTestStorePersistence(t *testing.T, snapshotInterval int) (StorePersistence, string) {
+    dir, err := ioutil.TempDir("", "store-persistence")
+    assert.Nil(t, err)
+    persistence, err := NewFileStorePersistence(dir, snapshotInterval)
+    assert.Nil(t, err)
+    return persistence, dir
+}
+
+func TestStorePersistence_SurvivesRestart(t *testing.T) {
+    persistence, dir := createTestStorePersistence(t, 0)
+    defer os.RemoveAll(dir)
+
+    itemType := reflect.TypeOf(&messageItem{})
+
+    store := newStoreManager(newTestEventBus()).CreateStoreWithType(
+        "motdStore", itemType, WithStorePersistence(persistence))
+    assert.Nil(t, store.Populate(map[string]interface{}{
+        "motd": &messageItem{From: "test", Message: "default"},
+    }))
+    store.Put("motd", &messageItem{From: "test", Message: "updated"}, "update")
+    store.Put("item1", &messageItem{From: "test", Message: "item1"}, "add")
+    store.Put("item2", &messageItem{From: "test", Message: "item2"}, "add")
+    store.Remove("item1", "remove")
+    _, version := store.AllValuesAndVersion()
+    persistence.Close()
+
+    // simulate a process restart with a new bus and persistence.
+    persistence, err := NewFileStorePersistence(dir, 0)
+    assert.Nil(t, err)
+    defer persistence.Close()
+
+    restoredStore := newStoreManager(newTestEventBus()).CreateStoreWithType(
+        "motdStore", itemType, WithStorePersistence(persistence))
+
+    wg := sync.WaitGroup{}
+    wg.Add(1)
+    restoredStore.WhenReady(wg.Done)
+    wg.Wait()
+
+    items, restoredVersion := restoredStore.AllValuesAndVersion()
+    assert.Equal(t, version, restoredVersion)
+    assert.Equal(t, map[string]interface{}{
+        "motd": &messageItem{From: "test", Message: "updated"},
+        "item2": &messageItem{From: "test", Message: "item2"},
+    }, items)
+    assert.Equal(t, "updated", restoredStore.GetValue("motd").(*messageItem).Message)
+}
+
+func TestStorePersistence_EmptyStore(t *testing.T) {
+    persistence, dir := createTestStorePersistence(t, 0)
+    defer os.RemoveAll(dir)
+    defer persistence.Close()
+
+    items, version, found, err := persistence.Load("unknownStore", nil)
+    assert.Nil(t, err)
+    assert.False(t, found)
+    assert.Nil(t, items)
+    assert.Equal(t, int64(0), version)
+
+    store := newStoreManager(newTestEventBus()).CreateStoreWithType(
+        "unknownStore", nil, WithStorePersistence(persistence))
+    assert.Equal(t, 0, len(store.AllValues()))
+    assert.Nil(t, store.Populate(map[string]interface{}{"item1": "value1"}))
+}
+
+func TestStorePersistence_Compaction(t *testing.T) {
+    persistence, dir := createTestStorePersistence(t, 3)
+    defer os.RemoveAll(dir)
+    defer persistence.Close()
+
+    for i := int64(1); i <= 7; i++ {
+        assert.Nil(t, persistence.SaveChange("store", &StoreChange{
+            Id: "counter", Value: i, StoreVersion: i + 1,
+        }))
+    }
+    assert.Nil(t, persistence.SaveChange("store", &StoreChange{
+        Id: "item", Value: 100, StoreVersion: 9,
+    }))
+
+    // loading waits for the queued changes
+    items, version, found, err := persistence.Load("store", reflect.TypeOf(int64(0)))
+    assert.Nil(t, err)
+    assert.True(t, found)
+    assert.Equal(t, int64(9), version)
+    assert.Equal(t, int64(7), items["counter"])
+
+    fileInfos, _ := ioutil.ReadDir(dir)
+    var fileNames []string
+    for _, fi := range fileInfos {
+        fileNames = append(fileNames, fi.Name())
+    }
+    assert.Equal(t, []string{"store.log", "store.snapshot"}, fileNames)
+    assert.Nil(t, persistence.SaveChange("store", &StoreChange{
+        Id: "item", StoreVersion: 10, IsDeleteChange: true,
+    }))
+
+    items, version, _, _ = persistence.Load("store", nil)
+    assert.Equal(t, int64(10), version)
+    assert.Equal(t, map[string]interface{}{"counter": float64(7)}, items)
+
+    assert.Nil(t, persistence.Close())
+    assert.EqualError(t, persistence.SaveChange("store", &StoreChange{Id: "item", StoreVersion: 11}),
+        "store persistence is closed")
+}
+
+func TestStorePersistence_Reset(t *testing.T) {
+    persistence, dir := createTestStorePersistence(t, 0)
+    defer os.RemoveAll(dir)
+    defer persistence.Close()
+
+    store := newBusStore("store", newTestEventBus(), nil, nil, WithStorePersistence(persistence))
+    store.Put("item1", "value1", nil)
+    store.Reset()
+    store.Put("item2", "value2", nil)
+
+    items, version, found, err := persistence.Load("store", nil)
+    assert.Nil(t, err)
+    assert.True(t, found)
+    assert.Equal(t, int64(2), version)
+    assert.Equal(t, map[string]interface{}{"item2": "value2"}, items)
+}
+
+func TestStorePersistence_RestoredStoreEvents(t *testing.T) {
+    persistence, dir := createTestStorePersistence(t, 0)
+    defer os.RemoveAll(dir)
+
+    store := newStoreManager(newTestEventBus()).CreateStoreWithType(
+        "eventStore", nil, WithStorePersistence(persistence))
+    store.Put("item", "value", "add")
+    persistence.Close()
+
+    persistence, _ = NewFileStorePersistence(dir, 0)
+    defer persistence.Close()
+
+    var records []*log.Record
+    eventBus := newTestEventBus()
+    eventBus.SetLogger(log.New(log.HandlerFunc(func(record *log.Record) {
+        records = append(records, record)
+    }), log.WarnLevel))
+
+    var events []MonitorEventType
+    eventBus.AddMonitorEventListener(func(event *MonitorEvent) {
+        events = append(events, event.EventType)
+    }, StoreCreatedEvt, StoreInitializedEvt)
+
+    manager := newStoreManager(eventBus)
+    restored := manager.CreateStoreWithType("eventStore", nil, WithStorePersistence(persistence))
+    assert.Equal(t, []MonitorEventType{StoreCreatedEvt, StoreInitializedEvt}, events)
+    assert.Equal(t, "value", restored.GetValue("item"))
+    assert.Len(t, records, 0)
+
+    // the options of an existing store cannot be changed
+    assert.Equal(t, restored, manager.CreateStoreWithType("eventStore", nil, WithStoreChangeHistory(10)))
+    assert.Len(t, records, 1)
+    assert.Equal(t, "store already exists, the store options are ignored", records[0].Message)
+}
@@ -22,9 +22,14 @@ type streamFilter struct {
     states        []interface{}
     itemId        string
     matchAllItems bool
+    predicate     StoreChangePredicate
 }
 
 func (f *streamFilter) match(change *StoreChange) bool {
+    if f.predicate != nil && !f.predicate(change) {
+        return false
+    }
+
     if f.matchAllItems || f.itemId == change.Id {
         if len(f.states) == 0 {
             return true
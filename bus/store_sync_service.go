@@ -18,6 +18,9 @@ const (
     galacticStoreSyncRemove = "galacticStoreSyncRemove"
 )
 
+// Error code of the responses sent for UpdateStoreRequests with a stale clientStoreVersion.
+const StoreVersionConflictErrorCode = 409
+
 type storeSyncService struct {
     bus                EventBus
     lock               sync.Mutex
@@ -158,7 +161,15 @@ func (syncService *storeSyncService) openStore(
     }
     storeListener.addChannel(syncClient.channelName)
 
+    // clients which reconnect can send their last known store version
+    // to receive only the changes made since that version.
+    clientVersion, resume := getInt64Property("storeVersion", request)
+
     store.WhenReady(func() {
+        if resume && syncService.sendStoreChanges(syncClient.channelName, store, clientVersion) {
+            return
+        }
+
         items, version :=  store.AllValuesAndVersion()
 
         syncService.bus.SendResponseMessage(syncClient.channelName,
@@ -166,6 +177,34 @@ func (syncService *storeSyncService) openStore(
     })
 }
 
+// Sends an UpdateStoreResponse for every change made after the given version.
+// Returns false if the store change history doesn't reach back to that version.
+func (syncService *storeSyncService) sendStoreChanges(
+        clientChannel string, store BusStore, version int64) bool {
+
+    bStore, ok := store.(*busStore)
+    if !ok {
+        return false
+    }
+    changes, ok := bStore.changesSince(version)
+    if !ok {
+        return false
+    }
+    for _, change := range changes {
+        syncService.bus.SendResponseMessage(clientChannel, newUpdateStoreResponse(store, change), nil)
+    }
+    return true
+}
+
+func newUpdateStoreResponse(store BusStore, change *StoreChange) *model.UpdateStoreResponse {
+    updateStoreResp := model.NewUpdateStoreResponse(
+            store.GetName(), change.Id, change.Value, change.StoreVersion)
+    if change.IsDeleteChange {
+        updateStoreResp.NewItemValue = nil
+    }
+    return updateStoreResp
+}
+
 func (syncService *storeSyncService) closeStore(
         syncClient *syncClientChannel, request map[string]interface{}, reqId *uuid.UUID) {
 
@@ -213,9 +252,17 @@ func (syncService *storeSyncService) updateStore(
         return
     }
 
+    // requests without a client version overwrite the item unconditionally
+    clientVersion, hasClientVersion := getInt64Property("clientStoreVersion", request)
+
+    var updateErr error
     rawValue, ok := request["newItemValue"]
     if rawValue == nil {
-        store.Remove(itemId, galacticStoreSyncRemove)
+        if hasClientVersion {
+            _, updateErr = store.RemoveIfVersion(itemId, galacticStoreSyncRemove, clientVersion)
+        } else {
+            store.Remove(itemId, galacticStoreSyncRemove)
+        }
     } else {
         deserializedValue, err := model.ConvertValueToType(rawValue, store.GetItemType())
         if err != nil || deserializedValue == nil {
@@ -226,8 +273,36 @@ func (syncService *storeSyncService) updateStore(
             syncService.sendErrorResponse(syncClient.channelName, errMsg, reqId)
             return
         }
-        store.Put(itemId, deserializedValue, galacticStoreSyncUpdate)
+        if hasClientVersion {
+            updateErr = store.PutIfVersion(itemId, deserializedValue, galacticStoreSyncUpdate, clientVersion)
+        } else {
+            store.Put(itemId, deserializedValue, galacticStoreSyncUpdate)
+        }
     }
+
+    if conflictErr, isConflict := updateErr.(*StoreVersionConflictError); isConflict {
+        // send the current item value, so the client can resolve the conflict
+        currentValue, itemVersion, _ := store.GetWithVersion(itemId)
+        syncService.bus.SendResponseMessage(syncClient.channelName, &model.Response{
+            Id: reqId,
+            Error: true,
+            ErrorCode: StoreVersionConflictErrorCode,
+            ErrorMessage: conflictErr.Error(),
+            Payload: model.NewUpdateStoreResponse(storeId, itemId, currentValue, itemVersion),
+        }, nil)
+    }
+}
+
+func getInt64Property(id string, request map[string]interface{}) (int64, bool) {
+    switch value := request[id].(type) {
+    case float64:
+        return int64(value), true
+    case int64:
+        return value, true
+    case int:
+        return int64(value), true
+    }
+    return 0, false
 }
 
 func getStingProperty(id string, request map[string]interface{}) (string, bool) {
@@ -258,11 +333,7 @@ func newSyncStoreListener(bus EventBus, store BusStore) *syncStoreListener {
     }
 
     listener.storeStream.Subscribe(func(change *StoreChange) {
-        updateStoreResp := model.NewUpdateStoreResponse(
-                store.GetName(), change.Id, change.Value, change.StoreVersion)
-        if change.IsDeleteChange {
-            updateStoreResp.NewItemValue = nil
-        }
+        updateStoreResp := newUpdateStoreResponse(store, change)
 
         listener.lock.RLock()
         defer listener.lock.RUnlock()
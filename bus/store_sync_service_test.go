@@ -190,6 +190,84 @@ func TestStoreSyncService_OpenStore(t *testing.T) {
     bus.SendMonitorEvent(ChannelDestroyedEvt, syncChan2, nil)
 }
 
+func TestStoreSyncService_OpenStoreFromVersion(t *testing.T) {
+    _, bus := testStoreSyncService()
+
+    store := bus.GetStoreManager().CreateStoreWithType(
+        "test-store", reflect.TypeOf(&MockStoreItem{}), WithStoreChangeHistory(2))
+    store.Populate(map[string]interface{} {
+        "item1": &MockStoreItem{From:"test", Message:"test-message"},
+    })
+
+    // wait for all store change notifications before the client opens the store
+    changesWg := sync.WaitGroup{}
+    changesWg.Add(3)
+    store.OnAllChanges().Subscribe(func(change *StoreChange) {
+        changesWg.Done()
+    })
+    store.Put("item2", &MockStoreItem{From: "test2", Message: "m2"}, nil)
+    store.Put("item3", &MockStoreItem{From: "test3", Message: "m3"}, nil)
+    store.Remove("item2", nil)
+    changesWg.Wait()
+
+    syncChan := "transport-store-sync.1"
+    bus.GetChannelManager().CreateChannel(syncChan)
+    bus.SendMonitorEvent(FabricEndpointSubscribeEvt, syncChan, nil)
+
+    wg := sync.WaitGroup{}
+    var lock sync.Mutex
+    var syncResp [] interface{}
+    responses := func() []interface{} {
+        lock.Lock()
+        defer lock.Unlock()
+        return append([]interface{}(nil), syncResp...)
+    }
+
+    mh, _ := bus.ListenStream(syncChan)
+    mh.Handle(func(message *model.Message) {
+        lock.Lock()
+        syncResp = append(syncResp, message.Payload)
+        lock.Unlock()
+        wg.Done()
+    }, func(e error) {
+        assert.Fail(t, "Unexpected error")
+    })
+
+    wg.Add(2)
+    bus.SendRequestMessage(syncChan, &model.Request{
+        Request: openStoreRequest,
+        Payload: map[string]interface{} { "storeId": "test-store", "storeVersion": float64(2) },
+    }, nil)
+    wg.Wait()
+
+    // messages might be delivered in any order, clients use the storeVersion to order them
+    assert.ElementsMatch(t, []interface{}{
+        model.NewUpdateStoreResponse("test-store", "item3", &MockStoreItem{From: "test3", Message: "m3"}, 3),
+        model.NewUpdateStoreResponse("test-store", "item2", nil, 4),
+    }, responses())
+
+    // the history doesn't reach back to version 1, expect the whole store content
+    wg.Add(1)
+    bus.SendRequestMessage(syncChan, &model.Request{
+        Request: openStoreRequest,
+        Payload: map[string]interface{} { "storeId": "test-store", "storeVersion": float64(1) },
+    }, nil)
+    wg.Wait()
+
+    items, version := store.AllValuesAndVersion()
+    assert.Equal(t, model.NewStoreContentResponse("test-store", items, version), responses()[2])
+
+    // unknown versions also fall back to the store content
+    wg.Add(1)
+    bus.SendRequestMessage(syncChan, &model.Request{
+        Request: openStoreRequest,
+        Payload: map[string]interface{} { "storeId": "test-store", "storeVersion": float64(10) },
+    }, nil)
+    wg.Wait()
+
+    assert.Equal(t, model.NewStoreContentResponse("test-store", items, version), responses()[3])
+}
+
 func TestStoreSyncService_CloseStore(t *testing.T) {
     service, bus := testStoreSyncService()
 
@@ -512,3 +590,91 @@ func TestStoreSyncService_UpdateStore(t *testing.T) {
     assert.True(t, strings.HasPrefix(syncResp1[5].(*model.Response).ErrorMessage,
             "Cannot deserialize UpdateStoreRequest item value:"))
 }
+
+func TestStoreSyncService_UpdateStoreConflict(t *testing.T) {
+    _, bus := testStoreSyncService()
+
+    store := bus.GetStoreManager().CreateStoreWithType(
+        "test-store", reflect.TypeOf(&MockStoreItem{}))
+    store.Populate(map[string]interface{}{
+        "item1": &MockStoreItem{From: "test", Message: "test-message"},
+    })
+    store.Put("item1", &MockStoreItem{From: "test", Message: "updated-message"}, nil)
+
+    syncChan := "transport-store-sync.1"
+    bus.GetChannelManager().CreateChannel(syncChan)
+    bus.SendMonitorEvent(FabricEndpointSubscribeEvt, syncChan, nil)
+
+    wg := sync.WaitGroup{}
+    var syncResp []*model.Response
+
+    mh, _ := bus.ListenStream(syncChan)
+    mh.Handle(func(message *model.Message) {
+        resp, ok := message.Payload.(*model.Response)
+        if ok {
+            syncResp = append(syncResp, resp)
+            wg.Done()
+        }
+    }, func(e error) {
+        assert.Fail(t, "Unexpected error")
+    })
+
+    id := uuid.New()
+    wg.Add(1)
+    bus.SendRequestMessage(syncChan, &model.Request{
+        Id: &id,
+        Request: updateStoreRequest,
+        Payload: map[string]interface{} {
+            "storeId": "test-store",
+            "itemId": "item1",
+            "clientStoreVersion": float64(1),
+            "newItemValue": map[string]interface{} {
+                "From": "test2",
+                "Message": "stale-message",
+            }},
+    }, nil)
+    wg.Wait()
+
+    assert.Equal(t, 1, len(syncResp))
+    assert.Equal(t, &id, syncResp[0].Id)
+    assert.True(t, syncResp[0].Error)
+    assert.Equal(t, StoreVersionConflictErrorCode, syncResp[0].ErrorCode)
+    assert.Equal(t, model.NewUpdateStoreResponse("test-store", "item1",
+        &MockStoreItem{From: "test", Message: "updated-message"}, 2), syncResp[0].Payload)
+    assert.Equal(t, &MockStoreItem{From: "test", Message: "updated-message"}, store.GetValue("item1"))
+
+    wg.Add(1)
+    bus.SendRequestMessage(syncChan, &model.Request{
+        Id: &id,
+        Request: updateStoreRequest,
+        Payload: map[string]interface{} {
+            "storeId": "test-store",
+            "itemId": "item1",
+            "clientStoreVersion": float64(1),
+            "newItemValue": nil},
+    }, nil)
+    wg.Wait()
+
+    assert.Equal(t, StoreVersionConflictErrorCode, syncResp[1].ErrorCode)
+    assert.NotNil(t, store.GetValue("item1"))
+
+    storeWg := sync.WaitGroup{}
+    storeWg.Add(1)
+    store.OnChange("item1").Subscribe(func(change *StoreChange) {
+        storeWg.Done()
+    })
+    bus.SendRequestMessage(syncChan, &model.Request{
+        Request: updateStoreRequest,
+        Payload: map[string]interface{} {
+            "storeId": "test-store",
+            "itemId": "item1",
+            "clientStoreVersion": float64(2),
+            "newItemValue": map[string]interface{} {
+                "From": "test2",
+                "Message": "new-message",
+            }},
+    }, nil)
+    storeWg.Wait()
+
+    assert.Equal(t, &MockStoreItem{From: "test2", Message: "new-message"}, store.GetValue("item1"))
+}
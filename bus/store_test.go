@@ -132,6 +132,124 @@ func TestBusStore_Remove(t *testing.T) {
     assert.Equal(t, mutationEventsCounter, int32(1))
 }
 
+func TestBusStore_PutIfVersion(t *testing.T) {
+    store := testStore()
+    assert.Nil(t, store.PutIfVersion("id1", "item1", "ITEM_ADDED", 0))
+
+    v, version, ok := store.GetWithVersion("id1")
+    assert.True(t, ok)
+    assert.Equal(t, "item1", v)
+    assert.Equal(t, int64(2), version)
+
+    store.Put("id2", "item2", "ITEM_ADDED")
+
+    // changes of other items don't cause conflicts
+    assert.Nil(t, store.PutIfVersion("id1", "item1-v2", "ITEM_UPDATED", version))
+    _, version, _ = store.GetWithVersion("id1")
+    assert.Equal(t, int64(4), version)
+
+    err := store.PutIfVersion("id1", "item1-stale", "ITEM_UPDATED", 2)
+    assert.Equal(t, &StoreVersionConflictError{
+        StoreName: "testStore", ItemId: "id1", ItemVersion: 4, ExpectedVersion: 2}, err)
+    assert.Equal(t, "item1-v2", store.GetValue("id1"))
+
+    _, _, ok = store.GetWithVersion("invalid-id")
+    assert.False(t, ok)
+
+    // concurrent updates with the same version, only one of them should succeed
+    var successfulPutsCounter int32 = 0
+    wg := sync.WaitGroup{}
+    for i := 0; i < 50; i++ {
+        wg.Add(1)
+        go func() {
+            if store.PutIfVersion("id1", "item1-v3", "ITEM_UPDATED", 4) == nil {
+                atomic.AddInt32(&successfulPutsCounter, 1)
+            }
+            wg.Done()
+        }()
+    }
+    wg.Wait()
+    assert.Equal(t, int32(1), successfulPutsCounter)
+}
+
+func TestBusStore_RemoveIfVersion(t *testing.T) {
+    store := testStore()
+    store.Put("id1", "item1", "ITEM_ADDED")
+    store.Put("id1", "item1-v2", "ITEM_UPDATED")
+
+    removed, err := store.RemoveIfVersion("id1", "ITEM_REMOVED", 2)
+    assert.False(t, removed)
+    assert.Equal(t, int64(3), err.(*StoreVersionConflictError).ItemVersion)
+
+    removed, err = store.RemoveIfVersion("id1", "ITEM_REMOVED", 3)
+    assert.True(t, removed)
+    assert.Nil(t, err)
+
+    removed, err = store.RemoveIfVersion("id1", "ITEM_REMOVED", 4)
+    assert.False(t, removed)
+    assert.Nil(t, err)
+
+    // stale updates cannot recreate removed items
+    err = store.PutIfVersion("id1", "item1-v3", "ITEM_ADDED", 3)
+    assert.NotNil(t, err)
+    assert.Nil(t, store.PutIfVersion("id1", "item1-v3", "ITEM_ADDED", 4))
+}
+
+func TestBusStore_PruneRemovedItemVersions(t *testing.T) {
+    store := newBusStore("testStore", newTestEventBus(), nil, nil, WithStoreChangeHistory(3)).(*busStore)
+    for i := 0; i < 100; i++ {
+        id := fmt.Sprintf("id%d", i)
+        store.Put(id, i, "ITEM_ADDED")
+        store.Remove(id, "ITEM_REMOVED")
+    }
+    store.Put("id1", "item1", "ITEM_ADDED")
+
+    // only the removals in the change history keep their versions
+    assert.Equal(t, map[string]int64{"id99": 201, "id1": 202}, store.itemVersions)
+    assert.NotNil(t, store.PutIfVersion("id99", "stale", "ITEM_ADDED", 200))
+
+    store = newBusStore("testStore", newTestEventBus(), nil, nil, WithStoreChangeHistory(0)).(*busStore)
+    store.Put("id1", "item1", "ITEM_ADDED")
+    store.Remove("id1", "ITEM_REMOVED")
+    assert.Len(t, store.itemVersions, 0)
+}
+
+func TestBusStore_ChangesSince(t *testing.T) {
+    store := newBusStore("testStore", newTestEventBus(), nil, nil, WithStoreChangeHistory(2)).(*busStore)
+
+    changes, ok := store.changesSince(1)
+    assert.True(t, ok)
+    assert.Equal(t, 0, len(changes))
+
+    store.Put("id1", "value1", nil)
+    store.Put("id2", "value2", nil)
+
+    changes, ok = store.changesSince(1)
+    assert.True(t, ok)
+    assert.Equal(t, 2, len(changes))
+    assert.Equal(t, "id1", changes[0].Id)
+    assert.Equal(t, "id2", changes[1].Id)
+
+    store.Remove("id1", nil)
+
+    _, ok = store.changesSince(1)
+    assert.False(t, ok)
+
+    changes, ok = store.changesSince(2)
+    assert.True(t, ok)
+    assert.Equal(t, 2, len(changes))
+    assert.Equal(t, int64(3), changes[0].StoreVersion)
+    assert.Equal(t, int64(4), changes[1].StoreVersion)
+    assert.True(t, changes[1].IsDeleteChange)
+
+    _, ok = store.changesSince(5)
+    assert.False(t, ok)
+
+    store.Reset()
+    _, ok = store.changesSince(0)
+    assert.False(t, ok)
+}
+
 func TestBusStore_AllValuesAndAllValuesAsMap(t *testing.T) {
     store := testStore()
 
@@ -163,6 +281,110 @@ func TestBusStore_AllValuesAndAllValuesAsMap(t *testing.T) {
     assert.Equal(t, version, int64(4))
 }
 
+func TestBusStore_Query(t *testing.T) {
+    store := testStore()
+    store.Put("id1", 1, "ITEM_ADDED")
+    store.Put("id2", 2, "ITEM_ADDED")
+    store.Put("id3", 3, "ITEM_ADDED")
+
+    result := store.Query(func(id string, value interface{}) bool {
+        return value.(int) > 1
+    })
+    assert.Equal(t, map[string]interface{}{"id2": 2, "id3": 3}, result)
+
+    result = store.Query(func(id string, value interface{}) bool {
+        return false
+    })
+    assert.Equal(t, 0, len(result))
+}
+
+func TestBusStore_CreateIndex(t *testing.T) {
+    store := newBusStore("testStore", newTestEventBus(), reflect.TypeOf(&MockStoreItem{}), nil)
+
+    assert.EqualError(t, store.CreateIndex("invalid", "Invalid"),
+        "item type *bus.MockStoreItem has no field 'Invalid'")
+
+    store.Put("id1", &MockStoreItem{From: "user1", Message: "m1"}, nil)
+    store.Put("id2", &MockStoreItem{From: "user2", Message: "m2"}, nil)
+
+    assert.Nil(t, store.CreateIndex("from", "From"))
+    assert.EqualError(t, store.CreateIndex("from", "From"), "index 'from' already exists")
+
+    store.Put("id3", &MockStoreItem{From: "user1", Message: "m3"}, nil)
+
+    result, err := store.QueryIndex("from", "user1")
+    assert.Nil(t, err)
+    assert.Equal(t, map[string]interface{}{
+        "id1": &MockStoreItem{From: "user1", Message: "m1"},
+        "id3": &MockStoreItem{From: "user1", Message: "m3"},
+    }, result)
+
+    store.Put("id1", &MockStoreItem{From: "user2", Message: "m1"}, nil)
+    store.Remove("id2", nil)
+
+    result, _ = store.QueryIndex("from", "user1")
+    assert.Equal(t, map[string]interface{}{"id3": &MockStoreItem{From: "user1", Message: "m3"}}, result)
+    result, _ = store.QueryIndex("from", "user2")
+    assert.Equal(t, map[string]interface{}{"id1": &MockStoreItem{From: "user2", Message: "m1"}}, result)
+    result, _ = store.QueryIndex("from", "user3")
+    assert.Equal(t, 0, len(result))
+
+    _, err = store.QueryIndex("invalid", "user1")
+    assert.EqualError(t, err, "index 'invalid' doesn't exist")
+
+    // indexes are kept when the store is reset
+    store.Reset()
+    result, _ = store.QueryIndex("from", "user1")
+    assert.Equal(t, 0, len(result))
+    store.Populate(map[string]interface{}{"id4": &MockStoreItem{From: "user1", Message: "m4"}})
+    result, _ = store.QueryIndex("from", "user1")
+    assert.Equal(t, map[string]interface{}{"id4": &MockStoreItem{From: "user1", Message: "m4"}}, result)
+}
+
+func TestBusStore_CreateIndexUntypedStore(t *testing.T) {
+    store := testStore()
+    store.Put("id1", map[string]interface{}{"type": "vm", "name": "vm1"}, nil)
+    store.Put("id2", map[string]interface{}{"type": "host", "name": "host1"}, nil)
+    store.Put("id3", MockStoreItem{From: "user1"}, nil)
+    store.Put("id4", 4, nil)
+
+    assert.Nil(t, store.CreateIndex("type", "type"))
+    result, _ := store.QueryIndex("type", "vm")
+    assert.Equal(t, map[string]interface{}{"id1": map[string]interface{}{"type": "vm", "name": "vm1"}}, result)
+
+    assert.Nil(t, store.CreateIndex("from", "From"))
+    result, _ = store.QueryIndex("from", "user1")
+    assert.Equal(t, map[string]interface{}{"id3": MockStoreItem{From: "user1"}}, result)
+
+    // values which are not comparable never match
+    result, _ = store.QueryIndex("from", []string{"user1"})
+    assert.Equal(t, 0, len(result))
+}
+
+func TestBusStore_OnMatchingChanges(t *testing.T) {
+    store := testStore()
+
+    wg := sync.WaitGroup{}
+    var changes []*StoreChange
+
+    store.OnMatchingChanges(func(change *StoreChange) bool {
+        return change.Value.(int) % 2 == 0
+    }, "ITEM_ADDED").Subscribe(func(change *StoreChange) {
+        changes = append(changes, change)
+        wg.Done()
+    })
+
+    wg.Add(1)
+    store.Put("id1", 1, "ITEM_ADDED")
+    store.Put("id2", 2, "ITEM_UPDATED")
+    store.Put("id3", 3, "ITEM_ADDED")
+    store.Put("id4", 4, "ITEM_ADDED")
+    wg.Wait()
+
+    assert.Equal(t, 1, len(changes))
+    assert.Equal(t, "id4", changes[0].Id)
+}
+
 func TestBusStore_OnChange(t *testing.T) {
     store := testStore()
 
@@ -541,13 +763,19 @@ func TestBusStore_InitGalacticStore(t *testing.T) {
     assert.Equal(t, rq["newItemValue"], nil)
     assert.Equal(t, rq["clientStoreVersion"], float64(12))
 
-    store.Reset()
+    assert.Nil(t, store.PutIfVersion("id2", "value2", "add", 7))
     assert.Equal(t, len(conn.messages), 4)
+    rq = conn.lastMessage()["payload"].(map[string]interface{})
+    assert.Equal(t, rq["itemId"], "id2")
+    assert.Equal(t, rq["clientStoreVersion"], float64(7))
+
+    store.Reset()
+    assert.Equal(t, len(conn.messages), 5)
     assert.Equal(t, conn.lastTopic(), "/pub/sync-channel")
     assert.Equal(t, conn.lastMessage()["request"], "openStore")
 
     store.(*busStore).OnDestroy()
-    assert.Equal(t, len(conn.messages), 5)
+    assert.Equal(t, len(conn.messages), 6)
     assert.Equal(t, conn.lastTopic(), "/pub/sync-channel")
     assert.Equal(t, conn.lastMessage()["request"], "closeStore")
 }
@@ -618,6 +846,38 @@ func TestBusStore_GalacticStoreUpdates(t *testing.T) {
     assert.Nil(t, store.GetValue("id1"))
 }
 
+func TestBusStore_GalacticStoreChangeOrder(t *testing.T) {
+    s, conn, _ := testGalacticStore(nil)
+    store := s.(*busStore)
+    update := func(version int64) map[string]interface{} {
+        return map[string]interface{}{"storeVersion": float64(version)}
+    }
+
+    // changes are applied as they arrive until the store content is received
+    assert.True(t, store.isNextChange(update(5)))
+
+    store.storeVersion = 10
+    store.Initialize()
+
+    assert.False(t, store.isNextChange(update(9)))
+    assert.False(t, store.isNextChange(update(10)))
+    assert.True(t, store.isNextChange(update(11)))
+
+    // a missing change triggers a single resync request
+    assert.False(t, store.isNextChange(update(12)))
+    assert.False(t, store.isNextChange(update(13)))
+    assert.Len(t, conn.messages, 2)
+    assert.Equal(t, "openStore", conn.lastMessage()["request"])
+    assert.Equal(t, map[string]interface{}{"storeId": "testStore", "storeVersion": float64(10)},
+        conn.lastMessage()["payload"])
+
+    store.storeVersion = 11
+    assert.True(t, store.isNextChange(update(12)))
+    store.storeVersion = 12
+    assert.False(t, store.isNextChange(update(14)))
+    assert.Len(t, conn.messages, 3)
+}
+
 func TestBusStore_GalacticStoreContent(t *testing.T) {
     store, _, bus := testGalacticStore(reflect.TypeOf(MockStoreItem{}))
 
@@ -4,10 +4,14 @@
 package bus
 
 import (
+    "context"
+    "errors"
     "fmt"
     "github.com/google/uuid"
     "github.com/vmware/transport-go/model"
+    "strings"
     "sync"
+    "time"
 )
 
 type transactionType int
@@ -18,9 +22,53 @@ const (
 
 type BusTransactionReadyFunction func(responses []*model.Message)
 
+// Error passed to the OnError handlers when the transaction deadline passed.
+var ErrTransactionTimeout = errors.New("transaction timed out")
+
+// Default time to wait for the response to a compensating request.
+const DefaultCompensationTimeout = 30 * time.Second
+
+// CompensatingRequest undoes the effect of a transaction request. It is sent if the
+// request succeeded but the transaction was aborted afterwards.
+type CompensatingRequest struct {
+    Channel string
+    Payload interface{}
+    // Optional function which builds the payload from the response to the original request,
+    // e.g. to delete a resource by the id returned when it was created. Overrides Payload.
+    PayloadFunc func(response *model.Message) interface{}
+    // Time to wait for the response, DefaultCompensationTimeout if zero
+    Timeout time.Duration
+}
+
+// CompensationError is passed to the OnError handlers if some compensating requests
+// of an aborted transaction failed.
+type CompensationError struct {
+    // The error which aborted the transaction
+    Cause error
+    // The errors of the failed compensating requests
+    Errors []error
+}
+
+func (e *CompensationError) Error() string {
+    messages := make([]string, len(e.Errors))
+    for i, err := range e.Errors {
+        messages[i] = err.Error()
+    }
+    return fmt.Sprintf("%s (compensation failed: %s)", e.Cause.Error(), strings.Join(messages, "; "))
+}
+
+func (e *CompensationError) Unwrap() error {
+    return e.Cause
+}
+
 type BusTransaction interface {
     // Sends a request to a channel as a part of this transaction.
     SendRequest(channel string, payload interface{}) error
+    // Same as SendRequest, but if the transaction is aborted after the request succeeded the
+    // compensating request is sent to undo it. Compensating requests are sent one at a time,
+    // in the reverse order of the responses, before the OnError handlers are called. A response
+    // which arrives after the abort, e.g. after the timeout, is compensated on its own.
+    SendRequestWithCompensation(channel string, payload interface{}, compensation *CompensatingRequest) error
     //  Wait for a store to be initialized as a part of this transaction.
     WaitForStoreReady(storeName string) error
     // Registers a new complete handler. Once all responses to requests have been received,
@@ -29,6 +77,9 @@ type BusTransaction interface {
     // Register a new error handler. If an error is thrown by any of the responders, the transaction
     // is aborted and the error sent to the registered errorHandlers.
     OnError(errorHandler MessageErrorFunction) error
+    // Abort the transaction with ErrTransactionTimeout if it is not complete within the timeout
+    // after Commit. Zero disables the timeout.
+    SetTimeout(timeout time.Duration) error
     // Commit the transaction, all requests will be sent and will wait for responses.
     // Once all the responses are in, onComplete handlers will be called with the responses.
     Commit() error
@@ -47,6 +98,7 @@ type busTransactionRequest struct {
     storeName    string
     channelName  string
     payload      interface{}
+    compensation *CompensatingRequest
 }
 
 type busTransaction struct {
@@ -59,6 +111,12 @@ type busTransaction struct {
     onErrorHandlers    []MessageErrorFunction
     bus                EventBus
     completedRequests  int
+    // requests in the order they succeeded
+    succeededRequests  []*busTransactionRequest
+    // response handlers of the requests waiting for a response
+    pendingHandlers    map[int]MessageHandler
+    timeout            time.Duration
+    timer              *time.Timer
 }
 
 func newBusTransaction(bus EventBus, transactionType transactionType) BusTransaction {
@@ -71,6 +129,7 @@ func newBusTransaction(bus EventBus, transactionType transactionType) BusTransac
     transaction.onCompleteHandlers = make([]BusTransactionReadyFunction, 0)
     transaction.onErrorHandlers = make([]MessageErrorFunction, 0)
     transaction.completedRequests = 0
+    transaction.pendingHandlers = make(map[int]MessageHandler)
 
     return transaction
 }
@@ -83,6 +142,12 @@ func (tr *busTransaction) checkUncommittedState() error {
 }
 
 func (tr *busTransaction) SendRequest(channel string, payload interface{}) error {
+    return tr.SendRequestWithCompensation(channel, payload, nil)
+}
+
+func (tr *busTransaction) SendRequestWithCompensation(
+        channel string, payload interface{}, compensation *CompensatingRequest) error {
+
     tr.lock.Lock()
     defer tr.lock.Unlock()
 
@@ -94,6 +159,7 @@ func (tr *busTransaction) SendRequest(channel string, payload interface{}) error
         channelName: channel,
         payload: payload,
         requestIndex: len(tr.requests),
+        compensation: compensation,
     })
 
     return nil
@@ -143,7 +209,7 @@ func (tr *busTransaction) OnError(errorHandler MessageErrorFunction) error {
     return nil
 }
 
-func (tr *busTransaction) Commit() error {
+func (tr *busTransaction) SetTimeout(timeout time.Duration) error {
     tr.lock.Lock()
     defer tr.lock.Unlock()
 
@@ -151,7 +217,20 @@ func (tr *busTransaction) Commit() error {
         return err
     }
 
+    tr.timeout = timeout
+    return nil
+}
+
+func (tr *busTransaction) Commit() error {
+    tr.lock.Lock()
+
+    if err := tr.checkUncommittedState(); err != nil {
+        tr.lock.Unlock()
+        return err
+    }
+
     if len(tr.requests) == 0 {
+        tr.lock.Unlock()
         return fmt.Errorf("cannot commit empty transaction")
     }
 
@@ -160,6 +239,15 @@ func (tr *busTransaction) Commit() error {
     // init responses slice
     tr.responses = make([]*model.Message, len(tr.requests))
 
+    if tr.timeout > 0 {
+        tr.timer = time.AfterFunc(tr.timeout, func() {
+            tr.onTransactionError(ErrTransactionTimeout)
+        })
+    }
+
+    // the requests are sent without holding the lock as their handlers update the transaction state
+    tr.lock.Unlock()
+
     if tr.transactionType == asyncTransaction {
         tr.startAsyncTransaction()
     } else {
@@ -202,23 +290,117 @@ func (tr *busTransaction) sendRequest(req *busTransactionRequest) {
         tr.onTransactionError(e)
     })
 
+    // the handler is registered before the request is sent, so it can be closed on abort
+    tr.lock.Lock()
+    if tr.state == abortedState {
+        tr.lock.Unlock()
+        mh.Close()
+        return
+    }
+    tr.pendingHandlers[req.requestIndex] = mh
+    tr.lock.Unlock()
+
     tr.bus.SendRequestMessage(req.channelName, req.payload, &reqId)
 }
 
 func (tr *busTransaction) onTransactionError(err error) {
     tr.lock.Lock()
-    defer tr.lock.Unlock()
 
-    if tr.state == abortedState {
+    if tr.state == abortedState || tr.state == completedState {
+        tr.lock.Unlock()
         return
     }
 
     tr.state = abortedState
+    tr.stopTimer()
+
+    // stop waiting for the responses to the requests which are still in progress
+    for _, mh := range tr.pendingHandlers {
+        mh.Close()
+    }
+    tr.pendingHandlers = nil
+
+    // the responses are copied while holding the lock, the compensation runs without it
+    var compensations []*compensationJob
+    for i := len(tr.succeededRequests) - 1; i >= 0; i-- {
+        if req := tr.succeededRequests[i]; req.compensation != nil {
+            compensations = append(compensations, &compensationJob{
+                request:  req,
+                response: tr.responses[req.requestIndex],
+            })
+        }
+    }
+    tr.lock.Unlock()
+
+    if len(compensations) == 0 {
+        tr.notifyErrorHandlers(err)
+        return
+    }
+    go tr.compensate(err, compensations)
+}
+
+func (tr *busTransaction) notifyErrorHandlers(err error) {
     for _, errorHandler := range tr.onErrorHandlers {
         go errorHandler(err)
     }
 }
 
+// a succeeded request to compensate and its response.
+type compensationJob struct {
+    request  *busTransactionRequest
+    response *model.Message
+}
+
+// Sends the compensating requests one at a time and passes the abort error to the error handlers.
+func (tr *busTransaction) compensate(err error, jobs []*compensationJob) {
+    var compensationErrors []error
+    for _, job := range jobs {
+        if compensationErr := tr.sendCompensatingRequest(job); compensationErr != nil {
+            compensationErrors = append(compensationErrors, fmt.Errorf(
+                "compensating request on channel '%s' failed: %w", job.request.compensation.Channel, compensationErr))
+        }
+    }
+
+    if len(compensationErrors) > 0 {
+        err = &CompensationError{Cause: err, Errors: compensationErrors}
+    }
+    tr.notifyErrorHandlers(err)
+}
+
+func (tr *busTransaction) sendCompensatingRequest(job *compensationJob) error {
+    compensation := job.request.compensation
+    payload := compensation.Payload
+    if compensation.PayloadFunc != nil {
+        payload = compensation.PayloadFunc(job.response)
+    }
+    timeout := compensation.Timeout
+    if timeout <= 0 {
+        timeout = DefaultCompensationTimeout
+    }
+
+    ctx, cancel := context.WithTimeout(context.Background(), timeout)
+    defer cancel()
+    reqId := uuid.New()
+    _, err := tr.bus.RequestOnceForDestinationWithContext(ctx, compensation.Channel, payload, &reqId)
+    return err
+}
+
+// Undoes a request which succeeded after the abort, the error handlers may already have been
+// called so a failure of the compensating request is only logged.
+func (tr *busTransaction) compensateLateResponse(job *compensationJob) {
+    if err := tr.sendCompensatingRequest(job); err != nil {
+        tr.bus.GetLogger().Warn("compensating request for a late transaction response failed",
+            "channel", job.request.compensation.Channel, "error", err)
+    }
+}
+
+// Stops the transaction timer, the caller must hold the lock.
+func (tr *busTransaction) stopTimer() {
+    if tr.timer != nil {
+        tr.timer.Stop()
+    }
+}
+
 func (tr *busTransaction) waitForStore(req *busTransactionRequest) {
     store := tr.bus.GetStoreManager().GetStore(req.storeName)
     if store == nil {
@@ -239,14 +421,21 @@ func (tr *busTransaction) onTransactionRequestSuccess(req *busTransactionRequest
 
     if tr.state == abortedState {
         tr.lock.Unlock()
+        // the request succeeded after the transaction was aborted, e.g. by the timeout
+        if req.compensation != nil {
+            go tr.compensateLateResponse(&compensationJob{request: req, response: message})
+        }
         return
     }
 
     tr.responses[req.requestIndex] = message
     tr.completedRequests++
+    tr.succeededRequests = append(tr.succeededRequests, req)
+    delete(tr.pendingHandlers, req.requestIndex)
 
     if tr.completedRequests == len(tr.requests) {
         tr.state = completedState
+        tr.stopTimer()
         triggerOnCompleteHandler = true
     }
 
@@ -10,6 +10,7 @@ import (
     "sync"
     "sync/atomic"
     "testing"
+    "time"
 )
 
 func TestBusTransaction_OnCompleteSync(t *testing.T) {
@@ -323,3 +324,184 @@ func TestBusTransaction_OnErrorAsync(t *testing.T) {
 
     assert.Equal(t, errorHandlerCount, int64(1))
 }
+
+// responds to the requests on the channel, or sends an error if the respond function returns one.
+func respondToRequests(bus EventBus, channel string, respond func(message *model.Message) (interface{}, error)) {
+    bus.GetChannelManager().CreateChannel(channel)
+    mh, _ := bus.ListenRequestStream(channel)
+    mh.Handle(func(message *model.Message) {
+        response, err := respond(message)
+        if err != nil {
+            bus.SendErrorMessage(channel, err, message.DestinationId)
+        } else {
+            bus.SendResponseMessage(channel, response, message.DestinationId)
+        }
+    }, func(e error) {})
+}
+
+func TestBusTransaction_Compensation(t *testing.T) {
+    bus := newTestEventBus()
+
+    var lock sync.Mutex
+    var compensated []string
+    compensate := func(message *model.Message) (interface{}, error) {
+        lock.Lock()
+        defer lock.Unlock()
+        compensated = append(compensated, message.Channel + ":" + message.Payload.(string))
+        return "undone", nil
+    }
+
+    respondToRequests(bus, "create-order", func(message *model.Message) (interface{}, error) {
+        return "order-1", nil
+    })
+    respondToRequests(bus, "reserve-stock", func(message *model.Message) (interface{}, error) {
+        return "reservation-1", nil
+    })
+    respondToRequests(bus, "charge-card", func(message *model.Message) (interface{}, error) {
+        return nil, errors.New("test-error")
+    })
+    respondToRequests(bus, "delete-order", compensate)
+    respondToRequests(bus, "release-stock", compensate)
+
+    tr := newBusTransaction(bus, syncTransaction)
+    assert.Nil(t, tr.SendRequestWithCompensation("create-order", "new-order", &CompensatingRequest{
+        Channel: "delete-order",
+        PayloadFunc: func(response *model.Message) interface{} {
+            return response.Payload
+        },
+    }))
+    assert.Nil(t, tr.SendRequestWithCompensation("reserve-stock", "order-1", &CompensatingRequest{
+        Channel: "release-stock",
+        Payload: "order-1",
+    }))
+    assert.Nil(t, tr.SendRequest("charge-card", "order-1"))
+
+    errCh := make(chan error, 1)
+    tr.OnComplete(func(responses []*model.Message) {
+        assert.Fail(t, "unexpected completion")
+    })
+    tr.OnError(func(e error) {
+        errCh <- e
+    })
+
+    assert.Nil(t, tr.Commit())
+    assert.EqualError(t, <-errCh, "test-error")
+
+    lock.Lock()
+    defer lock.Unlock()
+    assert.Equal(t, []string{"release-stock:order-1", "delete-order:order-1"}, compensated)
+}
+
+func TestBusTransaction_CompensationError(t *testing.T) {
+    bus := newTestEventBus()
+
+    respondToRequests(bus, "step-1", func(message *model.Message) (interface{}, error) {
+        return "ok", nil
+    })
+    respondToRequests(bus, "step-2", func(message *model.Message) (interface{}, error) {
+        return "ok", nil
+    })
+    respondToRequests(bus, "step-3", func(message *model.Message) (interface{}, error) {
+        return nil, errors.New("test-error")
+    })
+    respondToRequests(bus, "undo-step", func(message *model.Message) (interface{}, error) {
+        return nil, errors.New("undo failed")
+    })
+
+    tr := newBusTransaction(bus, syncTransaction)
+    tr.SendRequestWithCompensation("step-1", "request", &CompensatingRequest{Channel: "undo-step", Payload: "1"})
+    tr.SendRequestWithCompensation("step-2", "request", &CompensatingRequest{Channel: "undo-step", Payload: "2"})
+    tr.SendRequest("step-3", "request")
+
+    errCh := make(chan error, 1)
+    tr.OnError(func(e error) {
+        errCh <- e
+    })
+    assert.Nil(t, tr.Commit())
+
+    err := <-errCh
+    compensationErr, ok := err.(*CompensationError)
+    assert.True(t, ok)
+    assert.EqualError(t, compensationErr.Cause, "test-error")
+    assert.Len(t, compensationErr.Errors, 2)
+    assert.True(t, errors.Is(err, compensationErr.Cause))
+    assert.EqualError(t, err, "test-error (compensation failed: " +
+        "compensating request on channel 'undo-step' failed: undo failed; " +
+        "compensating request on channel 'undo-step' failed: undo failed)")
+}
+
+func TestBusTransaction_Timeout(t *testing.T) {
+    bus := newTestEventBus()
+
+    var compensations int64
+    respondToRequests(bus, "fast-channel", func(message *model.Message) (interface{}, error) {
+        return "ok", nil
+    })
+    respondToRequests(bus, "undo-channel", func(message *model.Message) (interface{}, error) {
+        atomic.AddInt64(&compensations, 1)
+        return "ok", nil
+    })
+    // requests on the slow channel are never answered
+    bus.GetChannelManager().CreateChannel("slow-channel")
+
+    tr := newBusTransaction(bus, syncTransaction)
+    tr.SendRequestWithCompensation("fast-channel", "request", &CompensatingRequest{Channel: "undo-channel"})
+    tr.SendRequest("slow-channel", "request")
+    assert.Nil(t, tr.SetTimeout(20 * time.Millisecond))
+
+    errCh := make(chan error, 1)
+    tr.OnError(func(e error) {
+        errCh <- e
+    })
+    assert.Nil(t, tr.Commit())
+    assert.EqualError(t, tr.SetTimeout(time.Second), "transaction has already been committed")
+
+    select {
+    case err := <-errCh:
+        assert.Equal(t, ErrTransactionTimeout, err)
+    case <-time.After(5 * time.Second):
+        assert.Fail(t, "transaction did not time out")
+    }
+    assert.Equal(t, int64(1), atomic.LoadInt64(&compensations))
+    assert.Equal(t, abortedState, tr.(*busTransaction).state)
+    assert.Nil(t, tr.(*busTransaction).pendingHandlers)
+}
+
+func TestBusTransaction_LateResponseCompensation(t *testing.T) {
+    bus := newTestEventBus()
+
+    undone := make(chan interface{}, 1)
+    respondToRequests(bus, "undo-channel", func(message *model.Message) (interface{}, error) {
+        undone <- message.Payload
+        return "ok", nil
+    })
+    // the request is answered after the transaction timed out
+    bus.GetChannelManager().CreateChannel("slow-channel")
+
+    tr := newBusTransaction(bus, asyncTransaction)
+    tr.SendRequestWithCompensation("slow-channel", "request", &CompensatingRequest{
+        Channel: "undo-channel",
+        PayloadFunc: func(response *model.Message) interface{} {
+            return response.Payload
+        },
+    })
+    tr.SetTimeout(10 * time.Millisecond)
+
+    errCh := make(chan error, 1)
+    tr.OnError(func(e error) {
+        errCh <- e
+    })
+    assert.Nil(t, tr.Commit())
+    assert.Equal(t, ErrTransactionTimeout, <-errCh)
+
+    busTr := tr.(*busTransaction)
+    busTr.onTransactionRequestSuccess(busTr.requests[0], &model.Message{Payload: "resource-1"})
+
+    select {
+    case payload := <-undone:
+        assert.Equal(t, "resource-1", payload)
+    case <-time.After(5 * time.Second):
+        assert.Fail(t, "the late response was not compensated")
+    }
+    assert.Empty(t, busTr.succeededRequests)
+}
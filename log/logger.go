@@ -23,7 +23,7 @@ var Version = ""
 func Warn(format string, arg ...interface{}) {
     color.NoColor = false
     color.Set(color.FgHiMagenta)
-    if !WarnFlag {
+    if WarnFlag {
         fmt.Printf("⚠️🚨 WARNING: "+format, arg...)
     }
     color.Unset()
@@ -0,0 +1,288 @@
+// Copyright 2019-2020 VMware, Inc.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package log
+
+import (
+    "bytes"
+    "context"
+    "encoding/json"
+    "fmt"
+    "io"
+    "os"
+    "strconv"
+    "sync"
+    "time"
+)
+
+// Severity of a log record.
+type Level int
+
+const (
+    DebugLevel Level = iota
+    InfoLevel
+    WarnLevel
+    ErrorLevel
+)
+
+func (l Level) String() string {
+    switch l {
+    case DebugLevel:
+        return "DEBUG"
+    case InfoLevel:
+        return "INFO"
+    case WarnLevel:
+        return "WARN"
+    case ErrorLevel:
+        return "ERROR"
+    }
+    return "LEVEL(" + strconv.Itoa(int(l)) + ")"
+}
+
+// Key-value pair attached to a log record, e.g. the channel name or the connection id.
+type Field struct {
+    Key   string
+    Value interface{}
+}
+
+// Record is a single log entry passed to a Handler.
+type Record struct {
+    Time    time.Time
+    Level   Level
+    Message string
+    Fields  []Field
+}
+
+// Handler writes log records, e.g. to the console or to a log pipeline.
+type Handler interface {
+    Handle(record *Record)
+}
+
+// Adapter which allows the use of ordinary functions as Handler.
+type HandlerFunc func(record *Record)
+
+func (f HandlerFunc) Handle(record *Record) {
+    f(record)
+}
+
+// Logger is a leveled, structured logger. The keyValues arguments are alternating
+// keys and values, e.g. logger.Warn("message discarded", "channel", channelName).
+type Logger interface {
+    Debug(msg string, keyValues ...interface{})
+    Info(msg string, keyValues ...interface{})
+    Warn(msg string, keyValues ...interface{})
+    Error(msg string, keyValues ...interface{})
+    // Returns a logger which adds the key-value pairs to all its records.
+    With(keyValues ...interface{}) Logger
+    // Returns true if records of the level are passed to the handler.
+    Enabled(level Level) bool
+}
+
+type logger struct {
+    handler Handler
+    level   Level
+    fields  []Field
+}
+
+// Creates a logger which passes the records with at least the given level to the handler.
+func New(handler Handler, level Level) Logger {
+    return &logger{handler: handler, level: level}
+}
+
+// Returns a logger which discards all records.
+func Discard() Logger {
+    return New(HandlerFunc(func(record *Record) {}), ErrorLevel+1)
+}
+
+func (l *logger) Debug(msg string, keyValues ...interface{}) {
+    l.log(DebugLevel, msg, keyValues)
+}
+
+func (l *logger) Info(msg string, keyValues ...interface{}) {
+    l.log(InfoLevel, msg, keyValues)
+}
+
+func (l *logger) Warn(msg string, keyValues ...interface{}) {
+    l.log(WarnLevel, msg, keyValues)
+}
+
+func (l *logger) Error(msg string, keyValues ...interface{}) {
+    l.log(ErrorLevel, msg, keyValues)
+}
+
+func (l *logger) With(keyValues ...interface{}) Logger {
+    fields := make([]Field, 0, len(l.fields)+len(keyValues)/2)
+    fields = append(fields, l.fields...)
+    return &logger{
+        handler: l.handler,
+        level:   l.level,
+        fields:  appendFields(fields, keyValues),
+    }
+}
+
+func (l *logger) Enabled(level Level) bool {
+    return level >= l.level
+}
+
+func (l *logger) log(level Level, msg string, keyValues []interface{}) {
+    if !l.Enabled(level) {
+        return
+    }
+    fields := make([]Field, 0, len(l.fields)+len(keyValues)/2)
+    fields = append(fields, l.fields...)
+    l.handler.Handle(&Record{
+        Time:    time.Now(),
+        Level:   level,
+        Message: msg,
+        Fields:  appendFields(fields, keyValues),
+    })
+}
+
+// Key used for a value without key, i.e. the last of an odd number of keyValues.
+const BadKey = "!BADKEY"
+
+func appendFields(fields []Field, keyValues []interface{}) []Field {
+    for i := 0; i < len(keyValues); i += 2 {
+        if i+1 == len(keyValues) {
+            fields = append(fields, Field{Key: BadKey, Value: keyValues[i]})
+            break
+        }
+        key, ok := keyValues[i].(string)
+        if !ok {
+            key = fmt.Sprint(keyValues[i])
+        }
+        fields = append(fields, Field{Key: key, Value: keyValues[i+1]})
+    }
+    return fields
+}
+
+var defaultLogger Logger = New(NewTextHandler(os.Stderr), InfoLevel)
+var defaultLoggerLock sync.RWMutex
+
+// Returns the logger used by the components which have no logger of their own.
+func Default() Logger {
+    defaultLoggerLock.RLock()
+    defer defaultLoggerLock.RUnlock()
+    return defaultLogger
+}
+
+// Replaces the default logger, which writes text records of level Info and above to stderr.
+func SetDefault(logger Logger) {
+    defaultLoggerLock.Lock()
+    defer defaultLoggerLock.Unlock()
+    defaultLogger = logger
+}
+
+type contextKey struct{}
+
+// Returns a copy of the context which carries the logger.
+func NewContext(ctx context.Context, logger Logger) context.Context {
+    return context.WithValue(ctx, contextKey{}, logger)
+}
+
+// Returns the logger of the context, or the default logger if the context has none.
+func FromContext(ctx context.Context) Logger {
+    if ctx != nil {
+        if logger, ok := ctx.Value(contextKey{}).(Logger); ok {
+            return logger
+        }
+    }
+    return Default()
+}
+
+const timeFormat = "2006-01-02T15:04:05.000Z07:00"
+
+type writerHandler struct {
+    lock   sync.Mutex
+    writer io.Writer
+    format func(buf *bytes.Buffer, record *Record)
+}
+
+func (h *writerHandler) Handle(record *Record) {
+    var buf bytes.Buffer
+    h.format(&buf, record)
+    buf.WriteByte('\n')
+
+    h.lock.Lock()
+    defer h.lock.Unlock()
+    h.writer.Write(buf.Bytes())
+}
+
+// Creates a handler which writes one line of key=value pairs per record, e.g.
+//  time=2020-06-01T10:00:00.000Z level=WARN msg="message discarded" channel=orders
+func NewTextHandler(w io.Writer) Handler {
+    return &writerHandler{writer: w, format: formatText}
+}
+
+// Creates a handler which writes one JSON object per record, e.g.
+//  {"time":"2020-06-01T10:00:00.000Z","level":"WARN","msg":"message discarded","channel":"orders"}
+func NewJSONHandler(w io.Writer) Handler {
+    return &writerHandler{writer: w, format: formatJSON}
+}
+
+func formatText(buf *bytes.Buffer, record *Record) {
+    buf.WriteString("time=" + record.Time.Format(timeFormat))
+    buf.WriteString(" level=" + record.Level.String())
+    buf.WriteString(" msg=" + quoteText(record.Message))
+    for _, f := range record.Fields {
+        buf.WriteString(" " + quoteText(f.Key) + "=" + quoteText(fieldString(f.Value)))
+    }
+}
+
+func quoteText(s string) string {
+    if s == "" {
+        return `""`
+    }
+    for _, c := range s {
+        if c <= ' ' || c == '=' || c == '"' || c >= 0x7f {
+            return strconv.Quote(s)
+        }
+    }
+    return s
+}
+
+func fieldString(value interface{}) string {
+    switch v := value.(type) {
+    case string:
+        return v
+    case error:
+        return v.Error()
+    case fmt.Stringer:
+        return v.String()
+    case time.Duration:
+        return v.String()
+    }
+    return fmt.Sprint(value)
+}
+
+func formatJSON(buf *bytes.Buffer, record *Record) {
+    buf.WriteString(`{"time":`)
+    writeJSONValue(buf, record.Time.Format(timeFormat))
+    buf.WriteString(`,"level":`)
+    writeJSONValue(buf, record.Level.String())
+    buf.WriteString(`,"msg":`)
+    writeJSONValue(buf, record.Message)
+    for _, f := range record.Fields {
+        buf.WriteByte(',')
+        writeJSONValue(buf, f.Key)
+        buf.WriteByte(':')
+        switch v := f.Value.(type) {
+        case error:
+            writeJSONValue(buf, v.Error())
+        case time.Duration:
+            writeJSONValue(buf, v.String())
+        default:
+            writeJSONValue(buf, v)
+        }
+    }
+    buf.WriteByte('}')
+}
+
+func writeJSONValue(buf *bytes.Buffer, value interface{}) {
+    data, err := json.Marshal(value)
+    if err != nil {
+        // values which cannot be marshalled are written as strings
+        data, _ = json.Marshal(fmt.Sprint(value))
+    }
+    buf.Write(data)
+}
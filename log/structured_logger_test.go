@@ -0,0 +1,94 @@
+// Copyright 2019-2020 VMware, Inc.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package log
+
+import (
+    "bytes"
+    "context"
+    "errors"
+    "github.com/stretchr/testify/assert"
+    "strings"
+    "testing"
+    "time"
+)
+
+func TestLogger_Levels(t *testing.T) {
+    var records []*Record
+    logger := New(HandlerFunc(func(record *Record) {
+        records = append(records, record)
+    }), WarnLevel)
+
+    logger.Debug("debug")
+    logger.Info("info")
+    logger.Warn("warn", "channel", "orders")
+    logger.Error("error", "error", errors.New("failure"), "dangling")
+
+    assert.False(t, logger.Enabled(InfoLevel))
+    assert.True(t, logger.Enabled(ErrorLevel))
+    assert.Len(t, records, 2)
+    assert.Equal(t, WarnLevel, records[0].Level)
+    assert.Equal(t, "warn", records[0].Message)
+    assert.Equal(t, []Field{{Key: "channel", Value: "orders"}}, records[0].Fields)
+    assert.Equal(t, []Field{{Key: "error", Value: errors.New("failure")}, {Key: BadKey, Value: "dangling"}},
+        records[1].Fields)
+}
+
+func TestLogger_With(t *testing.T) {
+    var records []*Record
+    logger := New(HandlerFunc(func(record *Record) {
+        records = append(records, record)
+    }), DebugLevel)
+
+    channelLogger := logger.With("channel", "orders")
+    channelLogger.With("connection.id", "con1").Info("connected")
+    channelLogger.Info("sent", "size", 10)
+    logger.Info("plain")
+
+    assert.Equal(t, []Field{{Key: "channel", Value: "orders"}, {Key: "connection.id", Value: "con1"}},
+        records[0].Fields)
+    assert.Equal(t, []Field{{Key: "channel", Value: "orders"}, {Key: "size", Value: 10}}, records[1].Fields)
+    assert.Len(t, records[2].Fields, 0)
+}
+
+func TestLogger_Handlers(t *testing.T) {
+    record := &Record{
+        Time:    time.Date(2020, 6, 1, 10, 0, 0, 0, time.UTC),
+        Level:   WarnLevel,
+        Message: "message discarded",
+        Fields: []Field{
+            {Key: "channel", Value: "orders"},
+            {Key: "error", Value: errors.New("queue \"full\"")},
+            {Key: "timeout", Value: 2 * time.Second},
+            {Key: "attempt", Value: 3},
+        },
+    }
+
+    var buf bytes.Buffer
+    NewTextHandler(&buf).Handle(record)
+    assert.Equal(t, `time=2020-06-01T10:00:00.000Z level=WARN msg="message discarded" channel=orders `+
+        `error="queue \"full\"" timeout=2s attempt=3`+"\n", buf.String())
+
+    buf.Reset()
+    NewJSONHandler(&buf).Handle(record)
+    assert.Equal(t, `{"time":"2020-06-01T10:00:00.000Z","level":"WARN","msg":"message discarded",`+
+        `"channel":"orders","error":"queue \"full\"","timeout":"2s","attempt":3}`+"\n", buf.String())
+}
+
+func TestLogger_DefaultAndContext(t *testing.T) {
+    original := Default()
+    defer SetDefault(original)
+
+    var buf bytes.Buffer
+    logger := New(NewJSONHandler(&buf), InfoLevel)
+    SetDefault(logger)
+    assert.Equal(t, logger, Default())
+    assert.Equal(t, logger, FromContext(context.Background()))
+
+    ctxLogger := logger.With("request", "req-1")
+    ctx := NewContext(context.Background(), ctxLogger)
+    FromContext(ctx).Info("handled")
+    assert.True(t, strings.Contains(buf.String(), `"request":"req-1"`))
+
+    Discard().Error("dropped")
+}
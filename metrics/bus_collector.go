@@ -0,0 +1,220 @@
+// Copyright 2019-2020 VMware, Inc.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package metrics
+
+import (
+    "github.com/vmware/transport-go/bus"
+    "github.com/vmware/transport-go/model"
+    "github.com/vmware/transport-go/service"
+    "strconv"
+    "sync"
+)
+
+// BusCollector records the monitor events of an EventBus as metrics of a Registry.
+// Channel queue depths and store sizes are sampled when the metrics are scraped.
+// The fabric endpoint metrics only count the connections and subscriptions opened after the
+// collector was created, so create it before starting the fabric endpoint.
+type BusCollector struct {
+    bus           bus.EventBus
+    listenerId    bus.MonitorEventListenerId
+    lock          sync.Mutex
+    channels      map[string]bool
+    stores        map[string]bool
+    // the endpoint connections and subscriptions counted by the collector
+    connectionIds map[string]bool
+    subscribers   map[string]int
+
+    messages          *Counter
+    handlerDuration   *Histogram
+    handlerPanics     *Counter
+    deadLetters       *Counter
+    queueDepth        *Gauge
+    storeItems        *Gauge
+    storeVersion      *Gauge
+    connections       *Gauge
+    subscriptions     *Gauge
+    restCalls         *Counter
+    restCallDuration  *Histogram
+}
+
+// Creates a collector which registers the transport metrics with the registry
+// and starts listening to the monitor events of the bus.
+func NewBusCollector(eventBus bus.EventBus, registry *Registry) *BusCollector {
+    c := &BusCollector{
+        bus:      eventBus,
+        channels: make(map[string]bool),
+        stores:   make(map[string]bool),
+        connectionIds: make(map[string]bool),
+        subscribers:   make(map[string]int),
+        messages: registry.NewCounter("transport_channel_messages_total",
+            "Number of messages sent on a bus channel.", "channel", "direction"),
+        handlerDuration: registry.NewHistogram("transport_channel_handler_duration_seconds",
+            "Time the channel handlers took to process a message.", nil, "channel"),
+        handlerPanics: registry.NewCounter("transport_channel_handler_panics_total",
+            "Number of panics recovered from channel handlers and fabric services.", "channel"),
+        deadLetters: registry.NewCounter("transport_channel_dead_letters_total",
+            "Number of messages which could not be delivered.", "channel", "reason"),
+        queueDepth: registry.NewGauge("transport_channel_queue_depth",
+            "Number of messages waiting in the handler queues of a channel.", "channel"),
+        storeItems: registry.NewGauge("transport_store_items",
+            "Number of items in a bus store.", "store"),
+        storeVersion: registry.NewGauge("transport_store_version",
+            "Current version of a bus store.", "store"),
+        connections: registry.NewGauge("transport_stomp_connections",
+            "Number of active fabric endpoint STOMP connections."),
+        subscriptions: registry.NewGauge("transport_stomp_subscriptions",
+            "Number of fabric endpoint STOMP subscriptions to a channel.", "channel"),
+        restCalls: registry.NewCounter("transport_rest_service_requests_total",
+            "Number of HTTP calls made by the rest service.", "method", "status"),
+        restCallDuration: registry.NewHistogram("transport_rest_service_request_duration_seconds",
+            "Duration of the HTTP calls made by the rest service.", nil, "method"),
+    }
+
+    // channels and stores which exist before the collector was created.
+    for name := range eventBus.GetChannelManager().GetAllChannels() {
+        c.channels[name] = true
+    }
+    for name := range eventBus.GetStoreManager().GetAllStores() {
+        c.stores[name] = true
+    }
+
+    c.listenerId = eventBus.AddMonitorEventListener(c.handleMonitorEvent)
+    registry.OnCollect(c.collect)
+    return c
+}
+
+// Stops listening to the monitor events of the bus.
+func (c *BusCollector) Close() {
+    c.bus.RemoveMonitorEventListener(c.listenerId)
+}
+
+func (c *BusCollector) handleMonitorEvent(evt *bus.MonitorEvent) {
+    switch evt.EventType {
+    case bus.ChannelCreatedEvt:
+        c.lock.Lock()
+        c.channels[evt.EntityName] = true
+        c.lock.Unlock()
+
+    case bus.ChannelDestroyedEvt:
+        c.lock.Lock()
+        delete(c.channels, evt.EntityName)
+        c.lock.Unlock()
+        c.queueDepth.Delete(evt.EntityName)
+
+    case bus.StoreCreatedEvt:
+        c.lock.Lock()
+        c.stores[evt.EntityName] = true
+        c.lock.Unlock()
+
+    case bus.StoreDestroyedEvt:
+        c.lock.Lock()
+        delete(c.stores, evt.EntityName)
+        c.lock.Unlock()
+        c.storeItems.Delete(evt.EntityName)
+        c.storeVersion.Delete(evt.EntityName)
+
+    case bus.ChannelMessageSentEvt:
+        if msg, ok := evt.Data.(*model.Message); ok {
+            c.messages.Inc(evt.EntityName, directionLabel(msg.Direction))
+        }
+
+    case bus.ChannelMessageHandledEvt:
+        if handled, ok := evt.Data.(*bus.MessageHandled); ok {
+            c.handlerDuration.Observe(handled.Duration.Seconds(), evt.EntityName)
+        }
+
+    case bus.HandlerPanicEvt:
+        c.handlerPanics.Inc(evt.EntityName)
+
+    case bus.ChannelMessageDeadLetteredEvt:
+        if deadLetter, ok := evt.Data.(*bus.DeadLetter); ok {
+            c.deadLetters.Inc(evt.EntityName, deadLetter.Reason.String())
+        }
+
+    case bus.FabricEndpointConnectedEvt:
+        c.lock.Lock()
+        c.connectionIds[evt.EntityName] = true
+        c.lock.Unlock()
+        c.connections.Inc()
+
+    case bus.FabricEndpointDisconnectedEvt:
+        // connections opened before the collector was created are not counted
+        c.lock.Lock()
+        counted := c.connectionIds[evt.EntityName]
+        delete(c.connectionIds, evt.EntityName)
+        c.lock.Unlock()
+        if counted {
+            c.connections.Dec()
+        }
+
+    case bus.FabricEndpointSubscribeEvt:
+        c.lock.Lock()
+        c.subscribers[evt.EntityName]++
+        c.lock.Unlock()
+        c.subscriptions.Inc(evt.EntityName)
+
+    case bus.FabricEndpointUnsubscribeEvt:
+        c.lock.Lock()
+        counted := c.subscribers[evt.EntityName] > 0
+        if counted {
+            c.subscribers[evt.EntityName]--
+            if c.subscribers[evt.EntityName] == 0 {
+                delete(c.subscribers, evt.EntityName)
+            }
+        }
+        c.lock.Unlock()
+        if counted {
+            c.subscriptions.Dec(evt.EntityName)
+        }
+
+    case bus.RestServiceCallEvt:
+        if call, ok := evt.Data.(*service.RestServiceCall); ok {
+            status := "error"
+            if call.StatusCode > 0 {
+                status = strconv.Itoa(call.StatusCode)
+            }
+            c.restCalls.Inc(call.Method, status)
+            c.restCallDuration.Observe(call.Duration.Seconds(), call.Method)
+        }
+    }
+}
+
+// Samples the queue depths and the store sizes.
+func (c *BusCollector) collect() {
+    c.lock.Lock()
+    channels := make([]string, 0, len(c.channels))
+    for name := range c.channels {
+        channels = append(channels, name)
+    }
+    stores := make([]string, 0, len(c.stores))
+    for name := range c.stores {
+        stores = append(stores, name)
+    }
+    c.lock.Unlock()
+
+    for _, name := range channels {
+        if channel, err := c.bus.GetChannelManager().GetChannel(name); err == nil {
+            c.queueDepth.Set(float64(channel.QueueDepth()), name)
+        }
+    }
+    for _, name := range stores {
+        if store := c.bus.GetStoreManager().GetStore(name); store != nil {
+            items, version := store.AllValuesAndVersion()
+            c.storeItems.Set(float64(len(items)), name)
+            c.storeVersion.Set(float64(version), name)
+        }
+    }
+}
+
+func directionLabel(direction model.Direction) string {
+    switch direction {
+    case model.RequestDir:
+        return "request"
+    case model.ResponseDir:
+        return "response"
+    case model.ErrorDir:
+        return "error"
+    }
+    return "unknown"
+}
@@ -0,0 +1,116 @@
+// Copyright 2019-2020 VMware, Inc.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package metrics
+
+import (
+    "bytes"
+    "errors"
+    "github.com/stretchr/testify/assert"
+    "github.com/vmware/transport-go/bus"
+    "github.com/vmware/transport-go/model"
+    "github.com/vmware/transport-go/service"
+    "testing"
+    "time"
+)
+
+func TestBusCollector_ChannelMetrics(t *testing.T) {
+    eventBus := bus.NewEventBusInstance()
+    registry := NewRegistry()
+    collector := NewBusCollector(eventBus, registry)
+    defer collector.Close()
+
+    eventBus.GetChannelManager().CreateChannel("test-channel", bus.WithOrderedDelivery())
+    handler, _ := eventBus.ListenStream("test-channel")
+    received := make(chan bool)
+    handler.Handle(func(message *model.Message) {
+        received <- true
+    }, func(e error) {})
+
+    eventBus.SendResponseMessage("test-channel", "response", nil)
+    eventBus.SendRequestMessage("test-channel", "request", nil)
+    eventBus.SendErrorMessage("test-channel", errors.New("error"), nil)
+    <-received
+
+    assert.Equal(t, float64(1), collector.messages.Value("test-channel", "response"))
+    assert.Equal(t, float64(1), collector.messages.Value("test-channel", "request"))
+    assert.Equal(t, float64(1), collector.messages.Value("test-channel", "error"))
+
+    assert.Eventually(t, func() bool {
+        count, _ := collector.handlerDuration.Count("test-channel")
+        return count == 3
+    }, time.Second, 5 * time.Millisecond)
+
+    var buf bytes.Buffer
+    registry.WriteText(&buf)
+    assert.Contains(t, buf.String(), "transport_channel_queue_depth{channel=\"test-channel\"} 0\n")
+}
+
+func TestBusCollector_StoreMetrics(t *testing.T) {
+    eventBus := bus.NewEventBusInstance()
+    registry := NewRegistry()
+    collector := NewBusCollector(eventBus, registry)
+    defer collector.Close()
+
+    store := eventBus.GetStoreManager().CreateStore("test-store")
+    store.Put("item1", "value1", "added")
+    store.Put("item2", "value2", "added")
+
+    assert.Eventually(t, func() bool {
+        var buf bytes.Buffer
+        registry.WriteText(&buf)
+        return collector.storeItems.Value("test-store") == 2
+    }, time.Second, 5 * time.Millisecond)
+    _, version := store.AllValuesAndVersion()
+    assert.Equal(t, float64(version), collector.storeVersion.Value("test-store"))
+}
+
+func TestBusCollector_ExistingStores(t *testing.T) {
+    eventBus := bus.NewEventBusInstance()
+    store := eventBus.GetStoreManager().CreateStore("existing-store")
+    store.Put("item1", "value1", "added")
+
+    registry := NewRegistry()
+    collector := NewBusCollector(eventBus, registry)
+    defer collector.Close()
+
+    var buf bytes.Buffer
+    registry.WriteText(&buf)
+    assert.Equal(t, float64(1), collector.storeItems.Value("existing-store"))
+    _, version := store.AllValuesAndVersion()
+    assert.Equal(t, float64(version), collector.storeVersion.Value("existing-store"))
+}
+
+func TestBusCollector_EndpointAndRestMetrics(t *testing.T) {
+    eventBus := bus.NewEventBusInstance()
+    registry := NewRegistry()
+    collector := NewBusCollector(eventBus, registry)
+
+    eventBus.SendMonitorEvent(bus.FabricEndpointConnectedEvt, "con1", nil)
+    eventBus.SendMonitorEvent(bus.FabricEndpointConnectedEvt, "con2", nil)
+    eventBus.SendMonitorEvent(bus.FabricEndpointDisconnectedEvt, "con1", nil)
+    eventBus.SendMonitorEvent(bus.FabricEndpointSubscribeEvt, "channel1", nil)
+    eventBus.SendMonitorEvent(bus.FabricEndpointSubscribeEvt, "channel1", nil)
+    eventBus.SendMonitorEvent(bus.FabricEndpointUnsubscribeEvt, "channel1", nil)
+    // connections and subscriptions opened before the collector was created are ignored
+    eventBus.SendMonitorEvent(bus.FabricEndpointDisconnectedEvt, "con0", nil)
+    eventBus.SendMonitorEvent(bus.FabricEndpointUnsubscribeEvt, "channel0", nil)
+
+    eventBus.SendMonitorEvent(bus.RestServiceCallEvt, "fabric-rest", &service.RestServiceCall{
+        Method: "GET", StatusCode: 200, Duration: 20 * time.Millisecond})
+    eventBus.SendMonitorEvent(bus.RestServiceCallEvt, "fabric-rest", &service.RestServiceCall{
+        Method: "GET", Error: errors.New("connection refused")})
+
+    assert.Equal(t, float64(1), collector.connections.Value())
+    assert.Equal(t, float64(1), collector.subscriptions.Value("channel1"))
+    assert.Equal(t, float64(0), collector.subscriptions.Value("channel0"))
+    assert.Equal(t, float64(1), collector.restCalls.Value("GET", "200"))
+    assert.Equal(t, float64(1), collector.restCalls.Value("GET", "error"))
+    count, _ := collector.restCallDuration.Count("GET")
+    assert.Equal(t, uint64(2), count)
+
+    // no updates after the collector is closed.
+    collector.Close()
+    eventBus.SendMonitorEvent(bus.FabricEndpointConnectedEvt, "con3", nil)
+    assert.Equal(t, float64(1), collector.connections.Value())
+}
@@ -0,0 +1,337 @@
+// Copyright 2019-2020 VMware, Inc.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package metrics
+
+import (
+    "bufio"
+    "fmt"
+    "io"
+    "math"
+    "net/http"
+    "sort"
+    "strconv"
+    "strings"
+    "sync"
+)
+
+// Content type of the Prometheus text exposition format.
+const TextContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// Default histogram buckets for durations in seconds.
+var DefaultBuckets = []float64{.001, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+type metricType string
+
+const (
+    counterType   metricType = "counter"
+    gaugeType     metricType = "gauge"
+    histogramType metricType = "histogram"
+)
+
+// Registry holds a set of metrics and writes them in the Prometheus text format.
+type Registry struct {
+    lock       sync.Mutex
+    families   map[string]*family
+    collectors []func()
+}
+
+func NewRegistry() *Registry {
+    return &Registry{
+        families: make(map[string]*family),
+    }
+}
+
+// A named metric with its series, one for each combination of label values.
+type family struct {
+    name       string
+    help       string
+    metricType metricType
+    labelNames []string
+    buckets    []float64
+    lock       sync.Mutex
+    series     map[string]*series
+}
+
+type series struct {
+    labelValues  []string
+    value        float64
+    bucketCounts []uint64
+    count        uint64
+}
+
+// Counter is a metric which can only increase, e.g. the number of processed messages.
+type Counter struct {
+    f *family
+}
+
+// Gauge is a metric which can go up and down, e.g. the number of active connections.
+type Gauge struct {
+    f *family
+}
+
+// Histogram counts observations, e.g. request durations, in configurable buckets.
+type Histogram struct {
+    f *family
+}
+
+// Creates a new counter. The label values passed to the counter methods must match the label names.
+func (r *Registry) NewCounter(name string, help string, labelNames ...string) *Counter {
+    return &Counter{f: r.register(name, help, counterType, labelNames, nil)}
+}
+
+// Creates a new gauge. The label values passed to the gauge methods must match the label names.
+func (r *Registry) NewGauge(name string, help string, labelNames ...string) *Gauge {
+    return &Gauge{f: r.register(name, help, gaugeType, labelNames, nil)}
+}
+
+// Creates a new histogram with the given upper bounds of its buckets, DefaultBuckets if nil.
+func (r *Registry) NewHistogram(name string, help string, buckets []float64, labelNames ...string) *Histogram {
+    if buckets == nil {
+        buckets = DefaultBuckets
+    }
+    sorted := append([]float64(nil), buckets...)
+    sort.Float64s(sorted)
+    return &Histogram{f: r.register(name, help, histogramType, labelNames, sorted)}
+}
+
+// Registers a function called before every scrape, e.g. to update gauges
+// whose values are sampled rather than tracked.
+func (r *Registry) OnCollect(collector func()) {
+    r.lock.Lock()
+    defer r.lock.Unlock()
+    r.collectors = append(r.collectors, collector)
+}
+
+func (r *Registry) register(
+        name string, help string, metricType metricType, labelNames []string, buckets []float64) *family {
+
+    r.lock.Lock()
+    defer r.lock.Unlock()
+
+    if _, exists := r.families[name]; exists {
+        panic(fmt.Sprintf("metric %s is already registered", name))
+    }
+    f := &family{
+        name:       name,
+        help:       help,
+        metricType: metricType,
+        labelNames: labelNames,
+        buckets:    buckets,
+        series:     make(map[string]*series),
+    }
+    r.families[name] = f
+    return f
+}
+
+// Returns the series for the label values, the caller must hold the family lock.
+func (f *family) getSeries(labelValues []string) *series {
+    if len(labelValues) != len(f.labelNames) {
+        panic(fmt.Sprintf("metric %s expects %d label values, got %d", f.name, len(f.labelNames), len(labelValues)))
+    }
+    key := strings.Join(labelValues, "\xff")
+    s, ok := f.series[key]
+    if !ok {
+        s = &series{labelValues: append([]string(nil), labelValues...)}
+        if f.metricType == histogramType {
+            s.bucketCounts = make([]uint64, len(f.buckets))
+        }
+        f.series[key] = s
+    }
+    return s
+}
+
+func (c *Counter) Inc(labelValues ...string) {
+    c.Add(1, labelValues...)
+}
+
+// Increases the counter, negative values are ignored.
+func (c *Counter) Add(value float64, labelValues ...string) {
+    if value < 0 {
+        return
+    }
+    c.f.lock.Lock()
+    defer c.f.lock.Unlock()
+    c.f.getSeries(labelValues).value += value
+}
+
+// Returns the current value of the counter.
+func (c *Counter) Value(labelValues ...string) float64 {
+    c.f.lock.Lock()
+    defer c.f.lock.Unlock()
+    if s, ok := c.f.series[strings.Join(labelValues, "\xff")]; ok {
+        return s.value
+    }
+    return 0
+}
+
+func (g *Gauge) Set(value float64, labelValues ...string) {
+    g.f.lock.Lock()
+    defer g.f.lock.Unlock()
+    g.f.getSeries(labelValues).value = value
+}
+
+func (g *Gauge) Add(value float64, labelValues ...string) {
+    g.f.lock.Lock()
+    defer g.f.lock.Unlock()
+    g.f.getSeries(labelValues).value += value
+}
+
+func (g *Gauge) Inc(labelValues ...string) {
+    g.Add(1, labelValues...)
+}
+
+func (g *Gauge) Dec(labelValues ...string) {
+    g.Add(-1, labelValues...)
+}
+
+// Returns the current value of the gauge.
+func (g *Gauge) Value(labelValues ...string) float64 {
+    g.f.lock.Lock()
+    defer g.f.lock.Unlock()
+    if s, ok := g.f.series[strings.Join(labelValues, "\xff")]; ok {
+        return s.value
+    }
+    return 0
+}
+
+// Removes the series of the label values, e.g. after the channel it describes was destroyed.
+func (g *Gauge) Delete(labelValues ...string) {
+    g.f.lock.Lock()
+    defer g.f.lock.Unlock()
+    delete(g.f.series, strings.Join(labelValues, "\xff"))
+}
+
+func (h *Histogram) Observe(value float64, labelValues ...string) {
+    h.f.lock.Lock()
+    defer h.f.lock.Unlock()
+
+    s := h.f.getSeries(labelValues)
+    for i, bound := range h.f.buckets {
+        if value <= bound {
+            s.bucketCounts[i]++
+        }
+    }
+    s.count++
+    s.value += value
+}
+
+// Returns the number of observations and their sum.
+func (h *Histogram) Count(labelValues ...string) (uint64, float64) {
+    h.f.lock.Lock()
+    defer h.f.lock.Unlock()
+    if s, ok := h.f.series[strings.Join(labelValues, "\xff")]; ok {
+        return s.count, s.value
+    }
+    return 0, 0
+}
+
+// Writes all metrics in the Prometheus text exposition format.
+func (r *Registry) WriteText(w io.Writer) error {
+    r.lock.Lock()
+    collectors := append([]func(){}, r.collectors...)
+    families := make([]*family, 0, len(r.families))
+    for _, f := range r.families {
+        families = append(families, f)
+    }
+    r.lock.Unlock()
+
+    for _, collect := range collectors {
+        collect()
+    }
+
+    sort.Slice(families, func(i, j int) bool {
+        return families[i].name < families[j].name
+    })
+
+    bw := bufio.NewWriter(w)
+    for _, f := range families {
+        f.write(bw)
+    }
+    return bw.Flush()
+}
+
+// Returns an http.Handler serving the metrics, e.g. on the "/metrics" path.
+func (r *Registry) Handler() http.Handler {
+    return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+        writer.Header().Set("Content-Type", TextContentType)
+        r.WriteText(writer)
+    })
+}
+
+func (f *family) write(w *bufio.Writer) {
+    f.lock.Lock()
+    defer f.lock.Unlock()
+
+    fmt.Fprintf(w, "# HELP %s %s\n", f.name, escapeHelp(f.help))
+    fmt.Fprintf(w, "# TYPE %s %s\n", f.name, f.metricType)
+
+    keys := make([]string, 0, len(f.series))
+    for key := range f.series {
+        keys = append(keys, key)
+    }
+    sort.Strings(keys)
+
+    for _, key := range keys {
+        s := f.series[key]
+        if f.metricType != histogramType {
+            fmt.Fprintf(w, "%s%s %s\n", f.name, formatLabels(f.labelNames, s.labelValues, "", ""),
+                formatValue(s.value))
+            continue
+        }
+        for i, bound := range f.buckets {
+            fmt.Fprintf(w, "%s_bucket%s %d\n", f.name,
+                formatLabels(f.labelNames, s.labelValues, "le", formatValue(bound)), s.bucketCounts[i])
+        }
+        fmt.Fprintf(w, "%s_bucket%s %d\n", f.name,
+            formatLabels(f.labelNames, s.labelValues, "le", "+Inf"), s.count)
+        fmt.Fprintf(w, "%s_sum%s %s\n", f.name, formatLabels(f.labelNames, s.labelValues, "", ""),
+            formatValue(s.value))
+        fmt.Fprintf(w, "%s_count%s %d\n", f.name, formatLabels(f.labelNames, s.labelValues, "", ""), s.count)
+    }
+}
+
+func formatLabels(names []string, values []string, extraName string, extraValue string) string {
+    if len(names) == 0 && extraName == "" {
+        return ""
+    }
+    var sb strings.Builder
+    sb.WriteString("{")
+    for i, name := range names {
+        if i > 0 {
+            sb.WriteString(",")
+        }
+        sb.WriteString(name + "=\"" + escapeLabelValue(values[i]) + "\"")
+    }
+    if extraName != "" {
+        if len(names) > 0 {
+            sb.WriteString(",")
+        }
+        sb.WriteString(extraName + "=\"" + extraValue + "\"")
+    }
+    sb.WriteString("}")
+    return sb.String()
+}
+
+func formatValue(value float64) string {
+    switch {
+    case math.IsInf(value, 1):
+        return "+Inf"
+    case math.IsInf(value, -1):
+        return "-Inf"
+    case math.IsNaN(value):
+        return "NaN"
+    }
+    return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+var labelValueReplacer = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+var helpReplacer = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+
+func escapeLabelValue(value string) string {
+    return labelValueReplacer.Replace(value)
+}
+
+func escapeHelp(help string) string {
+    return helpReplacer.Replace(help)
+}
@@ -0,0 +1,85 @@
+// Copyright 2019-2020 VMware, Inc.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package metrics
+
+import (
+    "bytes"
+    "github.com/stretchr/testify/assert"
+    "io/ioutil"
+    "net/http/httptest"
+    "testing"
+)
+
+func TestRegistry_WriteText(t *testing.T) {
+    registry := NewRegistry()
+    counter := registry.NewCounter("test_requests_total", "Number of requests.", "method", "path")
+    gauge := registry.NewGauge("test_connections", "Active connections.")
+    histogram := registry.NewHistogram("test_duration_seconds", "Request duration.", []float64{1, 0.1}, "method")
+
+    counter.Inc("GET", "/a")
+    counter.Add(2, "GET", "/a")
+    counter.Add(-1, "GET", "/a")
+    counter.Inc("POST", "/b\"c\"")
+    gauge.Inc()
+    gauge.Inc()
+    gauge.Dec()
+    histogram.Observe(0.05, "GET")
+    histogram.Observe(0.5, "GET")
+    histogram.Observe(5, "GET")
+
+    assert.Equal(t, float64(3), counter.Value("GET", "/a"))
+    assert.Equal(t, float64(0), counter.Value("PUT", "/a"))
+    assert.Equal(t, float64(1), gauge.Value())
+    count, sum := histogram.Count("GET")
+    assert.Equal(t, uint64(3), count)
+    assert.Equal(t, 5.55, sum)
+
+    var buf bytes.Buffer
+    assert.Nil(t, registry.WriteText(&buf))
+    assert.Equal(t, `# HELP test_connections Active connections.
+# TYPE test_connections gauge
+test_connections 1
+# HELP test_duration_seconds Request duration.
+# TYPE test_duration_seconds histogram
+test_duration_seconds_bucket{method="GET",le="0.1"} 1
+test_duration_seconds_bucket{method="GET",le="1"} 2
+test_duration_seconds_bucket{method="GET",le="+Inf"} 3
+test_duration_seconds_sum{method="GET"} 5.55
+test_duration_seconds_count{method="GET"} 3
+# HELP test_requests_total Number of requests.
+# TYPE test_requests_total counter
+test_requests_total{method="GET",path="/a"} 3
+test_requests_total{method="POST",path="/b\"c\""} 1
+`, buf.String())
+}
+
+func TestRegistry_InvalidMetrics(t *testing.T) {
+    registry := NewRegistry()
+    counter := registry.NewCounter("test_total", "", "label")
+
+    assert.Panics(t, func() {
+        registry.NewGauge("test_total", "")
+    })
+    assert.Panics(t, func() {
+        counter.Inc()
+    })
+}
+
+func TestRegistry_Handler(t *testing.T) {
+    registry := NewRegistry()
+    gauge := registry.NewGauge("test_sampled", "Sampled value.", "name")
+    registry.OnCollect(func() {
+        gauge.Set(42, "sample")
+    })
+
+    recorder := httptest.NewRecorder()
+    registry.Handler().ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+
+    assert.Equal(t, TextContentType, recorder.Header().Get("Content-Type"))
+    body, _ := ioutil.ReadAll(recorder.Body)
+    assert.Contains(t, string(body), "test_sampled{name=\"sample\"} 42\n")
+
+    gauge.Delete("sample")
+    assert.Equal(t, float64(0), gauge.Value("sample"))
+}
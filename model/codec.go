@@ -0,0 +1,133 @@
+// Copyright 2019-2020 VMware, Inc.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package model
+
+import (
+    "encoding/json"
+    "reflect"
+    "strings"
+    "sync"
+)
+
+// Content type of the default JSON codec.
+const JSONContentType = "application/json"
+
+// Codec encodes and decodes message payloads for a single content type.
+type Codec interface {
+    // Returns the content type handled by the codec, e.g. "application/json"
+    ContentType() string
+    // Encodes the value.
+    Marshal(value interface{}) ([]byte, error)
+    // Decodes the data into the value pointed to by target.
+    Unmarshal(data []byte, target interface{}) error
+}
+
+type funcCodec struct {
+    contentType string
+    marshal     func(value interface{}) ([]byte, error)
+    unmarshal   func(data []byte, target interface{}) error
+}
+
+func (c *funcCodec) ContentType() string {
+    return c.contentType
+}
+
+func (c *funcCodec) Marshal(value interface{}) ([]byte, error) {
+    return c.marshal(value)
+}
+
+func (c *funcCodec) Unmarshal(data []byte, target interface{}) error {
+    return c.unmarshal(data, target)
+}
+
+// Creates a new Codec from a pair of marshal and unmarshal functions. Most encoding libraries
+// can be plugged in directly, e.g.
+//  model.RegisterCodec(model.NewCodec("application/msgpack", msgpack.Marshal, msgpack.Unmarshal))
+func NewCodec(contentType string,
+        marshal func(value interface{}) ([]byte, error),
+        unmarshal func(data []byte, target interface{}) error) Codec {
+
+    return &funcCodec{contentType: NormalizeContentType(contentType), marshal: marshal, unmarshal: unmarshal}
+}
+
+// The default codec, used when no content type is specified or no codec is registered for it.
+var JSONCodec = NewCodec(JSONContentType, json.Marshal, json.Unmarshal)
+
+var codecsLock sync.RWMutex
+var codecs = map[string]Codec{
+    JSONContentType: JSONCodec,
+}
+
+// Registers a codec for its content type, replacing any codec already registered for that type.
+func RegisterCodec(codec Codec) {
+    codecsLock.Lock()
+    defer codecsLock.Unlock()
+    codecs[NormalizeContentType(codec.ContentType())] = codec
+}
+
+// Returns the codec registered for the content type and true, or nil and false if there is none.
+// Content type parameters like "charset" are ignored.
+func GetCodec(contentType string) (Codec, bool) {
+    codecsLock.RLock()
+    defer codecsLock.RUnlock()
+    codec, ok := codecs[NormalizeContentType(contentType)]
+    return codec, ok
+}
+
+// Returns the codec registered for the content type, or the JSON codec if there is none.
+func GetCodecOrDefault(contentType string) Codec {
+    if codec, ok := GetCodec(contentType); ok {
+        return codec
+    }
+    return JSONCodec
+}
+
+// Strips any parameters from the content type and converts it to lower case,
+// "Application/JSON;charset=UTF-8" becomes "application/json".
+func NormalizeContentType(contentType string) string {
+    if i := strings.Index(contentType, ";"); i >= 0 {
+        contentType = contentType[:i]
+    }
+    return strings.ToLower(strings.TrimSpace(contentType))
+}
+
+// Same as ConvertValueToType but uses the supplied codec for the conversion.
+// If value is a []byte, it is treated as already encoded data and decoded directly.
+func ConvertValueToTypeWithCodec(value interface{}, targetType reflect.Type, codec Codec) (interface{}, error) {
+    if targetType == nil {
+        return value, nil
+    }
+    if codec == nil {
+        codec = JSONCodec
+    }
+
+    itemType := targetType
+    var isTargetTypePointer bool
+
+    if itemType.Kind() == reflect.Ptr {
+        isTargetTypePointer = true
+        itemType = itemType.Elem()
+    }
+
+    decodedValuePtr := reflect.New(itemType).Interface()
+
+    encodedValue, ok := value.([]byte)
+    if !ok {
+        var err error
+        encodedValue, err = codec.Marshal(value)
+        if err != nil {
+            return nil, err
+        }
+    }
+
+    if decodeErr := codec.Unmarshal(encodedValue, decodedValuePtr); decodeErr != nil {
+        return nil, decodeErr
+    }
+
+    if isTargetTypePointer {
+        return decodedValuePtr, nil
+    } else {
+        return reflect.ValueOf(decodedValuePtr).Elem().Interface(), nil
+    }
+}
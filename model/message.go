@@ -3,7 +3,11 @@
 
 package model
 
-import "github.com/google/uuid"
+import (
+    "github.com/google/uuid"
+    "sort"
+    "time"
+)
 
 // Direction int defining which way messages are travelling on a Channel.
 type Direction int
@@ -25,6 +29,8 @@ type Message struct {
     Error         error           `json:"error"`
     Direction     Direction       `json:"direction"`
     Headers       []MessageHeader `json:"headers"`
+    ExpiresAt     time.Time       `json:"expiresAt"`     // the message is not delivered after this time, if set
+    Trace         *TraceContext   `json:"-"`             // trace context of the span which sent the message
 }
 
 // A Message header can contain any meta data.
@@ -32,3 +38,60 @@ type MessageHeader struct {
     Label string
     Value string
 }
+
+// Returns the value of the first header with the given label and true, or an empty string and false
+// if the message has no such header.
+func (m *Message) GetHeader(label string) (string, bool) {
+    for _, h := range m.Headers {
+        if h.Label == label {
+            return h.Value, true
+        }
+    }
+    return "", false
+}
+
+// Expire the message after the supplied duration, a zero or negative ttl clears the expiry.
+func (m *Message) SetTTL(ttl time.Duration) {
+    m.ExpiresAt = expiryFromTTL(ttl)
+}
+
+// Returns true if the message has an expiry time which has passed.
+func (m *Message) IsExpired() bool {
+    return !m.ExpiresAt.IsZero() && time.Now().After(m.ExpiresAt)
+}
+
+func expiryFromTTL(ttl time.Duration) time.Time {
+    if ttl <= 0 {
+        return time.Time{}
+    }
+    return time.Now().Add(ttl)
+}
+
+// Converts a slice of message headers into a map. If a label is repeated, the last value wins.
+// Returns nil if there are no headers.
+func MessageHeadersToMap(headers []MessageHeader) map[string]string {
+    if len(headers) == 0 {
+        return nil
+    }
+    m := make(map[string]string, len(headers))
+    for _, h := range headers {
+        m[h.Label] = h.Value
+    }
+    return m
+}
+
+// Converts a map into a slice of message headers sorted by label.
+// Returns nil if the map is empty.
+func MessageHeadersFromMap(headers map[string]string) []MessageHeader {
+    if len(headers) == 0 {
+        return nil
+    }
+    result := make([]MessageHeader, 0, len(headers))
+    for label, value := range headers {
+        result = append(result, MessageHeader{Label: label, Value: value})
+    }
+    sort.Slice(result, func(i, j int) bool {
+        return result[i].Label < result[j].Label
+    })
+    return result
+}
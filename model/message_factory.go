@@ -3,7 +3,10 @@
 
 package model
 
-import "github.com/google/uuid"
+import (
+    "github.com/google/uuid"
+    "time"
+)
 
 type MessageConfig struct {
     Id            *uuid.UUID
@@ -14,6 +17,10 @@ type MessageConfig struct {
     Headers       []MessageHeader
     Direction     Direction
     Err           error
+    // Optional time to live of the message
+    TTL           time.Duration
+    // Optional trace context of the message, parsed from the traceparent header if nil
+    Trace         *TraceContext
 }
 
 func checkId(msgConfig *MessageConfig) {
@@ -23,6 +30,13 @@ func checkId(msgConfig *MessageConfig) {
     }
 }
 
+func (msgConfig *MessageConfig) traceContext() *TraceContext {
+    if msgConfig.Trace != nil {
+        return msgConfig.Trace
+    }
+    return TraceContextFromHeaders(msgConfig.Headers)
+}
+
 func GenerateRequest(msgConfig *MessageConfig) *Message {
     checkId(msgConfig)
     return &Message{
@@ -31,6 +45,9 @@ func GenerateRequest(msgConfig *MessageConfig) *Message {
         DestinationId: msgConfig.DestinationId,
         Destination:   msgConfig.Destination,
         Payload:       msgConfig.Payload,
+        Headers:       msgConfig.Headers,
+        ExpiresAt:     expiryFromTTL(msgConfig.TTL),
+        Trace:         msgConfig.traceContext(),
         Direction:     RequestDir}
 }
 
@@ -42,6 +59,9 @@ func GenerateResponse(msgConfig *MessageConfig) *Message {
         DestinationId: msgConfig.DestinationId,
         Destination:   msgConfig.Destination,
         Payload:       msgConfig.Payload,
+        Headers:       msgConfig.Headers,
+        ExpiresAt:     expiryFromTTL(msgConfig.TTL),
+        Trace:         msgConfig.traceContext(),
         Direction:     ResponseDir}
 }
 
@@ -53,5 +73,8 @@ func GenerateError(msgConfig *MessageConfig) *Message {
         DestinationId: msgConfig.DestinationId,
         Destination:   msgConfig.Destination,
         Error:         msgConfig.Err,
+        Headers:       msgConfig.Headers,
+        ExpiresAt:     expiryFromTTL(msgConfig.TTL),
+        Trace:         msgConfig.traceContext(),
         Direction:     ErrorDir}
 }
@@ -3,7 +3,10 @@
 
 package model
 
-import "github.com/google/uuid"
+import (
+    "crypto/x509"
+    "github.com/google/uuid"
+)
 
 type Request struct {
     Id                *uuid.UUID               `json:"id"`
@@ -12,10 +15,29 @@ type Request struct {
     Destination       string                   `json:"channel"`
     Payload           interface{}              `json:"payload"`
     Request           string                   `json:"request"`
+    // Meta data sent along with the request, e.g. correlation or tenant ids.
+    // Requests bridged from a fabric endpoint carry the STOMP frame headers of the SEND frame.
+    Headers           map[string]string        `json:"headers,omitempty"`
     // Populated if the request was sent on a "private" channel and
     // indicates where to send back the Response.
     // A service should check this field and if not null copy it to the
     // Response.BrokerDestination field to ensure that the response will be sent
     // back on the correct the "private" channel.
     BrokerDestination *BrokerDestinationConfig `json:"-"`
+    // Populated if the request was received by a fabric endpoint over a TLS connection
+    // authenticated with a verified client certificate.
+    ClientIdentity    *ClientIdentity          `json:"-"`
+    // Trace context of the span which is processing the request, propagated to the
+    // response and to the requests made while handling it.
+    Trace             *TraceContext            `json:"-"`
+}
+
+// Identity of a client authenticated with a TLS client certificate.
+type ClientIdentity struct {
+    // Common name of the client certificate subject.
+    CommonName   string
+    // Distinguished name of the client certificate subject.
+    Subject      string
+    // The verified certificate chain of the client, starting with the client certificate.
+    Certificates []*x509.Certificate
 }
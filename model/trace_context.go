@@ -0,0 +1,103 @@
+// Copyright 2019-2020 VMware, Inc.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package model
+
+import (
+    "encoding/hex"
+    "fmt"
+    "strings"
+)
+
+// Names of the W3C trace context headers.
+const (
+    TraceParentHeader = "traceparent"
+    TraceStateHeader  = "tracestate"
+)
+
+const traceSampledFlag = 0x01
+
+// TraceContext identifies the span a message or request belongs to,
+// see https://www.w3.org/TR/trace-context/
+type TraceContext struct {
+    // 32 lowercase hex characters identifying the whole trace
+    TraceId string
+    // 16 lowercase hex characters identifying the span
+    SpanId string
+    // Trace flags, only the sampled flag is defined
+    Flags byte
+    // Vendor specific data of the tracestate header, propagated as is
+    TraceState string
+}
+
+// Parses the value of a traceparent header.
+func ParseTraceParent(traceParent string) (*TraceContext, error) {
+    parts := strings.Split(strings.TrimSpace(traceParent), "-")
+    if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" ||
+            (parts[0] == "00" && len(parts) != 4) {
+        return nil, fmt.Errorf("invalid traceparent '%s'", traceParent)
+    }
+    if !isHex(parts[0]) || !isNonZeroHex(parts[1], 32) || !isNonZeroHex(parts[2], 16) ||
+            len(parts[3]) != 2 || !isHex(parts[3]) {
+        return nil, fmt.Errorf("invalid traceparent '%s'", traceParent)
+    }
+    flags, _ := hex.DecodeString(parts[3])
+    return &TraceContext{
+        TraceId: parts[1],
+        SpanId:  parts[2],
+        Flags:   flags[0],
+    }, nil
+}
+
+// Returns the trace context of the traceparent and tracestate headers, or nil if
+// the headers have no valid traceparent.
+func TraceContextFromHeaders(headers []MessageHeader) *TraceContext {
+    for _, h := range headers {
+        if strings.EqualFold(h.Label, TraceParentHeader) {
+            tc, err := ParseTraceParent(h.Value)
+            if err != nil {
+                return nil
+            }
+            for _, s := range headers {
+                if strings.EqualFold(s.Label, TraceStateHeader) {
+                    tc.TraceState = s.Value
+                }
+            }
+            return tc
+        }
+    }
+    return nil
+}
+
+// Returns the value of the traceparent header for the trace context.
+func (tc *TraceContext) TraceParent() string {
+    return fmt.Sprintf("00-%s-%s-%02x", tc.TraceId, tc.SpanId, tc.Flags)
+}
+
+// Returns true if the spans of the trace should be recorded.
+func (tc *TraceContext) IsSampled() bool {
+    return tc.Flags&traceSampledFlag != 0
+}
+
+// Sets the traceparent and, if present, the tracestate headers of the trace context.
+func (tc *TraceContext) InjectHeaders(headers map[string]string) {
+    headers[TraceParentHeader] = tc.TraceParent()
+    if tc.TraceState != "" {
+        headers[TraceStateHeader] = tc.TraceState
+    } else {
+        delete(headers, TraceStateHeader)
+    }
+}
+
+func isHex(s string) bool {
+    for _, c := range s {
+        if !(c >= '0' && c <= '9') && !(c >= 'a' && c <= 'f') {
+            return false
+        }
+    }
+    return true
+}
+
+func isNonZeroHex(s string, length int) bool {
+    return len(s) == length && isHex(s) && strings.Trim(s, "0") != ""
+}
@@ -4,35 +4,11 @@
 package model
 
 import (
-    "encoding/json"
     "reflect"
 )
 
+// Converts the value to targetType by encoding it and decoding the result with the JSON codec.
+// Use ConvertValueToTypeWithCodec to convert values of other content types.
 func ConvertValueToType(value interface{}, targetType reflect.Type) (interface{}, error) {
-    if targetType == nil {
-        return value, nil
-    }
-
-    itemType := targetType
-    var isTargetTypePointer bool
-
-    if itemType.Kind() == reflect.Ptr {
-        isTargetTypePointer = true
-        itemType = itemType.Elem()
-    }
-
-    decodedValuePtr := reflect.New(itemType).Interface()
-
-    marshaledValue, _ := json.Marshal(value)
-    decodeErr := json.Unmarshal(marshaledValue, decodedValuePtr)
-
-    if decodeErr != nil {
-        return  nil, decodeErr
-    }
-
-    if isTargetTypePointer {
-        return decodedValuePtr, nil
-    } else {
-        return reflect.ValueOf(decodedValuePtr).Elem().Interface(), nil
-    }
+    return ConvertValueToTypeWithCodec(value, targetType, JSONCodec)
 }
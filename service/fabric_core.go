@@ -55,7 +55,7 @@ func (core *fabricCore) SendResponse(request *model.Request, responsePayload int
 		Payload:           responsePayload,
 		BrokerDestination: request.BrokerDestination,
 	}
-	core.bus.SendResponseMessage(core.channelName, response, request.Id)
+	core.sendResponse(request, response)
 }
 
 func (core *fabricCore) SendResponseWithHeaders(request *model.Request, responsePayload interface{}, headers map[string]string) {
@@ -66,7 +66,7 @@ func (core *fabricCore) SendResponseWithHeaders(request *model.Request, response
 		BrokerDestination: request.BrokerDestination,
 		Headers:           headers,
 	}
-	core.bus.SendResponseMessage(core.channelName, response, request.Id)
+	core.sendResponse(request, response)
 }
 
 func (core *fabricCore) SendErrorResponse(
@@ -87,7 +87,38 @@ func (core *fabricCore) SendErrorResponseWithPayload(
 		ErrorMessage:      responseErrorMessage,
 		BrokerDestination: request.BrokerDestination,
 	}
-	core.bus.SendResponseMessage(core.channelName, response, request.Id)
+	core.sendResponse(request, response)
+}
+
+// Request headers propagated as message headers of the responses. Responses are sent to all
+// listeners of the service channel, e.g. all topic subscribers of a fabric endpoint, so other
+// request headers such as credentials or tenant ids are only passed to the service.
+var propagatedRequestHeaders = []string{
+	"correlation-id",
+	model.TraceParentHeader,
+	model.TraceStateHeader,
+}
+
+// Sends the response on the service channel with the propagated request headers as
+// message headers. The trace context of the request is added as traceparent header.
+func (core *fabricCore) sendResponse(request *model.Request, response *model.Response) {
+	var headers map[string]string
+	for _, name := range propagatedRequestHeaders {
+		if value := headerValue(request.Headers, name); value != "" {
+			if headers == nil {
+				headers = make(map[string]string)
+			}
+			headers[name] = value
+		}
+	}
+	if request.Trace != nil {
+		if headers == nil {
+			headers = make(map[string]string)
+		}
+		request.Trace.InjectHeaders(headers)
+	}
+	core.bus.SendResponseMessageWithHeaders(
+		core.channelName, response, request.Id, model.MessageHeadersFromMap(headers))
 }
 
 func (core *fabricCore) HandleUnknownRequest(request *model.Request) {
@@ -123,6 +154,7 @@ func (core *fabricCore) RestServiceRequest(restRequest *RestServiceRequest,
 	request := &model.Request{
 		Id:      &id,
 		Payload: restRequest,
+		Trace:   restRequest.Trace,
 	}
 	mh, _ := core.bus.ListenOnceForDestination(restServiceChannel, request.Id)
 	mh.Handle(func(message *model.Message) {
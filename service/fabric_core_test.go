@@ -109,6 +109,44 @@ func TestFabricCore_SendMethods(t *testing.T) {
 	assert.Equal(t, nil, response.Payload)
 }
 
+func TestFabricCore_SendResponsePropagatesHeaders(t *testing.T) {
+	core := newTestFabricCore("test-channel")
+
+	mh, _ := core.Bus().ListenStream("test-channel")
+
+	wg := sync.WaitGroup{}
+	var messages []*model.Message
+	mh.Handle(func(message *model.Message) {
+		messages = append(messages, message)
+		wg.Done()
+	}, func(e error) {
+		assert.Fail(t, "unexpected error")
+	})
+
+	id := uuid.New()
+	req := model.Request{
+		Id:      &id,
+		Request: "test-request",
+		Headers: map[string]string{"correlation-id": "corr-1", "tenant-id": "acme", "Authorization": "Bearer token"},
+	}
+
+	wg.Add(1)
+	core.SendResponse(&req, "test-response")
+	wg.Wait()
+
+	wg.Add(1)
+	core.SendErrorResponse(&req, 500, "test-error")
+	wg.Wait()
+
+	assert.Len(t, messages, 2)
+	for _, msg := range messages {
+		// only the allowed request headers are propagated
+		assert.Equal(t, []model.MessageHeader{
+			{Label: "correlation-id", Value: "corr-1"},
+		}, msg.Headers)
+	}
+}
+
 func TestFabricCore_RestServiceRequest(t *testing.T) {
 
 	core := newTestFabricCore("test-channel")
@@ -0,0 +1,219 @@
+// Copyright 2019-2020 VMware, Inc.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package service
+
+import (
+    "fmt"
+    "github.com/vmware/transport-go/log"
+    "github.com/vmware/transport-go/model"
+    "sync"
+    "time"
+)
+
+// RequestHandler handles a single service request, FabricService.HandleServiceRequest
+// is the last handler of every middleware chain.
+type RequestHandler func(request *model.Request, core FabricServiceCore)
+
+// Middleware wraps the handling of service requests. It can inspect or modify the request
+// before calling next, short-circuit the request by sending an error response through the
+// core instead of calling next, or wrap the response path by passing a core created with
+// InterceptResponses to next.
+type Middleware func(next RequestHandler) RequestHandler
+
+// Builds the handler which runs the request through the middlewares, the first
+// middleware is the outermost one.
+func chainMiddleware(handler RequestHandler, middleware ...Middleware) RequestHandler {
+    for i := len(middleware) - 1; i >= 0; i-- {
+        handler = middleware[i](handler)
+    }
+    return handler
+}
+
+// ResponseInterceptor is called with every response sent for a request before it is
+// sent on the service channel, it may modify the response.
+type ResponseInterceptor func(request *model.Request, response *model.Response)
+
+// Returns a core which passes the responses sent through it to the interceptor
+// before sending them with the supplied core.
+func InterceptResponses(core FabricServiceCore, interceptor ResponseInterceptor) FabricServiceCore {
+    return &interceptingCore{
+        FabricServiceCore: core,
+        interceptor:       interceptor,
+    }
+}
+
+type interceptingCore struct {
+    FabricServiceCore
+    interceptor ResponseInterceptor
+}
+
+func (c *interceptingCore) SendResponse(request *model.Request, responsePayload interface{}) {
+    c.send(request, &model.Response{Payload: responsePayload})
+}
+
+func (c *interceptingCore) SendResponseWithHeaders(
+        request *model.Request, responsePayload interface{}, headers map[string]string) {
+    c.send(request, &model.Response{Payload: responsePayload, Headers: headers})
+}
+
+func (c *interceptingCore) SendErrorResponse(
+        request *model.Request, responseErrorCode int, responseErrorMessage string) {
+    c.SendErrorResponseWithPayload(request, responseErrorCode, responseErrorMessage, nil)
+}
+
+func (c *interceptingCore) SendErrorResponseWithPayload(
+        request *model.Request, responseErrorCode int, responseErrorMessage string, payload interface{}) {
+    c.send(request, &model.Response{
+        Payload:      payload,
+        Error:        true,
+        ErrorCode:    responseErrorCode,
+        ErrorMessage: responseErrorMessage,
+    })
+}
+
+func (c *interceptingCore) HandleUnknownRequest(request *model.Request) {
+    channelName := serviceChannelName(c.FabricServiceCore)
+    if channelName == "" {
+        c.FabricServiceCore.HandleUnknownRequest(request)
+        return
+    }
+    c.SendErrorResponse(request, 403, fmt.Sprintf("unsupported request for \"%s\": %s", channelName, request.Request))
+}
+
+func (c *interceptingCore) send(request *model.Request, response *model.Response) {
+    c.interceptor(request, response)
+
+    switch core := c.FabricServiceCore.(type) {
+    case *interceptingCore:
+        core.send(request, response)
+        return
+    case *fabricCore:
+        // send the response as is, the error methods of the core cannot set the headers
+        response.Id = request.Id
+        response.Destination = core.channelName
+        response.BrokerDestination = request.BrokerDestination
+        core.sendResponse(request, response)
+        return
+    }
+
+    if response.Error {
+        c.FabricServiceCore.SendErrorResponseWithPayload(
+            request, response.ErrorCode, response.ErrorMessage, response.Payload)
+    } else {
+        c.FabricServiceCore.SendResponseWithHeaders(request, response.Payload, response.Headers)
+    }
+}
+
+// Returns the channel of the service core, or an empty string for unknown core implementations.
+func serviceChannelName(core FabricServiceCore) string {
+    switch c := core.(type) {
+    case *fabricCore:
+        return c.channelName
+    case *interceptingCore:
+        return serviceChannelName(c.FabricServiceCore)
+    }
+    return ""
+}
+
+// Returns a middleware which logs every request and its first response at debug level,
+// error responses are logged at warn level. A nil logger logs with the logger of the bus.
+func LoggingMiddleware(logger log.Logger) Middleware {
+    return func(next RequestHandler) RequestHandler {
+        return func(request *model.Request, core FabricServiceCore) {
+            requestLogger := logger
+            if requestLogger == nil {
+                requestLogger = core.Bus().GetLogger()
+            }
+            requestLogger = requestLogger.With("channel", serviceChannelName(core), "request", request.Request)
+            requestLogger.Debug("service request received")
+
+            start := time.Now()
+            var once sync.Once
+            next(request, InterceptResponses(core, func(request *model.Request, response *model.Response) {
+                once.Do(func() {
+                    if response.Error {
+                        requestLogger.Warn("service request failed", "duration", time.Since(start),
+                            "error.code", response.ErrorCode, "error", response.ErrorMessage)
+                    } else {
+                        requestLogger.Debug("service request handled", "duration", time.Since(start))
+                    }
+                })
+            }))
+        }
+    }
+}
+
+// Returns a middleware which answers the requests the authorize function rejects with
+// a 403 error response, the service is not called for them.
+func AuthorizationMiddleware(authorize func(request *model.Request) error) Middleware {
+    return rejectingMiddleware(403, authorize)
+}
+
+// Returns a middleware which answers the requests the validate function rejects with
+// a 400 error response, the service is not called for them.
+func ValidationMiddleware(validate func(request *model.Request) error) Middleware {
+    return rejectingMiddleware(400, validate)
+}
+
+func rejectingMiddleware(errorCode int, check func(request *model.Request) error) Middleware {
+    return func(next RequestHandler) RequestHandler {
+        return func(request *model.Request, core FabricServiceCore) {
+            if err := check(request); err != nil {
+                core.SendErrorResponse(request, errorCode, err.Error())
+                return
+            }
+            next(request, core)
+        }
+    }
+}
+
+// Returns a middleware which lets through requestsPerSecond requests on average with bursts
+// of up to burst requests, other requests are answered with a 429 error response.
+// The limit applies to all services the middleware is used for.
+func RateLimitMiddleware(requestsPerSecond float64, burst int) Middleware {
+    if burst < 1 {
+        burst = 1
+    }
+    limiter := &tokenBucket{
+        rate:   requestsPerSecond,
+        burst:  float64(burst),
+        tokens: float64(burst),
+        last:   time.Now(),
+    }
+    return func(next RequestHandler) RequestHandler {
+        return func(request *model.Request, core FabricServiceCore) {
+            if !limiter.take() {
+                core.SendErrorResponse(request, 429, "too many requests")
+                return
+            }
+            next(request, core)
+        }
+    }
+}
+
+type tokenBucket struct {
+    lock   sync.Mutex
+    rate   float64
+    burst  float64
+    tokens float64
+    last   time.Time
+}
+
+func (b *tokenBucket) take() bool {
+    b.lock.Lock()
+    defer b.lock.Unlock()
+
+    now := time.Now()
+    b.tokens += now.Sub(b.last).Seconds() * b.rate
+    if b.tokens > b.burst {
+        b.tokens = b.burst
+    }
+    b.last = now
+
+    if b.tokens < 1 {
+        return false
+    }
+    b.tokens--
+    return true
+}
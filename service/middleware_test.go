@@ -0,0 +1,219 @@
+// Copyright 2019-2020 VMware, Inc.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package service
+
+import (
+    "context"
+    "errors"
+    "github.com/google/uuid"
+    "github.com/stretchr/testify/assert"
+    "github.com/vmware/transport-go/log"
+    "github.com/vmware/transport-go/model"
+    "sync"
+    "testing"
+    "time"
+)
+
+// core which records the responses instead of sending them.
+type recordingCore struct {
+    FabricServiceCore
+    lock      sync.Mutex
+    responses []*model.Response
+}
+
+func (c *recordingCore) SendResponse(request *model.Request, responsePayload interface{}) {
+    c.SendResponseWithHeaders(request, responsePayload, nil)
+}
+
+func (c *recordingCore) SendResponseWithHeaders(
+        request *model.Request, responsePayload interface{}, headers map[string]string) {
+    c.record(&model.Response{Id: request.Id, Payload: responsePayload, Headers: headers})
+}
+
+func (c *recordingCore) SendErrorResponse(request *model.Request, responseErrorCode int, responseErrorMessage string) {
+    c.SendErrorResponseWithPayload(request, responseErrorCode, responseErrorMessage, nil)
+}
+
+func (c *recordingCore) SendErrorResponseWithPayload(
+        request *model.Request, responseErrorCode int, responseErrorMessage string, payload interface{}) {
+    c.record(&model.Response{Id: request.Id, Payload: payload, Error: true,
+        ErrorCode: responseErrorCode, ErrorMessage: responseErrorMessage})
+}
+
+func (c *recordingCore) record(response *model.Response) {
+    c.lock.Lock()
+    defer c.lock.Unlock()
+    c.responses = append(c.responses, response)
+}
+
+func newTestRequest(requestName string, payload interface{}) *model.Request {
+    id := uuid.New()
+    return &model.Request{Id: &id, Request: requestName, Payload: payload}
+}
+
+// responds to each request with its payload
+func echoHandler(request *model.Request, core FabricServiceCore) {
+    core.SendResponse(request, request.Payload)
+}
+
+func TestServiceRegistry_Middleware(t *testing.T) {
+    registry := newTestServiceRegistry()
+
+    var lock sync.Mutex
+    var calls []string
+    recordingMiddleware := func(name string) Middleware {
+        return func(next RequestHandler) RequestHandler {
+            return func(request *model.Request, core FabricServiceCore) {
+                lock.Lock()
+                calls = append(calls, name)
+                lock.Unlock()
+                request.Payload = request.Payload.(string) + "-" + name
+                next(request, core)
+            }
+        }
+    }
+
+    registry.Use(recordingMiddleware("global"))
+    mockService := &mockFabricService{}
+    assert.Nil(t, registry.RegisterService(mockService, "test-channel",
+        recordingMiddleware("first"), recordingMiddleware("second")))
+    registry.Use(recordingMiddleware("global-2"))
+
+    mockService.wg.Add(1)
+    registry.bus.SendRequestMessage("test-channel", newTestRequest("test-request", "payload"), nil)
+    mockService.wg.Wait()
+
+    assert.Equal(t, []string{"global", "global-2", "first", "second"}, calls)
+    assert.Equal(t, "payload-global-global-2-first-second", mockService.processedRequests[0].Payload)
+}
+
+func TestServiceRegistry_MiddlewareShortCircuit(t *testing.T) {
+    registry := newTestServiceRegistry()
+    mockService := &mockFabricService{}
+    registry.RegisterService(mockService, "test-channel", AuthorizationMiddleware(func(request *model.Request) error {
+        if request.Headers["Authorization"] == "" {
+            return errors.New("not authorized")
+        }
+        return nil
+    }))
+
+    request := newTestRequest("test-request", "payload")
+    response, err := registry.bus.RequestOnceForDestinationWithContext(
+        context.Background(), "test-channel", request, request.Id)
+    assert.Nil(t, err)
+    assert.True(t, response.Payload.(*model.Response).Error)
+    assert.Equal(t, 403, response.Payload.(*model.Response).ErrorCode)
+    assert.Equal(t, "not authorized", response.Payload.(*model.Response).ErrorMessage)
+    assert.Len(t, mockService.processedRequests, 0)
+
+    request = newTestRequest("test-request", "payload")
+    request.Headers = map[string]string{"Authorization": "Bearer token"}
+    mockService.wg.Add(1)
+    registry.bus.SendRequestMessage("test-channel", request, request.Id)
+    mockService.wg.Wait()
+    assert.Len(t, mockService.processedRequests, 1)
+}
+
+func TestInterceptResponses(t *testing.T) {
+    registry := newTestServiceRegistry()
+    addHeader := func(next RequestHandler) RequestHandler {
+        return func(request *model.Request, core FabricServiceCore) {
+            next(request, InterceptResponses(core, func(request *model.Request, response *model.Response) {
+                response.Headers = map[string]string{"X-Request": request.Request}
+            }))
+        }
+    }
+    registry.RegisterService(&unknownRequestService{}, "test-channel", addHeader)
+
+    request := newTestRequest("echo", "payload")
+    response, err := registry.bus.RequestOnceForDestinationWithContext(context.Background(), "test-channel", request, request.Id)
+    assert.Nil(t, err)
+    assert.Equal(t, "payload", response.Payload.(*model.Response).Payload)
+    assert.Equal(t, map[string]string{"X-Request": "echo"}, response.Payload.(*model.Response).Headers)
+
+    request = newTestRequest("unknown", nil)
+    response, err = registry.bus.RequestOnceForDestinationWithContext(context.Background(), "test-channel", request, request.Id)
+    assert.Nil(t, err)
+    assert.Equal(t, 403, response.Payload.(*model.Response).ErrorCode)
+    assert.Equal(t, "unsupported request for \"test-channel\": unknown", response.Payload.(*model.Response).ErrorMessage)
+    assert.Equal(t, map[string]string{"X-Request": "unknown"}, response.Payload.(*model.Response).Headers)
+}
+
+type unknownRequestService struct{}
+
+func (s *unknownRequestService) HandleServiceRequest(request *model.Request, core FabricServiceCore) {
+    if request.Request == "echo" {
+        echoHandler(request, core)
+    } else {
+        core.HandleUnknownRequest(request)
+    }
+}
+
+func TestValidationMiddleware(t *testing.T) {
+    handler := ValidationMiddleware(func(request *model.Request) error {
+        if request.Payload == nil {
+            return errors.New("payload is required")
+        }
+        return nil
+    })(echoHandler)
+
+    core := &recordingCore{}
+    handler(newTestRequest("test", nil), core)
+    handler(newTestRequest("test", "payload"), core)
+
+    assert.Len(t, core.responses, 2)
+    assert.True(t, core.responses[0].Error)
+    assert.Equal(t, 400, core.responses[0].ErrorCode)
+    assert.Equal(t, "payload is required", core.responses[0].ErrorMessage)
+    assert.False(t, core.responses[1].Error)
+    assert.Equal(t, "payload", core.responses[1].Payload)
+}
+
+func TestRateLimitMiddleware(t *testing.T) {
+    handler := RateLimitMiddleware(100, 2)(echoHandler)
+
+    core := &recordingCore{}
+    for i := 0; i < 3; i++ {
+        handler(newTestRequest("test", i), core)
+    }
+    assert.False(t, core.responses[0].Error)
+    assert.False(t, core.responses[1].Error)
+    assert.True(t, core.responses[2].Error)
+    assert.Equal(t, 429, core.responses[2].ErrorCode)
+
+    // one token is added every 10ms
+    time.Sleep(20 * time.Millisecond)
+    handler(newTestRequest("test", 3), core)
+    assert.False(t, core.responses[3].Error)
+}
+
+func TestLoggingMiddleware(t *testing.T) {
+    var lock sync.Mutex
+    var records []*log.Record
+    logger := log.New(log.HandlerFunc(func(record *log.Record) {
+        lock.Lock()
+        defer lock.Unlock()
+        records = append(records, record)
+    }), log.DebugLevel)
+
+    failing := func(request *model.Request, core FabricServiceCore) {
+        core.SendErrorResponse(request, 500, "failed")
+        // only the first response is logged
+        core.SendErrorResponse(request, 500, "failed again")
+    }
+
+    core := &recordingCore{}
+    LoggingMiddleware(logger)(echoHandler)(newTestRequest("echo", "payload"), core)
+    LoggingMiddleware(logger)(failing)(newTestRequest("fail", nil), core)
+
+    assert.Len(t, core.responses, 3)
+    assert.Len(t, records, 4)
+    assert.Equal(t, "service request received", records[0].Message)
+    assert.Equal(t, "service request handled", records[1].Message)
+    assert.Equal(t, log.DebugLevel, records[1].Level)
+    assert.Equal(t, log.Field{Key: "request", Value: "echo"}, records[1].Fields[1])
+    assert.Equal(t, "service request failed", records[3].Message)
+    assert.Equal(t, log.WarnLevel, records[3].Level)
+    assert.Contains(t, records[3].Fields, log.Field{Key: "error.code", Value: 500})
+}
@@ -0,0 +1,182 @@
+// Copyright 2019-2020 VMware, Inc.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package service
+
+import (
+    "fmt"
+    "github.com/vmware/transport-go/model"
+    "reflect"
+    "strings"
+    "sync"
+)
+
+// Optional interface of request payloads, the router answers the requests whose
+// payload fails the validation with a 400 error response.
+type PayloadValidator interface {
+    Validate() error
+}
+
+// RouteContext is passed to the route handlers, it holds the request with its decoded payload.
+type RouteContext struct {
+    Request *model.Request
+    // The request payload decoded to the payload type of the route.
+    Payload interface{}
+    Core    FabricServiceCore
+}
+
+// Handles the requests of a single route.
+type RouteHandler func(ctx *RouteContext)
+
+// Sends the payload as response to the request.
+func (ctx *RouteContext) Respond(payload interface{}) {
+    ctx.Core.SendResponse(ctx.Request, payload)
+}
+
+// Sends the payload with the headers as response to the request.
+func (ctx *RouteContext) RespondWithHeaders(payload interface{}, headers map[string]string) {
+    ctx.Core.SendResponseWithHeaders(ctx.Request, payload, headers)
+}
+
+// Sends an error response with the code and message.
+func (ctx *RouteContext) Error(errorCode int, errorMessage string) {
+    ctx.Core.SendErrorResponse(ctx.Request, errorCode, errorMessage)
+}
+
+// Sends a 400 error response.
+func (ctx *RouteContext) BadRequest(errorMessage string) {
+    ctx.Error(400, errorMessage)
+}
+
+// Sends a 404 error response.
+func (ctx *RouteContext) NotFound(errorMessage string) {
+    ctx.Error(404, errorMessage)
+}
+
+// Sends a 500 error response with the message of the error.
+func (ctx *RouteContext) InternalError(err error) {
+    ctx.Error(500, err.Error())
+}
+
+type route struct {
+    payloadType reflect.Type
+    handler     RouteHandler
+}
+
+// RequestRouter dispatches the requests of a fabric service to the handlers registered
+// for their request names and decodes the request payloads to the types of the routes.
+// It implements FabricService, so it can be registered directly or called from the
+// HandleServiceRequest method of a service.
+type RequestRouter struct {
+    lock           sync.RWMutex
+    routes         map[string]*route
+    unknownHandler RequestHandler
+}
+
+func NewRequestRouter() *RequestRouter {
+    return &RequestRouter{
+        routes: make(map[string]*route),
+    }
+}
+
+// Registers the handler of the request. The request payload is decoded to payloadType
+// with the codec of the request content type, a nil payloadType passes the payload as is.
+// Requests whose payload cannot be decoded or fails the validation of a PayloadValidator
+// are answered with a 400 error response.
+func (r *RequestRouter) Handle(requestName string, payloadType reflect.Type, handler RouteHandler) error {
+    if handler == nil {
+        return fmt.Errorf("unable to add route for request '%s': nil handler", requestName)
+    }
+
+    r.lock.Lock()
+    defer r.lock.Unlock()
+    if _, exists := r.routes[requestName]; exists {
+        return fmt.Errorf("unable to add route for request '%s': route already exists", requestName)
+    }
+    r.routes[requestName] = &route{payloadType: payloadType, handler: handler}
+    return nil
+}
+
+// Sets the handler of the requests without route, FabricServiceCore.HandleUnknownRequest
+// is used if it is not set.
+func (r *RequestRouter) HandleUnknownRequest(handler RequestHandler) {
+    r.lock.Lock()
+    defer r.lock.Unlock()
+    r.unknownHandler = handler
+}
+
+func (r *RequestRouter) HandleServiceRequest(request *model.Request, core FabricServiceCore) {
+    r.lock.RLock()
+    rt, ok := r.routes[request.Request]
+    unknownHandler := r.unknownHandler
+    r.lock.RUnlock()
+
+    if !ok {
+        if unknownHandler != nil {
+            unknownHandler(request, core)
+        } else {
+            core.HandleUnknownRequest(request)
+        }
+        return
+    }
+
+    payload, err := decodeRequestPayload(request, rt.payloadType)
+    if err == nil {
+        if validator, ok := payload.(PayloadValidator); ok {
+            err = validator.Validate()
+        }
+    }
+    if err != nil {
+        core.SendErrorResponse(request, 400,
+            fmt.Sprintf("invalid payload for request '%s': %s", request.Request, err.Error()))
+        return
+    }
+
+    rt.handler(&RouteContext{Request: request, Payload: payload, Core: core})
+}
+
+func decodeRequestPayload(request *model.Request, payloadType reflect.Type) (interface{}, error) {
+    if payloadType == nil || (request.Payload != nil && reflect.TypeOf(request.Payload) == payloadType) {
+        return request.Payload, nil
+    }
+    if request.Payload == nil {
+        return nil, fmt.Errorf("payload is missing")
+    }
+    codec := model.GetCodecOrDefault(headerValue(request.Headers, "Content-Type"))
+    return model.ConvertValueToTypeWithCodec(request.Payload, payloadType, codec)
+}
+
+func headerValue(headers map[string]string, name string) string {
+    for key, value := range headers {
+        if strings.EqualFold(key, name) {
+            return value
+        }
+    }
+    return ""
+}
+
+// Returns the payload of the response to a service request decoded to payloadType.
+// The message payload must be a model.Response, error responses are returned as errors.
+func DecodeResponsePayload(message *model.Message, payloadType reflect.Type) (interface{}, error) {
+    var response *model.Response
+    switch payload := message.Payload.(type) {
+    case *model.Response:
+        response = payload
+    case model.Response:
+        response = &payload
+    default:
+        converted, err := model.ConvertValueToType(message.Payload, reflect.TypeOf(&model.Response{}))
+        if err != nil {
+            return nil, fmt.Errorf("message payload is not a service response: %s", err.Error())
+        }
+        response = converted.(*model.Response)
+    }
+
+    if response.Error {
+        return nil, fmt.Errorf("%s (error code %d)", response.ErrorMessage, response.ErrorCode)
+    }
+    if response.Payload == nil || payloadType == nil || reflect.TypeOf(response.Payload) == payloadType {
+        return response.Payload, nil
+    }
+    return model.ConvertValueToType(response.Payload, payloadType)
+}
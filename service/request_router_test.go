@@ -0,0 +1,143 @@
+// Copyright 2019-2020 VMware, Inc.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package service
+
+import (
+    "context"
+    "errors"
+    "github.com/stretchr/testify/assert"
+    "github.com/vmware/transport-go/model"
+    "reflect"
+    "testing"
+)
+
+type createVmRequest struct {
+    Name     string `json:"name"`
+    MemoryMB int    `json:"memoryMB"`
+}
+
+func (r *createVmRequest) Validate() error {
+    if r.Name == "" {
+        return errors.New("name is required")
+    }
+    return nil
+}
+
+type createVmResponse struct {
+    Id   string `json:"id"`
+    Name string `json:"name"`
+}
+
+func newTestRouter(t *testing.T) *RequestRouter {
+    router := NewRequestRouter()
+    assert.Nil(t, router.Handle("createVm", reflect.TypeOf(&createVmRequest{}), func(ctx *RouteContext) {
+        req := ctx.Payload.(*createVmRequest)
+        if req.MemoryMB > 1024 {
+            ctx.Error(422, "not enough memory")
+            return
+        }
+        ctx.Respond(&createVmResponse{Id: "vm-1", Name: req.Name})
+    }))
+    assert.Nil(t, router.Handle("ping", nil, func(ctx *RouteContext) {
+        ctx.RespondWithHeaders(ctx.Payload, map[string]string{"X-Pong": "true"})
+    }))
+    return router
+}
+
+func TestRequestRouter_Handle(t *testing.T) {
+    router := newTestRouter(t)
+    assert.EqualError(t, router.Handle("ping", nil, func(ctx *RouteContext) {}),
+        "unable to add route for request 'ping': route already exists")
+    assert.EqualError(t, router.Handle("pong", nil, nil),
+        "unable to add route for request 'pong': nil handler")
+
+    core := &recordingCore{}
+
+    // payload received over the wire
+    router.HandleServiceRequest(newTestRequest("createVm", map[string]interface{}{
+        "name": "vm", "memoryMB": 512,
+    }), core)
+    // payload sent in-process
+    router.HandleServiceRequest(newTestRequest("createVm", &createVmRequest{Name: "vm2"}), core)
+    router.HandleServiceRequest(newTestRequest("ping", "data"), core)
+    router.HandleServiceRequest(newTestRequest("createVm", &createVmRequest{Name: "vm3", MemoryMB: 2048}), core)
+
+    assert.Len(t, core.responses, 4)
+    assert.Equal(t, &createVmResponse{Id: "vm-1", Name: "vm"}, core.responses[0].Payload)
+    assert.Equal(t, &createVmResponse{Id: "vm-1", Name: "vm2"}, core.responses[1].Payload)
+    assert.Equal(t, "data", core.responses[2].Payload)
+    assert.Equal(t, map[string]string{"X-Pong": "true"}, core.responses[2].Headers)
+    assert.Equal(t, 422, core.responses[3].ErrorCode)
+    assert.Equal(t, "not enough memory", core.responses[3].ErrorMessage)
+}
+
+func TestRequestRouter_InvalidPayload(t *testing.T) {
+    router := newTestRouter(t)
+    core := &recordingCore{}
+
+    router.HandleServiceRequest(newTestRequest("createVm", nil), core)
+    router.HandleServiceRequest(newTestRequest("createVm", map[string]interface{}{"memoryMB": 512}), core)
+    router.HandleServiceRequest(newTestRequest("createVm", map[string]interface{}{"name": 42}), core)
+    router.HandleServiceRequest(newTestRequest("createVm", []byte("not json")), core)
+
+    assert.Len(t, core.responses, 4)
+    for _, response := range core.responses {
+        assert.True(t, response.Error)
+        assert.Equal(t, 400, response.ErrorCode)
+    }
+    assert.Equal(t, "invalid payload for request 'createVm': payload is missing", core.responses[0].ErrorMessage)
+    assert.Equal(t, "invalid payload for request 'createVm': name is required", core.responses[1].ErrorMessage)
+    assert.Contains(t, core.responses[2].ErrorMessage, "invalid payload for request 'createVm': json: cannot unmarshal")
+    assert.Contains(t, core.responses[3].ErrorMessage, "invalid payload for request 'createVm': invalid character")
+}
+
+func TestRequestRouter_UnknownRequest(t *testing.T) {
+    registry := newTestServiceRegistry()
+    router := newTestRouter(t)
+    registry.RegisterService(router, "vm-service")
+
+    request := newTestRequest("deleteVm", nil)
+    response, err := registry.bus.RequestOnceForDestinationWithContext(
+        context.Background(), "vm-service", request, request.Id)
+    assert.Nil(t, err)
+    assert.Equal(t, 403, response.Payload.(*model.Response).ErrorCode)
+
+    router.HandleUnknownRequest(func(request *model.Request, core FabricServiceCore) {
+        core.SendErrorResponse(request, 404, "no route for " + request.Request)
+    })
+    request = newTestRequest("deleteVm", nil)
+    response, err = registry.bus.RequestOnceForDestinationWithContext(
+        context.Background(), "vm-service", request, request.Id)
+    assert.Nil(t, err)
+    assert.Equal(t, 404, response.Payload.(*model.Response).ErrorCode)
+    assert.Equal(t, "no route for deleteVm", response.Payload.(*model.Response).ErrorMessage)
+}
+
+func TestDecodeResponsePayload(t *testing.T) {
+    registry := newTestServiceRegistry()
+    registry.RegisterService(newTestRouter(t), "vm-service")
+
+    request := newTestRequest("createVm", &createVmRequest{Name: "vm"})
+    message, _ := registry.bus.RequestOnceForDestinationWithContext(
+        context.Background(), "vm-service", request, request.Id)
+    payload, err := DecodeResponsePayload(message, reflect.TypeOf(&createVmResponse{}))
+    assert.Nil(t, err)
+    assert.Equal(t, &createVmResponse{Id: "vm-1", Name: "vm"}, payload)
+
+    // response received over the wire
+    payload, err = DecodeResponsePayload(&model.Message{Payload: map[string]interface{}{
+        "payload": map[string]interface{}{"id": "vm-2", "name": "vm"},
+    }}, reflect.TypeOf(createVmResponse{}))
+    assert.Nil(t, err)
+    assert.Equal(t, createVmResponse{Id: "vm-2", Name: "vm"}, payload)
+
+    request = newTestRequest("createVm", &createVmRequest{})
+    message, _ = registry.bus.RequestOnceForDestinationWithContext(
+        context.Background(), "vm-service", request, request.Id)
+    _, err = DecodeResponsePayload(message, reflect.TypeOf(&createVmResponse{}))
+    assert.EqualError(t, err, "invalid payload for request 'createVm': name is required (error code 400)")
+
+    _, err = DecodeResponsePayload(&model.Message{Payload: "text"}, nil)
+    assert.NotNil(t, err)
+}
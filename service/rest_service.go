@@ -6,11 +6,18 @@ package service
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
+	"github.com/vmware/transport-go/bus"
 	"github.com/vmware/transport-go/model"
+	"github.com/vmware/transport-go/tracing"
 	"io"
+	"io/ioutil"
 	"net/http"
 	"net/url"
 	"reflect"
+	"strconv"
+	"strings"
+	"time"
 )
 
 const (
@@ -23,7 +30,8 @@ type RestServiceRequest struct {
 	// HTTP Method to use, e.g. GET, POST, PATCH etc.
 	Method string `json:"method"`
 	// The body of the request. String and []byte payloads will be sent as is,
-	// all other payloads will be serialized as json.
+	// all other payloads will be serialized with the codec registered for the
+	// request Content-Type header (see model.RegisterCodec), json by default.
 	Body interface{} `json:"body"`
 	//  HTTP headers of the request.
 	Headers map[string]string `json:"headers"`
@@ -37,6 +45,9 @@ type RestServiceRequest struct {
 	// Shouldn't be populated directly, the field is used to deserialize
 	// com.vmware.bifrost.core.model.RestServiceRequest Java/Typescript requests
 	ApiClass string `json:"apiClass"`
+	// Optional trace context the HTTP call belongs to, usually the Trace of the
+	// model.Request being handled. The call is sent with a traceparent header.
+	Trace *model.TraceContext `json:"-"`
 }
 
 func (request *RestServiceRequest) marshalBody() ([]byte, error) {
@@ -49,8 +60,30 @@ func (request *RestServiceRequest) marshalBody() ([]byte, error) {
 	if ok {
 		return bytePayload, nil
 	}
-	// encode the message payload as JSON
-	return json.Marshal(request.Body)
+	// encode the message payload with the codec for the request content type
+	return model.GetCodecOrDefault(request.getHeader("Content-Type")).Marshal(request.Body)
+}
+
+// Returns the value of a request header, header names are case insensitive.
+func (request *RestServiceRequest) getHeader(name string) string {
+	for k, v := range request.Headers {
+		if strings.EqualFold(k, name) {
+			return v
+		}
+	}
+	return ""
+}
+
+// RestServiceCall describes an HTTP call made by the rest service. It is the data of
+// bus.RestServiceCallEvt monitor events.
+type RestServiceCall struct {
+	Method string
+	Uri    string
+	// HTTP status code of the response, zero if the call failed
+	StatusCode int
+	Duration   time.Duration
+	// Transport error of a failed call
+	Error error
 }
 
 type restService struct {
@@ -94,7 +127,36 @@ func (rs *restService) HandleServiceRequest(request *model.Request, core FabricS
 		httpReq.Header.Add("Content-Type", "application/merge-patch+json")
 	}
 
+	// traced requests are sent with the trace context of the client span
+	var span *tracing.Span
+	if request.Trace != nil {
+		span = tracing.StartSpan("HTTP "+httpReq.Method, tracing.ClientSpan, request.Trace)
+		defer span.End()
+		span.SetAttribute("http.method", httpReq.Method)
+		span.SetAttribute("http.url", httpReq.URL.String())
+		httpReq.Header.Set(model.TraceParentHeader, span.Context.TraceParent())
+		if span.Context.TraceState != "" {
+			httpReq.Header.Set(model.TraceStateHeader, span.Context.TraceState)
+		}
+	}
+
+	start := time.Now()
 	httpResp, err := rs.httpClient.Do(httpReq)
+	call := &RestServiceCall{
+		Method:   httpReq.Method,
+		Uri:      httpReq.URL.String(),
+		Duration: time.Since(start),
+		Error:    err,
+	}
+	if httpResp != nil {
+		call.StatusCode = httpResp.StatusCode
+	}
+	core.Bus().SendMonitorEvent(bus.RestServiceCallEvt, restServiceChannel, call)
+
+	if span != nil {
+		recordHttpCall(span, httpResp, err)
+	}
+
 	if err != nil {
 		core.SendErrorResponse(request, 500, err.Error())
 		return
@@ -111,7 +173,8 @@ func (rs *restService) HandleServiceRequest(request *model.Request, core FabricS
 		return
 	}
 
-	result, err := rs.deserializeResponse(httpResp.Body, restReq.ResponseType)
+	result, err := rs.deserializeResponse(
+		httpResp.Body, restReq.ResponseType, httpResp.Header.Get("Content-Type"))
 	if err != nil {
 		core.SendErrorResponse(request, 500, "failed to deserialize response:"+err.Error())
 	} else {
@@ -119,6 +182,18 @@ func (rs *restService) HandleServiceRequest(request *model.Request, core FabricS
 	}
 }
 
+// Records the status code or the error of an HTTP call on its span.
+func recordHttpCall(span *tracing.Span, httpResp *http.Response, err error) {
+	if err != nil {
+		span.SetError(err)
+		return
+	}
+	span.SetAttribute("http.status_code", strconv.Itoa(httpResp.StatusCode))
+	if httpResp.StatusCode >= 300 {
+		span.SetError(errors.New(httpResp.Status))
+	}
+}
+
 func (rs *restService) getRestServiceRequest(request *model.Request) (*RestServiceRequest, bool) {
 	restReq, ok := request.Payload.(*RestServiceRequest)
 	if ok {
@@ -156,7 +231,13 @@ func (rs *restService) getRequestUrl(address string, core FabricServiceCore) str
 }
 
 func (rs *restService) deserializeResponse(
-	body io.ReadCloser, responseType reflect.Type) (interface{}, error) {
+	body io.ReadCloser, responseType reflect.Type, contentType string) (interface{}, error) {
+
+	// use a registered codec for the response content type, stream json responses as before.
+	codec, hasCodec := model.GetCodec(contentType)
+	if hasCodec && codec == model.JSONCodec {
+		hasCodec = false
+	}
 
 	if responseType != nil {
 
@@ -187,7 +268,12 @@ func (rs *restService) deserializeResponse(
 			responseType = responseType.Elem()
 		}
 		decodedValuePtr := reflect.New(responseType).Interface()
-		err := json.NewDecoder(body).Decode(&decodedValuePtr)
+		var err error
+		if hasCodec {
+			err = decodeWithCodec(body, codec, decodedValuePtr)
+		} else {
+			err = json.NewDecoder(body).Decode(&decodedValuePtr)
+		}
 		if err != nil {
 			return nil, err
 		}
@@ -198,7 +284,20 @@ func (rs *restService) deserializeResponse(
 		}
 	} else {
 		var result map[string]interface{}
-		err := json.NewDecoder(body).Decode(&result)
+		var err error
+		if hasCodec {
+			err = decodeWithCodec(body, codec, &result)
+		} else {
+			err = json.NewDecoder(body).Decode(&result)
+		}
 		return result, err
 	}
 }
+
+func decodeWithCodec(body io.Reader, codec model.Codec, target interface{}) error {
+	data, err := ioutil.ReadAll(body)
+	if err != nil {
+		return err
+	}
+	return codec.Unmarshal(data, target)
+}
@@ -41,6 +41,55 @@ func TestRestServiceRequest_marshalBody(t *testing.T) {
     assert.Equal(t, expectedValue, body)
 }
 
+// test codec which wraps json with a prefix, so it can be told apart from the default codec.
+var testPrefixCodec = model.NewCodec("application/x-test-prefix",
+    func(value interface{}) ([]byte, error) {
+        data, err := json.Marshal(value)
+        return append([]byte("prefix:"), data...), err
+    },
+    func(data []byte, target interface{}) error {
+        return json.Unmarshal(bytes.TrimPrefix(data, []byte("prefix:")), target)
+    })
+
+func TestRestServiceRequest_marshalBodyWithCodec(t *testing.T) {
+    model.RegisterCodec(testPrefixCodec)
+
+    item := testItem{Name: "test-name", Count: 5}
+    req := &RestServiceRequest{Body: item, Headers: map[string]string{"content-type": "application/x-test-prefix"}}
+    body, err := req.marshalBody()
+    assert.Nil(t, err)
+    expectedValue, _ := json.Marshal(item)
+    assert.Equal(t, append([]byte("prefix:"), expectedValue...), body)
+
+    // unknown content types fall back to json
+    req = &RestServiceRequest{Body: item, Headers: map[string]string{"Content-Type": "application/merge-patch+json"}}
+    body, err = req.marshalBody()
+    assert.Nil(t, err)
+    assert.Equal(t, expectedValue, body)
+}
+
+func TestRestService_deserializeResponseWithCodec(t *testing.T) {
+    model.RegisterCodec(testPrefixCodec)
+    rs := &restService{}
+
+    result, err := rs.deserializeResponse(
+        ioutil.NopCloser(strings.NewReader(`prefix:{"name": "test-name", "count": 3}`)),
+        reflect.TypeOf(&testItem{}), "application/x-test-prefix; charset=UTF-8")
+    assert.Nil(t, err)
+    assert.Equal(t, &testItem{Name: "test-name", Count: 3}, result)
+
+    result, err = rs.deserializeResponse(
+        ioutil.NopCloser(strings.NewReader(`prefix:{"name": "test-name"}`)),
+        nil, "application/x-test-prefix")
+    assert.Nil(t, err)
+    assert.Equal(t, map[string]interface{}{"name": "test-name"}, result)
+
+    result, err = rs.deserializeResponse(
+        ioutil.NopCloser(strings.NewReader(`{"name": "test-name"}`)), nil, "application/json")
+    assert.Nil(t, err)
+    assert.Equal(t, map[string]interface{}{"name": "test-name"}, result)
+}
+
 func TestRestService_AutoRegistration(t *testing.T) {
     assert.NotNil(t, GetServiceRegistry().(*serviceRegistry).services[restServiceChannel])
 }
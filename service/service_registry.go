@@ -7,8 +7,10 @@ import (
     "github.com/vmware/transport-go/bus"
     "sync"
     "fmt"
+    "github.com/vmware/transport-go/log"
     "github.com/vmware/transport-go/model"
-    "log"
+    "github.com/vmware/transport-go/tracing"
+    "time"
 )
 
 // Registry with all local fabric services.
@@ -17,17 +19,32 @@ type ServiceRegistry interface {
     // Only one fabric service can be associated with a given channel.
     // If the fabric service implements the FabricInitializableService interface
     // its Init method will be called during the registration process.
-    RegisterService(service FabricService, serviceChannelName string) error
+    // The requests are passed through the global middleware chain and then through
+    // the supplied middlewares before they reach the service.
+    RegisterService(service FabricService, serviceChannelName string, middleware ...Middleware) error
     // Unregisters the fabric service associated with the given channel.
     UnregisterService(serviceChannelName string) error
     // Set global base host or host:port to be used by the restService
     SetGlobalRestServiceBaseHost(host string)
+    // Set the supervisor of the registered services, nil disables the supervision.
+    // Requests which make a service panic are always answered with an error response.
+    SetServiceSupervisor(supervisor *ServiceSupervisor)
+    // Set the logger of the registry and its services, nil falls back to the logger of the bus.
+    SetLogger(logger log.Logger)
+    // Appends middlewares to the global chain, which handles the requests of all services
+    // before their own middlewares.
+    Use(middleware ...Middleware)
 }
 
 type serviceRegistry struct {
     lock sync.Mutex
     services map[string]*fabricServiceWrapper
     bus bus.EventBus
+    supervisor *ServiceSupervisor
+    loggerLock sync.RWMutex
+    logger log.Logger
+    middlewareLock sync.RWMutex
+    middleware []Middleware
 }
 
 var once sync.Once
@@ -54,7 +71,9 @@ func (r *serviceRegistry) SetGlobalRestServiceBaseHost(host string) {
     r.services[restServiceChannel].service.(*restService).setBaseHost(host)
 }
 
-func (r *serviceRegistry) RegisterService(service FabricService, serviceChannelName string) error {
+func (r *serviceRegistry) RegisterService(
+        service FabricService, serviceChannelName string, middleware ...Middleware) error {
+
     r.lock.Lock()
     defer r.lock.Unlock()
 
@@ -66,7 +85,7 @@ func (r *serviceRegistry) RegisterService(service FabricService, serviceChannelN
         return fmt.Errorf("unable to register service: service channel name is already used: %s", serviceChannelName)
     }
 
-    sw := newServiceWrapper(r.bus, service, serviceChannelName)
+    sw := r.newServiceWrapper(service, serviceChannelName, middleware)
     err := sw.init()
     if err != nil {
         return err
@@ -88,10 +107,102 @@ func (r *serviceRegistry) UnregisterService(serviceChannelName string) error {
     return nil
 }
 
+func (r *serviceRegistry) SetServiceSupervisor(supervisor *ServiceSupervisor) {
+    r.lock.Lock()
+    defer r.lock.Unlock()
+    r.supervisor = supervisor
+}
+
+func (r *serviceRegistry) SetLogger(logger log.Logger) {
+    r.loggerLock.Lock()
+    defer r.loggerLock.Unlock()
+    r.logger = logger
+}
+
+func (r *serviceRegistry) Use(middleware ...Middleware) {
+    r.middlewareLock.Lock()
+    defer r.middlewareLock.Unlock()
+    // copy on write, the wrappers keep using the slice they got
+    chain := make([]Middleware, 0, len(r.middleware)+len(middleware))
+    r.middleware = append(append(chain, r.middleware...), middleware...)
+}
+
+func (r *serviceRegistry) getMiddleware() []Middleware {
+    r.middlewareLock.RLock()
+    defer r.middlewareLock.RUnlock()
+    return r.middleware
+}
+
+func (r *serviceRegistry) getLogger() log.Logger {
+    r.loggerLock.RLock()
+    defer r.loggerLock.RUnlock()
+    if r.logger == nil {
+        return r.bus.GetLogger()
+    }
+    return r.logger
+}
+
+func (r *serviceRegistry) newServiceWrapper(
+        service FabricService, serviceChannelName string, middleware []Middleware) *fabricServiceWrapper {
+
+    sw := newServiceWrapper(r.bus, service, serviceChannelName)
+    sw.failureHandler = r.handleServiceFailure
+    sw.getLogger = r.getLogger
+    sw.middleware = middleware
+    sw.getGlobalMiddleware = r.getMiddleware
+    return sw
+}
+
+func (r *serviceRegistry) handleServiceFailure(sw *fabricServiceWrapper) {
+    r.lock.Lock()
+    supervisor := r.supervisor
+    r.lock.Unlock()
+
+    if supervisor == nil || supervisor.MaxFailures <= 0 || !sw.recordFailure(supervisor) {
+        return
+    }
+    // the failing request is still being handled, act once it completes.
+    go r.superviseService(sw, supervisor.Action)
+}
+
+func (r *serviceRegistry) superviseService(sw *fabricServiceWrapper, action SupervisorAction) {
+    r.lock.Lock()
+    defer r.lock.Unlock()
+
+    serviceChannelName := sw.fabricCore.channelName
+    if r.services[serviceChannelName] != sw {
+        // the service was already restarted or unregistered
+        return
+    }
+    sw.unregister()
+    delete(r.services, serviceChannelName)
+
+    if action == SupervisorUnregister {
+        sw.logger().Warn("unregistered failing service")
+        return
+    }
+
+    restarted := r.newServiceWrapper(sw.service, serviceChannelName, sw.middleware)
+    if err := restarted.init(); err != nil {
+        sw.logger().Error("unable to restart failing service", "error", err)
+        return
+    }
+    r.services[serviceChannelName] = restarted
+    sw.logger().Warn("restarted failing service")
+}
+
 type fabricServiceWrapper struct {
-    service            FabricService
-    fabricCore         *fabricCore
-    requestMsgHandler  bus.MessageHandler
+    service             FabricService
+    fabricCore          *fabricCore
+    requestMsgHandler   bus.MessageHandler
+    // called after the service panicked while handling a request
+    failureHandler      func(sw *fabricServiceWrapper)
+    failureLock         sync.Mutex
+    failures            []time.Time
+    getLogger           func() log.Logger
+    // middlewares of the service
+    middleware          []Middleware
+    getGlobalMiddleware func() []Middleware
 }
 
 func newServiceWrapper(
@@ -103,9 +214,14 @@ func newServiceWrapper(
             bus:         bus,
             channelName: serviceChannelName,
         },
+        getLogger: bus.GetLogger,
     }
 }
 
+func (sw *fabricServiceWrapper) logger() log.Logger {
+    return sw.getLogger().With("channel", sw.fabricCore.channelName)
+}
+
 func (sw *fabricServiceWrapper) init() error {
     sw.fabricCore.bus.GetChannelManager().CreateChannel(sw.fabricCore.channelName)
 
@@ -129,7 +245,7 @@ func (sw *fabricServiceWrapper) init() error {
             if !ok {
                 request, ok := message.Payload.(model.Request)
                 if !ok {
-                    log.Println("cannot cast service request payload to model.Request")
+                    sw.logger().Warn("cannot cast service request payload to model.Request")
                     return
                 }
                 requestPtr = &request
@@ -139,13 +255,84 @@ func (sw *fabricServiceWrapper) init() error {
                 requestPtr.Id = message.DestinationId
             }
 
-            sw.service.HandleServiceRequest(requestPtr, sw.fabricCore)
+            // make message headers available to the service, headers already set on the request win.
+            if len(message.Headers) > 0 {
+                if requestPtr.Headers == nil {
+                    requestPtr.Headers = make(map[string]string)
+                }
+                for _, h := range message.Headers {
+                    if _, exists := requestPtr.Headers[h.Label]; !exists {
+                        requestPtr.Headers[h.Label] = h.Value
+                    }
+                }
+            }
+
+            sw.handleServiceRequest(message, requestPtr)
         },
         func(e error) {})
 
     return nil
 }
 
+// Passes the request to the service. A panic of the service is answered with a generic error
+// response, the panic value and stack are only logged and reported as a bus.HandlerPanicEvt monitor event.
+func (sw *fabricServiceWrapper) handleServiceRequest(message *model.Message, request *model.Request) {
+    span := sw.startSpan(message, request)
+    if span != nil {
+        defer span.End()
+    }
+
+    defer func() {
+        handlerPanic := bus.RecoverHandlerPanic(sw.fabricCore.channelName, message, recover())
+        if handlerPanic == nil {
+            return
+        }
+        sw.logger().Error("service failed to handle request", "request", request.Request,
+            "error", handlerPanic.Error, "stack", string(handlerPanic.Stack))
+        if span != nil {
+            span.SetError(handlerPanic.Error)
+        }
+        sw.fabricCore.SendErrorResponse(request, 500, "internal service error")
+        sw.fabricCore.bus.SendMonitorEvent(bus.HandlerPanicEvt, sw.fabricCore.channelName, handlerPanic)
+        if sw.failureHandler != nil {
+            sw.failureHandler(sw)
+        }
+    }()
+
+    sw.requestHandler()(request, sw.fabricCore)
+}
+
+// Returns the handler which passes the request through the global and the service
+// middlewares to the service.
+func (sw *fabricServiceWrapper) requestHandler() RequestHandler {
+    var global []Middleware
+    if sw.getGlobalMiddleware != nil {
+        global = sw.getGlobalMiddleware()
+    }
+    if len(global) == 0 && len(sw.middleware) == 0 {
+        return sw.service.HandleServiceRequest
+    }
+    handler := chainMiddleware(sw.service.HandleServiceRequest, sw.middleware...)
+    return chainMiddleware(handler, global...)
+}
+
+// Starts the span of a traced request and makes it the trace context of the request.
+// Returns nil if neither the request nor its message has a trace context.
+func (sw *fabricServiceWrapper) startSpan(message *model.Message, request *model.Request) *tracing.Span {
+    parent := request.Trace
+    if parent == nil {
+        parent = message.Trace
+    }
+    if parent == nil {
+        return nil
+    }
+    span := tracing.StartSpan("service "+sw.fabricCore.channelName, tracing.InternalSpan, parent)
+    span.SetAttribute("channel", sw.fabricCore.channelName)
+    span.SetAttribute("request", request.Request)
+    span.InjectRequest(request)
+    return span
+}
+
 func (sw *fabricServiceWrapper) unregister() {
     if sw.requestMsgHandler != nil {
         sw.requestMsgHandler.Close()
@@ -4,13 +4,19 @@
 package service
 
 import (
+    "bytes"
     "errors"
     "github.com/google/uuid"
     "github.com/stretchr/testify/assert"
     "github.com/vmware/transport-go/bus"
     "github.com/vmware/transport-go/model"
+    "github.com/vmware/transport-go/tracing"
+    "io/ioutil"
+    "net/http"
+    "reflect"
     "sync"
     "testing"
+    "time"
 )
 
 func newTestServiceRegistry() *serviceRegistry {
@@ -107,6 +113,60 @@ func TestServiceRegistry_RegisterService(t *testing.T) {
     assert.False(t, registry.bus.GetChannelManager().CheckChannelExists("test-channel2"))
 }
 
+func TestServiceRegistry_RequestHeaders(t *testing.T) {
+    registry := newTestServiceRegistry()
+    mockService := &mockFabricService{}
+    registry.RegisterService(mockService, "test-channel")
+
+    mockService.wg.Add(1)
+    registry.bus.SendRequestMessageWithHeaders("test-channel", &model.Request{
+        Request: "test-request",
+        Headers: map[string]string{"tenant-id": "request-tenant"},
+    }, nil, []model.MessageHeader{
+        {Label: "tenant-id", Value: "message-tenant"},
+        {Label: "correlation-id", Value: "corr-1"},
+    })
+    mockService.wg.Wait()
+
+    assert.Equal(t, map[string]string{"tenant-id": "request-tenant", "correlation-id": "corr-1"},
+        mockService.processedRequests[0].Headers)
+}
+
+func TestServiceRegistry_ResponsesDoNotLeakRequestHeaders(t *testing.T) {
+    registry := newTestServiceRegistry()
+    registry.RegisterService(&unknownRequestService{}, "test-channel")
+
+    // the topic subscriptions of a fabric endpoint forward the messages of the channel
+    // with their headers to every subscriber of the topic.
+    var lock sync.Mutex
+    var received []*model.Message
+    wg := sync.WaitGroup{}
+    for i := 0; i < 2; i++ {
+        mh, _ := registry.bus.ListenStream("test-channel")
+        mh.Handle(func(message *model.Message) {
+            lock.Lock()
+            received = append(received, message)
+            lock.Unlock()
+            wg.Done()
+        }, func(e error) {})
+    }
+
+    wg.Add(2)
+    request := newTestRequest("echo", "payload")
+    request.Headers = map[string]string{
+        "Authorization": "Bearer client-1-token",
+        "tenant-id": "client-1-tenant",
+        "correlation-id": "corr-1",
+    }
+    registry.bus.SendRequestMessage("test-channel", request, nil)
+    wg.Wait()
+
+    assert.Len(t, received, 2)
+    for _, message := range received {
+        assert.Equal(t, map[string]string{"correlation-id": "corr-1"}, model.MessageHeadersToMap(message.Headers))
+    }
+}
+
 func TestServiceRegistry_RegisterInitializableService(t *testing.T) {
     registry := newTestServiceRegistry()
     mockService := &mockInitializableService{}
@@ -148,3 +208,166 @@ func TestServiceRegistry_SetGlobalRestServiceBaseHost(t *testing.T) {
     assert.Equal(t, "localhost:9999",
             registry.services[restServiceChannel].service.(*restService).baseHost)
 }
+
+type panickingService struct {
+    lock      sync.Mutex
+    initCount int
+}
+
+func (fs *panickingService) Init(core FabricServiceCore) error {
+    fs.lock.Lock()
+    defer fs.lock.Unlock()
+    fs.initCount++
+    return nil
+}
+
+func (fs *panickingService) getInitCount() int {
+    fs.lock.Lock()
+    defer fs.lock.Unlock()
+    return fs.initCount
+}
+
+func (fs *panickingService) HandleServiceRequest(request *model.Request, core FabricServiceCore) {
+    panic("service failure")
+}
+
+func TestServiceRegistry_ServicePanic(t *testing.T) {
+    registry := newTestServiceRegistry()
+    assert.Nil(t, registry.RegisterService(&panickingService{}, "test-channel"))
+
+    panicEvents := make(chan *bus.MonitorEvent, 1)
+    registry.bus.AddMonitorEventListener(func(evt *bus.MonitorEvent) {
+        panicEvents <- evt
+    }, bus.HandlerPanicEvt)
+
+    mh, _ := registry.bus.ListenStream("test-channel")
+    responses := make(chan *model.Response, 1)
+    mh.Handle(func(message *model.Message) {
+        responses <- message.Payload.(*model.Response)
+    }, func(e error) {})
+
+    id := uuid.New()
+    registry.bus.SendRequestMessage("test-channel", &model.Request{Id: &id, Request: "test-request"}, nil)
+
+    response := <-responses
+    assert.True(t, response.Error)
+    assert.Equal(t, 500, response.ErrorCode)
+    // the panic details are not sent to the clients
+    assert.Equal(t, "internal service error", response.ErrorMessage)
+    assert.Equal(t, &id, response.Id)
+
+    evt := <-panicEvents
+    assert.Equal(t, "test-channel", evt.EntityName)
+    assert.EqualError(t, evt.Data.(*bus.HandlerPanic).Error, "handler panic: service failure")
+    assert.NotEmpty(t, evt.Data.(*bus.HandlerPanic).Stack)
+}
+
+func TestServiceRegistry_ServiceSupervisorRestart(t *testing.T) {
+    registry := newTestServiceRegistry()
+    registry.SetServiceSupervisor(&ServiceSupervisor{
+        MaxFailures:   2,
+        FailureWindow: time.Minute,
+        Action:        SupervisorRestart,
+    })
+    service := &panickingService{}
+    assert.Nil(t, registry.RegisterService(service, "test-channel"))
+    assert.Equal(t, 1, service.getInitCount())
+
+    registry.bus.SendRequestMessage("test-channel", &model.Request{Request: "test-request"}, nil)
+    registry.bus.SendRequestMessage("test-channel", &model.Request{Request: "test-request"}, nil)
+
+    assert.Eventually(t, func() bool {
+        return service.getInitCount() == 2
+    }, time.Second, 5 * time.Millisecond)
+
+    registry.lock.Lock()
+    assert.NotNil(t, registry.services["test-channel"])
+    registry.lock.Unlock()
+}
+
+func TestServiceRegistry_ServiceSupervisorUnregister(t *testing.T) {
+    registry := newTestServiceRegistry()
+    registry.SetServiceSupervisor(&ServiceSupervisor{
+        MaxFailures: 1,
+        Action:      SupervisorUnregister,
+    })
+    assert.Nil(t, registry.RegisterService(&panickingService{}, "test-channel"))
+
+    registry.bus.SendRequestMessage("test-channel", &model.Request{Request: "test-request"}, nil)
+
+    assert.Eventually(t, func() bool {
+        registry.lock.Lock()
+        defer registry.lock.Unlock()
+        return registry.services["test-channel"] == nil
+    }, time.Second, 5 * time.Millisecond)
+}
+
+type tracedRestService struct{}
+
+func (fs *tracedRestService) HandleServiceRequest(request *model.Request, core FabricServiceCore) {
+    core.RestServiceRequest(&RestServiceRequest{
+        Uri:          "http://localhost:4444/test-url",
+        Method:       "GET",
+        ResponseType: reflect.TypeOf(""),
+        Trace:        request.Trace,
+    }, func(response *model.Response) {
+        core.SendResponse(request, response.Payload)
+    }, func(response *model.Response) {
+        core.SendErrorResponse(request, response.ErrorCode, response.ErrorMessage)
+    })
+}
+
+func TestServiceRegistry_Tracing(t *testing.T) {
+    exporter := tracing.NewInMemoryExporter()
+    tracing.SetExporter(exporter)
+    defer tracing.SetExporter(nil)
+
+    registry := newTestServiceRegistry()
+    var httpTraceParent string
+    registry.services[restServiceChannel].service.(*restService).httpClient.Transport = RoundTripFunc(
+        func(req *http.Request) (*http.Response, error) {
+            httpTraceParent = req.Header.Get(model.TraceParentHeader)
+            return &http.Response{
+                StatusCode: 200,
+                Body:       ioutil.NopCloser(bytes.NewBufferString("test-response-body")),
+                Header:     make(http.Header),
+            }, nil
+        })
+    registry.RegisterService(&tracedRestService{}, "test-channel")
+
+    wg := sync.WaitGroup{}
+    wg.Add(1)
+    var responseMessage *model.Message
+    mh, _ := registry.bus.ListenStream("test-channel")
+    mh.Handle(func(message *model.Message) {
+        responseMessage = message
+        wg.Done()
+    }, func(e error) {})
+
+    registry.bus.SendRequestMessageWithHeaders("test-channel", &model.Request{Request: "test-request"}, nil,
+        []model.MessageHeader{
+            {Label: model.TraceParentHeader, Value: "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01"}})
+    wg.Wait()
+
+    assert.Equal(t, "test-response-body", responseMessage.Payload.(*model.Response).Payload)
+
+    serviceSpans := exporter.SpansByName("service test-channel")
+    restSpans := exporter.SpansByName("service " + restServiceChannel)
+    httpSpans := exporter.SpansByName("HTTP GET")
+    assert.Len(t, serviceSpans, 1)
+    assert.Len(t, restSpans, 1)
+    assert.Len(t, httpSpans, 1)
+
+    // client -> test-channel service -> rest service -> HTTP call
+    assert.Equal(t, "b7ad6b7169203331", serviceSpans[0].ParentSpanId)
+    assert.Equal(t, serviceSpans[0].Context.SpanId, restSpans[0].ParentSpanId)
+    assert.Equal(t, restSpans[0].Context.SpanId, httpSpans[0].ParentSpanId)
+    for _, span := range []*tracing.Span{serviceSpans[0], restSpans[0], httpSpans[0]} {
+        assert.Equal(t, "0af7651916cd43dd8448eb211c80319c", span.Context.TraceId)
+    }
+    assert.Equal(t, "200", httpSpans[0].Attributes["http.status_code"])
+    assert.Equal(t, httpSpans[0].Context.TraceParent(), httpTraceParent)
+
+    // the response is sent with the trace context of the service span
+    assert.Equal(t, serviceSpans[0].Context, responseMessage.Trace)
+}
@@ -0,0 +1,49 @@
+// Copyright 2019-2020 VMware, Inc.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package service
+
+import (
+    "time"
+)
+
+// Action taken by the ServiceSupervisor when a service fails too often.
+type SupervisorAction int
+
+const (
+    // Unregister the service and register it again on the same channel. The Init method of
+    // FabricInitializableService services is called again.
+    SupervisorRestart SupervisorAction = iota
+    // Unregister the service.
+    SupervisorUnregister
+)
+
+// ServiceSupervisor restarts or unregisters the services which panic repeatedly
+// while handling requests.
+type ServiceSupervisor struct {
+    // Number of failures which trigger the Action.
+    MaxFailures int
+    // Only failures within this time window are counted, zero counts all failures
+    // since the service was registered.
+    FailureWindow time.Duration
+    Action SupervisorAction
+}
+
+// Records a failure of the service and returns true if the supervisor should act.
+func (sw *fabricServiceWrapper) recordFailure(supervisor *ServiceSupervisor) bool {
+    sw.failureLock.Lock()
+    defer sw.failureLock.Unlock()
+
+    now := time.Now()
+    sw.failures = append(sw.failures, now)
+    if supervisor.FailureWindow > 0 {
+        recent := sw.failures[:0]
+        for _, failure := range sw.failures {
+            if now.Sub(failure) <= supervisor.FailureWindow {
+                recent = append(recent, failure)
+            }
+        }
+        sw.failures = recent
+    }
+    return len(sw.failures) >= supervisor.MaxFailures
+}
@@ -0,0 +1,98 @@
+// Copyright 2019-2020 VMware, Inc.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package stompserver
+
+import (
+    "crypto/tls"
+    "github.com/go-stomp/stomp/frame"
+    "strings"
+)
+
+// Credentials presented by a client in its CONNECT frame.
+type ConnectCredentials struct {
+    // Value of the login header
+    Login string
+    // Value of the passcode header
+    Passcode string
+    // Bearer token from the Authorization header, empty if the header is missing
+    Token string
+    // All headers of the CONNECT frame
+    Headers *frame.Header
+    // TLS state of the connection, nil for plaintext connections
+    TLSState *tls.ConnectionState
+}
+
+// Principal identifies an authenticated client connection.
+type Principal struct {
+    // Name of the authenticated user or service
+    Name string
+    // Optional authenticator specific data, e.g. roles or token claims
+    Attributes map[string]interface{}
+}
+
+// Authenticator validates the credentials of incoming STOMP connections.
+type Authenticator interface {
+    // Returns the principal of the client or an error if the connection should be rejected.
+    Authenticate(credentials *ConnectCredentials) (*Principal, error)
+}
+
+// Adapter which allows the use of ordinary functions as Authenticators.
+type AuthenticatorFunc func(credentials *ConnectCredentials) (*Principal, error)
+
+func (f AuthenticatorFunc) Authenticate(credentials *ConnectCredentials) (*Principal, error) {
+    return f(credentials)
+}
+
+const bearerPrefix = "bearer "
+
+func newConnectCredentials(f *frame.Frame, tlsState *tls.ConnectionState) *ConnectCredentials {
+    credentials := &ConnectCredentials{
+        Login:    f.Header.Get(frame.Login),
+        Passcode: f.Header.Get(frame.Passcode),
+        Headers:  f.Header,
+        TLSState: tlsState,
+    }
+    authHeader, ok := f.Header.Contains("Authorization")
+    if !ok {
+        authHeader = f.Header.Get("authorization")
+    }
+    if len(authHeader) > len(bearerPrefix) && strings.ToLower(authHeader[:len(bearerPrefix)]) == bearerPrefix {
+        credentials.Token = strings.TrimSpace(authHeader[len(bearerPrefix):])
+    }
+    return credentials
+}
+
+// Action a client performs on a destination.
+type DestinationAction int
+
+const (
+    // SUBSCRIBE to a destination
+    SubscribeAction DestinationAction = iota
+    // SEND a message to a destination
+    SendAction
+)
+
+func (a DestinationAction) String() string {
+    switch a {
+    case SubscribeAction:
+        return "subscribe"
+    case SendAction:
+        return "send"
+    }
+    return "unknown"
+}
+
+// Authorizer decides whether a connection can subscribe or send to a destination.
+type Authorizer interface {
+    // Returns an error if the action is not allowed. principal is nil if no authenticator is configured.
+    Authorize(connectionId string, principal *Principal, action DestinationAction, destination string) error
+}
+
+// Adapter which allows the use of ordinary functions as Authorizers.
+type AuthorizerFunc func(connectionId string, principal *Principal, action DestinationAction, destination string) error
+
+func (f AuthorizerFunc) Authorize(
+        connectionId string, principal *Principal, action DestinationAction, destination string) error {
+    return f(connectionId, principal, action, destination)
+}
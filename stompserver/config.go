@@ -3,33 +3,169 @@
 
 package stompserver
 
-import "strings"
+import (
+    "github.com/vmware/transport-go/log"
+    "strings"
+)
 
 type StompConfig interface {
     HeartBeat() int64
     AppDestinationPrefix() []string
     IsAppRequestDestination(destination string) bool
+    // Returns the authenticator used to validate CONNECT frames, nil if all connections are accepted.
+    Authenticator() Authenticator
+    // Returns the authorizer used to validate SUBSCRIBE and SEND frames, nil if all frames are accepted.
+    Authorizer() Authorizer
+    // Returns the prefixes of the queue destinations.
+    QueueDestinationPrefix() []string
+    // Returns true if the messages sent to the destination are delivered to a single subscriber.
+    IsQueueDestination(destination string) bool
+    // Returns the maximum number of messages buffered by a queue destination without subscribers,
+    // negative if the buffering is disabled.
+    QueueBufferSize() int
+    // Returns the maximum number of open transactions per connection, negative if unlimited.
+    MaxTransactions() int
+    // Returns the maximum number of frames buffered by a transaction, negative if unlimited.
+    MaxTransactionFrames() int
+    // Returns the maximum number of unacknowledged messages tracked per subscription, negative if unlimited.
+    MaxPendingMessages() int
+    // Returns the logger of the server and its connections.
+    Logger() log.Logger
 }
 
+// Default maximum number of messages buffered by a queue destination without subscribers.
+const DefaultQueueBufferSize = 1000
+
+// Default maximum number of open transactions per connection.
+const DefaultMaxTransactions = 16
+
+// Default maximum number of frames buffered by a transaction.
+const DefaultMaxTransactionFrames = 1000
+
+// Default maximum number of unacknowledged messages tracked per subscription.
+const DefaultMaxPendingMessages = 1000
+
 type stompConfig struct {
      heartbeat int64
      appDestPrefix []string
+     authenticator Authenticator
+     authorizer Authorizer
+     queueDestPrefix []string
+     queueBufferSize int
+     maxTransactions int
+     maxTransactionFrames int
+     maxPendingMessages int
+     logger log.Logger
+}
+
+// Optional StompConfig settings.
+type StompConfigOption func(config *stompConfig)
+
+// Authenticate all incoming connections with the supplied authenticator.
+// Connections which fail the authentication are rejected with an ERROR frame.
+func WithAuthenticator(authenticator Authenticator) StompConfigOption {
+    return func(config *stompConfig) {
+        config.authenticator = authenticator
+    }
+}
+
+// Check all SUBSCRIBE and SEND frames with the supplied authorizer.
+// Rejected frames close the connection with an "access denied" ERROR frame.
+func WithAuthorizer(authorizer Authorizer) StompConfigOption {
+    return func(config *stompConfig) {
+        config.authorizer = authorizer
+    }
+}
+
+// Treat the destinations with the supplied prefixes as queues. Each message sent to a queue
+// destination is delivered to exactly one of its subscribers in a round-robin fashion, and is
+// buffered until a client subscribes if the destination has no subscribers.
+func WithQueueDestinationPrefix(prefixes ...string) StompConfigOption {
+    return func(config *stompConfig) {
+        config.queueDestPrefix = normalizeDestinationPrefixes(prefixes)
+    }
+}
+
+// Limit the number of messages buffered by a queue destination without subscribers, the oldest
+// messages are discarded when the limit is reached. Zero uses DefaultQueueBufferSize and a
+// negative size disables the buffering.
+func WithQueueBufferSize(size int) StompConfigOption {
+    return func(config *stompConfig) {
+        if size == 0 {
+            size = DefaultQueueBufferSize
+        }
+        config.queueBufferSize = size
+    }
+}
+
+// Limit the number of open transactions of a connection, zero uses DefaultMaxTransactions
+// and a negative value removes the limit. A BEGIN frame over the limit is rejected with an
+// ERROR frame and closes the connection.
+func WithMaxTransactions(max int) StompConfigOption {
+    return func(config *stompConfig) {
+        if max == 0 {
+            max = DefaultMaxTransactions
+        }
+        config.maxTransactions = max
+    }
+}
+
+// Limit the number of SEND, ACK and NACK frames buffered by a transaction, zero uses
+// DefaultMaxTransactionFrames and a negative value removes the limit. A frame over the
+// limit is rejected with an ERROR frame and closes the connection.
+func WithMaxTransactionFrames(max int) StompConfigOption {
+    return func(config *stompConfig) {
+        if max == 0 {
+            max = DefaultMaxTransactionFrames
+        }
+        config.maxTransactionFrames = max
+    }
+}
+
+// Limit the number of unacknowledged messages tracked by a subscription with client or
+// client-individual ack mode, the oldest messages are discarded and never redelivered when
+// the limit is reached. Zero uses DefaultMaxPendingMessages and a negative value removes the limit.
+func WithMaxPendingMessages(max int) StompConfigOption {
+    return func(config *stompConfig) {
+        if max == 0 {
+            max = DefaultMaxPendingMessages
+        }
+        config.maxPendingMessages = max
+    }
 }
 
-func NewStompConfig(heartBeatMs int64, appDestinationPrefix []string) StompConfig {
-    prefixes := make([]string, len(appDestinationPrefix))
-    for i := 0; i < len(appDestinationPrefix); i++ {
-        if appDestinationPrefix[i] != "" && !strings.HasSuffix(appDestinationPrefix[i], "/") {
-            prefixes[i] =  appDestinationPrefix[i] + "/"
+// Log the server and connection events with the supplied logger instead of log.Default().
+func WithLogger(logger log.Logger) StompConfigOption {
+    return func(config *stompConfig) {
+        config.logger = logger
+    }
+}
+
+func normalizeDestinationPrefixes(destinationPrefixes []string) []string {
+    prefixes := make([]string, len(destinationPrefixes))
+    for i := 0; i < len(destinationPrefixes); i++ {
+        if destinationPrefixes[i] != "" && !strings.HasSuffix(destinationPrefixes[i], "/") {
+            prefixes[i] =  destinationPrefixes[i] + "/"
         } else {
-            prefixes[i] =  appDestinationPrefix[i]
+            prefixes[i] =  destinationPrefixes[i]
         }
     }
+    return prefixes
+}
 
-    return &stompConfig{
+func NewStompConfig(heartBeatMs int64, appDestinationPrefix []string, options ...StompConfigOption) StompConfig {
+    config := &stompConfig{
         heartbeat: heartBeatMs,
-        appDestPrefix: prefixes,
+        appDestPrefix: normalizeDestinationPrefixes(appDestinationPrefix),
+        queueBufferSize: DefaultQueueBufferSize,
+        maxTransactions: DefaultMaxTransactions,
+        maxTransactionFrames: DefaultMaxTransactionFrames,
+        maxPendingMessages: DefaultMaxPendingMessages,
+    }
+    for _, option := range options {
+        option(config)
     }
+    return config
 }
 
 func (c *stompConfig) HeartBeat() int64 {
@@ -40,8 +176,51 @@ func (c *stompConfig) AppDestinationPrefix() []string {
     return c.appDestPrefix
 }
 
+func (c *stompConfig) Authenticator() Authenticator {
+    return c.authenticator
+}
+
+func (c *stompConfig) Authorizer() Authorizer {
+    return c.authorizer
+}
+
 func (c *stompConfig) IsAppRequestDestination(destination string) bool {
-    for _, prefix := range c.appDestPrefix {
+    return hasDestinationPrefix(destination, c.appDestPrefix)
+}
+
+func (c *stompConfig) QueueDestinationPrefix() []string {
+    return c.queueDestPrefix
+}
+
+func (c *stompConfig) IsQueueDestination(destination string) bool {
+    return hasDestinationPrefix(destination, c.queueDestPrefix)
+}
+
+func (c *stompConfig) QueueBufferSize() int {
+    return c.queueBufferSize
+}
+
+func (c *stompConfig) MaxTransactions() int {
+    return c.maxTransactions
+}
+
+func (c *stompConfig) MaxTransactionFrames() int {
+    return c.maxTransactionFrames
+}
+
+func (c *stompConfig) MaxPendingMessages() int {
+    return c.maxPendingMessages
+}
+
+func (c *stompConfig) Logger() log.Logger {
+    if c.logger == nil {
+        return log.Default()
+    }
+    return c.logger
+}
+
+func hasDestinationPrefix(destination string, prefixes []string) bool {
+    for _, prefix := range prefixes {
         if prefix != "" && strings.HasPrefix(destination, prefix) {
             return true
         }
@@ -11,6 +11,11 @@ const (
     invalidSubscriptionError     = stompErrorMessage("invalid subscription")
     invalidFrameError            = stompErrorMessage("invalid frame")
     invalidHeaderError           = stompErrorMessage("invalid frame header")
+    authenticationFailedError    = stompErrorMessage("authentication failed")
+    accessDeniedError            = stompErrorMessage("access denied")
+    invalidTransactionError      = stompErrorMessage("invalid transaction")
+    tooManyTransactionsError     = stompErrorMessage("too many transactions")
+    transactionTooLargeError     = stompErrorMessage("transaction too large")
 )
 
 type stompErrorMessage string
@@ -4,6 +4,7 @@
 package stompserver
 
 import (
+    "crypto/tls"
     "github.com/go-stomp/stomp/frame"
     "time"
 )
@@ -19,6 +20,12 @@ type RawConnection interface {
     Close() error
 }
 
+// Implemented by raw connections which can be established over TLS.
+type TLSRawConnection interface {
+    // Returns the TLS state of the connection or nil if the connection is not encrypted.
+    TLSConnectionState() *tls.ConnectionState
+}
+
 type RawConnectionListener interface {
     // Blocks until a new RawConnection is established.
     Accept() (RawConnection, error)
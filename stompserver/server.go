@@ -4,8 +4,9 @@
 package stompserver
 
 import (
+    "crypto/tls"
     "github.com/go-stomp/stomp/frame"
-    "log"
+    "github.com/vmware/transport-go/model"
     "strconv"
     "sync"
 )
@@ -16,6 +17,12 @@ type UnsubscribeHandlerFunction func(conId string, subId string, destination str
 
 type ApplicationRequestHandlerFunction func(destination string, message []byte, connectionId string)
 
+// Same as ApplicationRequestHandlerFunction but receives the whole SEND frame, including its headers.
+type ApplicationRequestFrameHandlerFunction func(destination string, f *frame.Frame, connectionId string)
+
+// Called when a client connection is established (connected is true) and when an established connection is closed.
+type ConnectionEventHandlerFunction func(conId string, connected bool)
+
 type StompServer interface {
     // starts the server
     Start()
@@ -25,12 +32,27 @@ type StompServer interface {
     SendMessage(destination string, messageBody []byte)
     // sends a message to a single connection client
     SendMessageToClient(connectionId string, destination string, messageBody []byte)
+    // sends a message with additional frame headers to a given stomp topic destination
+    SendMessageWithHeaders(destination string, messageBody []byte, headers map[string]string)
+    // sends a message with additional frame headers to a single connection client
+    SendMessageToClientWithHeaders(
+            connectionId string, destination string, messageBody []byte, headers map[string]string)
     // registers a callback for stomp subscribe events
     OnSubscribeEvent(callback SubscribeHandlerFunction)
     // registers a callback for stomp unsubscribe events
     OnUnsubscribeEvent(callback UnsubscribeHandlerFunction)
     // registers a callback for application requests
     OnApplicationRequest(callback ApplicationRequestHandlerFunction)
+    // registers a callback for application requests which need access to the request frame headers
+    OnApplicationRequestFrame(callback ApplicationRequestFrameHandlerFunction)
+    // registers a callback for established and closed client connections
+    OnConnectionEvent(callback ConnectionEventHandlerFunction)
+    // returns the TLS state of an established client connection, including the verified
+    // client certificates. Returns false for plaintext connections.
+    GetConnectionTLSState(connectionId string) (*tls.ConnectionState, bool)
+    // returns the principal of an established client connection. Returns false if the
+    // connection is unknown or the server has no authenticator configured.
+    GetConnectionPrincipal(connectionId string) (*Principal, bool)
 }
 
 type eventType int
@@ -41,6 +63,8 @@ const (
     subscribeToTopic
     unsubscribeFromTopic
     incomingMessage
+    redeliverMessages
+    commitTransaction
 )
 
 type connEvent struct {
@@ -49,6 +73,11 @@ type connEvent struct {
     destination string
     sub *subscription
     frame *frame.Frame
+    // unacknowledged messages for redeliverMessages events or
+    // the messages sent in a transaction for commitTransaction events
+    frames []*frame.Frame
+    // allow redelivery to the originating subscription if there is no other subscriber (NACK)
+    requeue bool
 }
 
 type apiEventType int
@@ -89,19 +118,77 @@ type stompServer struct {
     subscribeCallbacks []SubscribeHandlerFunction
     unsubscribeCallbacks []UnsubscribeHandlerFunction
     applicationRequestCallbacks []ApplicationRequestHandlerFunction
+    applicationRequestFrameCallbacks []ApplicationRequestFrameHandlerFunction
+    connectionCallbacks []ConnectionEventHandlerFunction
+    connInfoLock sync.RWMutex
+    connInfos map[string]*connInfo
+    // state of the queue destinations, keyed by destination
+    queues map[string]*destinationQueue
+}
+
+// messages buffered by a queue destination without subscribers, its subscribers
+// in subscription order and the round-robin position of the next subscriber.
+type destinationQueue struct {
+    buffered    []*frame.Frame
+    subscribers []*queueSubscriber
+    next        int
+}
+
+type queueSubscriber struct {
+    conn StompConn
+    sub  *subscription
+}
+
+func (q *destinationQueue) addSubscriber(conn StompConn, sub *subscription) {
+    for _, qs := range q.subscribers {
+        if qs.conn.GetId() == conn.GetId() && qs.sub.id == sub.id {
+            qs.sub = sub
+            return
+        }
+    }
+    q.subscribers = append(q.subscribers, &queueSubscriber{conn: conn, sub: sub})
+}
+
+func (q *destinationQueue) removeSubscriber(conId string, subId string) {
+    for i, qs := range q.subscribers {
+        if qs.conn.GetId() == conId && qs.sub.id == subId {
+            q.subscribers = append(q.subscribers[:i], q.subscribers[i+1:]...)
+            if i < q.next {
+                q.next--
+            }
+            if q.next >= len(q.subscribers) {
+                q.next = 0
+            }
+            return
+        }
+    }
+}
+
+func (q *destinationQueue) isEmpty() bool {
+    return len(q.subscribers) == 0 && len(q.buffered) == 0
+}
+
+// security details of an established connection.
+type connInfo struct {
+    tlsState  *tls.ConnectionState
+    principal *Principal
 }
 
 func NewStompServer(listener RawConnectionListener, config StompConfig) StompServer {
     server := &stompServer{
-        config:                      config,
-        connectionListener:          listener,
-        apiEvents:                   make(chan *apiEvent, 32),
-        connectionsMap:              make(map[string]StompConn),
-        connectionEvents:            make(chan *connEvent, 64),
-        subscriptionsMap:            make(map[string]map[string]*connSubscriptions),
-        subscribeCallbacks:          make([]SubscribeHandlerFunction, 0),
-        unsubscribeCallbacks:        make([]UnsubscribeHandlerFunction, 0),
-        applicationRequestCallbacks: make([]ApplicationRequestHandlerFunction, 0),
+        config:                           config,
+        connectionListener:               listener,
+        apiEvents:                        make(chan *apiEvent, 32),
+        connectionsMap:                   make(map[string]StompConn),
+        connectionEvents:                 make(chan *connEvent, 64),
+        subscriptionsMap:                 make(map[string]map[string]*connSubscriptions),
+        subscribeCallbacks:               make([]SubscribeHandlerFunction, 0),
+        unsubscribeCallbacks:             make([]UnsubscribeHandlerFunction, 0),
+        applicationRequestCallbacks:      make([]ApplicationRequestHandlerFunction, 0),
+        applicationRequestFrameCallbacks: make([]ApplicationRequestFrameHandlerFunction, 0),
+        connectionCallbacks:              make([]ConnectionEventHandlerFunction, 0),
+        connInfos:                        make(map[string]*connInfo),
+        queues:                           make(map[string]*destinationQueue),
     }
 
     return server
@@ -128,41 +215,103 @@ func (s *stompServer) OnApplicationRequest(callback ApplicationRequestHandlerFun
     s.applicationRequestCallbacks = append(s.applicationRequestCallbacks, callback)
 }
 
-func (s *stompServer) SendMessage(destination string, messageBody []byte) {
+func (s *stompServer) OnApplicationRequestFrame(callback ApplicationRequestFrameHandlerFunction) {
+    s.callbackLock.Lock()
+    defer s.callbackLock.Unlock()
 
-    // create send frame.
-    f := frame.New(frame.MESSAGE,
-        frame.Destination, destination,
-        frame.ContentLength, strconv.Itoa(len(messageBody)),
-        frame.ContentType, "application/json;charset=UTF-8")
+    s.applicationRequestFrameCallbacks = append(s.applicationRequestFrameCallbacks, callback)
+}
 
-    f.Body = messageBody
+func (s *stompServer) OnConnectionEvent(callback ConnectionEventHandlerFunction) {
+    s.callbackLock.Lock()
+    defer s.callbackLock.Unlock()
+
+    s.connectionCallbacks = append(s.connectionCallbacks, callback)
+}
+
+func (s *stompServer) GetConnectionTLSState(connectionId string) (*tls.ConnectionState, bool) {
+    s.connInfoLock.RLock()
+    defer s.connInfoLock.RUnlock()
 
+    info, ok := s.connInfos[connectionId]
+    if !ok || info.tlsState == nil {
+        return nil, false
+    }
+    return info.tlsState, true
+}
+
+func (s *stompServer) GetConnectionPrincipal(connectionId string) (*Principal, bool) {
+    s.connInfoLock.RLock()
+    defer s.connInfoLock.RUnlock()
+
+    info, ok := s.connInfos[connectionId]
+    if !ok || info.principal == nil {
+        return nil, false
+    }
+    return info.principal, true
+}
+
+func (s *stompServer) SendMessage(destination string, messageBody []byte) {
+    s.SendMessageWithHeaders(destination, messageBody, nil)
+}
+
+func (s *stompServer) SendMessageWithHeaders(destination string, messageBody []byte, headers map[string]string) {
     s.apiEvents <- &apiEvent{
         eventType: sendMessage,
         destination: destination,
-        frame: f,
+        frame: newMessageFrame(destination, messageBody, headers),
     }
 }
 
 func (s *stompServer) SendMessageToClient(connectionId string, destination string, messageBody []byte) {
+    s.SendMessageToClientWithHeaders(connectionId, destination, messageBody, nil)
+}
 
-    // create send frame.
-    f := frame.New(frame.MESSAGE,
-        frame.Destination, destination,
-        frame.ContentLength, strconv.Itoa(len(messageBody)),
-        frame.ContentType, "application/json;charset=UTF-8")
-
-    f.Body = messageBody
+func (s *stompServer) SendMessageToClientWithHeaders(
+        connectionId string, destination string, messageBody []byte, headers map[string]string) {
 
     s.apiEvents <- &apiEvent{
         eventType: sendPrivateMessage,
         destination: destination,
-        frame: f,
+        frame: newMessageFrame(destination, messageBody, headers),
         connId: connectionId,
     }
 }
 
+// header added to messages which are delivered again because the original
+// recipient didn't acknowledge them.
+const redeliveredHeader = "redelivered"
+
+// headers which are managed by the server and cannot be overridden when sending messages.
+var reservedMessageHeaders = map[string]bool{
+    frame.Destination: true,
+    frame.ContentLength: true,
+    frame.Subscription: true,
+    frame.MessageId: true,
+    frame.Ack: true,
+}
+
+// content type of the messages sent without content-type header, the body is expected
+// to be encoded with the default codec.
+var defaultMessageContentType = model.JSONCodec.ContentType() + ";charset=UTF-8"
+
+func newMessageFrame(destination string, messageBody []byte, headers map[string]string) *frame.Frame {
+    // create send frame.
+    f := frame.New(frame.MESSAGE,
+        frame.Destination, destination,
+        frame.ContentLength, strconv.Itoa(len(messageBody)),
+        frame.ContentType, defaultMessageContentType)
+
+    for k, v := range headers {
+        if !reservedMessageHeaders[k] {
+            f.Header.Set(k, v)
+        }
+    }
+
+    f.Body = messageBody
+    return f
+}
+
 func (s *stompServer) Start() {
     if s.running {
         return
@@ -186,7 +335,7 @@ func (s *stompServer) waitForConnections() {
     for {
          rawConn, err :=  s.connectionListener.Accept()
          if err != nil {
-             log.Println("Failed to establish client connection:", err)
+             s.config.Logger().Warn("failed to establish client connection", "error", err)
          } else {
              c := NewStompConn(rawConn, s.config, s.connectionEvents)
 
@@ -232,13 +381,35 @@ func (s *stompServer) handleConnectionEvent(e *connEvent) {
     case connectionStarting:
         s.connectionsMap[e.conn.GetId()] = e.conn
 
+    case connectionEstablished:
+        // the TLS handshake and the authentication are complete once the CONNECT frame was handled.
+        s.connInfoLock.Lock()
+        s.connInfos[e.conn.GetId()] = &connInfo{
+            tlsState:  e.conn.GetTLSConnectionState(),
+            principal: e.conn.GetPrincipal(),
+        }
+        s.connInfoLock.Unlock()
+        for _, callback := range s.connectionCallbacks {
+            callback(e.conn.GetId(), true)
+        }
+
     case connectionClosed:
         delete(s.connectionsMap, e.conn.GetId())
+        s.connInfoLock.Lock()
+        _, established := s.connInfos[e.conn.GetId()]
+        delete(s.connInfos, e.conn.GetId())
+        s.connInfoLock.Unlock()
+        if established {
+            for _, callback := range s.connectionCallbacks {
+                callback(e.conn.GetId(), false)
+            }
+        }
         for _, connSubscriptions := range s.subscriptionsMap {
             conSub, ok := connSubscriptions[e.conn.GetId()]
             if ok {
                 delete(connSubscriptions, e.conn.GetId())
                 for _, sub := range conSub.subscriptions {
+                    s.removeQueueSubscriber(sub.destination, e.conn.GetId(), sub.id)
                     for _, callback := range s.unsubscribeCallbacks {
                         callback(e.conn.GetId(), sub.id, sub.destination)
                     }
@@ -265,6 +436,22 @@ func (s *stompServer) handleConnectionEvent(e *connEvent) {
             callback(e.conn.GetId(), e.sub.id, e.destination, e.frame)
         }
 
+        if s.config.IsQueueDestination(e.destination) {
+            queue, ok := s.queues[e.destination]
+            if !ok {
+                queue = &destinationQueue{}
+                s.queues[e.destination] = queue
+            }
+            queue.addSubscriber(e.conn, e.sub)
+
+            // deliver the messages buffered by the queue destination while it had no subscribers
+            buffered := queue.buffered
+            queue.buffered = nil
+            for _, f := range buffered {
+                s.sendQueueFrame(e.destination, f)
+            }
+        }
+
     case unsubscribeFromTopic:
         subs, ok := s.subscriptionsMap[e.destination]
         if ok {
@@ -274,6 +461,7 @@ func (s *stompServer) handleConnectionEvent(e *connEvent) {
                 _, ok = conSub.subscriptions[e.sub.id]
                 if ok {
                     delete(conSub.subscriptions, e.sub.id)
+                    s.removeQueueSubscriber(e.destination, e.conn.GetId(), e.sub.id)
                     // notify listeners
                     for _, callback := range s.unsubscribeCallbacks {
                         callback(e.conn.GetId(), e.sub.id, e.destination)
@@ -282,19 +470,86 @@ func (s *stompServer) handleConnectionEvent(e *connEvent) {
             }
         }
 
+    case redeliverMessages:
+        s.redeliverFrames(e)
+
     case incomingMessage:
-        s.sendFrame(e.destination, e.frame)
+        s.handleIncomingMessage(e.conn, e.destination, e.frame)
+
+    case commitTransaction:
+        // dispatch all messages of the transaction within a single event
+        // so they are not interleaved with other incoming messages.
+        for _, f := range e.frames {
+            s.handleIncomingMessage(e.conn, f.Header.Get(frame.Destination), f)
+        }
+    }
+}
+
+func (s *stompServer) handleIncomingMessage(conn StompConn, destination string, f *frame.Frame) {
+    s.sendFrame(destination, f)
+
+    if s.config.IsAppRequestDestination(destination) && conn != nil {
+        // notify app listeners
+        for _, callback := range s.applicationRequestCallbacks {
+            callback(destination, f.Body, conn.GetId())
+        }
+        for _, callback := range s.applicationRequestFrameCallbacks {
+            callback(destination, f, conn.GetId())
+        }
+    }
+}
 
-        if s.config.IsAppRequestDestination(e.destination) && e.conn != nil {
-            // notify app listeners
-            for _, callback := range s.applicationRequestCallbacks {
-                callback(e.destination, e.frame.Body, e.conn.GetId())
+// redelivers unacknowledged messages. Messages of queue destinations are redelivered to a single
+// other subscriber of the queue, preferring subscribers with client acknowledgements, and are buffered
+// by the queue if there is no other subscriber. The subscribers of other destinations received their
+// own copy of the messages, so the messages are only redelivered to the originating subscription (NACK).
+func (s *stompServer) redeliverFrames(e *connEvent) {
+    var targetConn StompConn
+    var targetSub *subscription
+    queue, isQueue := s.queues[e.destination]
+    if isQueue {
+        for _, qs := range queue.subscribers {
+            if qs.conn.GetId() == e.conn.GetId() {
+                continue
             }
+            if targetSub == nil || (qs.sub.requiresAck() && !targetSub.requiresAck()) {
+                targetConn, targetSub = qs.conn, qs.sub
+            }
+        }
+    }
+
+    if targetSub == nil && e.requeue {
+        if connSub, ok := s.subscriptionsMap[e.destination][e.conn.GetId()]; ok && connSub.subscriptions[e.sub.id] == e.sub {
+            targetConn, targetSub = connSub.conn, e.sub
+        }
+    }
+
+    if targetSub == nil && !s.config.IsQueueDestination(e.destination) {
+        s.config.Logger().Debug("discarding unacknowledged messages without subscription",
+            "destination", e.destination, "messages", len(e.frames))
+        return
+    }
+
+    for _, f := range e.frames {
+        redelivered := f.Clone()
+        redelivered.Header.Del(frame.Subscription)
+        redelivered.Header.Del(frame.MessageId)
+        redelivered.Header.Del(frame.Ack)
+        redelivered.Header.Set(redeliveredHeader, "true")
+        if targetSub != nil {
+            targetConn.SendFrameToSubscription(redelivered, targetSub)
+        } else {
+            s.bufferQueueFrame(e.destination, redelivered)
         }
     }
 }
 
 func (s *stompServer) sendFrame(dest string, f *frame.Frame) {
+    if s.config.IsQueueDestination(dest) {
+        s.sendQueueFrame(dest, f)
+        return
+    }
+
     subsMap, ok := s.subscriptionsMap[dest]
     if ok {
         for _, connSub := range subsMap {
@@ -305,6 +560,52 @@ func (s *stompServer) sendFrame(dest string, f *frame.Frame) {
     }
 }
 
+// delivers the message to a single subscriber of the queue destination, the subscribers take turns
+// in a round-robin fashion. The message is buffered if the destination has no subscribers.
+func (s *stompServer) sendQueueFrame(dest string, f *frame.Frame) {
+    queue, ok := s.queues[dest]
+    if !ok || len(queue.subscribers) == 0 {
+        s.bufferQueueFrame(dest, f.Clone())
+        return
+    }
+
+    target := queue.subscribers[queue.next]
+    queue.next = (queue.next + 1) % len(queue.subscribers)
+    target.conn.SendFrameToSubscription(f.Clone(), target.sub)
+}
+
+// buffers the message until a client subscribes to the queue destination, the oldest
+// messages are discarded once the queue buffer size is reached.
+func (s *stompServer) bufferQueueFrame(dest string, f *frame.Frame) {
+    bufferSize := s.config.QueueBufferSize()
+    if bufferSize <= 0 {
+        return
+    }
+    queue, ok := s.queues[dest]
+    if !ok {
+        queue = &destinationQueue{}
+        s.queues[dest] = queue
+    }
+    if len(queue.buffered) >= bufferSize {
+        s.config.Logger().Warn("queue buffer is full, discarding the oldest message", "destination", dest)
+        queue.buffered = queue.buffered[len(queue.buffered) - bufferSize + 1:]
+    }
+    queue.buffered = append(queue.buffered, f)
+}
+
+// removes the subscription from the queue destination, the state of the destination
+// is dropped once it has neither subscribers nor buffered messages.
+func (s *stompServer) removeQueueSubscriber(dest string, conId string, subId string) {
+    queue, ok := s.queues[dest]
+    if !ok {
+        return
+    }
+    queue.removeSubscriber(conId, subId)
+    if queue.isEmpty() {
+        delete(s.queues, dest)
+    }
+}
+
 func (s *stompServer) sendFrameToClient(conId string, dest string, f *frame.Frame) {
     subsMap, ok := s.subscriptionsMap[dest]
     if ok {
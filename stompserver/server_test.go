@@ -132,6 +132,88 @@ func TestStompServer_OnApplicationRequest(t *testing.T) {
     wg.Wait()
 }
 
+func TestStompServer_OnApplicationRequestFrame(t *testing.T) {
+    server, _ := newTestStompServer(NewStompConfig(0, []string{"/pub"}))
+    go server.Start()
+
+    wg := sync.WaitGroup{}
+    wg.Add(2)
+    server.OnApplicationRequest(func(destination string, message []byte, connectionId string) {
+        assert.Equal(t, string(message), "request1-payload")
+        wg.Done()
+    })
+    server.OnApplicationRequestFrame(func(destination string, f *frame.Frame, connectionId string) {
+        assert.Equal(t, destination, "/pub/testRequest1")
+        assert.Equal(t, string(f.Body), "request1-payload")
+        assert.Equal(t, f.Header.Get("correlation-id"), "corr-1")
+        assert.Equal(t, connectionId, "con1")
+        wg.Done()
+    })
+
+    f1 := frame.New(frame.MESSAGE, frame.Destination, "/pub/testRequest1", "correlation-id", "corr-1")
+    f1.Body = []byte("request1-payload")
+
+    server.connectionEvents <- &connEvent{
+        eventType: incomingMessage,
+        conn: &stompConn{
+            id: "con1",
+        },
+        destination: "/pub/testRequest1",
+        frame: f1,
+    }
+
+    wg.Wait()
+}
+
+func TestStompServer_CommitTransaction(t *testing.T) {
+    server, _ := newTestStompServer(NewStompConfig(0, []string{"/pub"}))
+    go server.Start()
+
+    var requests []string
+    wg := sync.WaitGroup{}
+    wg.Add(2)
+    server.OnApplicationRequest(func(destination string, message []byte, connectionId string) {
+        assert.Equal(t, connectionId, "con1")
+        requests = append(requests, destination + ":" + string(message))
+        wg.Done()
+    })
+
+    f1 := frame.New(frame.MESSAGE, frame.Destination, "/pub/request1")
+    f1.Body = []byte("payload1")
+    f2 := frame.New(frame.MESSAGE, frame.Destination, "/pub/request2")
+    f2.Body = []byte("payload2")
+
+    server.connectionEvents <- &connEvent{
+        eventType: commitTransaction,
+        conn: &stompConn{
+            id: "con1",
+        },
+        frames: []*frame.Frame{f1, f2},
+    }
+
+    wg.Wait()
+    assert.Equal(t, []string{"/pub/request1:payload1", "/pub/request2:payload2"}, requests)
+}
+
+func TestStompServer_NewMessageFrameHeaders(t *testing.T) {
+    f := newMessageFrame("/topic/test", []byte("test-message"), map[string]string{
+        "correlation-id": "corr-1",
+        frame.ContentType: "text/plain",
+        frame.Destination: "/topic/other",
+        frame.ContentLength: "1",
+        frame.MessageId: "10",
+    })
+
+    assert.Equal(t, f.Command, frame.MESSAGE)
+    assert.Equal(t, f.Header.Get(frame.Destination), "/topic/test")
+    assert.Equal(t, f.Header.Get(frame.ContentLength), "12")
+    assert.Equal(t, f.Header.Get(frame.ContentType), "text/plain")
+    assert.Equal(t, f.Header.Get("correlation-id"), "corr-1")
+    _, ok := f.Header.Contains(frame.MessageId)
+    assert.False(t, ok)
+    assert.Equal(t, string(f.Body), "test-message")
+}
+
 func TestStompServer_SendMessage(t *testing.T) {
     server, listener := newTestStompServer(NewStompConfig(0, []string{"/pub/"}))
     go server.Start()
@@ -392,3 +474,243 @@ func subscribeMockConToTopic(conn *MockRawConnection, topics ...string) {
             frame.Id, topic + "-" + strconv.Itoa(index))
     }
 }
+
+func TestStompServer_GetConnectionPrincipal(t *testing.T) {
+    server, conListener := newTestStompServer(NewStompConfig(0, []string{"/pub"}, WithAuthenticator(
+        AuthenticatorFunc(func(c *ConnectCredentials) (*Principal, error) {
+            return &Principal{Name: c.Login}, nil
+        }))))
+    go server.Start()
+
+    conIdChan := make(chan string)
+    server.OnSubscribeEvent(func(conId string, subId string, destination string, frame *frame.Frame) {
+        conIdChan <- conId
+    })
+
+    mockRawConn := NewMockRawConnection()
+    conListener.incomingConnections <- mockRawConn
+    mockRawConn.incomingFrames <- frame.New(frame.CONNECT, frame.AcceptVersion, "1.2", frame.Login, "user1")
+    mockRawConn.incomingFrames <- frame.New(frame.SUBSCRIBE,
+        frame.Destination, "/topic/destination",
+        frame.Id, "sub-id-1")
+
+    conId := <- conIdChan
+    principal, ok := server.GetConnectionPrincipal(conId)
+    assert.True(t, ok)
+    assert.Equal(t, "user1", principal.Name)
+
+    _, ok = server.GetConnectionTLSState(conId)
+    assert.False(t, ok)
+
+    _, ok = server.GetConnectionPrincipal("unknown-connection")
+    assert.False(t, ok)
+}
+
+func TestStompServer_RedeliverUnacknowledgedMessages(t *testing.T) {
+    server, listener := newTestStompServer(NewStompConfig(0, []string{"/pub/"}, WithQueueDestinationPrefix("/queue")))
+    go server.Start()
+
+    subscribed := make(chan string, 10)
+    server.OnSubscribeEvent(func(conId string, subId string, destination string, f *frame.Frame) {
+        subscribed <- conId
+    })
+
+    worker1 := NewMockRawConnection()
+    listener.incomingConnections <- worker1
+    worker1.SendConnectFrame()
+    worker1.incomingFrames <- frame.New(frame.SUBSCRIBE,
+        frame.Destination, "/queue/work", frame.Id, "w1", frame.Ack, frame.AckClientIndividual)
+    <- subscribed
+
+    wg := sync.WaitGroup{}
+    worker1.writeWg = &wg
+    wg.Add(2)
+    server.SendMessage("/queue/work", []byte("item-1"))
+    server.SendMessage("/queue/work", []byte("item-2"))
+    wg.Wait()
+    worker1.writeWg = nil
+
+    // the second worker joins after the items were published.
+    worker2 := NewMockRawConnection()
+    listener.incomingConnections <- worker2
+    worker2.SendConnectFrame()
+    worker2.incomingFrames <- frame.New(frame.SUBSCRIBE,
+        frame.Destination, "/queue/work", frame.Id, "w2", frame.Ack, frame.AckClient)
+    <- subscribed
+
+    // worker1 completes item-1 and disconnects before completing item-2.
+    worker2.writeWg = &wg
+    wg.Add(1)
+    worker1.incomingFrames <- frame.New(frame.ACK, frame.Id, worker1.sentFrames[1].Header.Get(frame.Ack))
+    worker1.incomingFrames <- errors.New("connection lost")
+    wg.Wait()
+    worker2.writeWg = nil
+
+    f := worker2.LastSentFrame()
+    assert.Equal(t, "item-2", string(f.Body))
+    assert.Equal(t, "true", f.Header.Get(redeliveredHeader))
+    assert.Equal(t, "w2", f.Header.Get(frame.Subscription))
+    assert.Equal(t, f.Header.Get(frame.MessageId), f.Header.Get(frame.Ack))
+
+    // NACK without other subscribers requeues the message to the same subscription.
+    wg.Add(1)
+    worker2.writeWg = &wg
+    worker2.incomingFrames <- frame.New(frame.NACK, frame.Id, f.Header.Get(frame.Ack))
+    wg.Wait()
+    worker2.writeWg = nil
+    assert.Equal(t, "item-2", string(worker2.LastSentFrame().Body))
+    assert.NotEqual(t, f.Header.Get(frame.MessageId), worker2.LastSentFrame().Header.Get(frame.MessageId))
+
+    // without subscribers the messages wait for the next subscription.
+    worker2.incomingFrames <- errors.New("connection lost")
+
+    worker3 := NewMockRawConnection()
+    listener.incomingConnections <- worker3
+    worker3.writeWg = &wg
+    wg.Add(2)
+    worker3.SendConnectFrame()
+    worker3.incomingFrames <- frame.New(frame.SUBSCRIBE,
+        frame.Destination, "/queue/work", frame.Id, "w3")
+    <- subscribed
+    wg.Wait()
+
+    assert.Equal(t, "item-2", string(worker3.LastSentFrame().Body))
+    assert.Equal(t, "w3", worker3.LastSentFrame().Header.Get(frame.Subscription))
+}
+
+func TestStompServer_RedeliverTopicMessages(t *testing.T) {
+    server, listener := newTestStompServer(NewStompConfig(0, []string{"/pub/"}))
+    go server.Start()
+
+    subscribed := make(chan string, 10)
+    server.OnSubscribeEvent(func(conId string, subId string, destination string, f *frame.Frame) {
+        subscribed <- conId
+    })
+
+    wg := sync.WaitGroup{}
+    client1 := NewMockRawConnection()
+    listener.incomingConnections <- client1
+    client1.SendConnectFrame()
+    client1.incomingFrames <- frame.New(frame.SUBSCRIBE,
+        frame.Destination, "/topic/news", frame.Id, "c1", frame.Ack, frame.AckClientIndividual)
+    <- subscribed
+
+    client2 := NewMockRawConnection()
+    listener.incomingConnections <- client2
+    client2.writeWg = &wg
+    wg.Add(1)
+    client2.SendConnectFrame()
+    client2.incomingFrames <- frame.New(frame.SUBSCRIBE, frame.Destination, "/topic/news", frame.Id, "c2")
+    <- subscribed
+    wg.Wait()
+
+    client1.writeWg = &wg
+    wg.Add(2)
+    server.SendMessage("/topic/news", []byte("news-1"))
+    wg.Wait()
+
+    // NACK redelivers the message to the same subscription only.
+    wg.Add(1)
+    client1.incomingFrames <- frame.New(frame.NACK, frame.Id, client1.LastSentFrame().Header.Get(frame.Ack))
+    wg.Wait()
+    assert.Equal(t, "news-1", string(client1.LastSentFrame().Body))
+    assert.Equal(t, "true", client1.LastSentFrame().Header.Get(redeliveredHeader))
+
+    // the unacknowledged messages of a closed connection are not sent to the other subscribers.
+    unsubscribed := make(chan string, 10)
+    server.OnUnsubscribeEvent(func(conId string, subId string, destination string) {
+        unsubscribed <- subId
+    })
+    client1.incomingFrames <- errors.New("connection lost")
+    <- unsubscribed
+
+    wg.Add(1)
+    server.SendMessage("/topic/news", []byte("news-2"))
+    wg.Wait()
+    assert.Equal(t, 3, len(client2.sentFrames))
+    assert.Equal(t, "news-1", string(client2.sentFrames[1].Body))
+    assert.Equal(t, "news-2", string(client2.sentFrames[2].Body))
+}
+
+func TestStompServer_QueueDestination(t *testing.T) {
+    server, listener := newTestStompServer(NewStompConfig(0, []string{"/pub/"},
+        WithQueueDestinationPrefix("/queue"), WithQueueBufferSize(2)))
+    go server.Start()
+
+    subscribed := make(chan string, 10)
+    server.OnSubscribeEvent(func(conId string, subId string, destination string, f *frame.Frame) {
+        subscribed <- conId
+    })
+
+    // without subscribers only the last two messages are buffered.
+    server.SendMessage("/queue/work", []byte("item-1"))
+    server.SendMessage("/queue/work", []byte("item-2"))
+    server.SendMessage("/queue/work", []byte("item-3"))
+
+    wg := sync.WaitGroup{}
+    worker1 := NewMockRawConnection()
+    listener.incomingConnections <- worker1
+    worker1.writeWg = &wg
+    wg.Add(3)
+    worker1.SendConnectFrame()
+    worker1.incomingFrames <- frame.New(frame.SUBSCRIBE, frame.Destination, "/queue/work", frame.Id, "w1")
+    <- subscribed
+    wg.Wait()
+
+    assert.Equal(t, "item-2", string(worker1.sentFrames[1].Body))
+    assert.Equal(t, "item-3", string(worker1.sentFrames[2].Body))
+
+    worker2 := NewMockRawConnection()
+    listener.incomingConnections <- worker2
+    worker2.writeWg = &wg
+    wg.Add(1)
+    worker2.SendConnectFrame()
+    worker2.incomingFrames <- frame.New(frame.SUBSCRIBE, frame.Destination, "/queue/work", frame.Id, "w2")
+    <- subscribed
+    wg.Wait()
+
+    // each message is delivered to exactly one of the subscribers.
+    wg.Add(4)
+    for i := 4; i <= 7; i++ {
+        server.SendMessage("/queue/work", []byte("item-" + strconv.Itoa(i)))
+    }
+    wg.Wait()
+
+    assert.Equal(t, 5, len(worker1.sentFrames))
+    assert.Equal(t, 3, len(worker2.sentFrames))
+    received := map[string]bool{}
+    for _, f := range append(worker1.sentFrames[3:], worker2.sentFrames[1:]...) {
+        assert.False(t, received[string(f.Body)])
+        received[string(f.Body)] = true
+    }
+    assert.Equal(t, 4, len(received))
+
+    unsubscribed := make(chan string, 10)
+    server.OnUnsubscribeEvent(func(conId string, subId string, destination string) {
+        unsubscribed <- subId
+    })
+
+    // the remaining subscriber receives all messages
+    worker1.incomingFrames <- frame.New(frame.UNSUBSCRIBE, frame.Id, "w1")
+    assert.Equal(t, "w1", <-unsubscribed)
+    wg.Add(2)
+    server.SendMessage("/queue/work", []byte("item-8"))
+    server.SendMessage("/queue/work", []byte("item-9"))
+    wg.Wait()
+    assert.Equal(t, 5, len(worker2.sentFrames))
+
+    // the queue state is dropped with the last subscriber
+    worker2.incomingFrames <- frame.New(frame.DISCONNECT)
+    assert.Equal(t, "w2", <-unsubscribed)
+    assert.Equal(t, 0, len(server.queues))
+}
+
+func TestStompServer_QueueDestinationWithoutBuffer(t *testing.T) {
+    server, _ := newTestStompServer(NewStompConfig(0, []string{"/pub/"},
+        WithQueueDestinationPrefix("/queue"), WithQueueBufferSize(-1)))
+
+    server.sendFrame("/queue/work", frame.New(frame.MESSAGE))
+    assert.Equal(t, 0, len(server.queues))
+    assert.Equal(t, DefaultQueueBufferSize,
+        NewStompConfig(0, []string{}, WithQueueBufferSize(0)).QueueBufferSize())
+}
@@ -4,11 +4,12 @@
 package stompserver
 
 import (
+    "crypto/tls"
     "fmt"
     "github.com/go-stomp/stomp"
     "github.com/go-stomp/stomp/frame"
     "github.com/google/uuid"
-    "log"
+    "github.com/vmware/transport-go/log"
     "strconv"
     "strings"
     "sync"
@@ -19,12 +20,44 @@ import (
 type subscription struct {
     id string
     destination string
+    // ack mode requested by the client: auto, client or client-individual
+    ack string
+    // messages sent to the client which are not acknowledged yet, in the order they were sent
+    pending []*frame.Frame
+}
+
+func (sub *subscription) requiresAck() bool {
+    return sub.ack == frame.AckClient || sub.ack == frame.AckClientIndividual
+}
+
+// removes and returns the pending messages acknowledged with ackId. In client mode the
+// acknowledgement is cumulative and also covers all previously sent messages.
+func (sub *subscription) takePending(ackId string) []*frame.Frame {
+    for i, f := range sub.pending {
+        if f.Header.Get(frame.Ack) != ackId {
+            continue
+        }
+        var taken []*frame.Frame
+        if sub.ack == frame.AckClient {
+            taken = append(taken, sub.pending[:i + 1]...)
+            sub.pending = append([]*frame.Frame{}, sub.pending[i + 1:]...)
+        } else {
+            taken = []*frame.Frame{f}
+            sub.pending = append(sub.pending[:i:i], sub.pending[i + 1:]...)
+        }
+        return taken
+    }
+    return nil
 }
 
 type StompConn interface {
     // Return unique connection Id string
     GetId() string
     SendFrameToSubscription(f *frame.Frame, sub *subscription)
+    // Return the TLS state of the connection, nil for plaintext connections
+    GetTLSConnectionState() *tls.ConnectionState
+    // Return the principal of an authenticated connection, nil if no authenticator is configured
+    GetPrincipal() *Principal
     Close()
 }
 
@@ -52,6 +85,10 @@ type stompConn struct {
     subscriptions    map[string]*subscription
     currentMessageId uint64
     closeOnce        sync.Once
+    principal        *Principal
+    // frames buffered by the active transactions, dispatched on COMMIT
+    transactions     map[string][]*frame.Frame
+    logger           log.Logger
 }
 
 func NewStompConn(rawConnection RawConnection, config StompConfig, events chan *connEvent) StompConn {
@@ -64,7 +101,9 @@ func NewStompConn(rawConnection RawConnection, config StompConfig, events chan *
         id:            uuid.New().String(),
         events:        events,
         subscriptions: make(map[string]*subscription),
+        transactions:  make(map[string][]*frame.Frame),
     }
+    conn.logger = config.Logger().With("connection.id", conn.id)
 
     go conn.run()
     go conn.readInFrames()
@@ -93,8 +132,26 @@ func (conn *stompConn) GetId() string {
     return conn.id
 }
 
+func (conn *stompConn) GetTLSConnectionState() *tls.ConnectionState {
+    tlsConn, ok := conn.rawConnection.(TLSRawConnection)
+    if !ok {
+        return nil
+    }
+    return tlsConn.TLSConnectionState()
+}
+
+func (conn *stompConn) GetPrincipal() *Principal {
+    return conn.principal
+}
+
 func (conn *stompConn) run() {
-    defer conn.Close()
+    defer func() {
+        // redeliver the messages the client didn't acknowledge to other subscribers
+        for _, sub := range conn.subscriptions {
+            conn.releasePendingMessages(sub)
+        }
+        conn.Close()
+    }()
 
     var timerChannel <-chan time.Time
     var timer *time.Timer
@@ -124,6 +181,7 @@ func (conn *stompConn) run() {
             }
 
             conn.populateMessageIdHeader(f)
+            conn.trackPendingMessage(f)
 
             // write the frame to the client
             err := conn.rawConnection.WriteFrame(f)
@@ -137,7 +195,7 @@ func (conn *stompConn) run() {
             }
 
             if err := conn.handleIncomingFrame(f); err != nil {
-                conn.sendError(err)
+                conn.sendError(err, f)
                 return
             }
 
@@ -173,6 +231,21 @@ func (conn *stompConn) handleIncomingFrame(f *frame.Frame) error {
 
     case frame.UNSUBSCRIBE:
         return conn.handleUnsubscribe(f)
+
+    case frame.ACK:
+        return conn.handleAck(f, false)
+
+    case frame.NACK:
+        return conn.handleAck(f, true)
+
+    case frame.BEGIN:
+        return conn.handleBegin(f)
+
+    case frame.COMMIT:
+        return conn.handleCommit(f)
+
+    case frame.ABORT:
+        return conn.handleAbort(f)
     }
 
     return unsupportedStompCommandError
@@ -202,7 +275,7 @@ func (conn *stompConn) handleConnect(f *frame.Frame) error {
     var err error
     conn.version, err = determineVersion(f)
     if err != nil {
-        log.Println("cannot determine version")
+        conn.logger.Warn("cannot determine STOMP version", "error", err)
         return err
     }
 
@@ -210,9 +283,18 @@ func (conn *stompConn) handleConnect(f *frame.Frame) error {
         return unsupportedStompVersionError
     }
 
+    if authenticator := conn.config.Authenticator(); authenticator != nil {
+        principal, err := authenticator.Authenticate(newConnectCredentials(f, conn.GetTLSConnectionState()))
+        if err != nil || principal == nil {
+            conn.logger.Warn("authentication failed", "error", err)
+            return authenticationFailedError
+        }
+        conn.principal = principal
+    }
+
     cxDuration, cyDuration, err := getHeartBeat(f)
     if err != nil {
-        log.Println("invalid heart-beat")
+        conn.logger.Warn("invalid heart-beat", "error", err)
         return err
     }
 
@@ -292,9 +374,23 @@ func (conn *stompConn) handleSubscribe(f *frame.Frame) error {
         return nil
     }
 
+    if err := conn.authorize(SubscribeAction, dest); err != nil {
+        return err
+    }
+
+    ack := f.Header.Get(frame.Ack)
+    switch ack {
+    case "":
+        ack = frame.AckAuto
+    case frame.AckAuto, frame.AckClient, frame.AckClientIndividual:
+    default:
+        return invalidHeaderError
+    }
+
     conn.subscriptions[subId] = &subscription{
         id: subId,
         destination: dest,
+        ack: ack,
     }
 
     conn.events <- &connEvent{
@@ -331,6 +427,7 @@ func (conn *stompConn) handleUnsubscribe(f *frame.Frame) error {
 
     // remove the subscription
     delete(conn.subscriptions, id)
+    conn.releasePendingMessages(sub)
 
     conn.events <- &connEvent{
         eventType: unsubscribeFromTopic,
@@ -350,19 +447,22 @@ func (conn *stompConn) handleSend(f *frame.Frame) error {
         return nil
     }
 
-    // TODO: Remove if we start supporting transactions
-    if  containsHeader(f, frame.Transaction) {
-        return unsupportedStompCommandError
+    dest, ok := f.Header.Contains(frame.Destination)
+    if !ok {
+        return invalidFrameError
     }
 
-    err := conn.sendReceiptResponse(f)
-    if err != nil {
+    if err := conn.authorize(SendAction, dest); err != nil {
         return err
     }
 
-    dest, ok := f.Header.Contains(frame.Destination)
-    if !ok {
-        return invalidFrameError
+    if _, ok := f.Header.Contains(frame.Transaction); ok {
+        return conn.bufferTransactionFrame(f)
+    }
+
+    err := conn.sendReceiptResponse(f)
+    if err != nil {
+        return err
     }
 
     f.Command = frame.MESSAGE
@@ -376,6 +476,202 @@ func (conn *stompConn) handleSend(f *frame.Frame) error {
     return nil
 }
 
+func (conn *stompConn) authorize(action DestinationAction, destination string) error {
+    authorizer := conn.config.Authorizer()
+    if authorizer == nil {
+        return nil
+    }
+    if err := authorizer.Authorize(conn.id, conn.principal, action, destination); err != nil {
+        conn.logger.Warn("access denied", "action", action, "destination", destination, "error", err)
+        return accessDeniedError
+    }
+    return nil
+}
+
+func (conn *stompConn) handleAck(f *frame.Frame, nack bool) error {
+    switch atomic.LoadInt32(&conn.state) {
+    case connecting:
+        return notConnectedStompError
+    case closed:
+        return nil
+    }
+
+    ackId, ok := f.Header.Contains(frame.Id)
+    if !ok {
+        return invalidFrameError
+    }
+
+    if _, ok := f.Header.Contains(frame.Transaction); ok {
+        return conn.bufferTransactionFrame(f)
+    }
+
+    if err := conn.sendReceiptResponse(f); err != nil {
+        return err
+    }
+
+    conn.applyAck(ackId, nack)
+    return nil
+}
+
+// acknowledges the message with the given id and all messages before it for subscriptions
+// with client ack mode. Negatively acknowledged messages are redelivered.
+func (conn *stompConn) applyAck(ackId string, nack bool) {
+    for _, sub := range conn.subscriptions {
+        acknowledged := sub.takePending(ackId)
+        if len(acknowledged) == 0 {
+            continue
+        }
+        if nack {
+            conn.events <- &connEvent{
+                eventType: redeliverMessages,
+                conn: conn,
+                sub: sub,
+                destination: sub.destination,
+                frames: acknowledged,
+                requeue: true,
+            }
+        }
+        return
+    }
+
+    // unknown or already acknowledged message
+}
+
+func (conn *stompConn) handleBegin(f *frame.Frame) error {
+    if atomic.LoadInt32(&conn.state) == connecting {
+        return notConnectedStompError
+    }
+
+    tx, ok := f.Header.Contains(frame.Transaction)
+    if !ok || tx == "" {
+        return invalidFrameError
+    }
+    if _, exists := conn.transactions[tx]; exists {
+        return invalidTransactionError
+    }
+    if max := conn.config.MaxTransactions(); max >= 0 && len(conn.transactions) >= max {
+        return tooManyTransactionsError
+    }
+
+    conn.transactions[tx] = []*frame.Frame{}
+    return conn.sendReceiptResponse(f)
+}
+
+func (conn *stompConn) handleCommit(f *frame.Frame) error {
+    if atomic.LoadInt32(&conn.state) == connecting {
+        return notConnectedStompError
+    }
+
+    tx, ok := f.Header.Contains(frame.Transaction)
+    if !ok {
+        return invalidFrameError
+    }
+    frames, exists := conn.transactions[tx]
+    if !exists {
+        return invalidTransactionError
+    }
+    delete(conn.transactions, tx)
+
+    if err := conn.sendReceiptResponse(f); err != nil {
+        return err
+    }
+
+    var messages []*frame.Frame
+    for _, txFrame := range frames {
+        switch txFrame.Command {
+        case frame.MESSAGE:
+            messages = append(messages, txFrame)
+        case frame.ACK, frame.NACK:
+            conn.applyAck(txFrame.Header.Get(frame.Id), txFrame.Command == frame.NACK)
+        }
+    }
+
+    if len(messages) > 0 {
+        conn.events <- &connEvent{
+            eventType: commitTransaction,
+            conn: conn,
+            frames: messages,
+        }
+    }
+    return nil
+}
+
+func (conn *stompConn) handleAbort(f *frame.Frame) error {
+    if atomic.LoadInt32(&conn.state) == connecting {
+        return notConnectedStompError
+    }
+
+    tx, ok := f.Header.Contains(frame.Transaction)
+    if !ok {
+        return invalidFrameError
+    }
+    if _, exists := conn.transactions[tx]; !exists {
+        return invalidTransactionError
+    }
+
+    // discard the buffered frames, the messages acknowledged in the
+    // transaction remain pending.
+    delete(conn.transactions, tx)
+    return conn.sendReceiptResponse(f)
+}
+
+// buffers a SEND, ACK or NACK frame until its transaction is committed.
+func (conn *stompConn) bufferTransactionFrame(f *frame.Frame) error {
+    tx := f.Header.Get(frame.Transaction)
+    frames, exists := conn.transactions[tx]
+    if !exists {
+        return invalidTransactionError
+    }
+    if max := conn.config.MaxTransactionFrames(); max >= 0 && len(frames) >= max {
+        return transactionTooLargeError
+    }
+
+    if err := conn.sendReceiptResponse(f); err != nil {
+        return err
+    }
+
+    f.Header.Del(frame.Transaction)
+    if f.Command == frame.SEND {
+        f.Command = frame.MESSAGE
+    }
+    conn.transactions[tx] = append(frames, f)
+    return nil
+}
+
+// remembers the messages sent to subscriptions which require acknowledgements.
+func (conn *stompConn) trackPendingMessage(f *frame.Frame) {
+    if f.Command != frame.MESSAGE {
+        return
+    }
+    sub, ok := conn.subscriptions[f.Header.Get(frame.Subscription)]
+    if !ok || !sub.requiresAck() {
+        return
+    }
+    f.Header.Set(frame.Ack, f.Header.Get(frame.MessageId))
+    if max := conn.config.MaxPendingMessages(); max >= 0 && len(sub.pending) >= max {
+        conn.logger.Warn("too many unacknowledged messages, discarding the oldest message",
+            "subscription", sub.id, "destination", sub.destination)
+        sub.pending = append([]*frame.Frame{}, sub.pending[len(sub.pending) - max + 1:]...)
+    }
+    sub.pending = append(sub.pending, f)
+}
+
+// hands the unacknowledged messages of the subscription back to the server for redelivery.
+func (conn *stompConn) releasePendingMessages(sub *subscription) {
+    if len(sub.pending) == 0 {
+        return
+    }
+    pending := sub.pending
+    sub.pending = nil
+    conn.events <- &connEvent{
+        eventType: redeliverMessages,
+        conn: conn,
+        sub: sub,
+        destination: sub.destination,
+        frames: pending,
+    }
+}
+
 func (conn *stompConn) sendReceiptResponse(f *frame.Frame) error {
     if receipt, ok := f.Header.Contains(frame.Receipt); ok {
         f.Header.Del(frame.Receipt)
@@ -440,10 +736,18 @@ func getHeartBeat(f *frame.Frame) (cx, cy time.Duration, err error) {
     return 0, 0, nil
 }
 
-func (conn *stompConn) sendError(err error) {
+func (conn *stompConn) sendError(err error, f *frame.Frame) {
     errorFrame := frame.New(frame.ERROR,
         frame.Message, err.Error())
 
+    if err == accessDeniedError && f != nil {
+        // let the client correlate the error with the rejected frame
+        errorFrame.Header.Set(frame.Destination, f.Header.Get(frame.Destination))
+        if receipt, ok := f.Header.Contains(frame.Receipt); ok {
+            errorFrame.Header.Set(frame.ReceiptId, receipt)
+        }
+    }
+
     conn.rawConnection.WriteFrame(errorFrame)
 }
 
@@ -453,7 +757,8 @@ func (conn *stompConn) populateMessageIdHeader(f *frame.Frame) {
         conn.currentMessageId++
         messageId := strconv.FormatUint(conn.currentMessageId, 10)
         f.Header.Set(frame.MessageId, messageId)
-        // remove the Ack header (if any) as we don't support those
+        // remove the ack header of the sender (if any), the ack id of
+        // the message is set when it is sent to a client ack subscription
         f.Header.Del(frame.Ack)
     }
 }
@@ -8,6 +8,7 @@ import (
     "fmt"
     "github.com/go-stomp/stomp/frame"
     "github.com/stretchr/testify/assert"
+    "strconv"
     "sync"
     "testing"
     "time"
@@ -123,6 +124,67 @@ func TestStompConn_Connect(t *testing.T) {
     assert.Equal(t, stompConn.state, connected)
 }
 
+func TestStompConn_ConnectAuthenticated(t *testing.T) {
+    var credentials []*ConnectCredentials
+    authenticator := AuthenticatorFunc(func(c *ConnectCredentials) (*Principal, error) {
+        credentials = append(credentials, c)
+        if c.Login == "guest" && c.Passcode == "guest" {
+            return &Principal{Name: c.Login}, nil
+        }
+        if c.Token == "secret-token" {
+            return &Principal{Name: "token-user", Attributes: map[string]interface{}{"role": "admin"}}, nil
+        }
+        return nil, errors.New("invalid credentials")
+    })
+    config := NewStompConfig(0, []string{}, WithAuthenticator(authenticator))
+
+    stompConn, rawConn, events := getTestStompConn(config, nil)
+    rawConn.incomingFrames <- frame.New(frame.CONNECT, frame.AcceptVersion, "1.2",
+        frame.Login, "guest", frame.Passcode, "guest")
+
+    e := <- events
+    assert.Equal(t, e.eventType, connectionEstablished)
+    assert.Equal(t, &Principal{Name: "guest"}, stompConn.GetPrincipal())
+    assert.Equal(t, rawConn.sentFrames[0].Command, frame.CONNECTED)
+
+    stompConn, rawConn, events = getTestStompConn(config, nil)
+    rawConn.incomingFrames <- frame.New(frame.CONNECT, frame.AcceptVersion, "1.2",
+        "Authorization", "Bearer secret-token")
+
+    e = <- events
+    assert.Equal(t, e.eventType, connectionEstablished)
+    assert.Equal(t, "token-user", stompConn.GetPrincipal().Name)
+    assert.Equal(t, "admin", stompConn.GetPrincipal().Attributes["role"])
+    assert.Equal(t, "secret-token", credentials[1].Token)
+    assert.Equal(t, "Bearer secret-token", credentials[1].Headers.Get("Authorization"))
+    assert.Nil(t, credentials[1].TLSState)
+}
+
+func TestStompConn_ConnectAuthenticationFailed(t *testing.T) {
+    config := NewStompConfig(0, []string{}, WithAuthenticator(
+        AuthenticatorFunc(func(c *ConnectCredentials) (*Principal, error) {
+            if c.Login == "guest" && c.Passcode == "guest" {
+                return &Principal{Name: c.Login}, nil
+            }
+            return nil, errors.New("invalid credentials")
+        })))
+
+    stompConn, rawConn, events := getTestStompConn(config, nil)
+    rawConn.incomingFrames <- frame.New(frame.CONNECT, frame.AcceptVersion, "1.2",
+        frame.Login, "guest", frame.Passcode, "wrong")
+
+    e := <- events
+
+    assert.Equal(t, e.eventType, connectionClosed)
+    assert.Equal(t, len(rawConn.sentFrames), 1)
+    verifyFrame(t, rawConn.sentFrames[0], frame.New(frame.ERROR,
+        frame.Message, authenticationFailedError.Error()), true)
+
+    assert.Nil(t, stompConn.GetPrincipal())
+    assert.Equal(t, stompConn.state, closed)
+    assert.Equal(t, rawConn.connected, false)
+}
+
 func TestStompConn_ConnectStomp10(t *testing.T) {
     stompConn, rawConn, events := getTestStompConn(NewStompConfig(0, []string{}), nil)
 
@@ -486,6 +548,376 @@ func TestStompConn_Send(t *testing.T) {
         frame.ReceiptId, "receipt-id"), true)
 }
 
+func newTestAuthorizerConfig() StompConfig {
+    return NewStompConfig(0, []string{}, WithAuthorizer(AuthorizerFunc(
+        func(connectionId string, principal *Principal, action DestinationAction, destination string) error {
+            if destination == "/topic/private" {
+                return errors.New("private destination")
+            }
+            return nil
+        })))
+}
+
+func TestStompConn_SubscribeAccessDenied(t *testing.T) {
+    stompConn, rawConn, events := getTestStompConn(newTestAuthorizerConfig(), nil)
+
+    rawConn.SendConnectFrame()
+
+    e := <- events
+    assert.Equal(t, e.eventType, connectionEstablished)
+
+    rawConn.incomingFrames <- frame.New(frame.SUBSCRIBE,
+        frame.Id, "sub-1", frame.Destination, "/topic/public")
+
+    e = <- events
+    assert.Equal(t, e.eventType, subscribeToTopic)
+
+    rawConn.incomingFrames <- frame.New(frame.SUBSCRIBE,
+        frame.Id, "sub-2", frame.Destination, "/topic/private", frame.Receipt, "receipt-1")
+
+    e = <- events
+    assert.Equal(t, e.eventType, connectionClosed)
+
+    assert.Equal(t, len(rawConn.sentFrames), 2)
+    verifyFrame(t, rawConn.sentFrames[1], frame.New(frame.ERROR,
+        frame.Message, accessDeniedError.Error(),
+        frame.Destination, "/topic/private",
+        frame.ReceiptId, "receipt-1"), true)
+    assert.Equal(t, len(stompConn.subscriptions), 1)
+    assert.Equal(t, stompConn.state, closed)
+}
+
+func TestStompConn_SendAccessDenied(t *testing.T) {
+    stompConn, rawConn, events := getTestStompConn(newTestAuthorizerConfig(), nil)
+
+    rawConn.SendConnectFrame()
+
+    e := <- events
+    assert.Equal(t, e.eventType, connectionEstablished)
+
+    rawConn.incomingFrames <- frame.New(frame.SEND,
+        frame.Destination, "/topic/private", frame.Receipt, "receipt-1")
+
+    e = <- events
+    assert.Equal(t, e.eventType, connectionClosed)
+
+    // no receipt is sent for the rejected frame.
+    assert.Equal(t, len(rawConn.sentFrames), 2)
+    verifyFrame(t, rawConn.sentFrames[1], frame.New(frame.ERROR,
+        frame.Message, accessDeniedError.Error(),
+        frame.Destination, "/topic/private",
+        frame.ReceiptId, "receipt-1"), true)
+    assert.Equal(t, stompConn.state, closed)
+}
+
+func TestStompConn_SubscribeInvalidAckMode(t *testing.T) {
+    stompConn, rawConn, events := getTestStompConn(NewStompConfig(0, []string{}), nil)
+
+    rawConn.SendConnectFrame()
+
+    e := <- events
+    assert.Equal(t, e.eventType, connectionEstablished)
+
+    rawConn.incomingFrames <- frame.New(frame.SUBSCRIBE,
+        frame.Id, "sub-id", frame.Destination, "/topic/test", frame.Ack, "invalid")
+
+    e = <- events
+    assert.Equal(t, e.eventType, connectionClosed)
+
+    verifyFrame(t, rawConn.sentFrames[1], frame.New(frame.ERROR,
+        frame.Message, invalidHeaderError.Error()), true)
+    assert.Equal(t, stompConn.state, closed)
+}
+
+// subscribes with the given ack mode and sends three messages to the subscription.
+func subscribeAndSendMessages(t *testing.T, ackMode string,
+        options ...StompConfigOption) (*stompConn, *MockRawConnection, chan *connEvent) {
+    stompConn, rawConn, events := getTestStompConn(NewStompConfig(0, []string{}, options...), nil)
+
+    rawConn.SendConnectFrame()
+    e := <- events
+    assert.Equal(t, e.eventType, connectionEstablished)
+
+    rawConn.incomingFrames <- frame.New(frame.SUBSCRIBE,
+        frame.Id, "sub-id", frame.Destination, "/topic/test", frame.Ack, ackMode)
+    e = <- events
+    assert.Equal(t, e.eventType, subscribeToTopic)
+    assert.Equal(t, ackMode, e.sub.ack)
+
+    rawConn.writeWg = &sync.WaitGroup{}
+    rawConn.writeWg.Add(3)
+    for i := 1; i <= 3; i++ {
+        f := frame.New(frame.MESSAGE, frame.Destination, "/topic/test", frame.Ack, "ignored")
+        f.Body = []byte("message-" + strconv.Itoa(i))
+        stompConn.SendFrameToSubscription(f, e.sub)
+    }
+    rawConn.writeWg.Wait()
+    rawConn.writeWg = nil
+
+    for i := 1; i <= 3; i++ {
+        f := rawConn.sentFrames[i]
+        assert.Equal(t, strconv.Itoa(i), f.Header.Get(frame.MessageId))
+        assert.Equal(t, f.Header.Get(frame.MessageId), f.Header.Get(frame.Ack))
+    }
+    return stompConn, rawConn, events
+}
+
+func pendingMessageBodies(sub *subscription) []string {
+    var bodies []string
+    for _, f := range sub.pending {
+        bodies = append(bodies, string(f.Body))
+    }
+    return bodies
+}
+
+func TestStompConn_AckAutoMode(t *testing.T) {
+    stompConn, rawConn, _ := getTestStompConn(NewStompConfig(0, []string{}), nil)
+    sub := &subscription{id: "sub-id", destination: "/topic/test", ack: frame.AckAuto}
+    stompConn.subscriptions["sub-id"] = sub
+
+    rawConn.writeWg = &sync.WaitGroup{}
+    rawConn.writeWg.Add(1)
+    stompConn.SendFrameToSubscription(
+        frame.New(frame.MESSAGE, frame.Destination, "/topic/test", frame.Ack, "ignored"), sub)
+    rawConn.writeWg.Wait()
+
+    _, ok := rawConn.sentFrames[0].Header.Contains(frame.Ack)
+    assert.False(t, ok)
+    assert.Equal(t, 0, len(sub.pending))
+}
+
+func TestStompConn_AckClientIndividual(t *testing.T) {
+    stompConn, rawConn, events := subscribeAndSendMessages(t, frame.AckClientIndividual)
+    sub := stompConn.subscriptions["sub-id"]
+
+    rawConn.incomingFrames <- frame.New(frame.ACK, frame.Id, "2", frame.Receipt, "ack-receipt")
+    rawConn.incomingFrames <- frame.New(frame.NACK, frame.Id, "1")
+
+    e := <- events
+    assert.Equal(t, e.eventType, redeliverMessages)
+    assert.Equal(t, e.sub, sub)
+    assert.Equal(t, e.destination, "/topic/test")
+    assert.True(t, e.requeue)
+    assert.Equal(t, 1, len(e.frames))
+    assert.Equal(t, "message-1", string(e.frames[0].Body))
+
+    verifyFrame(t, rawConn.sentFrames[4], frame.New(frame.RECEIPT, frame.ReceiptId, "ack-receipt"), true)
+    assert.Equal(t, []string{"message-3"}, pendingMessageBodies(sub))
+
+    // unknown and repeated acknowledgements are ignored.
+    rawConn.incomingFrames <- frame.New(frame.ACK, frame.Id, "2")
+    rawConn.incomingFrames <- frame.New(frame.ACK, frame.Id, "unknown")
+
+    // pending messages are released when the connection closes.
+    rawConn.incomingFrames <- errors.New("connection closed")
+    e = <- events
+    assert.Equal(t, e.eventType, redeliverMessages)
+    assert.False(t, e.requeue)
+    assert.Equal(t, "message-3", string(e.frames[0].Body))
+
+    e = <- events
+    assert.Equal(t, e.eventType, connectionClosed)
+}
+
+func TestStompConn_AckClient(t *testing.T) {
+    stompConn, rawConn, events := subscribeAndSendMessages(t, frame.AckClient)
+    sub := stompConn.subscriptions["sub-id"]
+
+    // cumulative acknowledgement of the first two messages
+    rawConn.incomingFrames <- frame.New(frame.ACK, frame.Id, "2")
+    rawConn.incomingFrames <- frame.New(frame.UNSUBSCRIBE, frame.Id, "sub-id")
+
+    e := <- events
+    assert.Equal(t, e.eventType, redeliverMessages)
+    assert.Equal(t, 1, len(e.frames))
+    assert.Equal(t, "message-3", string(e.frames[0].Body))
+    assert.Equal(t, 0, len(sub.pending))
+
+    e = <- events
+    assert.Equal(t, e.eventType, unsubscribeFromTopic)
+}
+
+func TestStompConn_MaxPendingMessages(t *testing.T) {
+    stompConn, _, _ := subscribeAndSendMessages(t, frame.AckClientIndividual, WithMaxPendingMessages(2))
+
+    // the oldest unacknowledged message is discarded
+    assert.Equal(t, []string{"message-2", "message-3"}, pendingMessageBodies(stompConn.subscriptions["sub-id"]))
+
+    assert.Equal(t, DefaultMaxPendingMessages, NewStompConfig(0, []string{}).MaxPendingMessages())
+    assert.Equal(t, -1, NewStompConfig(0, []string{}, WithMaxPendingMessages(-1)).MaxPendingMessages())
+}
+
+func TestStompConn_AckMissingIdHeader(t *testing.T) {
+    stompConn, rawConn, events := subscribeAndSendMessages(t, frame.AckClient)
+
+    rawConn.incomingFrames <- frame.New(frame.ACK)
+
+    e := <- events
+    assert.Equal(t, e.eventType, redeliverMessages)
+    e = <- events
+    assert.Equal(t, e.eventType, connectionClosed)
+    verifyFrame(t, rawConn.LastSentFrame(), frame.New(frame.ERROR,
+        frame.Message, invalidFrameError.Error()), true)
+    assert.Equal(t, stompConn.state, closed)
+}
+
+func TestStompConn_TransactionCommit(t *testing.T) {
+    _, rawConn, events := getTestStompConn(NewStompConfig(0, []string{}), nil)
+
+    rawConn.SendConnectFrame()
+    e := <- events
+    assert.Equal(t, e.eventType, connectionEstablished)
+
+    rawConn.incomingFrames <- frame.New(frame.BEGIN, frame.Transaction, "tx1", frame.Receipt, "begin-receipt")
+    msg1 := frame.New(frame.SEND, frame.Destination, "/topic/test", frame.Transaction, "tx1")
+    msg1.Body = []byte("message-1")
+    rawConn.incomingFrames <- msg1
+    msg2 := frame.New(frame.SEND, frame.Destination, "/topic/test2", frame.Transaction, "tx1",
+        frame.Receipt, "send-receipt")
+    msg2.Body = []byte("message-2")
+    rawConn.incomingFrames <- msg2
+
+    // messages sent outside of the transaction are dispatched immediately
+    rawConn.incomingFrames <- frame.New(frame.SEND, frame.Destination, "/topic/test")
+    e = <- events
+    assert.Equal(t, e.eventType, incomingMessage)
+
+    rawConn.incomingFrames <- frame.New(frame.COMMIT, frame.Transaction, "tx1", frame.Receipt, "commit-receipt")
+    e = <- events
+    assert.Equal(t, e.eventType, commitTransaction)
+    assert.Equal(t, 2, len(e.frames))
+    assert.Equal(t, msg1, e.frames[0])
+    assert.Equal(t, msg2, e.frames[1])
+    for _, f := range e.frames {
+        assert.Equal(t, frame.MESSAGE, f.Command)
+        assert.False(t, containsHeader(f, frame.Transaction))
+    }
+
+    assert.Equal(t, 4, len(rawConn.sentFrames))
+    verifyFrame(t, rawConn.sentFrames[1], frame.New(frame.RECEIPT, frame.ReceiptId, "begin-receipt"), true)
+    verifyFrame(t, rawConn.sentFrames[2], frame.New(frame.RECEIPT, frame.ReceiptId, "send-receipt"), true)
+    verifyFrame(t, rawConn.sentFrames[3], frame.New(frame.RECEIPT, frame.ReceiptId, "commit-receipt"), true)
+
+    // the transaction id can be reused once the transaction is completed.
+    rawConn.incomingFrames <- frame.New(frame.BEGIN, frame.Transaction, "tx1")
+    rawConn.incomingFrames <- frame.New(frame.COMMIT, frame.Transaction, "tx1")
+    rawConn.incomingFrames <- frame.New(frame.SEND, frame.Destination, "/topic/test")
+    e = <- events
+    assert.Equal(t, e.eventType, incomingMessage)
+}
+
+func TestStompConn_TransactionAbort(t *testing.T) {
+    stompConn, rawConn, events := subscribeAndSendMessages(t, frame.AckClientIndividual)
+    sub := stompConn.subscriptions["sub-id"]
+
+    rawConn.incomingFrames <- frame.New(frame.BEGIN, frame.Transaction, "tx1")
+    rawConn.incomingFrames <- frame.New(frame.SEND, frame.Destination, "/topic/test", frame.Transaction, "tx1")
+    rawConn.incomingFrames <- frame.New(frame.ACK, frame.Id, "1", frame.Transaction, "tx1")
+    rawConn.incomingFrames <- frame.New(frame.ABORT, frame.Transaction, "tx1", frame.Receipt, "abort-receipt")
+
+    // the aborted frames are discarded
+    rawConn.incomingFrames <- frame.New(frame.SEND, frame.Destination, "/topic/after-abort")
+    e := <- events
+    assert.Equal(t, e.eventType, incomingMessage)
+    assert.Equal(t, "/topic/after-abort", e.destination)
+
+    verifyFrame(t, rawConn.LastSentFrame(), frame.New(frame.RECEIPT, frame.ReceiptId, "abort-receipt"), true)
+    assert.Equal(t, []string{"message-1", "message-2", "message-3"}, pendingMessageBodies(sub))
+}
+
+func TestStompConn_TransactionAck(t *testing.T) {
+    stompConn, rawConn, events := subscribeAndSendMessages(t, frame.AckClientIndividual)
+    sub := stompConn.subscriptions["sub-id"]
+
+    rawConn.incomingFrames <- frame.New(frame.BEGIN, frame.Transaction, "tx1")
+    rawConn.incomingFrames <- frame.New(frame.ACK, frame.Id, "1", frame.Transaction, "tx1")
+    rawConn.incomingFrames <- frame.New(frame.NACK, frame.Id, "3", frame.Transaction, "tx1")
+    rawConn.incomingFrames <- frame.New(frame.SEND, frame.Destination, "/topic/test")
+
+    // the acknowledgements are applied on commit
+    e := <- events
+    assert.Equal(t, e.eventType, incomingMessage)
+    assert.Equal(t, []string{"message-1", "message-2", "message-3"}, pendingMessageBodies(sub))
+
+    rawConn.incomingFrames <- frame.New(frame.COMMIT, frame.Transaction, "tx1")
+    e = <- events
+    assert.Equal(t, e.eventType, redeliverMessages)
+    assert.True(t, e.requeue)
+    assert.Equal(t, 1, len(e.frames))
+    assert.Equal(t, "message-3", string(e.frames[0].Body))
+    assert.Equal(t, []string{"message-2"}, pendingMessageBodies(sub))
+}
+
+func TestStompConn_InvalidTransaction(t *testing.T) {
+    testInvalidTransaction := func(expectedErr error, frames ...*frame.Frame) {
+        stompConn, rawConn, events := getTestStompConn(NewStompConfig(0, []string{}), nil)
+
+        rawConn.SendConnectFrame()
+        e := <- events
+        assert.Equal(t, e.eventType, connectionEstablished)
+
+        for _, f := range frames {
+            rawConn.incomingFrames <- f
+        }
+
+        e = <- events
+        assert.Equal(t, e.eventType, connectionClosed)
+        verifyFrame(t, rawConn.LastSentFrame(), frame.New(frame.ERROR,
+            frame.Message, expectedErr.Error()), true)
+        assert.Equal(t, stompConn.state, closed)
+    }
+
+    testInvalidTransaction(invalidFrameError, frame.New(frame.BEGIN))
+    testInvalidTransaction(invalidFrameError, frame.New(frame.COMMIT))
+    testInvalidTransaction(invalidFrameError, frame.New(frame.ABORT))
+    testInvalidTransaction(invalidTransactionError,
+        frame.New(frame.BEGIN, frame.Transaction, "tx1"),
+        frame.New(frame.BEGIN, frame.Transaction, "tx1"))
+    testInvalidTransaction(invalidTransactionError, frame.New(frame.COMMIT, frame.Transaction, "unknown"))
+    testInvalidTransaction(invalidTransactionError, frame.New(frame.ABORT, frame.Transaction, "unknown"))
+    testInvalidTransaction(invalidTransactionError,
+        frame.New(frame.SEND, frame.Destination, "/topic/test", frame.Transaction, "unknown"))
+}
+
+func TestStompConn_TransactionLimits(t *testing.T) {
+    config := NewStompConfig(0, []string{}, WithMaxTransactions(2), WithMaxTransactionFrames(1))
+
+    stompConn, rawConn, events := getTestStompConn(config, nil)
+    rawConn.SendConnectFrame()
+    e := <- events
+    assert.Equal(t, e.eventType, connectionEstablished)
+
+    rawConn.incomingFrames <- frame.New(frame.BEGIN, frame.Transaction, "tx1")
+    rawConn.incomingFrames <- frame.New(frame.BEGIN, frame.Transaction, "tx2")
+    rawConn.incomingFrames <- frame.New(frame.BEGIN, frame.Transaction, "tx3")
+    e = <- events
+    assert.Equal(t, e.eventType, connectionClosed)
+    verifyFrame(t, rawConn.LastSentFrame(), frame.New(frame.ERROR,
+        frame.Message, tooManyTransactionsError.Error()), true)
+    assert.Equal(t, stompConn.state, closed)
+
+    stompConn, rawConn, events = getTestStompConn(config, nil)
+    rawConn.SendConnectFrame()
+    e = <- events
+    assert.Equal(t, e.eventType, connectionEstablished)
+
+    rawConn.incomingFrames <- frame.New(frame.BEGIN, frame.Transaction, "tx1")
+    rawConn.incomingFrames <- frame.New(frame.SEND, frame.Destination, "/topic/test", frame.Transaction, "tx1")
+    rawConn.incomingFrames <- frame.New(frame.SEND, frame.Destination, "/topic/test", frame.Transaction, "tx1")
+    e = <- events
+    assert.Equal(t, e.eventType, connectionClosed)
+    verifyFrame(t, rawConn.LastSentFrame(), frame.New(frame.ERROR,
+        frame.Message, transactionTooLargeError.Error()), true)
+
+    // negative limits remove the limits
+    config = NewStompConfig(0, []string{}, WithMaxTransactions(-1), WithMaxTransactionFrames(-1))
+    assert.Equal(t, -1, config.MaxTransactions())
+    assert.Equal(t, -1, config.MaxTransactionFrames())
+    config = NewStompConfig(0, []string{}, WithMaxTransactions(0))
+    assert.Equal(t, DefaultMaxTransactions, config.MaxTransactions())
+    assert.Equal(t, DefaultMaxTransactionFrames, config.MaxTransactionFrames())
+}
+
 func TestStompConn_UnsubscribeNotConnected(t *testing.T) {
     _, rawConn, events := getTestStompConn(NewStompConfig(0, []string{}), nil)
 
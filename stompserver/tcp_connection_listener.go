@@ -4,6 +4,8 @@
 package stompserver
 
 import (
+    "crypto/tls"
+    "fmt"
     "time"
     "net"
     "github.com/go-stomp/stomp/frame"
@@ -33,6 +35,15 @@ func (c *tcpStompConnection) Close() error {
     return c.tcpCon.Close()
 }
 
+func (c *tcpStompConnection) TLSConnectionState() *tls.ConnectionState {
+    tlsCon, ok := c.tcpCon.(*tls.Conn)
+    if !ok {
+        return nil
+    }
+    state := tlsCon.ConnectionState()
+    return &state
+}
+
 type tcpConnectionListener struct {
     listener net.Listener
 }
@@ -45,6 +56,19 @@ func NewTcpConnectionListener(addr string) (RawConnectionListener, error) {
     return &tcpConnectionListener{listener: tcpListener}, nil
 }
 
+// Creates a TCP connection listener which only accepts TLS connections.
+// Use NewMutualTLSConfig() to create a tlsConfig which also requires and verifies client certificates.
+func NewTLSTcpConnectionListener(addr string, tlsConfig *tls.Config) (RawConnectionListener, error) {
+    if tlsConfig == nil {
+        return nil, fmt.Errorf("tls config is nil")
+    }
+    tlsListener, err := tls.Listen("tcp", addr, tlsConfig)
+    if err != nil {
+        return nil, err
+    }
+    return &tcpConnectionListener{listener: tlsListener}, nil
+}
+
 func (l *tcpConnectionListener) Accept() (RawConnection, error) {
     conn, err := l.listener.Accept()
 
@@ -0,0 +1,20 @@
+// Copyright 2019-2020 VMware, Inc.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package stompserver
+
+import (
+    "crypto/tls"
+    "crypto/x509"
+)
+
+// Creates a TLS configuration for the TLS connection listeners which requires all clients
+// to present a certificate signed by one of the clientCAs (mutual TLS).
+func NewMutualTLSConfig(serverCert tls.Certificate, clientCAs *x509.CertPool) *tls.Config {
+    return &tls.Config{
+        Certificates: []tls.Certificate{serverCert},
+        ClientAuth:   tls.RequireAndVerifyClientCert,
+        ClientCAs:    clientCAs,
+        MinVersion:   tls.VersionTLS12,
+    }
+}
@@ -0,0 +1,206 @@
+// Copyright 2019-2020 VMware, Inc.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package stompserver
+
+import (
+    "crypto/ecdsa"
+    "crypto/elliptic"
+    "crypto/rand"
+    "crypto/tls"
+    "crypto/x509"
+    "crypto/x509/pkix"
+    "github.com/go-stomp/stomp/frame"
+    "github.com/gorilla/websocket"
+    "github.com/stretchr/testify/assert"
+    "math/big"
+    "net"
+    "testing"
+    "time"
+)
+
+type testCertificates struct {
+    caPool     *x509.CertPool
+    serverCert tls.Certificate
+    clientCert tls.Certificate
+}
+
+func createTestCertificate(t *testing.T, template *x509.Certificate,
+        parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (tls.Certificate, *x509.Certificate, *ecdsa.PrivateKey) {
+
+    key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+    assert.Nil(t, err)
+    if parent == nil {
+        parent, parentKey = template, key
+    }
+    der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+    assert.Nil(t, err)
+    cert, err := x509.ParseCertificate(der)
+    assert.Nil(t, err)
+    return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, cert, key
+}
+
+func createTestCertificates(t *testing.T) *testCertificates {
+    notBefore := time.Now().Add(-time.Hour)
+    notAfter := time.Now().Add(time.Hour)
+
+    _, caCert, caKey := createTestCertificate(t, &x509.Certificate{
+        SerialNumber:          big.NewInt(1),
+        Subject:               pkix.Name{CommonName: "test-ca"},
+        NotBefore:             notBefore,
+        NotAfter:              notAfter,
+        IsCA:                  true,
+        BasicConstraintsValid: true,
+        KeyUsage:              x509.KeyUsageCertSign,
+    }, nil, nil)
+
+    serverCert, _, _ := createTestCertificate(t, &x509.Certificate{
+        SerialNumber: big.NewInt(2),
+        Subject:      pkix.Name{CommonName: "localhost"},
+        IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+        NotBefore:    notBefore,
+        NotAfter:     notAfter,
+        KeyUsage:     x509.KeyUsageDigitalSignature,
+        ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+    }, caCert, caKey)
+
+    clientCert, _, _ := createTestCertificate(t, &x509.Certificate{
+        SerialNumber: big.NewInt(3),
+        Subject:      pkix.Name{CommonName: "test-client"},
+        NotBefore:    notBefore,
+        NotAfter:     notAfter,
+        KeyUsage:     x509.KeyUsageDigitalSignature,
+        ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+    }, caCert, caKey)
+
+    caPool := x509.NewCertPool()
+    caPool.AddCert(caCert)
+    return &testCertificates{caPool: caPool, serverCert: serverCert, clientCert: clientCert}
+}
+
+func (certs *testCertificates) clientConfig(withClientCert bool) *tls.Config {
+    config := &tls.Config{RootCAs: certs.caPool}
+    if withClientCert {
+        config.Certificates = []tls.Certificate{certs.clientCert}
+    }
+    return config
+}
+
+func TestTLSConnectionListener_NilConfig(t *testing.T) {
+    tcpListener, err := NewTLSTcpConnectionListener("127.0.0.1:0", nil)
+    assert.Nil(t, tcpListener)
+    assert.EqualError(t, err, "tls config is nil")
+
+    wsListener, err := NewTLSWebSocketConnectionListener("127.0.0.1:0", "/fabric", nil, nil)
+    assert.Nil(t, wsListener)
+    assert.EqualError(t, err, "tls config is nil")
+}
+
+func TestTLSTcpConnectionListener_MutualTLS(t *testing.T) {
+    certs := createTestCertificates(t)
+    listener, err := NewTLSTcpConnectionListener("127.0.0.1:0",
+        NewMutualTLSConfig(certs.serverCert, certs.caPool))
+    assert.Nil(t, err)
+    defer listener.Close()
+
+    addr := listener.(*tcpConnectionListener).listener.Addr().String()
+
+    go func() {
+        clientConn, err := tls.Dial("tcp", addr, certs.clientConfig(true))
+        assert.Nil(t, err)
+        frame.NewWriter(clientConn).Write(frame.New(frame.CONNECT, frame.AcceptVersion, "1.2"))
+    }()
+
+    rawConn, err := listener.Accept()
+    assert.Nil(t, err)
+    f, err := rawConn.ReadFrame()
+    assert.Nil(t, err)
+    verifyFrame(t, f, frame.New(frame.CONNECT, frame.AcceptVersion, "1.2"), true)
+
+    tlsState := rawConn.(TLSRawConnection).TLSConnectionState()
+    assert.NotNil(t, tlsState)
+    assert.Equal(t, "test-client", tlsState.VerifiedChains[0][0].Subject.CommonName)
+    rawConn.Close()
+
+    // clients without a certificate are rejected.
+    go func() {
+        clientConn, err := tls.Dial("tcp", addr, certs.clientConfig(false))
+        if err == nil {
+            frame.NewWriter(clientConn).Write(frame.New(frame.CONNECT, frame.AcceptVersion, "1.2"))
+        }
+    }()
+
+    rawConn, err = listener.Accept()
+    assert.Nil(t, err)
+    _, err = rawConn.ReadFrame()
+    assert.NotNil(t, err)
+}
+
+func TestTcpConnectionListener_PlaintextTLSState(t *testing.T) {
+    serverConn, _ := net.Pipe()
+    rawConn := &tcpStompConnection{tcpCon: serverConn}
+    assert.Nil(t, rawConn.TLSConnectionState())
+}
+
+func TestTLSWebSocketConnectionListener_MutualTLS(t *testing.T) {
+    certs := createTestCertificates(t)
+    listener, err := NewTLSWebSocketConnectionListener("127.0.0.1:0", "/fabric", nil,
+        NewMutualTLSConfig(certs.serverCert, certs.caPool))
+    assert.Nil(t, err)
+    defer listener.Close()
+
+    addr := listener.(*webSocketConnectionListener).tcpConnectionListener.Addr().String()
+
+    dialer := &websocket.Dialer{TLSClientConfig: certs.clientConfig(true)}
+    go func() {
+        clientConn, _, err := dialer.Dial("wss://" + addr + "/fabric", nil)
+        assert.Nil(t, err)
+        assert.NotNil(t, clientConn)
+    }()
+
+    rawConn, err := listener.Accept()
+    assert.Nil(t, err)
+
+    tlsState := rawConn.(TLSRawConnection).TLSConnectionState()
+    assert.NotNil(t, tlsState)
+    assert.Equal(t, "test-client", tlsState.VerifiedChains[0][0].Subject.CommonName)
+
+    // plaintext websocket connections are refused.
+    _, _, err = (&websocket.Dialer{}).Dial("ws://" + addr + "/fabric", nil)
+    assert.NotNil(t, err)
+}
+
+func TestStompServer_GetConnectionTLSState(t *testing.T) {
+    certs := createTestCertificates(t)
+    listener, err := NewTLSTcpConnectionListener("127.0.0.1:0",
+        NewMutualTLSConfig(certs.serverCert, certs.caPool))
+    assert.Nil(t, err)
+    addr := listener.(*tcpConnectionListener).listener.Addr().String()
+
+    server := NewStompServer(listener, NewStompConfig(0, []string{"/pub"}))
+    go server.Start()
+    defer server.Stop()
+
+    conIdChan := make(chan string)
+    server.OnApplicationRequest(func(destination string, message []byte, connectionId string) {
+        conIdChan <- connectionId
+    })
+
+    clientConn, err := tls.Dial("tcp", addr, certs.clientConfig(true))
+    assert.Nil(t, err)
+    defer clientConn.Close()
+
+    wr := frame.NewWriter(clientConn)
+    wr.Write(frame.New(frame.CONNECT, frame.AcceptVersion, "1.2"))
+    sendFrame := frame.New(frame.SEND, frame.Destination, "/pub/channel")
+    sendFrame.Body = []byte("request")
+    wr.Write(sendFrame)
+
+    conId := <-conIdChan
+    tlsState, ok := server.GetConnectionTLSState(conId)
+    assert.True(t, ok)
+    assert.Equal(t, "test-client", tlsState.VerifiedChains[0][0].Subject.CommonName)
+
+    _, ok = server.GetConnectionTLSState("unknown-connection")
+    assert.False(t, ok)
+}
@@ -4,6 +4,8 @@
 package stompserver
 
 import (
+    "crypto/tls"
+    "fmt"
     "github.com/go-stomp/stomp/frame"
     "github.com/gorilla/mux"
     "github.com/gorilla/websocket"
@@ -15,7 +17,8 @@ import (
 )
 
 type webSocketStompConnection struct {
-    wsCon *websocket.Conn
+    wsCon    *websocket.Conn
+    tlsState *tls.ConnectionState
 }
 
 func (c *webSocketStompConnection) ReadFrame() (*frame.Frame, error) {
@@ -50,6 +53,10 @@ func (c *webSocketStompConnection) Close() error {
     return c.wsCon.Close()
 }
 
+func (c *webSocketStompConnection) TLSConnectionState() *tls.ConnectionState {
+    return c.tlsState
+}
+
 type webSocketConnectionListener struct {
     httpServer *http.Server
     requestHandler *http.ServeMux
@@ -88,6 +95,7 @@ func NewWebSocketConnectionFromExistingHttpServer(httpServer *http.Server, handl
             l.connectionsChannel <- rawConnResult{
                 conn: &webSocketStompConnection{
                     wsCon: conn,
+                    tlsState: request.TLS,
                 },
             }
         }
@@ -97,6 +105,23 @@ func NewWebSocketConnectionFromExistingHttpServer(httpServer *http.Server, handl
 }
 
 func NewWebSocketConnectionListener(addr string, endpoint string, allowedOrigins []string) (RawConnectionListener, error) {
+    return newWebSocketConnectionListener(addr, endpoint, allowedOrigins, nil)
+}
+
+// Creates a websocket connection listener which only accepts wss:// connections.
+// Use NewMutualTLSConfig() to create a tlsConfig which also requires and verifies client certificates.
+func NewTLSWebSocketConnectionListener(
+        addr string, endpoint string, allowedOrigins []string, tlsConfig *tls.Config) (RawConnectionListener, error) {
+
+    if tlsConfig == nil {
+        return nil, fmt.Errorf("tls config is nil")
+    }
+    return newWebSocketConnectionListener(addr, endpoint, allowedOrigins, tlsConfig)
+}
+
+func newWebSocketConnectionListener(
+        addr string, endpoint string, allowedOrigins []string, tlsConfig *tls.Config) (RawConnectionListener, error) {
+
     rh := http.NewServeMux()
     l := &webSocketConnectionListener{
         requestHandler: rh,
@@ -125,6 +150,7 @@ func NewWebSocketConnectionListener(addr string, endpoint string, allowedOrigins
             l.connectionsChannel <- rawConnResult{
                 conn: &webSocketStompConnection{
                     wsCon: conn,
+                    tlsState: request.TLS,
                 },
             }
         }
@@ -135,6 +161,10 @@ func NewWebSocketConnectionListener(addr string, endpoint string, allowedOrigins
     if err != nil {
         return nil, err
     }
+    if tlsConfig != nil {
+        l.httpServer.TLSConfig = tlsConfig
+        l.tcpConnectionListener = tls.NewListener(l.tcpConnectionListener, tlsConfig)
+    }
 
     go l.httpServer.Serve(l.tcpConnectionListener)
     return l, nil
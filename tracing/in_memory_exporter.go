@@ -0,0 +1,47 @@
+// Copyright 2019-2020 VMware, Inc.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package tracing
+
+import "sync"
+
+// InMemoryExporter keeps the exported spans in memory, useful in tests.
+type InMemoryExporter struct {
+    lock  sync.Mutex
+    spans []*Span
+}
+
+func NewInMemoryExporter() *InMemoryExporter {
+    return &InMemoryExporter{}
+}
+
+func (e *InMemoryExporter) ExportSpan(span *Span) {
+    e.lock.Lock()
+    defer e.lock.Unlock()
+    e.spans = append(e.spans, span)
+}
+
+// Returns the exported spans in the order they ended.
+func (e *InMemoryExporter) Spans() []*Span {
+    e.lock.Lock()
+    defer e.lock.Unlock()
+    return append([]*Span(nil), e.spans...)
+}
+
+// Returns the exported spans with the given name.
+func (e *InMemoryExporter) SpansByName(name string) []*Span {
+    var result []*Span
+    for _, span := range e.Spans() {
+        if span.Name == name {
+            result = append(result, span)
+        }
+    }
+    return result
+}
+
+// Removes all exported spans.
+func (e *InMemoryExporter) Reset() {
+    e.lock.Lock()
+    defer e.lock.Unlock()
+    e.spans = nil
+}
@@ -0,0 +1,241 @@
+// Copyright 2019-2020 VMware, Inc.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package tracing
+
+import (
+    "crypto/rand"
+    "encoding/hex"
+    "github.com/vmware/transport-go/model"
+    "sync"
+    "time"
+)
+
+// Role of a span in a trace.
+type SpanKind int
+
+const (
+    // Work done inside the process, e.g. a fabric service handling a request
+    InternalSpan SpanKind = iota
+    // A request received from a remote client, e.g. over a fabric endpoint
+    ServerSpan
+    // A request made to a remote server, e.g. an HTTP call of the rest service
+    ClientSpan
+)
+
+func (k SpanKind) String() string {
+    switch k {
+    case ServerSpan:
+        return "server"
+    case ClientSpan:
+        return "client"
+    }
+    return "internal"
+}
+
+// SpanExporter receives the spans once they have ended.
+type SpanExporter interface {
+    ExportSpan(span *Span)
+}
+
+// Adapter which allows the use of ordinary functions as SpanExporter.
+type SpanExporterFunc func(span *Span)
+
+func (f SpanExporterFunc) ExportSpan(span *Span) {
+    f(span)
+}
+
+// Span is a timed operation of a trace.
+type Span struct {
+    Name string
+    Kind SpanKind
+    // Trace context of the span, pass it to the operations started by the span
+    Context *model.TraceContext
+    // Span id of the parent span, empty for the root span of a trace
+    ParentSpanId string
+    StartTime    time.Time
+    EndTime      time.Time
+    Attributes   map[string]string
+    // Error which made the operation fail, if any
+    Error error
+
+    tracer *Tracer
+    lock   sync.Mutex
+    ended  bool
+}
+
+// Sets an attribute of the span, e.g. the channel name or the HTTP method.
+func (s *Span) SetAttribute(key string, value string) {
+    s.lock.Lock()
+    defer s.lock.Unlock()
+    s.Attributes[key] = value
+}
+
+// Marks the span as failed.
+func (s *Span) SetError(err error) {
+    s.lock.Lock()
+    defer s.lock.Unlock()
+    s.Error = err
+}
+
+// Ends the span and passes it to the exporter if the trace is sampled.
+// Calling End more than once has no effect.
+func (s *Span) End() {
+    s.lock.Lock()
+    if s.ended {
+        s.lock.Unlock()
+        return
+    }
+    s.ended = true
+    s.EndTime = time.Now()
+    s.lock.Unlock()
+
+    if s.Context.IsSampled() {
+        if exporter := s.tracer.getExporter(); exporter != nil {
+            exporter.ExportSpan(s)
+        }
+    }
+}
+
+// Makes the span the trace context of the request and adds the traceparent and
+// tracestate headers of the span to the request headers.
+func (s *Span) InjectRequest(request *model.Request) {
+    request.Trace = s.Context
+    if request.Headers == nil {
+        request.Headers = make(map[string]string)
+    }
+    s.Context.InjectHeaders(request.Headers)
+}
+
+// RootSampler decides whether an operation without an incoming trace context starts
+// a new trace, name is the name of the span which would be the root of the trace.
+type RootSampler func(name string) bool
+
+// Starts a new trace for every operation without an incoming trace context.
+func AlwaysSampleRoots(name string) bool {
+    return true
+}
+
+// Tracer creates spans and passes the ended ones to its exporter.
+type Tracer struct {
+    lock        sync.RWMutex
+    exporter    SpanExporter
+    rootSampler RootSampler
+}
+
+// Optional Tracer settings.
+type TracerOption func(tracer *Tracer)
+
+// Start new traces for the operations without an incoming trace context which the
+// sampler samples. By default only incoming traces are continued.
+func WithRootSampler(sampler RootSampler) TracerOption {
+    return func(tracer *Tracer) {
+        tracer.rootSampler = sampler
+    }
+}
+
+// Creates a tracer, spans are dropped if the exporter is nil.
+func NewTracer(exporter SpanExporter, options ...TracerOption) *Tracer {
+    tracer := &Tracer{exporter: exporter}
+    for _, option := range options {
+        option(tracer)
+    }
+    return tracer
+}
+
+var defaultTracer = NewTracer(nil)
+
+// Returns the tracer used by the bus, the fabric endpoint and the fabric services.
+func GetTracer() *Tracer {
+    return defaultTracer
+}
+
+// Sets the exporter of the default tracer.
+func SetExporter(exporter SpanExporter) {
+    defaultTracer.SetExporter(exporter)
+}
+
+// Sets the root sampler of the default tracer.
+func SetRootSampler(sampler RootSampler) {
+    defaultTracer.SetRootSampler(sampler)
+}
+
+// Starts a span of the default tracer.
+func StartSpan(name string, kind SpanKind, parent *model.TraceContext) *Span {
+    return defaultTracer.StartSpan(name, kind, parent)
+}
+
+// Starts a span of the default tracer if the operation is traced, see Tracer.StartTracedSpan.
+func StartTracedSpan(name string, kind SpanKind, parent *model.TraceContext) *Span {
+    return defaultTracer.StartTracedSpan(name, kind, parent)
+}
+
+func (t *Tracer) SetExporter(exporter SpanExporter) {
+    t.lock.Lock()
+    defer t.lock.Unlock()
+    t.exporter = exporter
+}
+
+// Sets the sampler deciding which operations without an incoming trace context start a
+// new trace, nil only continues incoming traces.
+func (t *Tracer) SetRootSampler(sampler RootSampler) {
+    t.lock.Lock()
+    defer t.lock.Unlock()
+    t.rootSampler = sampler
+}
+
+// Starts a child span of parent. If parent is nil the span is the root of a new trace if the
+// root sampler of the tracer samples it, otherwise no span is started and nil is returned.
+func (t *Tracer) StartTracedSpan(name string, kind SpanKind, parent *model.TraceContext) *Span {
+    if parent == nil {
+        t.lock.RLock()
+        sampler := t.rootSampler
+        t.lock.RUnlock()
+        if sampler == nil || !sampler(name) {
+            return nil
+        }
+    }
+    return t.StartSpan(name, kind, parent)
+}
+
+func (t *Tracer) getExporter() SpanExporter {
+    t.lock.RLock()
+    defer t.lock.RUnlock()
+    return t.exporter
+}
+
+// Starts a new span. The span is a child of the parent trace context, or the root
+// span of a new sampled trace if parent is nil.
+func (t *Tracer) StartSpan(name string, kind SpanKind, parent *model.TraceContext) *Span {
+    span := &Span{
+        Name:       name,
+        Kind:       kind,
+        StartTime:  time.Now(),
+        Attributes: make(map[string]string),
+        tracer:     t,
+    }
+    if parent != nil {
+        span.ParentSpanId = parent.SpanId
+        span.Context = &model.TraceContext{
+            TraceId:    parent.TraceId,
+            SpanId:     newId(8),
+            Flags:      parent.Flags,
+            TraceState: parent.TraceState,
+        }
+    } else {
+        span.Context = &model.TraceContext{
+            TraceId: newId(16),
+            SpanId:  newId(8),
+            Flags:   0x01,
+        }
+    }
+    return span
+}
+
+func newId(size int) string {
+    id := make([]byte, size)
+    rand.Read(id)
+    // all zero ids are invalid
+    id[size-1] |= 0x01
+    return hex.EncodeToString(id)
+}
@@ -0,0 +1,122 @@
+// Copyright 2019-2020 VMware, Inc.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package tracing
+
+import (
+    "errors"
+    "github.com/stretchr/testify/assert"
+    "github.com/vmware/transport-go/model"
+    "testing"
+)
+
+func TestTracer_StartSpan(t *testing.T) {
+    exporter := NewInMemoryExporter()
+    tracer := NewTracer(exporter)
+
+    root := tracer.StartSpan("root", ServerSpan, nil)
+    assert.Len(t, root.Context.TraceId, 32)
+    assert.Len(t, root.Context.SpanId, 16)
+    assert.Equal(t, "", root.ParentSpanId)
+    assert.True(t, root.Context.IsSampled())
+
+    child := tracer.StartSpan("child", ClientSpan, root.Context)
+    assert.Equal(t, root.Context.TraceId, child.Context.TraceId)
+    assert.Equal(t, root.Context.SpanId, child.ParentSpanId)
+    assert.NotEqual(t, root.Context.SpanId, child.Context.SpanId)
+
+    child.SetAttribute("http.method", "GET")
+    child.SetError(errors.New("connection refused"))
+    child.End()
+    child.End()
+    root.End()
+
+    spans := exporter.Spans()
+    assert.Len(t, spans, 2)
+    assert.Equal(t, child, spans[0])
+    assert.Equal(t, root, spans[1])
+    assert.Equal(t, "GET", spans[0].Attributes["http.method"])
+    assert.EqualError(t, spans[0].Error, "connection refused")
+    assert.False(t, spans[0].EndTime.Before(spans[0].StartTime))
+    assert.Equal(t, []*Span{root}, exporter.SpansByName("root"))
+
+    exporter.Reset()
+    assert.Len(t, exporter.Spans(), 0)
+}
+
+func TestTracer_NotSampled(t *testing.T) {
+    exporter := NewInMemoryExporter()
+    tracer := NewTracer(exporter)
+
+    parent, err := model.ParseTraceParent("00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-00")
+    assert.Nil(t, err)
+    span := tracer.StartSpan("span", InternalSpan, parent)
+    assert.False(t, span.Context.IsSampled())
+    span.End()
+    assert.Len(t, exporter.Spans(), 0)
+
+    // spans are dropped without an exporter
+    NewTracer(nil).StartSpan("span", InternalSpan, nil).End()
+}
+
+func TestTracer_StartTracedSpan(t *testing.T) {
+    tracer := NewTracer(NewInMemoryExporter())
+    assert.Nil(t, tracer.StartTracedSpan("root", ServerSpan, nil))
+
+    parent, _ := model.ParseTraceParent("00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01")
+    span := tracer.StartTracedSpan("span", ServerSpan, parent)
+    assert.Equal(t, parent.TraceId, span.Context.TraceId)
+
+    tracer = NewTracer(nil, WithRootSampler(func(name string) bool {
+        return name == "sampled"
+    }))
+    assert.Nil(t, tracer.StartTracedSpan("root", ServerSpan, nil))
+    assert.NotNil(t, tracer.StartTracedSpan("sampled", ServerSpan, nil))
+
+    tracer.SetRootSampler(AlwaysSampleRoots)
+    root := tracer.StartTracedSpan("root", ServerSpan, nil)
+    assert.Equal(t, "", root.ParentSpanId)
+
+    request := &model.Request{}
+    root.InjectRequest(request)
+    assert.Equal(t, root.Context, request.Trace)
+    assert.Equal(t, map[string]string{model.TraceParentHeader: root.Context.TraceParent()}, request.Headers)
+}
+
+func TestTraceContext_Headers(t *testing.T) {
+    tc := model.TraceContextFromHeaders([]model.MessageHeader{
+        {Label: "correlation-id", Value: "corr-1"},
+        {Label: "traceparent", Value: "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01"},
+        {Label: "tracestate", Value: "vendor=value"},
+    })
+    assert.Equal(t, &model.TraceContext{
+        TraceId:    "0af7651916cd43dd8448eb211c80319c",
+        SpanId:     "b7ad6b7169203331",
+        Flags:      0x01,
+        TraceState: "vendor=value",
+    }, tc)
+
+    headers := map[string]string{"tracestate": "stale"}
+    tc.TraceState = ""
+    tc.InjectHeaders(headers)
+    assert.Equal(t, map[string]string{
+        "traceparent": "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01"}, headers)
+
+    assert.Nil(t, model.TraceContextFromHeaders(nil))
+    assert.Nil(t, model.TraceContextFromHeaders([]model.MessageHeader{{Label: "traceparent", Value: "invalid"}}))
+
+    for _, invalid := range []string{
+        "00-00000000000000000000000000000000-b7ad6b7169203331-01",
+        "00-0af7651916cd43dd8448eb211c80319c-0000000000000000-01",
+        "00-0AF7651916CD43DD8448EB211C80319C-b7ad6b7169203331-01",
+        "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01-extra",
+        "ff-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01",
+        "00-0af7651916cd43dd8448eb211c80319c-b7ad6b716920333-01",
+    } {
+        _, err := model.ParseTraceParent(invalid)
+        assert.NotNil(t, err, invalid)
+    }
+    // future versions can have additional fields
+    _, err := model.ParseTraceParent("01-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01-extra")
+    assert.Nil(t, err)
+}
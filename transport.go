@@ -4,6 +4,8 @@
 package main
 
 import (
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
 	"fmt"
 	"github.com/google/uuid"
@@ -13,6 +15,7 @@ import (
 	"github.com/vmware/transport-go/model"
 	"github.com/vmware/transport-go/service"
 	"github.com/vmware/transport-go/stompserver"
+	"io/ioutil"
 	"log"
 	"math/rand"
 	"os"
@@ -75,6 +78,23 @@ func main() {
 					Name:  "tcp",
 					Usage: "Use TCP connection ",
 				},
+				&cli.StringFlag{
+					Name:  "store-dir",
+					Value: "transport-stores",
+					Usage: "Directory used to persist the service stores",
+				},
+				&cli.StringFlag{
+					Name:  "tls-cert",
+					Usage: "PEM encoded server certificate, enables TLS together with --tls-key",
+				},
+				&cli.StringFlag{
+					Name:  "tls-key",
+					Usage: "PEM encoded private key of the server certificate",
+				},
+				&cli.StringFlag{
+					Name:  "tls-client-ca",
+					Usage: "PEM encoded CA certificates used to verify client certificates, enables mutual TLS",
+				},
 			},
 			Action: func(c *cli.Context) error {
 				runLocalFabricBroker(c)
@@ -674,18 +694,40 @@ func runLocalFabricBroker(c *cli.Context) {
 	service.GetServiceRegistry().RegisterService(&vmService{}, VmServiceChan)
 	service.GetServiceRegistry().RegisterService(&vmwCloudServiceService{}, VMWCloudServiceChan)
 
+	var storeOptions []bus.StoreOption
+	storePersistence, err := bus.NewFileStorePersistence(c.String("store-dir"), 0)
+	if err != nil {
+		log.Println("unable to persist stores:", err)
+	} else {
+		defer storePersistence.Close()
+		storeOptions = append(storeOptions, bus.WithStorePersistence(storePersistence))
+	}
+
 	store := bus.GetBus().GetStoreManager().CreateStoreWithType(
-		"messageOfTheDayStore", reflect.TypeOf(&SampleMessageItem{}))
-	store.Populate(map[string]interface{}{
-		"messageOfTheDay": &SampleMessageItem{
-			From:    "golang message broker",
-			Message: "default message",
-		},
-	})
+		"messageOfTheDayStore", reflect.TypeOf(&SampleMessageItem{}), storeOptions...)
+	// populate the store only if it wasn't restored from a previous run
+	if len(store.AllValues()) == 0 {
+		store.Populate(map[string]interface{}{
+			"messageOfTheDay": &SampleMessageItem{
+				From:    "golang message broker",
+				Message: "default message",
+			},
+		})
+	}
 
-	var err error
 	var connectionListener stompserver.RawConnectionListener
-	if c.Bool("tcp") {
+	tlsConfig, err := loadServerTLSConfig(c)
+	if err != nil {
+		fmt.Println("Failed to load TLS configuration", err)
+		return
+	}
+	if tlsConfig != nil {
+		if c.Bool("tcp") {
+			connectionListener, err = stompserver.NewTLSTcpConnectionListener(addr, tlsConfig)
+		} else {
+			connectionListener, err = stompserver.NewTLSWebSocketConnectionListener(addr, "/fabric", nil, tlsConfig)
+		}
+	} else if c.Bool("tcp") {
 		connectionListener, err = stompserver.NewTcpConnectionListener(addr)
 	} else {
 		connectionListener, err = stompserver.NewWebSocketConnectionListener(addr, "/fabric", nil)
@@ -705,3 +747,26 @@ func runLocalFabricBroker(c *cli.Context) {
 		fmt.Println("Failed to start local fabric broker", err)
 	}
 }
+
+// loads the server TLS configuration from the service command flags, returns nil if TLS is not configured.
+func loadServerTLSConfig(c *cli.Context) (*tls.Config, error) {
+	if c.String("tls-cert") == "" && c.String("tls-key") == "" {
+		return nil, nil
+	}
+	serverCert, err := tls.LoadX509KeyPair(c.String("tls-cert"), c.String("tls-key"))
+	if err != nil {
+		return nil, err
+	}
+	if c.String("tls-client-ca") == "" {
+		return &tls.Config{Certificates: []tls.Certificate{serverCert}, MinVersion: tls.VersionTLS12}, nil
+	}
+	caPEM, err := ioutil.ReadFile(c.String("tls-client-ca"))
+	if err != nil {
+		return nil, err
+	}
+	clientCAs := x509.NewCertPool()
+	if !clientCAs.AppendCertsFromPEM(caPEM) {
+		return nil, fmt.Errorf("no certificates found in %s", c.String("tls-client-ca"))
+	}
+	return stompserver.NewMutualTLSConfig(serverCert, clientCAs), nil
+}
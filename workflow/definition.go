@@ -0,0 +1,144 @@
+// Copyright 2019-2020 VMware, Inc.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package workflow
+
+import (
+    "fmt"
+    "time"
+)
+
+// Step is a single request of a workflow, sent to a bus channel (usually a fabric service).
+type Step struct {
+    // Unique name of the step within the workflow.
+    Name string
+    // Channel the request is sent to.
+    Channel string
+    // Request payload, ignored if PayloadFunc is set.
+    Payload interface{}
+    // Optional function which builds the request payload from the workflow input
+    // and the responses of the completed steps.
+    PayloadFunc func(state *State) interface{}
+    // Names of the steps which must be completed or skipped before this step runs.
+    DependsOn []string
+    // Optional condition evaluated when the dependencies are done, the step is
+    // skipped if it returns false.
+    Condition func(state *State) bool
+    // Optional retry policy, the step is attempted only once if nil.
+    Retry *RetryPolicy
+    // Time to wait for the response to a single attempt, DefaultStepTimeout if zero.
+    Timeout time.Duration
+}
+
+// RetryPolicy configures how often a failed step is attempted again.
+type RetryPolicy struct {
+    // Maximum number of attempts, including the first one.
+    MaxAttempts int
+    // Delay before the first retry, doubled after each failed attempt.
+    Backoff time.Duration
+    // Upper limit of the delay between attempts, the delay is not limited if zero.
+    MaxBackoff time.Duration
+}
+
+// Default time to wait for the response to a step request.
+const DefaultStepTimeout = 30 * time.Second
+
+func (s *Step) maxAttempts() int {
+    if s.Retry == nil || s.Retry.MaxAttempts < 1 {
+        return 1
+    }
+    return s.Retry.MaxAttempts
+}
+
+// Returns the delay before the next attempt after the given number of failed attempts.
+func (s *Step) backoff(attempts int) time.Duration {
+    if s.Retry == nil || s.Retry.Backoff <= 0 {
+        return 0
+    }
+    delay := s.Retry.Backoff
+    for i := 1; i < attempts; i++ {
+        delay *= 2
+        if s.Retry.MaxBackoff > 0 && delay >= s.Retry.MaxBackoff {
+            return s.Retry.MaxBackoff
+        }
+    }
+    return delay
+}
+
+func (s *Step) timeout() time.Duration {
+    if s.Timeout <= 0 {
+        return DefaultStepTimeout
+    }
+    return s.Timeout
+}
+
+// Definition describes a workflow as a directed acyclic graph of steps.
+type Definition struct {
+    // Unique name of the workflow, used to find the definition of a persisted workflow on resume.
+    Name  string
+    Steps []*Step
+}
+
+// Checks that the step names are unique, that all dependencies exist and that
+// the dependencies have no cycles.
+func (d *Definition) Validate() error {
+    if d.Name == "" {
+        return fmt.Errorf("workflow name is empty")
+    }
+    if len(d.Steps) == 0 {
+        return fmt.Errorf("workflow '%s' has no steps", d.Name)
+    }
+
+    steps := make(map[string]*Step, len(d.Steps))
+    for _, step := range d.Steps {
+        if step.Name == "" {
+            return fmt.Errorf("workflow '%s' has a step without name", d.Name)
+        }
+        if step.Channel == "" {
+            return fmt.Errorf("step '%s' of workflow '%s' has no channel", step.Name, d.Name)
+        }
+        if steps[step.Name] != nil {
+            return fmt.Errorf("workflow '%s' has duplicate step '%s'", d.Name, step.Name)
+        }
+        steps[step.Name] = step
+    }
+
+    for _, step := range d.Steps {
+        for _, dep := range step.DependsOn {
+            if steps[dep] == nil {
+                return fmt.Errorf("step '%s' of workflow '%s' depends on unknown step '%s'",
+                    step.Name, d.Name, dep)
+            }
+        }
+    }
+
+    // depth-first search for cycles, visiting steps are on the current path.
+    const (
+        visiting = 1
+        visited  = 2
+    )
+    marks := make(map[string]int, len(d.Steps))
+    var visit func(step *Step) error
+    visit = func(step *Step) error {
+        switch marks[step.Name] {
+        case visiting:
+            return fmt.Errorf("workflow '%s' has a dependency cycle at step '%s'", d.Name, step.Name)
+        case visited:
+            return nil
+        }
+        marks[step.Name] = visiting
+        for _, dep := range step.DependsOn {
+            if err := visit(steps[dep]); err != nil {
+                return err
+            }
+        }
+        marks[step.Name] = visited
+        return nil
+    }
+    for _, step := range d.Steps {
+        if err := visit(step); err != nil {
+            return err
+        }
+    }
+    return nil
+}
@@ -0,0 +1,62 @@
+// Copyright 2019-2020 VMware, Inc.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package workflow
+
+import (
+    "github.com/stretchr/testify/assert"
+    "testing"
+    "time"
+)
+
+func TestDefinition_Validate(t *testing.T) {
+    valid := &Definition{
+        Name: "provision",
+        Steps: []*Step{
+            {Name: "network", Channel: "network-service"},
+            {Name: "vm", Channel: "vm-service", DependsOn: []string{"network"}},
+            {Name: "dns", Channel: "dns-service", DependsOn: []string{"network", "vm"}},
+        },
+    }
+    assert.Nil(t, valid.Validate())
+
+    assert.EqualError(t, (&Definition{}).Validate(), "workflow name is empty")
+    assert.EqualError(t, (&Definition{Name: "empty"}).Validate(), "workflow 'empty' has no steps")
+
+    assert.EqualError(t, (&Definition{Name: "wf", Steps: []*Step{
+        {Channel: "channel"},
+    }}).Validate(), "workflow 'wf' has a step without name")
+
+    assert.EqualError(t, (&Definition{Name: "wf", Steps: []*Step{
+        {Name: "a"},
+    }}).Validate(), "step 'a' of workflow 'wf' has no channel")
+
+    assert.EqualError(t, (&Definition{Name: "wf", Steps: []*Step{
+        {Name: "a", Channel: "channel"},
+        {Name: "a", Channel: "channel"},
+    }}).Validate(), "workflow 'wf' has duplicate step 'a'")
+
+    assert.EqualError(t, (&Definition{Name: "wf", Steps: []*Step{
+        {Name: "a", Channel: "channel", DependsOn: []string{"b"}},
+    }}).Validate(), "step 'a' of workflow 'wf' depends on unknown step 'b'")
+
+    assert.EqualError(t, (&Definition{Name: "wf", Steps: []*Step{
+        {Name: "a", Channel: "channel", DependsOn: []string{"c"}},
+        {Name: "b", Channel: "channel", DependsOn: []string{"a"}},
+        {Name: "c", Channel: "channel", DependsOn: []string{"b"}},
+    }}).Validate(), "workflow 'wf' has a dependency cycle at step 'a'")
+}
+
+func TestStep_Backoff(t *testing.T) {
+    step := &Step{Name: "a", Channel: "channel"}
+    assert.Equal(t, 1, step.maxAttempts())
+    assert.Equal(t, time.Duration(0), step.backoff(1))
+    assert.Equal(t, DefaultStepTimeout, step.timeout())
+
+    step.Retry = &RetryPolicy{MaxAttempts: 5, Backoff: 10 * time.Millisecond, MaxBackoff: 50 * time.Millisecond}
+    assert.Equal(t, 5, step.maxAttempts())
+    assert.Equal(t, 10*time.Millisecond, step.backoff(1))
+    assert.Equal(t, 20*time.Millisecond, step.backoff(2))
+    assert.Equal(t, 40*time.Millisecond, step.backoff(3))
+    assert.Equal(t, 50*time.Millisecond, step.backoff(4))
+}
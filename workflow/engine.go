@@ -0,0 +1,457 @@
+// Copyright 2019-2020 VMware, Inc.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package workflow
+
+import (
+    "context"
+    "fmt"
+    "github.com/google/uuid"
+    "github.com/vmware/transport-go/bus"
+    "github.com/vmware/transport-go/model"
+    "reflect"
+    "sync"
+    "time"
+)
+
+const (
+    // Name of the store the workflow states are persisted in unless WithStore is used.
+    DefaultStoreName = "transport-workflows"
+    // Channel the progress events are sent on unless WithProgressChannel is used.
+    DefaultProgressChannel = "transport-workflow-progress"
+)
+
+// Type of a workflow progress event.
+type EventType string
+
+const (
+    WorkflowStartedEvt   EventType = "workflow-started"
+    WorkflowResumedEvt   EventType = "workflow-resumed"
+    WorkflowCompletedEvt EventType = "workflow-completed"
+    WorkflowFailedEvt    EventType = "workflow-failed"
+    StepStartedEvt       EventType = "step-started"
+    StepRetryingEvt      EventType = "step-retrying"
+    StepCompletedEvt     EventType = "step-completed"
+    StepSkippedEvt       EventType = "step-skipped"
+    StepFailedEvt        EventType = "step-failed"
+)
+
+// Event is sent as a response message on the progress channel for every
+// state change of a workflow.
+type Event struct {
+    Type       EventType
+    WorkflowId string
+    Workflow   string
+    Step       string `json:",omitempty"`
+    // Number of the attempt, set for the step events.
+    Attempt    int    `json:",omitempty"`
+    Error      string `json:",omitempty"`
+}
+
+type EngineOption func(engine *Engine)
+
+// Persist the workflow states in the store, e.g. a store created with bus.WithStorePersistence
+// to resume the workflows after a restart.
+func WithStore(store bus.BusStore) EngineOption {
+    return func(engine *Engine) {
+        engine.store = store
+    }
+}
+
+// Send the progress events on the channel instead of DefaultProgressChannel.
+func WithProgressChannel(channelName string) EngineOption {
+    return func(engine *Engine) {
+        engine.progressChannel = channelName
+    }
+}
+
+// Engine runs workflows. Steps are started as soon as all their dependencies are
+// completed or skipped, independent steps run concurrently.
+type Engine struct {
+    bus             bus.EventBus
+    store           bus.BusStore
+    progressChannel string
+    lock            sync.Mutex
+    definitions     map[string]*Definition
+    executions      map[string]*execution
+}
+
+// Creates a workflow engine which sends the step requests on the bus.
+func NewEngine(eventBus bus.EventBus, options ...EngineOption) *Engine {
+    engine := &Engine{
+        bus:             eventBus,
+        progressChannel: DefaultProgressChannel,
+        definitions:     make(map[string]*Definition),
+        executions:      make(map[string]*execution),
+    }
+    for _, option := range options {
+        option(engine)
+    }
+    if engine.store == nil {
+        engine.store = eventBus.GetStoreManager().CreateStoreWithType(DefaultStoreName, reflect.TypeOf(&State{}))
+    }
+    eventBus.GetChannelManager().CreateChannel(engine.progressChannel, bus.WithOrderedDelivery())
+    return engine
+}
+
+// Registers a workflow definition, workflows can only be started or resumed
+// if their definition is registered.
+func (e *Engine) Register(definition *Definition) error {
+    if err := definition.Validate(); err != nil {
+        return err
+    }
+
+    e.lock.Lock()
+    defer e.lock.Unlock()
+    if e.definitions[definition.Name] != nil {
+        return fmt.Errorf("workflow '%s' is already registered", definition.Name)
+    }
+    e.definitions[definition.Name] = definition
+    return nil
+}
+
+// Starts a new instance of the registered workflow and returns its id.
+func (e *Engine) Start(workflowName string, input interface{}) (string, error) {
+    e.lock.Lock()
+    definition := e.definitions[workflowName]
+    e.lock.Unlock()
+    if definition == nil {
+        return "", fmt.Errorf("workflow '%s' is not registered", workflowName)
+    }
+
+    now := time.Now()
+    state := &State{
+        Id:       uuid.New().String(),
+        Workflow: workflowName,
+        Status:   StatusRunning,
+        Input:    input,
+        Steps:    make(map[string]*StepState, len(definition.Steps)),
+        Created:  now,
+        Updated:  now,
+    }
+    for _, step := range definition.Steps {
+        state.Steps[step.Name] = &StepState{Status: StatusPending}
+    }
+
+    e.run(definition, state, WorkflowStartedEvt)
+    return state.Id, nil
+}
+
+// Resumes the running workflows of the store, e.g. after a restart. Steps which were
+// interrupted are sent again, so the services should handle repeated requests.
+// Workflows whose definition is not registered are not resumed and reported in the error.
+func (e *Engine) Resume() error {
+    var missing []string
+    for _, value := range e.store.AllValues() {
+        state, err := toState(value)
+        if err != nil || state.IsDone() {
+            continue
+        }
+
+        e.lock.Lock()
+        definition := e.definitions[state.Workflow]
+        _, active := e.executions[state.Id]
+        e.lock.Unlock()
+        if active {
+            continue
+        }
+        if definition == nil {
+            missing = append(missing, state.Id)
+            continue
+        }
+
+        for _, step := range definition.Steps {
+            stepState, ok := state.Steps[step.Name]
+            if !ok {
+                stepState = &StepState{Status: StatusPending}
+                state.Steps[step.Name] = stepState
+            }
+            if stepState.Status == StatusRunning {
+                // the interrupted attempt is made again.
+                stepState.Status = StatusPending
+                if stepState.Attempts > 0 {
+                    stepState.Attempts--
+                }
+            }
+        }
+        e.run(definition, state, WorkflowResumedEvt)
+    }
+
+    if len(missing) > 0 {
+        return fmt.Errorf("cannot resume workflows %v, their definitions are not registered", missing)
+    }
+    return nil
+}
+
+// Returns a copy of the current state of the workflow.
+func (e *Engine) GetState(workflowId string) (*State, bool) {
+    value, ok := e.store.Get(workflowId)
+    if !ok {
+        return nil, false
+    }
+    state, err := toState(value)
+    if err != nil {
+        return nil, false
+    }
+    return state, true
+}
+
+// Blocks until the workflow is completed or failed, or the context is done.
+func (e *Engine) Wait(ctx context.Context, workflowId string) (*State, error) {
+    e.lock.Lock()
+    ex := e.executions[workflowId]
+    e.lock.Unlock()
+
+    if ex != nil {
+        select {
+        case <-ex.done:
+        case <-ctx.Done():
+            return nil, ctx.Err()
+        }
+    }
+
+    state, ok := e.GetState(workflowId)
+    if !ok {
+        return nil, fmt.Errorf("unknown workflow '%s'", workflowId)
+    }
+    return state, nil
+}
+
+func (e *Engine) run(definition *Definition, state *State, eventType EventType) {
+    ex := &execution{
+        engine:     e,
+        definition: definition,
+        state:      state,
+        done:       make(chan struct{}),
+    }
+
+    e.lock.Lock()
+    e.executions[state.Id] = ex
+    e.lock.Unlock()
+
+    ex.lock.Lock()
+    ex.persist()
+    ex.sendEvent(&Event{Type: eventType})
+    ex.lock.Unlock()
+
+    ex.schedule()
+}
+
+func (e *Engine) finish(ex *execution) {
+    e.lock.Lock()
+    delete(e.executions, ex.state.Id)
+    e.lock.Unlock()
+    close(ex.done)
+}
+
+// Values of untyped stores or restored from a persistence are converted to *State.
+func toState(value interface{}) (*State, error) {
+    switch state := value.(type) {
+    case *State:
+        return state, nil
+    case State:
+        return &state, nil
+    }
+    converted, err := model.ConvertValueToType(value, reflect.TypeOf(&State{}))
+    if err != nil {
+        return nil, err
+    }
+    return converted.(*State), nil
+}
+
+// execution is a running workflow instance.
+type execution struct {
+    engine     *Engine
+    definition *Definition
+    lock       sync.Mutex
+    state      *State
+    done       chan struct{}
+}
+
+// Starts the pending steps whose dependencies are done and completes the workflow
+// when all steps are done.
+func (ex *execution) schedule() {
+    ex.lock.Lock()
+    if ex.state.Status != StatusRunning {
+        ex.lock.Unlock()
+        return
+    }
+
+    var ready []*Step
+    allDone := true
+    for _, step := range ex.definition.Steps {
+        stepState := ex.state.Steps[step.Name]
+        if stepState.Status != StatusCompleted && stepState.Status != StatusSkipped {
+            allDone = false
+        }
+        if stepState.Status == StatusPending && ex.dependenciesDone(step) {
+            stepState.Status = StatusRunning
+            ready = append(ready, step)
+        }
+    }
+
+    if allDone {
+        ex.state.Status = StatusCompleted
+        ex.persist()
+        ex.sendEvent(&Event{Type: WorkflowCompletedEvt})
+    } else if len(ready) > 0 {
+        ex.persist()
+    }
+    ex.lock.Unlock()
+
+    if allDone {
+        ex.engine.finish(ex)
+        return
+    }
+    for _, step := range ready {
+        go ex.runStep(step)
+    }
+}
+
+// The caller must hold the lock.
+func (ex *execution) dependenciesDone(step *Step) bool {
+    for _, dep := range step.DependsOn {
+        status := ex.state.Steps[dep].Status
+        if status != StatusCompleted && status != StatusSkipped {
+            return false
+        }
+    }
+    return true
+}
+
+func (ex *execution) runStep(step *Step) {
+    if step.Condition != nil && !step.Condition(ex.snapshot()) {
+        ex.lock.Lock()
+        ex.state.Steps[step.Name].Status = StatusSkipped
+        ex.persist()
+        ex.sendEvent(&Event{Type: StepSkippedEvt, Step: step.Name})
+        ex.lock.Unlock()
+        ex.schedule()
+        return
+    }
+
+    for {
+        attempt, ok := ex.startAttempt(step)
+        if !ok {
+            return
+        }
+
+        response, err := ex.sendRequest(step)
+        if err == nil {
+            ex.completeStep(step, attempt, response)
+            ex.schedule()
+            return
+        }
+
+        if attempt >= step.maxAttempts() {
+            ex.failStep(step, attempt, err)
+            return
+        }
+        ex.lock.Lock()
+        ex.state.Steps[step.Name].Error = err.Error()
+        ex.persist()
+        ex.sendEvent(&Event{Type: StepRetryingEvt, Step: step.Name, Attempt: attempt, Error: err.Error()})
+        ex.lock.Unlock()
+
+        time.Sleep(step.backoff(attempt))
+    }
+}
+
+// Records a new attempt of the step, returns false if the workflow failed in the meantime.
+func (ex *execution) startAttempt(step *Step) (int, bool) {
+    ex.lock.Lock()
+    defer ex.lock.Unlock()
+
+    if ex.state.Status != StatusRunning {
+        return 0, false
+    }
+    stepState := ex.state.Steps[step.Name]
+    stepState.Attempts++
+    ex.persist()
+    ex.sendEvent(&Event{Type: StepStartedEvt, Step: step.Name, Attempt: stepState.Attempts})
+    return stepState.Attempts, true
+}
+
+// Sends the step request and waits for the response. Error responses of fabric
+// services are returned as errors.
+func (ex *execution) sendRequest(step *Step) (interface{}, error) {
+    payload := step.Payload
+    if step.PayloadFunc != nil {
+        payload = step.PayloadFunc(ex.snapshot())
+    }
+
+    ctx, cancel := context.WithTimeout(context.Background(), step.timeout())
+    defer cancel()
+    reqId := uuid.New()
+    message, err := ex.engine.bus.RequestOnceForDestinationWithContext(ctx, step.Channel, payload, &reqId)
+    if err != nil {
+        return nil, err
+    }
+
+    switch response := message.Payload.(type) {
+    case *model.Response:
+        return responsePayload(response)
+    case model.Response:
+        return responsePayload(&response)
+    }
+    return message.Payload, nil
+}
+
+func responsePayload(response *model.Response) (interface{}, error) {
+    if response.Error {
+        return nil, fmt.Errorf("%s (error code %d)", response.ErrorMessage, response.ErrorCode)
+    }
+    return response.Payload, nil
+}
+
+func (ex *execution) completeStep(step *Step, attempt int, response interface{}) {
+    ex.lock.Lock()
+    defer ex.lock.Unlock()
+
+    stepState := ex.state.Steps[step.Name]
+    stepState.Status = StatusCompleted
+    stepState.Response = response
+    stepState.Error = ""
+    ex.persist()
+    ex.sendEvent(&Event{Type: StepCompletedEvt, Step: step.Name, Attempt: attempt})
+}
+
+// Fails the step and the workflow, the steps which are still running are not retried.
+func (ex *execution) failStep(step *Step, attempt int, err error) {
+    ex.lock.Lock()
+    stepState := ex.state.Steps[step.Name]
+    stepState.Status = StatusFailed
+    stepState.Error = err.Error()
+    if ex.state.Status != StatusRunning {
+        ex.persist()
+        ex.lock.Unlock()
+        return
+    }
+    ex.state.Status = StatusFailed
+    ex.state.Error = fmt.Sprintf("step '%s' failed: %s", step.Name, err.Error())
+    ex.persist()
+    ex.sendEvent(&Event{Type: StepFailedEvt, Step: step.Name, Attempt: attempt, Error: err.Error()})
+    ex.sendEvent(&Event{Type: WorkflowFailedEvt, Error: ex.state.Error})
+    ex.lock.Unlock()
+
+    ex.engine.finish(ex)
+}
+
+func (ex *execution) snapshot() *State {
+    ex.lock.Lock()
+    defer ex.lock.Unlock()
+    return ex.state.copy()
+}
+
+// Saves a copy of the state in the store, the caller must hold the lock.
+func (ex *execution) persist() {
+    ex.state.Updated = time.Now()
+    ex.engine.store.Put(ex.state.Id, ex.state.copy(), ex.state.Status)
+}
+
+// The caller must hold the lock.
+func (ex *execution) sendEvent(event *Event) {
+    event.WorkflowId = ex.state.Id
+    event.Workflow = ex.state.Workflow
+    ex.engine.bus.SendResponseMessage(ex.engine.progressChannel, event, nil)
+}
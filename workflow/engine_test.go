@@ -0,0 +1,299 @@
+// Copyright 2019-2020 VMware, Inc.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package workflow
+
+import (
+    "context"
+    "errors"
+    "github.com/stretchr/testify/assert"
+    "github.com/vmware/transport-go/bus"
+    "github.com/vmware/transport-go/model"
+    "io/ioutil"
+    "os"
+    "reflect"
+    "sync"
+    "testing"
+    "time"
+)
+
+// responds to the requests on the channel, or sends an error if the respond function returns one.
+func respondToRequests(eventBus bus.EventBus, channel string, respond func(payload interface{}) (interface{}, error)) {
+    eventBus.GetChannelManager().CreateChannel(channel)
+    mh, _ := eventBus.ListenRequestStream(channel)
+    mh.Handle(func(message *model.Message) {
+        response, err := respond(message.Payload)
+        if err != nil {
+            eventBus.SendErrorMessage(channel, err, message.DestinationId)
+        } else {
+            eventBus.SendResponseMessage(channel, response, message.DestinationId)
+        }
+    }, func(e error) {})
+}
+
+func waitForWorkflow(t *testing.T, engine *Engine, id string) *State {
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+    state, err := engine.Wait(ctx, id)
+    assert.Nil(t, err)
+    return state
+}
+
+type eventRecorder struct {
+    lock   sync.Mutex
+    events []*Event
+}
+
+func recordEvents(eventBus bus.EventBus, channel string) *eventRecorder {
+    recorder := &eventRecorder{}
+    mh, _ := eventBus.ListenStream(channel)
+    mh.Handle(func(message *model.Message) {
+        recorder.lock.Lock()
+        defer recorder.lock.Unlock()
+        recorder.events = append(recorder.events, message.Payload.(*Event))
+    }, func(e error) {})
+    return recorder
+}
+
+// Waits until the event of the type arrived and returns the types of all recorded events.
+func (r *eventRecorder) waitFor(eventType EventType) []EventType {
+    deadline := time.Now().Add(5 * time.Second)
+    for time.Now().Before(deadline) {
+        r.lock.Lock()
+        var types []EventType
+        found := false
+        for _, event := range r.events {
+            types = append(types, event.Type)
+            found = found || event.Type == eventType
+        }
+        r.lock.Unlock()
+        if found {
+            return types
+        }
+        time.Sleep(time.Millisecond)
+    }
+    return nil
+}
+
+func TestEngine_RunsStepsInDependencyOrder(t *testing.T) {
+    eventBus := bus.NewEventBusInstance()
+    engine := NewEngine(eventBus)
+    events := recordEvents(eventBus, DefaultProgressChannel)
+
+    var lock sync.Mutex
+    var calls []string
+    record := func(name string) func(payload interface{}) (interface{}, error) {
+        return func(payload interface{}) (interface{}, error) {
+            lock.Lock()
+            defer lock.Unlock()
+            calls = append(calls, name)
+            return name + ":" + payload.(string), nil
+        }
+    }
+    respondToRequests(eventBus, "network-service", record("network"))
+    respondToRequests(eventBus, "vm-service", record("vm"))
+    respondToRequests(eventBus, "storage-service", record("storage"))
+    respondToRequests(eventBus, "dns-service", record("dns"))
+
+    assert.Nil(t, engine.Register(&Definition{
+        Name: "provision",
+        Steps: []*Step{
+            {Name: "dns", Channel: "dns-service", DependsOn: []string{"vm", "storage"},
+                PayloadFunc: func(state *State) interface{} {
+                    return state.Response("vm").(string)
+                }},
+            {Name: "vm", Channel: "vm-service", DependsOn: []string{"network"},
+                PayloadFunc: func(state *State) interface{} {
+                    return state.Input.(string)
+                }},
+            {Name: "storage", Channel: "storage-service", DependsOn: []string{"network"}, Payload: "disk"},
+            {Name: "network", Channel: "network-service", Payload: "net"},
+        },
+    }))
+    assert.EqualError(t, engine.Register(&Definition{
+        Name: "provision", Steps: []*Step{{Name: "a", Channel: "a"}},
+    }), "workflow 'provision' is already registered")
+
+    _, err := engine.Start("unknown", nil)
+    assert.EqualError(t, err, "workflow 'unknown' is not registered")
+
+    id, err := engine.Start("provision", "vm-1")
+    assert.Nil(t, err)
+
+    state := waitForWorkflow(t, engine, id)
+    assert.Equal(t, StatusCompleted, state.Status)
+    assert.Equal(t, "provision", state.Workflow)
+    assert.Equal(t, "network:net", state.Response("network"))
+    assert.Equal(t, "vm:vm-1", state.Response("vm"))
+    assert.Equal(t, "storage:disk", state.Response("storage"))
+    assert.Equal(t, "dns:vm:vm-1", state.Response("dns"))
+    for _, step := range state.Steps {
+        assert.Equal(t, 1, step.Attempts)
+    }
+
+    lock.Lock()
+    assert.Len(t, calls, 4)
+    assert.Equal(t, "network", calls[0])
+    assert.Equal(t, "dns", calls[3])
+    lock.Unlock()
+
+    types := events.waitFor(WorkflowCompletedEvt)
+    assert.Equal(t, WorkflowStartedEvt, types[0])
+    assert.Equal(t, WorkflowCompletedEvt, types[len(types)-1])
+    assert.Len(t, types, 10)
+}
+
+func TestEngine_ConditionalSteps(t *testing.T) {
+    eventBus := bus.NewEventBusInstance()
+    engine := NewEngine(eventBus)
+
+    respondToRequests(eventBus, "quota-service", func(payload interface{}) (interface{}, error) {
+        return "exceeded", nil
+    })
+    respondToRequests(eventBus, "create-service", func(payload interface{}) (interface{}, error) {
+        assert.Fail(t, "the create step should be skipped")
+        return nil, nil
+    })
+    respondToRequests(eventBus, "notify-service", func(payload interface{}) (interface{}, error) {
+        return "notified", nil
+    })
+
+    quotaAvailable := func(state *State) bool {
+        return state.Response("quota") == "available"
+    }
+    engine.Register(&Definition{
+        Name: "create",
+        Steps: []*Step{
+            {Name: "quota", Channel: "quota-service"},
+            {Name: "create", Channel: "create-service", DependsOn: []string{"quota"}, Condition: quotaAvailable},
+            {Name: "notify", Channel: "notify-service", DependsOn: []string{"create"}},
+        },
+    })
+
+    id, _ := engine.Start("create", nil)
+    state := waitForWorkflow(t, engine, id)
+    assert.Equal(t, StatusCompleted, state.Status)
+    assert.Equal(t, StatusSkipped, state.Steps["create"].Status)
+    assert.Equal(t, 0, state.Steps["create"].Attempts)
+    assert.Nil(t, state.Response("create"))
+    assert.Equal(t, "notified", state.Response("notify"))
+}
+
+func TestEngine_Retries(t *testing.T) {
+    eventBus := bus.NewEventBusInstance()
+    engine := NewEngine(eventBus, WithProgressChannel("provisioning-progress"))
+    events := recordEvents(eventBus, "provisioning-progress")
+
+    var flakyCalls, failingCalls int
+    respondToRequests(eventBus, "flaky-service", func(payload interface{}) (interface{}, error) {
+        flakyCalls++
+        if flakyCalls < 3 {
+            return nil, errors.New("unavailable")
+        }
+        return "ok", nil
+    })
+    respondToRequests(eventBus, "failing-service", func(payload interface{}) (interface{}, error) {
+        failingCalls++
+        return &model.Response{Error: true, ErrorCode: 500, ErrorMessage: "broken"}, nil
+    })
+    respondToRequests(eventBus, "never-called", func(payload interface{}) (interface{}, error) {
+        assert.Fail(t, "the step depends on a failed step")
+        return nil, nil
+    })
+
+    retry := &RetryPolicy{MaxAttempts: 3, Backoff: time.Millisecond}
+    engine.Register(&Definition{
+        Name: "flaky",
+        Steps: []*Step{{Name: "flaky", Channel: "flaky-service", Retry: retry}},
+    })
+    engine.Register(&Definition{
+        Name: "failing",
+        Steps: []*Step{
+            {Name: "failing", Channel: "failing-service", Retry: &RetryPolicy{MaxAttempts: 2}},
+            {Name: "next", Channel: "never-called", DependsOn: []string{"failing"}},
+        },
+    })
+
+    id, _ := engine.Start("flaky", nil)
+    state := waitForWorkflow(t, engine, id)
+    assert.Equal(t, StatusCompleted, state.Status)
+    assert.Equal(t, 3, state.Steps["flaky"].Attempts)
+    assert.Equal(t, "", state.Steps["flaky"].Error)
+
+    id, _ = engine.Start("failing", nil)
+    state = waitForWorkflow(t, engine, id)
+    assert.Equal(t, StatusFailed, state.Status)
+    assert.Equal(t, "step 'failing' failed: broken (error code 500)", state.Error)
+    assert.Equal(t, StatusFailed, state.Steps["failing"].Status)
+    assert.Equal(t, 2, state.Steps["failing"].Attempts)
+    assert.Equal(t, StatusPending, state.Steps["next"].Status)
+    assert.Equal(t, 2, failingCalls)
+
+    types := events.waitFor(WorkflowFailedEvt)
+    assert.Contains(t, types, StepRetryingEvt)
+    assert.Contains(t, types, StepFailedEvt)
+}
+
+func TestEngine_Resume(t *testing.T) {
+    dir, _ := ioutil.TempDir("", "workflow-test")
+    defer os.RemoveAll(dir)
+
+    definition := &Definition{
+        Name: "provision",
+        Steps: []*Step{
+            {Name: "network", Channel: "network-service"},
+            {Name: "vm", Channel: "vm-service", DependsOn: []string{"network"}},
+        },
+    }
+    itemType := reflect.TypeOf(&State{})
+
+    // a workflow interrupted while the vm step was running
+    persistence, _ := bus.NewFileStorePersistence(dir, 0)
+    store := bus.NewEventBusInstance().GetStoreManager().CreateStoreWithType(
+        DefaultStoreName, itemType, bus.WithStorePersistence(persistence))
+    store.Put("wf-1", &State{
+        Id:       "wf-1",
+        Workflow: "provision",
+        Status:   StatusRunning,
+        Steps: map[string]*StepState{
+            "network": {Status: StatusCompleted, Attempts: 1, Response: "net-1"},
+            "vm":      {Status: StatusRunning, Attempts: 1},
+        },
+    }, StatusRunning)
+    store.Put("wf-2", &State{Id: "wf-2", Workflow: "unknown", Status: StatusRunning}, StatusRunning)
+    store.Put("wf-3", &State{Id: "wf-3", Workflow: "provision", Status: StatusCompleted}, StatusCompleted)
+    persistence.Close()
+
+    // restart
+    eventBus := bus.NewEventBusInstance()
+    persistence, _ = bus.NewFileStorePersistence(dir, 0)
+    defer persistence.Close()
+    store = eventBus.GetStoreManager().CreateStoreWithType(
+        DefaultStoreName, itemType, bus.WithStorePersistence(persistence))
+    engine := NewEngine(eventBus, WithStore(store))
+    events := recordEvents(eventBus, DefaultProgressChannel)
+
+    respondToRequests(eventBus, "network-service", func(payload interface{}) (interface{}, error) {
+        assert.Fail(t, "completed steps should not be sent again")
+        return nil, nil
+    })
+    respondToRequests(eventBus, "vm-service", func(payload interface{}) (interface{}, error) {
+        return "vm-1", nil
+    })
+    engine.Register(definition)
+
+    assert.EqualError(t, engine.Resume(), "cannot resume workflows [wf-2], their definitions are not registered")
+
+    state := waitForWorkflow(t, engine, "wf-1")
+    assert.Equal(t, StatusCompleted, state.Status)
+    assert.Equal(t, "net-1", state.Response("network"))
+    assert.Equal(t, "vm-1", state.Response("vm"))
+    assert.Equal(t, 1, state.Steps["vm"].Attempts)
+    assert.Equal(t, WorkflowResumedEvt, events.waitFor(WorkflowCompletedEvt)[0])
+
+    state, ok := engine.GetState("wf-3")
+    assert.True(t, ok)
+    assert.Equal(t, StatusCompleted, state.Status)
+    _, ok = engine.GetState("wf-4")
+    assert.False(t, ok)
+}
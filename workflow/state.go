@@ -0,0 +1,67 @@
+// Copyright 2019-2020 VMware, Inc.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package workflow
+
+import (
+    "time"
+)
+
+// Status of a workflow or a workflow step.
+type Status string
+
+const (
+    StatusPending   Status = "pending"
+    StatusRunning   Status = "running"
+    StatusCompleted Status = "completed"
+    StatusSkipped   Status = "skipped"
+    StatusFailed    Status = "failed"
+)
+
+// State of a single workflow step.
+type StepState struct {
+    Status   Status
+    // Number of attempts made so far.
+    Attempts int
+    // Payload of the response, set when the step is completed.
+    Response interface{} `json:",omitempty"`
+    // Error of the last failed attempt.
+    Error    string      `json:",omitempty"`
+}
+
+// State of a workflow instance, persisted in the workflow store after every change.
+// Responses and inputs are plain values when the state is restored from the persistence,
+// use model.ConvertValueToType to decode them to their original types.
+type State struct {
+    Id       string
+    Workflow string
+    Status   Status
+    Input    interface{}           `json:",omitempty"`
+    Steps    map[string]*StepState
+    Error    string                `json:",omitempty"`
+    Created  time.Time
+    Updated  time.Time
+}
+
+// Returns the response of a completed step, or nil if the step was not completed.
+func (s *State) Response(stepName string) interface{} {
+    if step, ok := s.Steps[stepName]; ok && step.Status == StatusCompleted {
+        return step.Response
+    }
+    return nil
+}
+
+// Returns true if the workflow is completed or failed.
+func (s *State) IsDone() bool {
+    return s.Status == StatusCompleted || s.Status == StatusFailed
+}
+
+func (s *State) copy() *State {
+    c := *s
+    c.Steps = make(map[string]*StepState, len(s.Steps))
+    for name, step := range s.Steps {
+        stepCopy := *step
+        c.Steps[name] = &stepCopy
+    }
+    return &c
+}